@@ -1,12 +1,131 @@
 package lookout
 
 import (
+	"context"
+	"strconv"
+
 	"google.golang.org/grpc"
 	"gopkg.in/src-d/lookout-sdk.v0/pb"
 )
 
 type EventResponse = pb.EventResponse
-type Comment = pb.Comment
+
+// Comment is a comment of an analyzer. File, Line, Text and Confidence are
+// the ones of the pb.Comment returned by the analyzers, see NewComment. The
+// rest of the fields are not in the analyzer protocol of the SDK yet, so the
+// analyzers can't set them; they are kept out of pb.Comment until the SDK
+// carries them.
+type Comment struct {
+	// File this comment belongs to. If empty, it is a global comment.
+	File string `json:"file,omitempty"`
+	// Line this comment refers to. If 0 (and file is set), it is a
+	// file-level comment. Line is expressed as a 1-based index.
+	Line int32 `json:"line,omitempty"`
+	// Text of the comment.
+	Text string `json:"text,omitempty"`
+	// Confidence in the comment. It should be an integer between 0 and 100.
+	Confidence uint32 `json:"confidence,omitempty"`
+	// RuleID is the identifier of the rule or category that produced the
+	// comment, e.g. "SEC001". It can be empty.
+	RuleID string `json:"rule_id,omitempty"`
+	// Severity of the comment. If UnspecifiedSeverity, the comment is
+	// handled as before severities were introduced.
+	Severity Severity `json:"severity,omitempty"`
+	// DetailURL is a link to the details of the comment, e.g. the
+	// documentation of the rule. It can be empty.
+	DetailURL string `json:"detail_url,omitempty"`
+	// Items are the actionable sub-items of the comment, e.g. the things to
+	// fix. It can be empty.
+	Items []string `json:"items,omitempty"`
+	// Language is the language of the code snippets in Text, used to add a
+	// language hint to the fenced code blocks without one.
+	Language string `json:"language,omitempty"`
+	// IssueRef is the number of an issue of the repository tracking the
+	// finding. If 0, the comment references no issue.
+	IssueRef int64 `json:"issue_ref,omitempty"`
+	// AnchorPosition is where the comment is anchored when Line is the first
+	// line of a block of added lines: AnchorStart or empty anchors it at
+	// Line, AnchorEnd at the last added line of the block.
+	AnchorPosition string `json:"anchor_position,omitempty"`
+	// TargetDescription marks a comment on the description of the pull
+	// request itself instead of on its code. File and Line are ignored.
+	TargetDescription bool `json:"target_description,omitempty"`
+}
+
+// NewComment returns the Comment of a pb.Comment returned by an analyzer
+func NewComment(c *pb.Comment) *Comment {
+	return &Comment{
+		File:       c.File,
+		Line:       c.Line,
+		Text:       c.Text,
+		Confidence: c.Confidence,
+	}
+}
+
+// NewComments returns the Comments of the pb.Comments returned by an
+// analyzer
+func NewComments(cs []*pb.Comment) []*Comment {
+	if cs == nil {
+		return nil
+	}
+
+	result := make([]*Comment, len(cs))
+	for i, c := range cs {
+		result[i] = NewComment(c)
+	}
+
+	return result
+}
+
+// Severity is the severity of a Comment
+type Severity int32
+
+const (
+	// UnspecifiedSeverity is the severity of the comments that don't set one
+	UnspecifiedSeverity Severity = iota
+	// InfoSeverity is the severity of informative comments
+	InfoSeverity
+	// WarningSeverity is the severity of comments about possible issues
+	WarningSeverity
+	// ErrorSeverity is the severity of comments about issues that must be
+	// fixed, they make the analysis status fail
+	ErrorSeverity
+)
+
+var severityNames = map[Severity]string{
+	UnspecifiedSeverity: "UNSPECIFIED",
+	InfoSeverity:        "INFO",
+	WarningSeverity:     "WARNING",
+	ErrorSeverity:       "ERROR",
+}
+
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+
+	return strconv.Itoa(int(s))
+}
+
+// SeverityByName returns the severity with the given name, e.g. "ERROR". ok
+// is false if there is none.
+func SeverityByName(name string) (s Severity, ok bool) {
+	for s, n := range severityNames {
+		if n == name {
+			return s, true
+		}
+	}
+
+	return UnspecifiedSeverity, false
+}
+
+const (
+	// AnchorStart anchors the comments at their Line, the default
+	AnchorStart = "start"
+	// AnchorEnd anchors the comments at the last added line of the block
+	// starting at their Line
+	AnchorEnd = "end"
+)
 
 type AnalyzerClient = pb.AnalyzerClient
 type AnalyzerServer = pb.AnalyzerServer
@@ -21,7 +140,12 @@ func NewAnalyzerClient(conn *grpc.ClientConn) AnalyzerClient {
 
 // AnalyzerConfig is a configuration of analyzer
 type AnalyzerConfig struct {
+	// Name is the identifier of the analyzer, used in the configuration and
+	// to find the comments already posted
 	Name string
+	// DisplayName is the name of the analyzer shown to the users. If empty,
+	// Name is shown
+	DisplayName string `yaml:"display_name"`
 	// Addr is gRPC URL.
 	// can be defined only in global config, repository-scoped configuration is ignored
 	Addr string
@@ -29,10 +153,39 @@ type AnalyzerConfig struct {
 	Disabled bool
 	// Feedback is a url to be linked after each comment
 	Feedback string
+	// FeedbackLinks are more urls to be linked after each comment, keyed by
+	// their label, e.g. "Report a false positive"
+	FeedbackLinks map[string]string `yaml:"feedback_links"`
+	// Priority orders the comments of the analyzers on the same line when
+	// they are merged, higher first
+	Priority int
+	// PathPrefix is prepended to the files of the comments, for analyzers
+	// reporting paths relative to a subdirectory of the repository, e.g.
+	// "services/foo" in a monorepo
+	PathPrefix string `yaml:"path_prefix"`
+	// RuleDocs is the documentation of the rules of the analyzer, in
+	// Markdown, keyed by their RuleID. It's added to the comments of each
+	// rule in a collapsed block
+	RuleDocs map[string]string `yaml:"rule_docs"`
+	// Languages handled by the analyzer, e.g. "Go". It's not called for the
+	// events of repositories with none of them. If empty, it's called for all
+	// the repositories.
+	// can be defined only in global config, repository-scoped configuration is ignored
+	Languages []string
 	// Settings any configuration for an analyzer
 	Settings map[string]interface{}
 }
 
+// ShownName returns the name of the analyzer to show to the users, its
+// DisplayName if it has one or its Name otherwise
+func (c AnalyzerConfig) ShownName() string {
+	if c.DisplayName != "" {
+		return c.DisplayName
+	}
+
+	return c.Name
+}
+
 // Analyzer is a struct of analyzer client and config
 type Analyzer struct {
 	Client AnalyzerClient
@@ -44,4 +197,23 @@ type Analyzer struct {
 type AnalyzerComments struct {
 	Config   AnalyzerConfig
 	Comments []*Comment
+	// Error is the reason the analysis failed, Comments is empty then. It is
+	// empty if the analysis succeeded.
+	Error string
+}
+
+// OrgConfigGetter is used to retrieve the default configuration of the
+// organization that owns the repository of an event.
+type OrgConfigGetter interface {
+	// OrgConfig returns the contents of the organization-wide .lookout.yml,
+	// or nil if the organization doesn't have one.
+	OrgConfig(context.Context, Event) ([]byte, error)
+}
+
+// LanguageGetter is used to retrieve the languages of the repository of an
+// event, to skip the analyzers that don't handle any of them.
+type LanguageGetter interface {
+	// Languages returns the languages of the repository, or nil if they are
+	// unknown.
+	Languages(context.Context, Event) ([]string, error)
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/src-d/lookout/server"
+	"github.com/src-d/lookout/store"
+
+	log "gopkg.in/src-d/go-log.v1"
+)
+
+func init() {
+	if _, err := app.AddCommand("redrive", "posts again the failed posts of the dead letter directory", "",
+		&RedriveCommand{}); err != nil {
+		panic(err)
+	}
+}
+
+// RedriveCommand posts again the comments that couldn't be posted, written
+// to the dead_letter_dir by the serve command
+type RedriveCommand struct {
+	ServeCommand
+}
+
+func (c *RedriveCommand) Execute(args []string) error {
+	conf, err := c.readConfig()
+	if err != nil {
+		return err
+	}
+
+	if conf.DeadLetterDir == "" {
+		return fmt.Errorf("missing dead_letter_dir in config")
+	}
+
+	// the background work of the provider stops once redriving is done
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := c.initProvider(ctx, conf); err != nil {
+		return err
+	}
+
+	if c.installations != nil {
+		if err := c.installations.Sync(ctx); err != nil {
+			return fmt.Errorf("can't sync installations with github: %s", err)
+		}
+	}
+
+	poster, err := c.initPoster(conf)
+	if err != nil {
+		return err
+	}
+
+	n, err := server.Redrive(ctx,
+		store.NewFSDeadLetterStore(conf.DeadLetterDir), poster)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("%d dead letters posted", n)
+	return nil
+}
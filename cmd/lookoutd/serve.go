@@ -6,12 +6,17 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/src-d/lookout"
 	"github.com/src-d/lookout/provider/github"
+	"github.com/src-d/lookout/provider/gitlab"
 	"github.com/src-d/lookout/provider/json"
+	"github.com/src-d/lookout/queue"
 	"github.com/src-d/lookout/server"
 	"github.com/src-d/lookout/service/bblfsh"
 	"github.com/src-d/lookout/service/enry"
@@ -27,6 +32,7 @@ import (
 	"github.com/gregjones/httpcache/diskcache"
 	"github.com/jinzhu/copier"
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sanity-io/litter"
 	"google.golang.org/grpc"
 	"gopkg.in/src-d/go-billy.v4/osfs"
@@ -47,45 +53,102 @@ type ServeCommand struct {
 	ConfigFile  string `long:"config" short:"c" default:"config.yml" env:"LOOKOUT_CONFIG_FILE" description:"path to configuration file"`
 	GithubUser  string `long:"github-user" env:"GITHUB_USER" description:"user for the GitHub API"`
 	GithubToken string `long:"github-token" env:"GITHUB_TOKEN" description:"access token for the GitHub API"`
+	GitlabToken string `long:"gitlab-token" env:"GITLAB_TOKEN" description:"access token for the GitLab API"`
 	DataServer  string `long:"data-server" default:"ipv4://localhost:10301" env:"LOOKOUT_DATA_SERVER" description:"gRPC URL to bind the data server to"`
 	Bblfshd     string `long:"bblfshd" default:"ipv4://localhost:9432" env:"LOOKOUT_BBLFSHD" description:"gRPC URL of the Bblfshd server"`
 	DryRun      bool   `long:"dry-run" env:"LOOKOUT_DRY_RUN" description:"analyze repositories and log the result without posting code reviews to GitHub"`
 	Library     string `long:"library" default:"/tmp/lookout" env:"LOOKOUT_LIBRARY" description:"path to the lookout library"`
-	Provider    string `long:"provider" default:"github" env:"LOOKOUT_PROVIDER" description:"provider name: github, json"`
+	Provider    string `long:"provider" default:"github" env:"LOOKOUT_PROVIDER" description:"provider name: github, gitlab, json"`
 	ProbesAddr  string `long:"probes-addr" default:"0.0.0.0:8090" env:"LOOKOUT_PROBES_ADDRESS" description:"TCP address to bind the health probe endpoints"`
 
 	analyzers      map[string]lookout.AnalyzerClient
 	pool           *github.ClientPool
+	gitlabPool     *gitlab.ClientPool
+	installations  *github.Installations
 	probeReadiness bool
 }
 
 var defaultInstallationsSyncInterval = 5 * time.Minute
 
+// how many times the events of the queue are processed, and the time to wait
+// before processing again the ones that failed, if not configured
+var (
+	defaultQueueMaxAttempts = 5
+	defaultQueueRetryDelay  = 10 * time.Second
+)
+
+// how often the tokens of the installations about to expire are refreshed,
+// if enabled
+var tokenRefreshInterval = time.Minute
+
 // Config holds the main configuration
 type Config struct {
 	server.Config `yaml:",inline"`
 	Providers     struct {
 		Github github.ProviderConfig
+		Gitlab gitlab.ProviderConfig
 	}
 	Repositories []RepoConfig
+	// DeadLetterDir is the directory where the failed attempts to post are
+	// written, to be re-driven with the redrive command. If empty, they are
+	// not written
+	DeadLetterDir string `yaml:"dead_letter_dir"`
+	// SARIFDir is the directory where the comments of each event are
+	// exported as a SARIF document. If empty, they are not exported
+	SARIFDir string `yaml:"sarif_dir"`
+	// SARIFOnly only exports the comments to SARIFDir, without posting them
+	// to the provider
+	SARIFOnly bool `yaml:"sarif_only"`
+	// QueueDir is the directory where the events are kept until they are
+	// processed, so they are processed after a restart. If empty, the events
+	// are processed as soon as they are watched
+	QueueDir string `yaml:"queue_dir"`
+	// QueueMaxAttempts is the max number of times each event of QueueDir is
+	// processed, once reached an event that fails is dropped. If 0,
+	// defaultQueueMaxAttempts is used
+	QueueMaxAttempts int `yaml:"queue_max_attempts"`
+	// QueueRetryDelay is the time to wait, e.g. "10s", before processing
+	// again an event of QueueDir that failed, doubled for each following
+	// attempt. If empty, defaultQueueRetryDelay is used
+	QueueRetryDelay string `yaml:"queue_retry_delay"`
+	// DeferredPostsDir is the directory where the posts deferred by the
+	// provider are kept until they are done, so they are posted after a
+	// restart. If empty, they are kept in memory
+	DeferredPostsDir string `yaml:"deferred_posts_dir"`
 }
 
-// RepoConfig holds configuration for repository, support only github provider
+// RepoConfig holds configuration for repository, Client for the github
+// provider and Gitlab for the gitlab provider
 type RepoConfig struct {
 	URL    string
 	Client github.ClientConfig
+	Gitlab gitlab.ClientConfig
 }
 
 func (c *ServeCommand) Execute(args []string) error {
+	// the server is stopped on SIGINT or SIGTERM, stopping the background
+	// work on the way out
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Infof("received %s, stopping", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
 	c.initHealthProbes()
 
-	var conf Config
-	configData, err := ioutil.ReadFile(c.ConfigFile)
+	conf, err := c.readConfig()
 	if err != nil {
-		return fmt.Errorf("Can't open configuration file: %s", err)
-	}
-	if err := yaml.Unmarshal([]byte(configData), &conf); err != nil {
-		return fmt.Errorf("Can't parse configuration file: %s", err)
+		return err
 	}
 
 	c.logConfig(conf)
@@ -122,7 +185,7 @@ func (c *ServeCommand) Execute(args []string) error {
 		if aConf.Disabled {
 			continue
 		}
-		client, err := c.startAnalyzer(aConf)
+		client, err := c.startAnalyzer(aConf, dataHandler.ChangeGetter)
 		if err != nil {
 			return err
 		}
@@ -132,25 +195,111 @@ func (c *ServeCommand) Execute(args []string) error {
 		}
 	}
 
-	err = c.initProvider(conf)
+	err = c.initProvider(ctx, conf)
 	if err != nil {
 		return err
 	}
 
+	if c.installations != nil {
+		defer c.installations.StopTokenRefresh()
+	}
+
 	poster, err := c.initPoster(conf)
 	if err != nil {
 		return err
 	}
 
+	if p, ok := poster.(*github.Poster); ok {
+		p.SetFileGetter(dataHandler.FileGetter)
+		p.SetCommentStates(store.NewDBCommentStateOperator(db))
+		if conf.Providers.Github.SyncOnMissingRepo && c.installations != nil {
+			p.SetSyncer(c.installations)
+		}
+	}
+
+	if conf.SARIFDir != "" {
+		sarifPoster := &server.SARIFPoster{
+			Poster: poster,
+			Sink:   server.NewFSSARIFSink(conf.SARIFDir),
+		}
+		if conf.SARIFOnly {
+			sarifPoster.Poster = nil
+		}
+
+		poster = sarifPoster
+	}
+
+	if conf.DeadLetterDir != "" {
+		deadLetterPoster := &server.DeadLetterPoster{
+			Poster: poster,
+			Store:  store.NewFSDeadLetterStore(conf.DeadLetterDir),
+		}
+		switch c.Provider {
+		case github.Provider:
+			deadLetterPoster.IsPermanent = github.IsPermanentError
+		case gitlab.Provider:
+			deadLetterPoster.IsPermanent = gitlab.IsPermanentError
+		}
+
+		poster = deadLetterPoster
+	}
+
 	watcher, err := c.initWatcher(conf)
 	if err != nil {
 		return err
 	}
 
+	if conf.QueueDir != "" {
+		q, err := queue.NewFSQueue(conf.QueueDir, 0)
+		if err != nil {
+			return fmt.Errorf("Can't open the event queue: %s", err)
+		}
+
+		retry, err := queueRetryPolicy(conf)
+		if err != nil {
+			return err
+		}
+
+		watcher = &queue.Watcher{Watcher: watcher, Queue: q, Retry: retry}
+	}
+
 	c.probeReadiness = true
 
-	ctx := context.Background()
-	return server.NewServer(watcher, poster, dataHandler.FileGetter, analyzers, eventOp, commentsOp).Run(ctx)
+	srv := server.NewServer(watcher, poster, dataHandler.FileGetter, analyzers, eventOp, commentsOp)
+	// with a queue, the events that fail are redelivered instead of being
+	// marked as failed
+	srv.SetRedeliverFailed(conf.QueueDir != "")
+	if c.Provider == github.Provider && conf.Providers.Github.OrgConfig {
+		srv.SetOrgConfigGetter(github.NewOrgConfigGetter(c.pool))
+	}
+
+	if c.Provider == github.Provider {
+		srv.SetLanguageGetter(github.NewLanguageGetter(c.pool))
+	}
+
+	if conf.DeferredPostsDir != "" {
+		srv.SetDeferredPostStore(store.NewFSDeferredPostStore(conf.DeferredPostsDir))
+	}
+
+	err = srv.Run(ctx)
+	if err == context.Canceled {
+		return nil
+	}
+
+	return err
+}
+
+func (c *ServeCommand) readConfig() (Config, error) {
+	var conf Config
+	configData, err := ioutil.ReadFile(c.ConfigFile)
+	if err != nil {
+		return conf, fmt.Errorf("Can't open configuration file: %s", err)
+	}
+	if err := yaml.Unmarshal([]byte(configData), &conf); err != nil {
+		return conf, fmt.Errorf("Can't parse configuration file: %s", err)
+	}
+
+	return conf, nil
 }
 
 func (c *ServeCommand) logConfig(conf Config) {
@@ -159,6 +308,7 @@ func (c *ServeCommand) logConfig(conf Config) {
 
 	cCp.DBOptions.DB = "****"
 	cCp.GithubToken = "****"
+	cCp.GitlabToken = "****"
 
 	var confCp Config
 	copier.Copy(&confCp, conf)
@@ -170,6 +320,9 @@ func (c *ServeCommand) logConfig(conf Config) {
 		if repoConfigCp.Client.Token != "" {
 			repoConfigCp.Client.Token = "****"
 		}
+		if repoConfigCp.Gitlab.Token != "" {
+			repoConfigCp.Gitlab.Token = "****"
+		}
 		confCp.Repositories[i] = repoConfigCp
 	}
 
@@ -185,16 +338,54 @@ func (c *ServeCommand) logConfig(conf Config) {
 	}).Infof("starting %s", name)
 }
 
-func (c *ServeCommand) initProvider(conf Config) error {
+// initProvider initializes the clients of the provider. The background work
+// of the provider, e.g. syncing the installations, stops once ctx is done.
+func (c *ServeCommand) initProvider(ctx context.Context, conf Config) error {
 	switch c.Provider {
 	case github.Provider:
 		if conf.Providers.Github.PrivateKey != "" || conf.Providers.Github.AppID != 0 {
-			return c.initProviderGithubApp(conf)
+			return c.initProviderGithubApp(ctx, conf)
 		}
 
 		return c.initProviderGithubToken(conf)
+	case gitlab.Provider:
+		return c.initProviderGitlab(conf)
+	}
+
+	return nil
+}
+
+func (c *ServeCommand) initProviderGitlab(conf Config) error {
+	repoToConfig := make(map[string]gitlab.ClientConfig, len(conf.Repositories))
+	for _, repo := range conf.Repositories {
+		config := repo.Gitlab
+		if config.Token == "" {
+			config.Token = c.GitlabToken
+		}
+
+		if config.URL == "" {
+			// the GitLab instance is the one hosting the repository
+			u, err := url.Parse(repo.URL)
+			if err != nil {
+				return fmt.Errorf("bad repository URL %s: %s", repo.URL, err)
+			}
+
+			config.URL = fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+		}
+
+		if config.Token == "" {
+			log.Warningf("missing authentication for repository %s, and no default provided", repo.URL)
+		}
+
+		repoToConfig[repo.URL] = config
+	}
+
+	pool, err := gitlab.NewClientPool(repoToConfig)
+	if err != nil {
+		return err
 	}
 
+	c.gitlabPool = pool
 	return nil
 }
 
@@ -234,7 +425,7 @@ func (c *ServeCommand) initProviderGithubToken(conf Config) error {
 	return nil
 }
 
-func (c *ServeCommand) initProviderGithubApp(conf Config) error {
+func (c *ServeCommand) initProviderGithubApp(ctx context.Context, conf Config) error {
 	if conf.Providers.Github.PrivateKey == "" {
 		return fmt.Errorf("missing GitHub App private key filepath in config")
 	}
@@ -251,19 +442,41 @@ func (c *ServeCommand) initProviderGithubApp(conf Config) error {
 	}
 
 	cache := cache.NewValidableCache(diskcache.New("/tmp/github"))
-	insts, err := github.NewInstallations(conf.Providers.Github.AppID, conf.Providers.Github.PrivateKey, cache)
+	insts, err := github.NewInstallations(ctx, conf.Providers.Github.AppID, conf.Providers.Github.PrivateKey, cache,
+		github.InstallationsConfig{
+			WatchMinInterval: conf.Providers.Github.WatchMinInterval,
+			SyncConcurrency:  conf.Providers.Github.InstallationSyncConcurrency,
+			PerPage:          conf.Providers.Github.PerPage,
+			UserTokens:       conf.Providers.Github.InstallationUserTokens,
+			SyncRetries:      conf.Providers.Github.InstallationSyncRetries,
+			SyncRetryDelay:   conf.Providers.Github.InstallationSyncRetryDelay,
+			RefreshTokens:    conf.Providers.Github.InstallationTokenRefresh,
+		})
 	if err != nil {
 		return err
 	}
 
 	c.pool = insts.Pool
+	c.installations = insts
+
+	if conf.Providers.Github.InstallationTokenRefresh {
+		insts.StartTokenRefresh(tokenRefreshInterval)
+	}
 
 	go func() {
 		for {
-			if err := insts.Sync(); err != nil {
+			// a sync taking longer than the interval is cancelled
+			syncCtx, cancel := context.WithTimeout(ctx, installationsSyncInterval)
+			if err := insts.Sync(syncCtx); err != nil && ctx.Err() == nil {
 				log.Errorf(err, "can't sync installations with github")
 			}
-			time.Sleep(installationsSyncInterval)
+			cancel()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(installationsSyncInterval):
+			}
 		}
 	}()
 
@@ -277,7 +490,14 @@ func (c *ServeCommand) initPoster(conf Config) (lookout.Poster, error) {
 
 	switch c.Provider {
 	case github.Provider:
-		return github.NewPoster(c.pool, conf.Providers.Github), nil
+		p, err := github.NewPoster(c.pool, conf.Providers.Github)
+		if err != nil {
+			return nil, err
+		}
+
+		return p, nil
+	case gitlab.Provider:
+		return gitlab.NewPoster(c.gitlabPool, conf.Providers.Gitlab), nil
 	case json.Provider:
 		return json.NewPoster(os.Stdout), nil
 	default:
@@ -288,12 +508,14 @@ func (c *ServeCommand) initPoster(conf Config) (lookout.Poster, error) {
 func (c *ServeCommand) initWatcher(conf Config) (lookout.Watcher, error) {
 	switch c.Provider {
 	case github.Provider:
-		watcher, err := github.NewWatcher(c.pool)
+		watcher, err := github.NewWatcher(c.pool, conf.Providers.Github)
 		if err != nil {
 			return nil, err
 		}
 
 		return watcher, nil
+	case gitlab.Provider:
+		return gitlab.NewWatcher(c.gitlabPool, conf.Providers.Gitlab)
 	case json.Provider:
 		return json.NewWatcher(os.Stdin)
 	default:
@@ -301,7 +523,43 @@ func (c *ServeCommand) initWatcher(conf Config) (lookout.Watcher, error) {
 	}
 }
 
-func (c *ServeCommand) startAnalyzer(conf lookout.AnalyzerConfig) (lookout.AnalyzerClient, error) {
+// queueRetryPolicy returns the retry policy of the events of the queue
+func queueRetryPolicy(conf Config) (queue.RetryPolicy, error) {
+	retry := queue.RetryPolicy{
+		MaxAttempts: defaultQueueMaxAttempts,
+		Delay:       defaultQueueRetryDelay,
+	}
+
+	if conf.QueueMaxAttempts < 0 {
+		return retry, fmt.Errorf("queue max attempts can't be negative: %d", conf.QueueMaxAttempts)
+	}
+	if conf.QueueMaxAttempts > 0 {
+		retry.MaxAttempts = conf.QueueMaxAttempts
+	}
+
+	if conf.QueueRetryDelay != "" {
+		d, err := time.ParseDuration(conf.QueueRetryDelay)
+		if err != nil {
+			return retry, fmt.Errorf("can't parse queue retry delay: %s", err)
+		}
+		if d < 0 {
+			return retry, fmt.Errorf("queue retry delay can't be negative: %s", conf.QueueRetryDelay)
+		}
+
+		retry.Delay = d
+	}
+
+	return retry, nil
+}
+
+func (c *ServeCommand) startAnalyzer(
+	conf lookout.AnalyzerConfig,
+	changes lookout.ChangeGetter,
+) (lookout.AnalyzerClient, error) {
+	if lookout.IsHTTPAnalyzerAddr(conf.Addr) {
+		return lookout.NewHTTPAnalyzerClient(conf.Addr, changes), nil
+	}
+
 	addr, err := grpchelper.ToGoGrpcAddress(conf.Addr)
 	if err != nil {
 		return nil, err
@@ -426,10 +684,13 @@ func (c *ServeCommand) initHealthProbes() {
 		}
 	})
 
+	metricsPath := "/metrics"
+	http.Handle(metricsPath, promhttp.Handler())
+
 	go func() {
 		log.With(log.Fields{
 			"addr":  c.ProbesAddr,
-			"paths": []string{livenessPath, readinessPath},
+			"paths": []string{livenessPath, readinessPath, metricsPath},
 		}).Debugf("listening health probe HTTP requests")
 
 		err := http.ListenAndServe(c.ProbesAddr, nil)
@@ -9,6 +9,7 @@ import (
 	"github.com/src-d/lookout"
 
 	"gopkg.in/src-d/go-git.v4/utils/binary"
+	"gopkg.in/src-d/lookout-sdk.v0/pb"
 )
 
 type Analyzer struct {
@@ -87,7 +88,7 @@ func (a *Analyzer) NotifyPushEvent(ctx context.Context, e *lookout.PushEvent) (*
 	return resp, nil
 }
 
-func (a *Analyzer) lineIncrease(ch *lookout.Change) []*lookout.Comment {
+func (a *Analyzer) lineIncrease(ch *lookout.Change) []*pb.Comment {
 	if a.isBinary(ch.Head) || a.isBinary(ch.Base) {
 		return nil
 	}
@@ -97,7 +98,7 @@ func (a *Analyzer) lineIncrease(ch *lookout.Change) []*lookout.Comment {
 		return nil
 	}
 
-	return []*lookout.Comment{{
+	return []*pb.Comment{{
 		File: ch.Head.Path,
 		Line: 0,
 		Text: fmt.Sprintf("The file has increased in %d lines.", diff),
@@ -106,16 +107,16 @@ func (a *Analyzer) lineIncrease(ch *lookout.Change) []*lookout.Comment {
 
 const maxLineLength = 120
 
-func (a *Analyzer) maxLineLen(file *lookout.File) []*lookout.Comment {
+func (a *Analyzer) maxLineLen(file *lookout.File) []*pb.Comment {
 	if file == nil || a.isBinary(file) {
 		return nil
 	}
 
 	lines := strings.Split(string(file.Content), "\n")
-	var comments []*lookout.Comment
+	var comments []*pb.Comment
 	for i, line := range lines {
 		if len(line) > maxLineLength {
-			comments = append(comments, &lookout.Comment{
+			comments = append(comments, &pb.Comment{
 				File: file.Path,
 				Line: int32(i + 1),
 				Text: fmt.Sprintf("This line exceeded %d chars.", maxLineLength),
@@ -126,7 +127,7 @@ func (a *Analyzer) maxLineLen(file *lookout.File) []*lookout.Comment {
 	return comments
 }
 
-func (a *Analyzer) hasUAST(file *lookout.File) []*lookout.Comment {
+func (a *Analyzer) hasUAST(file *lookout.File) []*pb.Comment {
 	if file == nil {
 		return nil
 	}
@@ -138,19 +139,19 @@ func (a *Analyzer) hasUAST(file *lookout.File) []*lookout.Comment {
 		text = "The file has UAST."
 	}
 
-	return []*lookout.Comment{{
+	return []*pb.Comment{{
 		File: file.Path,
 		Line: 0,
 		Text: text,
 	}}
 }
 
-func (a *Analyzer) language(file *lookout.File) []*lookout.Comment {
+func (a *Analyzer) language(file *lookout.File) []*pb.Comment {
 	if file == nil {
 		return nil
 	}
 
-	return []*lookout.Comment{{
+	return []*pb.Comment{{
 		File: file.Path,
 		Line: 0,
 		Text: fmt.Sprintf("The file has language detected: %q", file.Language),
@@ -0,0 +1,158 @@
+package lookout
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/src-d/lookout/util/grpchelper"
+
+	"github.com/gogo/protobuf/types"
+	"google.golang.org/grpc"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+// ErrHTTPAnalyzer is returned when the request to an HTTP analyzer fails
+var ErrHTTPAnalyzer = errors.NewKind("HTTP analyzer request failed")
+
+// HTTPAnalyzerRequest is the JSON document posted to the HTTP analyzers for
+// each event. Only one of ReviewEvent or PushEvent is set.
+type HTTPAnalyzerRequest struct {
+	ReviewEvent *ReviewEvent `json:"review_event,omitempty"`
+	PushEvent   *PushEvent   `json:"push_event,omitempty"`
+	// Configuration is the configuration of the analyzer for the repository
+	// of the event. The Configuration of the event is not set
+	Configuration map[string]interface{} `json:"configuration,omitempty"`
+	// Changes are the files changed by the event, with their contents and
+	// language. Vendored files are excluded
+	Changes []*Change `json:"changes"`
+}
+
+// HTTPAnalyzerResponse is the JSON document returned by the HTTP analyzers,
+// the same as the EventResponse of the gRPC analyzers.
+type HTTPAnalyzerResponse = EventResponse
+
+// HTTPAnalyzerClient is an AnalyzerClient for analyzers exposing an HTTP
+// endpoint instead of a gRPC service. The events are posted to the URL as an
+// HTTPAnalyzerRequest, along with their changes, since HTTP analyzers can't
+// call the data server, and the comments are read from the
+// HTTPAnalyzerResponse.
+type HTTPAnalyzerClient struct {
+	URL          string
+	Client       *http.Client
+	ChangeGetter ChangeGetter
+}
+
+var _ AnalyzerClient = &HTTPAnalyzerClient{}
+
+// NewHTTPAnalyzerClient creates a new HTTPAnalyzerClient posting the events
+// to the given URL, with their changes from the ChangeGetter.
+func NewHTTPAnalyzerClient(url string, cg ChangeGetter) *HTTPAnalyzerClient {
+	return &HTTPAnalyzerClient{
+		URL:          url,
+		Client:       http.DefaultClient,
+		ChangeGetter: cg,
+	}
+}
+
+// IsHTTPAnalyzerAddr returns true if the address of an analyzer is an HTTP
+// URL, so it's called with an HTTPAnalyzerClient instead of gRPC.
+func IsHTTPAnalyzerAddr(addr string) bool {
+	return strings.HasPrefix(addr, "http://") || strings.HasPrefix(addr, "https://")
+}
+
+// NotifyReviewEvent implements the AnalyzerClient interface. The call options
+// are ignored.
+func (c *HTTPAnalyzerClient) NotifyReviewEvent(
+	ctx context.Context, in *ReviewEvent, opts ...grpc.CallOption) (*EventResponse, error) {
+	changes, err := c.changes(ctx, &in.CommitRevision)
+	if err != nil {
+		return nil, err
+	}
+
+	e := *in
+	e.Configuration = types.Struct{}
+
+	return c.post(ctx, &HTTPAnalyzerRequest{
+		ReviewEvent:   &e,
+		Configuration: grpchelper.FromPBStruct(&in.Configuration),
+		Changes:       changes,
+	})
+}
+
+// NotifyPushEvent implements the AnalyzerClient interface. The call options
+// are ignored.
+func (c *HTTPAnalyzerClient) NotifyPushEvent(
+	ctx context.Context, in *PushEvent, opts ...grpc.CallOption) (*EventResponse, error) {
+	changes, err := c.changes(ctx, &in.CommitRevision)
+	if err != nil {
+		return nil, err
+	}
+
+	e := *in
+	e.Configuration = types.Struct{}
+
+	return c.post(ctx, &HTTPAnalyzerRequest{
+		PushEvent:     &e,
+		Configuration: grpchelper.FromPBStruct(&in.Configuration),
+		Changes:       changes,
+	})
+}
+
+func (c *HTTPAnalyzerClient) changes(ctx context.Context, rev *CommitRevision) ([]*Change, error) {
+	scanner, err := c.ChangeGetter.GetChanges(ctx, &ChangesRequest{
+		Base:            &rev.Base,
+		Head:            &rev.Head,
+		ExcludeVendored: true,
+		WantContents:    true,
+		WantLanguage:    true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer scanner.Close()
+
+	var changes []*Change
+	for scanner.Next() {
+		changes = append(changes, scanner.Change())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+func (c *HTTPAnalyzerClient) post(ctx context.Context, r *HTTPAnalyzerRequest) (*EventResponse, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, ErrHTTPAnalyzer.Wrap(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(b))
+	if err != nil {
+		return nil, ErrHTTPAnalyzer.Wrap(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, ErrHTTPAnalyzer.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, ErrHTTPAnalyzer.Wrap(fmt.Errorf("bad HTTP status: %d", resp.StatusCode))
+	}
+
+	var result HTTPAnalyzerResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, ErrHTTPAnalyzer.Wrap(err)
+	}
+
+	return &result, nil
+}
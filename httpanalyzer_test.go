@@ -0,0 +1,131 @@
+package lookout
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/src-d/lookout/util/grpchelper"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/lookout-sdk.v0/pb"
+)
+
+var httpAnalyzerRevision = CommitRevision{
+	Base: ReferencePointer{InternalRepositoryURL: "repo", Hash: "base"},
+	Head: ReferencePointer{InternalRepositoryURL: "repo", Hash: "head"},
+}
+
+func httpAnalyzerChanges(t *testing.T) *MockService {
+	return &MockService{
+		T: t,
+		ExpectedCRequest: &ChangesRequest{
+			Base:            &httpAnalyzerRevision.Base,
+			Head:            &httpAnalyzerRevision.Head,
+			ExcludeVendored: true,
+			WantContents:    true,
+			WantLanguage:    true,
+		},
+		ChangeScanner: &SliceChangeScanner{Changes: []*Change{&Change{
+			Head: &File{Path: "main.go", Content: []byte("package main"), Language: "Go"},
+		}}},
+	}
+}
+
+func TestHTTPAnalyzerClientReviewEvent(t *testing.T) {
+	require := require.New(t)
+
+	var received HTTPAnalyzerRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(http.MethodPost, r.Method)
+		require.Equal("application/json", r.Header.Get("Content-Type"))
+		require.NoError(json.NewDecoder(r.Body).Decode(&received))
+
+		json.NewEncoder(w).Encode(&HTTPAnalyzerResponse{
+			AnalyzerVersion: "v1",
+			Comments: []*pb.Comment{&pb.Comment{
+				File: "main.go",
+				Line: 1,
+				Text: "Line comment",
+			}},
+		})
+	}))
+	defer server.Close()
+
+	c := NewHTTPAnalyzerClient(server.URL, httpAnalyzerChanges(t))
+	resp, err := c.NotifyReviewEvent(context.Background(), &ReviewEvent{
+		Provider:       "github",
+		Number:         42,
+		CommitRevision: httpAnalyzerRevision,
+		Configuration:  *grpchelper.ToPBStruct(map[string]interface{}{"threshold": 0.5}),
+	})
+	require.NoError(err)
+	require.Equal(&EventResponse{
+		AnalyzerVersion: "v1",
+		Comments: []*pb.Comment{&pb.Comment{
+			File: "main.go",
+			Line: 1,
+			Text: "Line comment",
+		}},
+	}, resp)
+
+	require.Nil(received.PushEvent)
+	require.NotNil(received.ReviewEvent)
+	require.Equal(uint32(42), received.ReviewEvent.Number)
+	require.Equal(httpAnalyzerRevision, received.ReviewEvent.CommitRevision)
+	require.Equal(map[string]interface{}{"threshold": 0.5}, received.Configuration)
+	require.Len(received.Changes, 1)
+	require.Equal("main.go", received.Changes[0].Head.Path)
+	require.Equal([]byte("package main"), received.Changes[0].Head.Content)
+	require.Equal("Go", received.Changes[0].Head.Language)
+}
+
+func TestHTTPAnalyzerClientPushEvent(t *testing.T) {
+	require := require.New(t)
+
+	var received HTTPAnalyzerRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(json.NewDecoder(r.Body).Decode(&received))
+		json.NewEncoder(w).Encode(&HTTPAnalyzerResponse{})
+	}))
+	defer server.Close()
+
+	c := NewHTTPAnalyzerClient(server.URL, httpAnalyzerChanges(t))
+	resp, err := c.NotifyPushEvent(context.Background(), &PushEvent{
+		Provider:       "github",
+		CommitRevision: httpAnalyzerRevision,
+	})
+	require.NoError(err)
+	require.Empty(resp.Comments)
+
+	require.Nil(received.ReviewEvent)
+	require.NotNil(received.PushEvent)
+	require.Equal(httpAnalyzerRevision, received.PushEvent.CommitRevision)
+	require.Len(received.Changes, 1)
+}
+
+func TestHTTPAnalyzerClientError(t *testing.T) {
+	require := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	c := NewHTTPAnalyzerClient(server.URL, httpAnalyzerChanges(t))
+	_, err := c.NotifyReviewEvent(context.Background(), &ReviewEvent{
+		CommitRevision: httpAnalyzerRevision,
+	})
+	require.True(ErrHTTPAnalyzer.Is(err))
+}
+
+func TestIsHTTPAnalyzerAddr(t *testing.T) {
+	require := require.New(t)
+
+	require.True(IsHTTPAnalyzerAddr("http://localhost:8080/analyze"))
+	require.True(IsHTTPAnalyzerAddr("https://analyzer.example.com"))
+	require.False(IsHTTPAnalyzerAddr("ipv4://localhost:9930"))
+	require.False(IsHTTPAnalyzerAddr("localhost:9930"))
+}
@@ -1,6 +1,11 @@
 package lookout
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
 
 // AnalysisStatus is the status reported to the provider to
 // inform that we are performing an analysis, or that it has finished
@@ -16,17 +21,30 @@ const (
 	PendingAnalysisStatus
 	// SuccessAnalysisStatus represents a success status
 	SuccessAnalysisStatus
+	// SkippedAnalysisStatus represents a neutral status, used when the
+	// analysis was intentionally not performed
+	SkippedAnalysisStatus
 )
 
 func (st AnalysisStatus) String() string {
-	names := [...]string{"unknown", "error", "failure", "pending", "success"}
-	if st < ErrorAnalysisStatus || st > SuccessAnalysisStatus {
+	names := [...]string{"unknown", "error", "failure", "pending", "success", "skipped"}
+	if st < ErrorAnalysisStatus || st > SkippedAnalysisStatus {
 		return names[0]
 	}
 
 	return names[st]
 }
 
+// PostDeferredError is returned by a Poster when the comments can't be posted
+// yet. The same comments should be posted again after Until.
+type PostDeferredError struct {
+	Until time.Time
+}
+
+func (e *PostDeferredError) Error() string {
+	return fmt.Sprintf("posting deferred until %s", e.Until)
+}
+
 // Poster can post comments about an event.
 type Poster interface {
 	// Post posts comments about an event.
@@ -35,3 +53,88 @@ type Poster interface {
 	// Status sends the current analysis status to the provider
 	Status(context.Context, Event, AnalysisStatus) error
 }
+
+type analysisStartKey struct{}
+
+// WithAnalysisStart returns a copy of ctx holding the time when the analysis
+// of an event started, so the Poster can report its duration in the final
+// Status.
+func WithAnalysisStart(ctx context.Context, start time.Time) context.Context {
+	return context.WithValue(ctx, analysisStartKey{}, start)
+}
+
+// AnalysisStart returns the time when the analysis of the event started, set
+// with WithAnalysisStart. ok is false if it's not set.
+func AnalysisStart(ctx context.Context) (start time.Time, ok bool) {
+	start, ok = ctx.Value(analysisStartKey{}).(time.Time)
+	return start, ok
+}
+
+// PostedParts holds the keys of the parts of a post already done, e.g. each
+// chunk of a review, chosen by the Poster. When posting fails midway, they can
+// be kept and given back to the Poster to post the same comments again, so it
+// skips the parts already posted.
+type PostedParts struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+// NewPostedParts returns a new PostedParts with the given keys.
+func NewPostedParts(keys []string) *PostedParts {
+	return &PostedParts{keys: keys}
+}
+
+// Add records the part with the given key as posted. It does nothing on a
+// nil PostedParts.
+func (p *PostedParts) Add(key string) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.keys = append(p.keys, key)
+}
+
+// Has returns true if the part with the given key was posted. It's false on
+// a nil PostedParts.
+func (p *PostedParts) Has(key string) bool {
+	if p == nil {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, k := range p.keys {
+		if k == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Keys returns the keys of the parts posted, in the order they were added.
+func (p *PostedParts) Keys() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]string(nil), p.keys...)
+}
+
+type postedPartsKey struct{}
+
+// WithPostedParts returns a copy of ctx holding parts, where the Poster finds
+// the parts already posted and records the ones it posts.
+func WithPostedParts(ctx context.Context, parts *PostedParts) context.Context {
+	return context.WithValue(ctx, postedPartsKey{}, parts)
+}
+
+// GetPostedParts returns the PostedParts of ctx set with WithPostedParts, or
+// nil if there is none.
+func GetPostedParts(ctx context.Context) *PostedParts {
+	parts, _ := ctx.Value(postedPartsKey{}).(*PostedParts)
+	return parts
+}
@@ -0,0 +1,305 @@
+package github
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/util/ctxlog"
+
+	"github.com/google/go-github/github"
+	"gopkg.in/src-d/go-errors.v1"
+	log "gopkg.in/src-d/go-log.v1"
+)
+
+// ErrAnchorNotFound is returned when the content of an anchored line is not
+// found in the file anymore
+var ErrAnchorNotFound = errors.NewKind("anchored line not found in %s")
+
+// anchor identifies the line a comment was posted on by its content, so the
+// comment can be relocated after the line moves
+type anchor struct {
+	File string
+	Line int
+	Hash string
+	// Rule is the RuleID of the comment, it can be empty
+	Rule string
+}
+
+var anchorPattern = regexp.MustCompile(`\s*<!-- lookout-anchor:(.+):(\d+):([0-9a-f]+)(?::(\S+))? -->$`)
+
+// lineHash returns the hash of the content of a line, ignoring the
+// surrounding whitespace
+func lineHash(content string) string {
+	sum := sha1.Sum([]byte(strings.TrimSpace(content)))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// marker returns the hidden marker for the anchor to be added to the comments
+func (a anchor) marker() string {
+	if a.Rule != "" {
+		return fmt.Sprintf("<!-- lookout-anchor:%s:%d:%s:%s -->", a.File, a.Line, a.Hash, a.Rule)
+	}
+
+	return fmt.Sprintf("<!-- lookout-anchor:%s:%d:%s -->", a.File, a.Line, a.Hash)
+}
+
+// parseAnchor returns the text of a comment body without the anchor marker,
+// and the anchor. ok is false if the body doesn't have a marker.
+func parseAnchor(body string) (text string, a anchor, ok bool) {
+	m := anchorPattern.FindStringSubmatchIndex(body)
+	if m == nil {
+		return body, anchor{}, false
+	}
+
+	line, err := strconv.Atoi(body[m[4]:m[5]])
+	if err != nil {
+		return body, anchor{}, false
+	}
+
+	a = anchor{
+		File: body[m[2]:m[3]],
+		Line: line,
+		Hash: body[m[6]:m[7]],
+	}
+	if m[8] >= 0 {
+		a.Rule = body[m[8]:m[9]]
+	}
+
+	return body[:m[0]], a, true
+}
+
+// AnchorDecorator appends to the text of line comments a hidden marker with
+// the hash of the commented line content, so the comment can be found on
+// following analyses even if the line moves.
+func AnchorDecorator(ctx context.Context, rc *RenderContext, text string) string {
+	if !rc.IsLineComment() {
+		return text
+	}
+
+	content, err := rc.LineContent()
+	if err != nil {
+		ctxlog.Get(ctx).With(log.Fields{
+			"file": rc.Comment.File,
+			"line": rc.Comment.Line,
+		}).Warningf("can't anchor the comment: %s", err)
+		return text
+	}
+
+	a := anchor{
+		File: rc.Comment.File,
+		Line: int(rc.Comment.Line),
+		Hash: lineHash(content),
+		Rule: rc.Comment.RuleID,
+	}
+	return fmt.Sprintf("%s\n\n%s", text, a.marker())
+}
+
+// fileContent returns the content of a file using the data service, or nil if
+// the file doesn't exist in the revision
+func fileContent(
+	ctx context.Context,
+	fileGetter lookout.FileGetter,
+	rev *lookout.ReferencePointer,
+	file string,
+) ([]byte, error) {
+	scanner, err := fileGetter.GetFiles(ctx, &lookout.FilesRequest{
+		Revision:       rev,
+		IncludePattern: "^" + regexp.QuoteMeta(file) + "$",
+		WantContents:   true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var content []byte
+	if scanner.Next() {
+		content = scanner.File().Content
+	}
+	scanner.Close()
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return content, nil
+}
+
+// fileContents caches the content of the files of a revision read using the
+// data service
+type fileContents struct {
+	fileGetter lookout.FileGetter
+	rev        *lookout.ReferencePointer
+	contents   map[string][]byte
+}
+
+// fileContents returns the cache of the files of the given revision, or nil if
+// the poster doesn't have a FileGetter
+func (p *Poster) fileContents(rev *lookout.ReferencePointer) *fileContents {
+	if p.fileGetter == nil {
+		return nil
+	}
+
+	return &fileContents{
+		fileGetter: p.fileGetter,
+		rev:        rev,
+		contents:   make(map[string][]byte),
+	}
+}
+
+// get returns the content of a file, or nil if the file doesn't exist in the
+// revision
+func (fc *fileContents) get(ctx context.Context, file string) ([]byte, error) {
+	content, ok := fc.contents[file]
+	if ok {
+		return content, nil
+	}
+
+	content, err := fileContent(ctx, fc.fileGetter, fc.rev, file)
+	if err != nil {
+		return nil, err
+	}
+
+	fc.contents[file] = content
+	return content, nil
+}
+
+// line returns the content of a line of a file. ErrFileNotFound is returned if
+// the file doesn't exist or doesn't have that line.
+func (fc *fileContents) line(ctx context.Context, file string, n int) (string, error) {
+	content, err := fc.get(ctx, file)
+	if err != nil {
+		return "", err
+	}
+
+	lines := bufio.NewScanner(bytes.NewReader(content))
+	for i := 1; lines.Scan(); i++ {
+		if i == n {
+			return lines.Text(), nil
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return "", err
+	}
+
+	return "", ErrFileNotFound.New()
+}
+
+// findAnchor returns the line in content with the same content as the
+// anchored line. If there are several, the nearest one to the original line
+// is returned. ErrAnchorNotFound is returned if the content is not in the
+// file anymore.
+func findAnchor(content []byte, a anchor) (int, error) {
+	best := 0
+	lines := bufio.NewScanner(bytes.NewReader(content))
+	for i := 1; lines.Scan(); i++ {
+		if lineHash(lines.Text()) != a.Hash {
+			continue
+		}
+
+		if best == 0 || distance(i, a.Line) < distance(best, a.Line) {
+			best = i
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return 0, err
+	}
+
+	if best == 0 {
+		return 0, ErrAnchorNotFound.New(a.File)
+	}
+
+	return best, nil
+}
+
+func distance(a, b int) int {
+	if a > b {
+		return a - b
+	}
+
+	return b - a
+}
+
+// anchoredKey identifies an anchored comment by its current position, text
+// and rule. Depending on the ProviderConfig.DedupeBy mode some of the fields
+// are left empty, see newAnchoredKey.
+type anchoredKey struct {
+	File string
+	Line int
+	Text string
+	Rule string
+}
+
+const (
+	// DedupeExact considers a comment already posted if there is one on the
+	// same line with the same text
+	DedupeExact = "exact"
+	// DedupeFileLine considers a comment already posted if there is one on
+	// the same line, regardless of its text
+	DedupeFileLine = "file-line"
+	// DedupeFileLineRule considers a comment already posted if there is one
+	// on the same line from the same rule, regardless of its text
+	DedupeFileLineRule = "file-line-rule"
+)
+
+// newAnchoredKey returns the key used to find the comments already posted
+// with the given dedupe mode. Unknown modes are handled as DedupeExact.
+func newAnchoredKey(mode, file string, line int, text, rule string) anchoredKey {
+	key := anchoredKey{File: file, Line: line}
+	switch mode {
+	case DedupeFileLine:
+	case DedupeFileLineRule:
+		key.Rule = rule
+	default:
+		key.Text = text
+	}
+
+	return key
+}
+
+// anchoredComments returns the anchored review comments among the ones
+// already posted in the pull request, relocated to their current line in the
+// revision of the given files. Comments that can't be relocated, or older
+// than the DedupTTL, are ignored.
+func (p *Poster) anchoredComments(
+	ctx context.Context,
+	comments []*github.PullRequestComment,
+	contents *fileContents,
+) (map[anchoredKey]bool, error) {
+	result := make(map[anchoredKey]bool)
+	now := p.clock()
+	for _, c := range comments {
+		if p.dedupTTL > 0 && now.Sub(c.GetCreatedAt()) > p.dedupTTL {
+			continue
+		}
+
+		text, a, ok := p.parseMarker(ctx, c.GetID(), c.GetBody())
+		if !ok {
+			continue
+		}
+
+		content, err := contents.get(ctx, a.File)
+		if err != nil {
+			return nil, err
+		}
+
+		line, err := findAnchor(content, a)
+		if err != nil {
+			ctxlog.Get(ctx).With(log.Fields{
+				"file": a.File,
+				"line": a.Line,
+			}).Debugf("can't relocate anchored comment: %s", err)
+			continue
+		}
+
+		result[newAnchoredKey(p.conf.DedupeBy, a.File, line, text, a.Rule)] = true
+	}
+
+	return result, nil
+}
@@ -0,0 +1,112 @@
+package github
+
+import (
+	"context"
+	"testing"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/mock"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAnchor(t *testing.T) {
+	require := require.New(t)
+
+	a := anchor{File: "dir/file:name.go", Line: 12, Hash: lineHash("foo()")}
+	text, parsed, ok := parseAnchor("some text\n\n" + a.marker())
+	require.True(ok)
+	require.Equal("some text", text)
+	require.Equal(a, parsed)
+
+	text, _, ok = parseAnchor("some text")
+	require.False(ok)
+	require.Equal("some text", text)
+}
+
+func TestParseAnchorRule(t *testing.T) {
+	require := require.New(t)
+
+	a := anchor{File: "dir/file:name.go", Line: 12, Hash: lineHash("foo()"), Rule: "SEC001"}
+	text, parsed, ok := parseAnchor("some text\n\n" + a.marker())
+	require.True(ok)
+	require.Equal("some text", text)
+	require.Equal(a, parsed)
+}
+
+func TestNewAnchoredKey(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal(anchoredKey{File: "a.go", Line: 1, Text: "text"},
+		newAnchoredKey("", "a.go", 1, "text", "SEC001"))
+	require.Equal(anchoredKey{File: "a.go", Line: 1, Text: "text"},
+		newAnchoredKey(DedupeExact, "a.go", 1, "text", "SEC001"))
+	require.Equal(anchoredKey{File: "a.go", Line: 1},
+		newAnchoredKey(DedupeFileLine, "a.go", 1, "text", "SEC001"))
+	require.Equal(anchoredKey{File: "a.go", Line: 1, Rule: "SEC001"},
+		newAnchoredKey(DedupeFileLineRule, "a.go", 1, "text", "SEC001"))
+}
+
+func TestLineHashIgnoresWhitespace(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal(lineHash("foo()"), lineHash("\t  foo()  "))
+	require.NotEqual(lineHash("foo()"), lineHash("bar()"))
+}
+
+func newFileGetterMock(t *testing.T, file, content string) *mock.MockFilesService {
+	return &mock.MockFilesService{
+		T: t,
+		ExpectedRequest: &lookout.FilesRequest{
+			Revision:       &mockEvent.Head,
+			IncludePattern: `^main\.go$`,
+			WantContents:   true,
+		},
+		FileScanner: &mock.SliceFileScanner{Files: []*lookout.File{{
+			Path:    file,
+			Content: []byte(content),
+		}}},
+	}
+}
+
+func TestFileContent(t *testing.T) {
+	require := require.New(t)
+
+	fg := newFileGetterMock(t, "main.go", "package main\n")
+	content, err := fileContent(context.Background(), fg, &mockEvent.Head, "main.go")
+	require.NoError(err)
+	require.Equal("package main\n", string(content))
+}
+
+func TestFindAnchorMovedLine(t *testing.T) {
+	require := require.New(t)
+
+	// the commented line was 2, and two lines were added before it
+	content := []byte("package main\n\n// new\n// lines\nfunc foo() {}\n")
+	a := anchor{File: "main.go", Line: 2, Hash: lineHash("func foo() {}")}
+
+	line, err := findAnchor(content, a)
+	require.NoError(err)
+	require.Equal(5, line)
+}
+
+func TestFindAnchorNearest(t *testing.T) {
+	require := require.New(t)
+
+	content := []byte("}\na\n}\nb\nc\n}\n")
+	a := anchor{File: "main.go", Line: 4, Hash: lineHash("}")}
+
+	line, err := findAnchor(content, a)
+	require.NoError(err)
+	require.Equal(3, line)
+}
+
+func TestFindAnchorNotFound(t *testing.T) {
+	require := require.New(t)
+
+	content := []byte("package main\n")
+	a := anchor{File: "main.go", Line: 2, Hash: lineHash("func foo() {}")}
+
+	_, err := findAnchor(content, a)
+	require.True(ErrAnchorNotFound.Is(err))
+}
@@ -0,0 +1,242 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/util/ctxlog"
+)
+
+// Reasons of the comments not posted, written in the results artifacts
+const (
+	reasonEmpty         = "empty comment"
+	reasonSeverity      = "dropped by a severity policy"
+	reasonMinSeverity   = "under the min severity"
+	reasonThreshold     = "under the threshold of its rule"
+	reasonGenerated     = "file generated"
+	reasonMerged        = "merged into another comment on the same line"
+	reasonDuplicate     = "duplicate of another comment of the analyzer"
+	reasonTooClose      = "too close to another comment on the same file"
+	reasonMaxComments   = "over the max number of line comments"
+	reasonNotPushed     = "file not changed by the latest push"
+	reasonLargePR       = "pull request too large"
+	reasonWIP           = "pull request is a work in progress"
+	reasonEmptyDiff     = "pull request without changed files"
+	reasonOutOfDiff     = "line out of the diff range"
+	reasonNotAddition   = "line not added by the diff"
+	reasonFileNotFound  = "file not part of the diff"
+	reasonBadPatch      = "diff of the file could not be parsed"
+	reasonAlreadyPosted = "already posted"
+	reasonNoDescription = "pull request description could not be updated"
+)
+
+// resultsArtifact is the document written for each event when
+// ProviderConfig.ArtifactsDir is set, with all the comments of the analyzers,
+// posted or not
+type resultsArtifact struct {
+	Repository string `json:"repository"`
+	Base       string `json:"base,omitempty"`
+	Head       string `json:"head"`
+	// Error is the error posting the comments, if any
+	Error    string          `json:"error,omitempty"`
+	Comments []resultComment `json:"comments"`
+}
+
+type resultComment struct {
+	Analyzer string           `json:"analyzer"`
+	Comment  *lookout.Comment `json:"comment"`
+	Posted   bool             `json:"posted"`
+	// Reason is why the comment was not posted
+	Reason string `json:"reason,omitempty"`
+}
+
+// eventResults collects what happened to each comment of an event. A nil
+// *eventResults discards everything, so it can be used unconditionally.
+type eventResults struct {
+	comments []resultComment
+}
+
+func (r *eventResults) posted(analyzer string, c *lookout.Comment) {
+	if r == nil {
+		return
+	}
+
+	r.comments = append(r.comments, resultComment{
+		Analyzer: analyzer,
+		Comment:  c,
+		Posted:   true,
+	})
+}
+
+func (r *eventResults) dropped(analyzer string, c *lookout.Comment, reason string) {
+	if r == nil {
+		return
+	}
+
+	r.comments = append(r.comments, resultComment{
+		Analyzer: analyzer,
+		Comment:  c,
+		Reason:   reason,
+	})
+}
+
+// postedAll records all the comments as posted
+func (r *eventResults) postedAll(aCommentsList []lookout.AnalyzerComments) {
+	for _, aComments := range aCommentsList {
+		for _, c := range aComments.Comments {
+			r.posted(aComments.Config.Name, c)
+		}
+	}
+}
+
+// droppedAll records all the comments as not posted, with the given reason
+func (r *eventResults) droppedAll(aCommentsList []lookout.AnalyzerComments, reason string) {
+	for _, aComments := range aCommentsList {
+		for _, c := range aComments.Comments {
+			r.dropped(aComments.Config.Name, c, reason)
+		}
+	}
+}
+
+type resultKey struct {
+	file string
+	line int32
+	text string
+}
+
+// filtered records the comments of before missing in after, the result of a
+// filter, as not posted with the given reason, and returns after. The
+// comments are compared by file, line and text, so the ones only changed by
+// the filter, e.g. downgraded, are not recorded.
+func (r *eventResults) filtered(
+	reason string,
+	before, after []lookout.AnalyzerComments,
+) []lookout.AnalyzerComments {
+	if r == nil {
+		return after
+	}
+
+	for i, aComments := range before {
+		kept := make(map[resultKey]int)
+		if i < len(after) {
+			for _, c := range after[i].Comments {
+				kept[resultKey{c.File, c.Line, c.Text}]++
+			}
+		}
+
+		for _, c := range aComments.Comments {
+			k := resultKey{c.File, c.Line, c.Text}
+			if kept[k] > 0 {
+				kept[k]--
+				continue
+			}
+
+			r.dropped(aComments.Config.Name, c, reason)
+		}
+	}
+
+	return after
+}
+
+type eventResultsKey struct{}
+
+// withResults returns the context with a new eventResults if
+// ProviderConfig.ArtifactsDir is set, or nil and the same context otherwise.
+func (p *Poster) withResults(ctx context.Context) (context.Context, *eventResults) {
+	if p.conf.ArtifactsDir == "" {
+		return ctx, nil
+	}
+
+	r := &eventResults{}
+	return context.WithValue(ctx, eventResultsKey{}, r), r
+}
+
+// getResults returns the eventResults of the context, or nil if there is none
+func getResults(ctx context.Context) *eventResults {
+	r, _ := ctx.Value(eventResultsKey{}).(*eventResults)
+	return r
+}
+
+// writeResults writes the results artifact of the event to
+// ProviderConfig.ArtifactsDir, as owner/repo/head.json. Errors are only
+// logged.
+func (p *Poster) writeResults(
+	ctx context.Context,
+	owner, repo string,
+	rev *lookout.CommitRevision,
+	results *eventResults,
+	postErr error,
+) {
+	if results == nil {
+		return
+	}
+
+	artifact := resultsArtifact{
+		Repository: owner + "/" + repo,
+		Base:       rev.Base.Hash,
+		Head:       rev.Head.Hash,
+		Comments:   results.comments,
+	}
+	if postErr != nil {
+		artifact.Error = postErr.Error()
+	}
+
+	b, err := json.Marshal(artifact)
+	if err != nil {
+		ctxlog.Get(ctx).Errorf(err, "can't encode the results artifact")
+		return
+	}
+
+	store := NewFileFindingsStore(p.conf.ArtifactsDir, "")
+	key := fmt.Sprintf("%s/%s/%s", owner, repo, rev.Head.Hash)
+	if _, err := store.Store(ctx, key, b); err != nil {
+		ctxlog.Get(ctx).Errorf(err, "can't write the results artifact")
+	}
+}
+
+// filterComments applies the filters of the configuration to the comments
+// before posting them, recording the ones dropped in the results of the
+// context.
+func (p *Poster) filterComments(
+	ctx context.Context,
+	aCommentsList []lookout.AnalyzerComments,
+) []lookout.AnalyzerComments {
+	results := getResults(ctx)
+
+	aCommentsList = prefixPaths(aCommentsList)
+	aCommentsList = p.analysisErrorComments(aCommentsList)
+	aCommentsList = results.filtered(reasonEmpty,
+		aCommentsList, p.dropEmptyComments(ctx, aCommentsList))
+	aCommentsList = results.filtered(reasonDuplicate,
+		aCommentsList, dropDuplicates(p.conf.UniqueComments, aCommentsList))
+	aCommentsList = results.filtered(reasonSeverity,
+		aCommentsList, p.applySeverityPolicies(ctx, aCommentsList))
+	aCommentsList = results.filtered(reasonMinSeverity,
+		aCommentsList, p.applyMinSeverity(ctx, aCommentsList))
+	aCommentsList = results.filtered(reasonThreshold,
+		aCommentsList, p.applyRuleThresholds(aCommentsList))
+
+	return aCommentsList
+}
+
+// filterResolvedComments applies the filters of the configuration that need
+// the positions of the comments in the diff, recording the ones dropped in
+// the results of the context.
+func (p *Poster) filterResolvedComments(
+	ctx context.Context,
+	dl *diffLines,
+	aCommentsList []lookout.AnalyzerComments,
+) []lookout.AnalyzerComments {
+	results := getResults(ctx)
+
+	aCommentsList = results.filtered(reasonMerged,
+		aCommentsList, mergeSameLine(p.mergeSameLineMode(), dl, aCommentsList))
+	aCommentsList = results.filtered(reasonTooClose,
+		aCommentsList, dropCloseComments(p.conf.MinCommentLineGap, aCommentsList))
+	aCommentsList = results.filtered(reasonMaxComments,
+		aCommentsList, limitLineComments(p.conf.MaxComments, dl, aCommentsList))
+
+	return aCommentsList
+}
@@ -0,0 +1,122 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/src-d/lookout"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventResultsFiltered(t *testing.T) {
+	require := require.New(t)
+
+	kept := &lookout.Comment{File: "a.go", Line: 1, Text: "kept"}
+	dropped := &lookout.Comment{File: "a.go", Line: 2, Text: "dropped"}
+	changed := &lookout.Comment{File: "a.go", Line: 3, Text: "changed", Severity: lookout.ErrorSeverity}
+	before := []lookout.AnalyzerComments{lookout.AnalyzerComments{
+		Config:   lookout.AnalyzerConfig{Name: "mock"},
+		Comments: []*lookout.Comment{kept, dropped, changed},
+	}}
+	after := []lookout.AnalyzerComments{lookout.AnalyzerComments{
+		Config: lookout.AnalyzerConfig{Name: "mock"},
+		Comments: []*lookout.Comment{
+			kept,
+			&lookout.Comment{File: "a.go", Line: 3, Text: "changed", Severity: lookout.InfoSeverity},
+		},
+	}}
+
+	r := &eventResults{}
+	require.Equal(after, r.filtered("reason", before, after))
+	require.Equal([]resultComment{
+		resultComment{Analyzer: "mock", Comment: dropped, Reason: "reason"},
+	}, r.comments)
+
+	// nil results record nothing
+	var nilResults *eventResults
+	require.Equal(after, nilResults.filtered("reason", before, after))
+}
+
+func (s *PosterTestSuite) TestPostResultsArtifact() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	dir, err := ioutil.TempDir("", "lookout-artifacts")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{ArtifactsDir: dir}}
+	err = p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{Text: "Global comment"},
+				&lookout.Comment{File: "main.go", Line: 5, Text: "Line comment"},
+				&lookout.Comment{File: "main.go", Line: 50, Text: "Out of range"},
+				&lookout.Comment{File: "other.go", Line: 5, Text: "Wrong file"},
+				&lookout.Comment{File: "main.go", Line: 6, Text: " "},
+			},
+		}})
+	s.NoError(err)
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "foo", "bar", hash2+".json"))
+	s.Require().NoError(err)
+
+	var artifact resultsArtifact
+	s.Require().NoError(json.Unmarshal(b, &artifact))
+	s.Equal("foo/bar", artifact.Repository)
+	s.Equal(hash1, artifact.Base)
+	s.Equal(hash2, artifact.Head)
+	s.Equal("", artifact.Error)
+
+	results := make(map[string]string)
+	for _, c := range artifact.Comments {
+		s.Equal("mock", c.Analyzer)
+		s.Equal(c.Posted, c.Reason == "")
+		results[c.Comment.Text] = c.Reason
+	}
+
+	s.Equal(map[string]string{
+		"Global comment": "",
+		"Line comment":   "",
+		"Out of range":   reasonOutOfDiff,
+		"Wrong file":     reasonFileNotFound,
+		" ":              reasonEmpty,
+	}, results)
+}
+
+func (s *PosterTestSuite) TestPostResultsArtifactError() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	})
+
+	dir, err := ioutil.TempDir("", "lookout-artifacts")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{ArtifactsDir: dir}}
+	err = p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.Error(err)
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "foo", "bar", hash2+".json"))
+	s.Require().NoError(err)
+
+	var artifact resultsArtifact
+	s.Require().NoError(json.Unmarshal(b, &artifact))
+	s.NotEmpty(artifact.Error)
+}
@@ -0,0 +1,272 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/src-d/lookout"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/suite"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// cassette is a list of recorded GitHub API interactions that can be replayed
+// in the tests, so flows involving several endpoints can be tested against
+// real responses instead of hand-built mocks.
+//
+// Cassettes are recorded with a cassetteRecorder wrapping the transport of a
+// client authenticated against the real API, and saved into testdata. Request
+// headers are never recorded, so they don't contain credentials.
+type cassette struct {
+	Interactions []*interaction `yaml:"interactions"`
+}
+
+type interaction struct {
+	Request  recordedRequest  `yaml:"request"`
+	Response recordedResponse `yaml:"response"`
+}
+
+type recordedRequest struct {
+	Method string `yaml:"method"`
+	// URL is the path of the request and its query, without host
+	URL  string `yaml:"url"`
+	Body string `yaml:"body,omitempty"`
+}
+
+type recordedResponse struct {
+	Status  int               `yaml:"status"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Body    string            `yaml:"body,omitempty"`
+}
+
+func loadCassette(path string) (*cassette, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c cassette
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func (c *cassette) save(path string) error {
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// cassetteRecorder is an http.RoundTripper that records the interactions
+// made through it into its cassette
+type cassetteRecorder struct {
+	Transport http.RoundTripper
+
+	mu       sync.Mutex
+	cassette cassette
+}
+
+func (r *cassetteRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	headers := make(map[string]string)
+	for _, h := range []string{"Content-Type", "Link"} {
+		if v := resp.Header.Get(h); v != "" {
+			headers[h] = v
+		}
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, &interaction{
+		Request: recordedRequest{
+			Method: req.Method,
+			URL:    req.URL.RequestURI(),
+			Body:   string(reqBody),
+		},
+		Response: recordedResponse{
+			Status:  resp.StatusCode,
+			Headers: headers,
+			Body:    string(respBody),
+		},
+	})
+	r.mu.Unlock()
+
+	return resp, nil
+}
+
+// cassettePlayer replays the interactions of a cassette, in order, keeping
+// the bodies of the requests received
+type cassettePlayer struct {
+	s        suite.Suite
+	cassette *cassette
+
+	mu       sync.Mutex
+	next     int
+	received []string
+}
+
+var _ http.Handler = &cassettePlayer{}
+
+func (p *cassettePlayer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.next >= len(p.cassette.Interactions) {
+		p.s.Failf("unexpected request", "%s %s", r.Method, r.URL.RequestURI())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	i := p.cassette.Interactions[p.next]
+	p.next++
+
+	if i.Request.Method != r.Method || i.Request.URL != r.URL.RequestURI() {
+		p.s.Failf("unexpected request", "expected %s %s, got %s %s",
+			i.Request.Method, i.Request.URL, r.Method, r.URL.RequestURI())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	p.s.NoError(err)
+	p.received = append(p.received, string(body))
+
+	for k, v := range i.Response.Headers {
+		w.Header().Set(k, v)
+	}
+
+	w.WriteHeader(i.Response.Status)
+	w.Write([]byte(i.Response.Body))
+}
+
+// done returns true if all the interactions were replayed
+func (p *cassettePlayer) done() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.next == len(p.cassette.Interactions)
+}
+
+// playCassette loads the cassette from testdata and serves it for all the
+// requests of the suite
+func (s *PosterTestSuite) playCassette(name string) *cassettePlayer {
+	c, err := loadCassette("testdata/" + name + ".yml")
+	s.Require().NoError(err)
+
+	p := &cassettePlayer{s: s.Suite, cassette: c}
+	s.mux.Handle("/", p)
+
+	return p
+}
+
+func (s *PosterTestSuite) TestCassetteRecorder() {
+	s.mux.HandleFunc("/repos/foo/bar/statuses/"+hash2, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":1}`))
+	})
+
+	recorder := &cassetteRecorder{Transport: http.DefaultTransport}
+	req, err := http.NewRequest("POST", s.server.URL+"/repos/foo/bar/statuses/"+hash2,
+		bytes.NewBufferString(`{"state":"success"}`))
+	s.NoError(err)
+	req.Header.Set("Authorization", "token secret")
+
+	resp, err := recorder.RoundTrip(req)
+	s.NoError(err)
+	body, err := ioutil.ReadAll(resp.Body)
+	s.NoError(err)
+	s.Equal(`{"id":1}`, string(body))
+
+	s.Equal([]*interaction{&interaction{
+		Request: recordedRequest{
+			Method: "POST",
+			URL:    "/repos/foo/bar/statuses/" + hash2,
+			Body:   `{"state":"success"}`,
+		},
+		Response: recordedResponse{
+			Status:  http.StatusCreated,
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Body:    `{"id":1}`,
+		},
+	}}, recorder.cassette.Interactions)
+
+	// the recorded cassette can be replayed
+	replay := httptest.NewServer(&cassettePlayer{s: s.Suite, cassette: &recorder.cassette})
+	defer replay.Close()
+
+	resp, err = http.Post(replay.URL+"/repos/foo/bar/statuses/"+hash2,
+		"application/json", bytes.NewBufferString(`{"state":"success"}`))
+	s.NoError(err)
+	s.Equal(http.StatusCreated, resp.StatusCode)
+}
+
+func (s *PosterTestSuite) TestPostCassette() {
+	player := s.playCassette("post_review")
+
+	p := &Poster{pool: s.pool}
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{Text: "Global comment"},
+				&lookout.Comment{File: "main.go", Line: 3, Text: "Line comment"},
+				&lookout.Comment{File: "README.md", Text: "File comment"},
+			},
+		}})
+	s.NoError(err)
+
+	err = p.Status(context.Background(), mockEvent, lookout.SuccessAnalysisStatus)
+	s.NoError(err)
+
+	s.True(player.done())
+	s.Len(player.received, 3)
+
+	expected, _ := json.Marshal(&github.PullRequestReviewRequest{
+		CommitID: &mockEvent.Head.Hash,
+		Body:     strptr("Global comment"),
+		Event:    strptr(commentEvent),
+		Comments: []*github.DraftReviewComment{&github.DraftReviewComment{
+			Path:     strptr("main.go"),
+			Position: intptr(4),
+			Body:     strptr("Line comment"),
+		}, &github.DraftReviewComment{
+			Path:     strptr("README.md"),
+			Position: intptr(1),
+			Body:     strptr("File comment"),
+		}}})
+	s.JSONEq(string(expected), player.received[1])
+}
@@ -0,0 +1,163 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/util/ctxlog"
+
+	"github.com/google/go-github/github"
+	log "gopkg.in/src-d/go-log.v1"
+)
+
+// tooManyFilesDescription is the description of the status of the pull
+// requests not analyzed because they change more than MaxChangedFiles files
+const tooManyFilesDescription = "Not analyzed, the pull request changes %d files, more than %d"
+
+// maxChangedFilesHeads is the max number of heads whose number of changed
+// files is cached, the oldest ones are forgotten first
+const maxChangedFilesHeads = 1000
+
+// changedFilesHead is the number of files changed by a pull request head,
+// and whether the status noting it changes too many files was set
+type changedFilesHead struct {
+	files     int
+	statusSet bool
+}
+
+// changedFilesHeads caches the changedFilesHead of the latest heads, up to
+// max, so the pull request is requested once for each head
+type changedFilesHeads struct {
+	mu    sync.Mutex
+	max   int
+	heads map[string]changedFilesHead
+	// order holds the cached heads, oldest first
+	order []string
+}
+
+// get returns the cached changedFilesHead of the head, ok is false if it's
+// not cached
+func (c *changedFilesHeads) get(hash string) (h changedFilesHead, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	h, ok = c.heads[hash]
+	return h, ok
+}
+
+// set caches the changedFilesHead of the head, forgetting the oldest one if
+// there are already max heads cached
+func (c *changedFilesHeads) set(hash string, h changedFilesHead) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.heads == nil {
+		c.heads = make(map[string]changedFilesHead)
+	}
+
+	if _, ok := c.heads[hash]; !ok {
+		max := c.max
+		if max <= 0 {
+			max = maxChangedFilesHeads
+		}
+
+		if len(c.order) >= max {
+			delete(c.heads, c.order[0])
+			c.order = c.order[1:]
+		}
+
+		c.order = append(c.order, hash)
+	}
+
+	c.heads[hash] = h
+}
+
+// changedFiles returns the number of files changed by the pull request. The
+// listings of pull requests don't include it, so the pull request is
+// requested if it's missing.
+func changedFiles(
+	ctx context.Context,
+	client *Client,
+	r *lookout.RepositoryInfo,
+	pr *github.PullRequest,
+) (int, error) {
+	if pr.ChangedFiles != nil {
+		return *pr.ChangedFiles, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+
+	full, _, err := client.PullRequests.Get(ctx, r.Username, r.Name, pr.GetNumber())
+	if err != nil {
+		return 0, ErrGitHubAPI.Wrap(err)
+	}
+
+	return full.GetChangedFiles(), nil
+}
+
+// hasTooManyFiles returns true if the pull request changes more than
+// MaxChangedFiles files. In that case a status noting it is set on the head
+// of the event, once for each head. The number of files is cached by head,
+// so it's requested once for each one. If it can't be retrieved the pull
+// request is analyzed.
+func (w *Watcher) hasTooManyFiles(
+	ctx context.Context,
+	client *Client,
+	r *lookout.RepositoryInfo,
+	pr *github.PullRequest,
+	e *lookout.ReviewEvent,
+) bool {
+	if w.conf.MaxChangedFiles <= 0 {
+		return false
+	}
+
+	cached, ok := w.changedFiles.get(e.Head.Hash)
+	if ok && cached.statusSet {
+		return true
+	}
+
+	n := cached.files
+	if !ok {
+		var err error
+		n, err = changedFiles(ctx, client, r, pr)
+		if err != nil {
+			ctxlog.Get(ctx).Errorf(err, "can't get the number of files changed by the pull request, analyzing it")
+			return false
+		}
+
+		w.changedFiles.set(e.Head.Hash, changedFilesHead{files: n})
+	}
+
+	if n <= w.conf.MaxChangedFiles {
+		return false
+	}
+
+	ctxlog.Get(ctx).With(log.Fields{
+		"changed-files": n,
+	}).Infof("skipping pull request, it changes more files than the max")
+
+	state := "success"
+	description := fmt.Sprintf(tooManyFilesDescription, n, w.conf.MaxChangedFiles)
+	statusCtx := statusContext(w.conf.StatusContextPrefix, "")
+	status := &github.RepoStatus{
+		State:       &state,
+		Description: &description,
+		Context:     &statusCtx,
+	}
+
+	sctx, cancel := withTimeout(ctx, RequestTimeout)
+	defer cancel()
+
+	_, _, err := client.Repositories.CreateStatus(sctx, r.Username, r.Name, e.Head.Hash, status)
+	if err != nil {
+		ctxlog.Get(ctx).Errorf(ErrGitHubAPI.Wrap(err), "can't set the status of the skipped pull request")
+		return true
+	}
+
+	w.changedFiles.set(e.Head.Hash, changedFilesHead{files: n, statusSet: true})
+
+	return true
+}
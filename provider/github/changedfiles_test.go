@@ -0,0 +1,36 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangedFilesHeads(t *testing.T) {
+	require := require.New(t)
+
+	c := &changedFilesHeads{max: 2}
+	_, ok := c.get("a")
+	require.False(ok)
+
+	c.set("a", changedFilesHead{files: 1})
+	c.set("b", changedFilesHead{files: 2})
+	c.set("a", changedFilesHead{files: 1, statusSet: true})
+
+	h, ok := c.get("a")
+	require.True(ok)
+	require.Equal(changedFilesHead{files: 1, statusSet: true}, h)
+
+	// the oldest head is forgotten
+	c.set("c", changedFilesHead{files: 3})
+	_, ok = c.get("a")
+	require.False(ok)
+
+	h, ok = c.get("b")
+	require.True(ok)
+	require.Equal(2, h.files)
+	h, ok = c.get("c")
+	require.True(ok)
+	require.Equal(3, h.files)
+	require.Len(c.heads, 2)
+}
@@ -0,0 +1,110 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/src-d/lookout/util/ctxlog"
+
+	"github.com/google/go-github/github"
+	log "gopkg.in/src-d/go-log.v1"
+)
+
+// changesRequestedMarker is the hidden marker of the reviews requesting
+// changes, used to find them in the next analyses to dismiss them
+const changesRequestedMarker = "<!-- lookout-changes-requested -->"
+
+// changesRequestedState is the state of the reviews requesting changes
+const changesRequestedState = "CHANGES_REQUESTED"
+
+// changesDismissedMessage is the message of the dismissal of the reviews
+// requesting changes
+const changesDismissedMessage = "No finding requests changes anymore."
+
+// withChangesRequestedMarker returns a copy of the review with the marker of
+// the reviews requesting changes at the end of its body
+func withChangesRequestedMarker(req *github.PullRequestReviewRequest) *github.PullRequestReviewRequest {
+	body := changesRequestedMarker
+	if req.GetBody() != "" {
+		body = fmt.Sprintf("%s\n\n%s", req.GetBody(), changesRequestedMarker)
+	}
+
+	r := *req
+	r.Body = &body
+	return &r
+}
+
+// dismissChangeRequests dismisses the reviews requesting changes posted by
+// previous analyses of the pull request, found by their marker. The new
+// reviews are already posted, so errors are only logged.
+func (p *Poster) dismissChangeRequests(
+	ctx context.Context,
+	client *Client,
+	budget *retryBudget,
+	owner, repo string,
+	pr int,
+) {
+	var reviews []*github.PullRequestReview
+	err := budget.do(ctx, "list reviews", func() error {
+		var err error
+		reviews, err = p.listReviews(ctx, client, owner, repo, pr)
+		return err
+	})
+	if err != nil {
+		ctxlog.Get(ctx).Errorf(err, "can't list the reviews to dismiss the change requests")
+		return
+	}
+
+	dismissal := &github.PullRequestReviewDismissalRequest{
+		Message: github.String(changesDismissedMessage),
+	}
+
+	for _, r := range reviews {
+		if r.GetState() != changesRequestedState ||
+			!strings.Contains(r.GetBody(), changesRequestedMarker) {
+			continue
+		}
+
+		err := budget.do(ctx, "dismiss review", func() error {
+			ctx, cancel := withTimeout(ctx, p.postTimeout)
+			defer cancel()
+
+			_, resp, err := client.PullRequests.DismissReview(ctx, owner, repo, int64(pr), r.GetID(), dismissal)
+			return p.handleAPIError(resp, err)
+		})
+		if err != nil {
+			ctxlog.Get(ctx).With(log.Fields{
+				"review": r.GetID(),
+			}).Errorf(err, "can't dismiss the review requesting changes")
+		}
+	}
+}
+
+// listReviews returns all the reviews of a pull request, following the
+// pagination.
+// If a GitHub API request fails, ErrGitHubAPI is returned.
+func (p *Poster) listReviews(
+	ctx context.Context,
+	client *Client,
+	owner, repo string,
+	pr int,
+) ([]*github.PullRequestReview, error) {
+	opts := &github.ListOptions{PerPage: p.perPage()}
+
+	var result []*github.PullRequestReview
+	for {
+		reviews, resp, err := client.PullRequests.ListReviews(ctx, owner, repo, pr, opts)
+		if err != nil {
+			return nil, p.handleAPIError(resp, err)
+		}
+
+		result = append(result, reviews...)
+
+		if resp.NextPage == 0 {
+			return result, nil
+		}
+
+		opts.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,326 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/src-d/lookout"
+)
+
+// the Checks API is only available as a preview in the API version used by
+// the client
+const checksPreviewMediaType = "application/vnd.github.antiope-preview+json"
+
+// GitHub doesn't allow more than 50 annotations per request, the rest must be
+// added updating the check run
+var batchCheckAnnotations = 50
+
+const (
+	checkRunName           = "lookout"
+	checkRunTitle          = "lookout analysis"
+	annotationLevel        = "warning"
+	noRuleID               = "(no rule)"
+	checkRunCompleted      = "completed"
+	checkRunInProgress     = "in_progress"
+	checkConclusionNeutral = "neutral"
+	checkConclusionSuccess = "success"
+)
+
+// checkRun is a check run request for the GitHub Checks API
+type checkRun struct {
+	Name       string          `json:"name,omitempty"`
+	HeadSHA    string          `json:"head_sha,omitempty"`
+	Status     string          `json:"status,omitempty"`
+	Conclusion string          `json:"conclusion,omitempty"`
+	Output     *checkRunOutput `json:"output,omitempty"`
+}
+
+type checkRunOutput struct {
+	Title       string             `json:"title"`
+	Summary     string             `json:"summary"`
+	Annotations []*checkAnnotation `json:"annotations,omitempty"`
+}
+
+type checkAnnotation struct {
+	Path            string `json:"path"`
+	StartLine       int    `json:"start_line"`
+	EndLine         int    `json:"end_line"`
+	AnnotationLevel string `json:"annotation_level"`
+	Title           string `json:"title,omitempty"`
+	Message         string `json:"message"`
+}
+
+type checkRunResponse struct {
+	ID int64 `json:"id"`
+}
+
+// postCheckRun posts the comments as a completed check run. File comments are
+// posted as annotations grouped by rule, and the summary contains the count
+// of annotations for each rule followed by the global comments.
+func (p *Poster) postCheckRun(
+	ctx context.Context,
+	client *Client,
+	budget *retryBudget,
+	owner, repo string,
+	e *lookout.ReviewEvent,
+	aCommentsList []lookout.AnalyzerComments,
+) error {
+	run := newCheckRun(prCommit(e), aCommentsList)
+
+	annotations := run.Output.Annotations
+	if len(annotations) > batchCheckAnnotations {
+		run.Output.Annotations = annotations[:batchCheckAnnotations]
+	}
+	annotations = annotations[len(run.Output.Annotations):]
+
+	var created checkRunResponse
+	err := budget.doCreate(ctx, "create check run", func() error {
+		return p.checksRequest(ctx, client, "POST",
+			fmt.Sprintf("repos/%s/%s/check-runs", owner, repo), run, &created)
+	})
+	if err != nil {
+		return err
+	}
+
+	for len(annotations) > 0 {
+		n := batchCheckAnnotations
+		if len(annotations) < n {
+			n = len(annotations)
+		}
+
+		update := &checkRun{Output: &checkRunOutput{
+			Title:       run.Output.Title,
+			Summary:     run.Output.Summary,
+			Annotations: annotations[:n],
+		}}
+		annotations = annotations[n:]
+
+		err := budget.do(ctx, "update check run", func() error {
+			return p.checksRequest(ctx, client, "PATCH",
+				fmt.Sprintf("repos/%s/%s/check-runs/%d", owner, repo, created.ID), update, nil)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checksRequest makes a request to the Checks API, decoding the response into v
+func (p *Poster) checksRequest(
+	ctx context.Context,
+	client *Client,
+	method, url string,
+	body interface{},
+	v interface{},
+) error {
+	ctx, cancel := withTimeout(ctx, p.postTimeout)
+	defer cancel()
+
+	req, err := client.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", checksPreviewMediaType)
+
+	resp, err := client.Do(ctx, req, v)
+	if err == nil && resp.StatusCode == 201 {
+		return nil
+	}
+
+	return p.handleAPIError(resp, err)
+}
+
+func newCheckRun(headSHA string, aCommentsList []lookout.AnalyzerComments) *checkRun {
+	annotations, globals, counts := checkRunAnnotations(aCommentsList)
+
+	conclusion := checkConclusionNeutral
+	if len(annotations) == 0 && len(globals) == 0 {
+		conclusion = checkConclusionSuccess
+	}
+
+	return &checkRun{
+		Name:       checkRunName,
+		HeadSHA:    headSHA,
+		Status:     checkRunCompleted,
+		Conclusion: conclusion,
+		Output: &checkRunOutput{
+			Title:       checkRunTitle,
+			Summary:     checkRunSummary(counts, globals),
+			Annotations: annotations,
+		},
+	}
+}
+
+// checkRunAnnotations returns the annotations of the file comments grouped by
+// rule, the text of the global comments and the number of annotations of each
+// rule
+func checkRunAnnotations(
+	aCommentsList []lookout.AnalyzerComments,
+) ([]*checkAnnotation, []string, map[string]int) {
+	var annotations []*checkAnnotation
+	var globals []string
+	counts := make(map[string]int)
+
+	for _, aComments := range aCommentsList {
+		for _, c := range aComments.Comments {
+			if c.File == "" {
+				globals = append(globals, c.Text)
+				continue
+			}
+
+			line := int(c.Line)
+			if line < 1 {
+				line = 1
+			}
+
+			ruleID := c.RuleID
+			if ruleID == "" {
+				ruleID = noRuleID
+			}
+			counts[ruleID]++
+
+			annotations = append(annotations, &checkAnnotation{
+				Path:            c.File,
+				StartLine:       line,
+				EndLine:         line,
+				AnnotationLevel: annotationLevel,
+				Title:           c.RuleID,
+				Message:         c.Text,
+			})
+		}
+	}
+
+	// group the annotations by rule, keeping the order within each rule
+	sort.SliceStable(annotations, func(i, j int) bool {
+		return annotationRule(annotations[i]) < annotationRule(annotations[j])
+	})
+
+	return annotations, globals, counts
+}
+
+func annotationRule(a *checkAnnotation) string {
+	if a.Title == "" {
+		return noRuleID
+	}
+
+	return a.Title
+}
+
+// checkRunSummary returns the Markdown summary with the number of findings
+// for each rule, sorted by rule, and the total, followed by the global comments
+func checkRunSummary(counts map[string]int, globals []string) string {
+	rules := make([]string, 0, len(counts))
+	total := 0
+	for rule, n := range counts {
+		rules = append(rules, rule)
+		total += n
+	}
+	sort.Strings(rules)
+
+	var sections []string
+	if total > 0 {
+		var lines []string
+		for _, rule := range rules {
+			lines = append(lines, fmt.Sprintf("- %s: %d", rule, counts[rule]))
+		}
+
+		sections = append(sections, fmt.Sprintf("%s\n\n**Total: %d**",
+			strings.Join(lines, "\n"), total))
+	} else {
+		sections = append(sections, "No findings")
+	}
+
+	sections = append(sections, globals...)
+
+	return strings.Join(sections, "\n\n")
+}
+
+// postAggregateCheckRun posts the comments as a single check run with a
+// section for each analyzer in its summary. The check run is created in
+// progress and updated with each analyzer, in the order they finished, with
+// its section and annotations, and it's completed with the last one.
+func (p *Poster) postAggregateCheckRun(
+	ctx context.Context,
+	client *Client,
+	budget *retryBudget,
+	owner, repo string,
+	e *lookout.ReviewEvent,
+	aCommentsList []lookout.AnalyzerComments,
+) error {
+	run := &checkRun{
+		Name:    checkRunName,
+		HeadSHA: prCommit(e),
+		Status:  checkRunInProgress,
+		Output: &checkRunOutput{
+			Title:   checkRunTitle,
+			Summary: "Analyzing",
+		},
+	}
+	if len(aCommentsList) == 0 {
+		run.Status = checkRunCompleted
+		run.Conclusion = checkConclusionSuccess
+		run.Output.Summary = "No findings"
+	}
+
+	var created checkRunResponse
+	err := budget.doCreate(ctx, "create check run", func() error {
+		return p.checksRequest(ctx, client, "POST",
+			fmt.Sprintf("repos/%s/%s/check-runs", owner, repo), run, &created)
+	})
+	if err != nil {
+		return err
+	}
+
+	update := func(u *checkRun) error {
+		return budget.do(ctx, "update check run", func() error {
+			return p.checksRequest(ctx, client, "PATCH",
+				fmt.Sprintf("repos/%s/%s/check-runs/%d", owner, repo, created.ID), u, nil)
+		})
+	}
+
+	conclusion := checkConclusionSuccess
+	var sections []string
+	for i, aComments := range aCommentsList {
+		annotations, globals, counts := checkRunAnnotations(
+			[]lookout.AnalyzerComments{aComments})
+		if len(annotations) > 0 || len(globals) > 0 {
+			conclusion = checkConclusionNeutral
+		}
+
+		sections = append(sections, fmt.Sprintf("### %s\n\n%s",
+			aComments.Config.ShownName(), checkRunSummary(counts, globals)))
+		summary := strings.Join(sections, "\n\n")
+
+		// the annotations are added in batches, and the summary is set with
+		// the first one
+		for first := true; first || len(annotations) > 0; first = false {
+			n := batchCheckAnnotations
+			if len(annotations) < n {
+				n = len(annotations)
+			}
+
+			u := &checkRun{Output: &checkRunOutput{
+				Title:       checkRunTitle,
+				Summary:     summary,
+				Annotations: annotations[:n],
+			}}
+			annotations = annotations[n:]
+
+			if i == len(aCommentsList)-1 && len(annotations) == 0 {
+				u.Status = checkRunCompleted
+				u.Conclusion = conclusion
+			}
+
+			if err := update(u); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
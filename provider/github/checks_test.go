@@ -0,0 +1,80 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/src-d/lookout"
+
+	"github.com/stretchr/testify/require"
+)
+
+var ruleComments = []lookout.AnalyzerComments{
+	lookout.AnalyzerComments{
+		Config: lookout.AnalyzerConfig{Name: "first"},
+		Comments: []*lookout.Comment{
+			&lookout.Comment{Text: "Global"},
+			&lookout.Comment{File: "a.go", Line: 1, Text: "lint 1", RuleID: "LINT002"},
+			&lookout.Comment{File: "a.go", Line: 2, Text: "sec 1", RuleID: "SEC001"},
+			&lookout.Comment{File: "b.go", Text: "file comment"},
+		},
+	},
+	lookout.AnalyzerComments{
+		Config: lookout.AnalyzerConfig{Name: "second"},
+		Comments: []*lookout.Comment{
+			&lookout.Comment{File: "b.go", Line: 3, Text: "lint 2", RuleID: "LINT002"},
+			&lookout.Comment{File: "b.go", Line: 4, Text: "sec 2", RuleID: "SEC001"},
+			&lookout.Comment{File: "c.go", Line: 5, Text: "sec 3", RuleID: "SEC001"},
+		},
+	},
+}
+
+func TestNewCheckRunSummary(t *testing.T) {
+	require := require.New(t)
+
+	run := newCheckRun("hash", ruleComments)
+	require.Equal("hash", run.HeadSHA)
+	require.Equal(checkRunCompleted, run.Status)
+	require.Equal(checkConclusionNeutral, run.Conclusion)
+	require.Equal(""+
+		"- (no rule): 1\n"+
+		"- LINT002: 2\n"+
+		"- SEC001: 3\n"+
+		"\n"+
+		"**Total: 6**\n"+
+		"\n"+
+		"Global", run.Output.Summary)
+}
+
+func TestNewCheckRunGrouping(t *testing.T) {
+	require := require.New(t)
+
+	run := newCheckRun("hash", ruleComments)
+
+	var messages, rules []string
+	for _, a := range run.Output.Annotations {
+		messages = append(messages, a.Message)
+		rules = append(rules, a.Title)
+	}
+
+	require.Equal([]string{
+		"file comment", "lint 1", "lint 2", "sec 1", "sec 2", "sec 3",
+	}, messages)
+	require.Equal([]string{
+		"", "LINT002", "LINT002", "SEC001", "SEC001", "SEC001",
+	}, rules)
+
+	// file comments are annotated on the first line
+	a := run.Output.Annotations[0]
+	require.Equal("b.go", a.Path)
+	require.Equal(1, a.StartLine)
+	require.Equal(1, a.EndLine)
+}
+
+func TestNewCheckRunNoComments(t *testing.T) {
+	require := require.New(t)
+
+	run := newCheckRun("hash", nil)
+	require.Equal(checkConclusionSuccess, run.Conclusion)
+	require.Equal("No findings", run.Output.Summary)
+	require.Len(run.Output.Annotations, 0)
+}
@@ -5,6 +5,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/src-d/lookout"
@@ -80,12 +81,17 @@ func (p *ClientPool) Clients() map[*Client][]*lookout.RepositoryInfo {
 	return copyMap
 }
 
-// Client returns client, ok by username and repository name
+// Client returns client, ok by username and repository name. Unhealthy
+// clients are skipped.
 func (p *ClientPool) Client(username, repo string) (*Client, bool) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
 	c, ok := p.byRepo[username+"/"+repo]
+	if ok && !c.Healthy() {
+		return nil, false
+	}
+
 	return c, ok
 }
 
@@ -220,12 +226,49 @@ type Client struct {
 	cache            *cache.ValidableCache
 	limitRT          *limitRoundTripper
 	watchMinInterval time.Duration
+	// installationID is the GitHub App installation the client belongs to,
+	// it is 0 for clients not created from an installation
+	installationID int64
+	// tokens is the source of the installation tokens, nil for clients not
+	// created from an installation
+	tokens tokenSource
+	// userToken is true for the installation clients authenticated with a
+	// user-to-server token instead of the installation token
+	userToken bool
+	// unhealthy is 1 when the last attempt to get the installation token
+	// failed, the client is skipped by the pool and the watcher then
+	unhealthy int32
+	// tokenErrors is the number of failed attempts to get the installation
+	// token
+	tokenErrors int64
+}
+
+// Healthy returns false if the client can't get its installation token, e.g.
+// because the installation was suspended or the private key revoked
+func (c *Client) Healthy() bool {
+	return atomic.LoadInt32(&c.unhealthy) == 0
+}
+
+// TokenErrors returns the number of failed attempts to get the installation
+// token of the client
+func (c *Client) TokenErrors() int64 {
+	return atomic.LoadInt64(&c.tokenErrors)
+}
+
+// setHealthy sets the health of the client, it returns true if it changed
+func (c *Client) setHealthy(healthy bool) bool {
+	var v int32 = 1
+	if healthy {
+		v = 0
+	}
+
+	return atomic.SwapInt32(&c.unhealthy, v) != v
 }
 
 // NewClient creates new Client
 func NewClient(t http.RoundTripper, cache *cache.ValidableCache, watchMinInterval string) *Client {
 	limitRT := &limitRoundTripper{
-		Base: t,
+		Base: &durationRoundTripper{Base: t},
 	}
 
 	cachedT := httpcache.NewTransport(cache)
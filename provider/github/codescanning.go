@@ -0,0 +1,87 @@
+package github
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/sarif"
+
+	"github.com/google/go-github/github"
+)
+
+// sarifUpload is a request to upload a SARIF document to the GitHub code
+// scanning API
+type sarifUpload struct {
+	CommitSHA string `json:"commit_sha"`
+	Ref       string `json:"ref"`
+	// SARIF is the document, gzip compressed and base64 encoded
+	SARIF    string `json:"sarif"`
+	ToolName string `json:"tool_name,omitempty"`
+}
+
+const sarifToolName = "lookout"
+
+// uploadSARIF uploads the comments as a SARIF document to code scanning, for
+// the given commit and reference, so they are shown in the Security tab of
+// the repository.
+func (p *Poster) uploadSARIF(
+	ctx context.Context,
+	client *Client,
+	budget *retryBudget,
+	owner, repo string,
+	e lookout.Event,
+	head lookout.ReferencePointer,
+	aCommentsList []lookout.AnalyzerComments,
+) error {
+	encoded, err := encodeSARIF(sarif.FromComments(e, aCommentsList))
+	if err != nil {
+		return err
+	}
+
+	upload := &sarifUpload{
+		CommitSHA: head.Hash,
+		Ref:       head.ReferenceName.String(),
+		SARIF:     encoded,
+		ToolName:  sarifToolName,
+	}
+
+	return budget.doCreate(ctx, "upload sarif", func() error {
+		ctx, cancel := withTimeout(ctx, p.postTimeout)
+		defer cancel()
+
+		req, err := client.NewRequest("POST",
+			fmt.Sprintf("repos/%s/%s/code-scanning/sarifs", owner, repo), upload)
+		if err != nil {
+			return err
+		}
+
+		// the upload is processed asynchronously, GitHub answers 202
+		resp, err := client.Do(ctx, req, nil)
+		if _, ok := err.(*github.AcceptedError); ok || err == nil {
+			return nil
+		}
+
+		return p.handleAPIError(resp, err)
+	})
+}
+
+// encodeSARIF returns the document compressed with gzip and base64 encoded,
+// as expected by the code scanning API
+func encodeSARIF(log *sarif.Log) (string, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(w).Encode(log); err != nil {
+		return "", err
+	}
+
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
@@ -0,0 +1,87 @@
+package github
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+
+	"github.com/src-d/lookout/sarif"
+
+	"github.com/google/go-github/github"
+)
+
+func decodeSARIF(encoded string) (*sarif.Log, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var log sarif.Log
+	if err := json.NewDecoder(r).Decode(&log); err != nil {
+		return nil, err
+	}
+
+	return &log, nil
+}
+
+func (s *PosterTestSuite) TestPostUploadSARIF() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	var upload sarifUpload
+	s.mux.HandleFunc("/repos/foo/bar/code-scanning/sarifs", func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("POST", r.Method)
+		s.NoError(json.NewDecoder(r.Body).Decode(&upload))
+
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"id":"47177e22-5596-11eb-80a1-c1e54ef945c6"}`))
+	})
+
+	reviewsCalled := false
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		reviewsCalled = true
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{UploadSARIF: true}}
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.NoError(err)
+
+	// the comments are still posted as a review
+	s.True(reviewsCalled)
+
+	s.Equal(hash2, upload.CommitSHA)
+	s.Equal("refs/pull/42/head", upload.Ref)
+	s.Equal("lookout", upload.ToolName)
+
+	log, err := decodeSARIF(upload.SARIF)
+	s.Require().NoError(err)
+	s.Equal(sarif.Version, log.Version)
+	s.Require().Len(log.Runs, 1)
+	s.Equal("mock", log.Runs[0].Tool.Driver.Name)
+	s.Len(log.Runs[0].Results, len(mockComments))
+	s.Equal(hash2, log.Runs[0].VersionControlProvenance[0].RevisionID)
+}
+
+func (s *PosterTestSuite) TestPostUploadSARIFForbidden() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	s.mux.HandleFunc("/repos/foo/bar/code-scanning/sarifs", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message":"Resource not accessible by integration"}`))
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{UploadSARIF: true}}
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.True(ErrGitHubAPI.Is(err))
+}
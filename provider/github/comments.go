@@ -0,0 +1,228 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/src-d/lookout/util/ctxlog"
+
+	"github.com/google/go-github/github"
+)
+
+// maxPerPage is the max page size allowed by the GitHub API
+const maxPerPage = 100
+
+// pageSize returns the page size of the listings for the configured one, n,
+// capped to maxPerPage. If n is 0 or negative, maxPerPage is used.
+func pageSize(n int) int {
+	if n <= 0 || n > maxPerPage {
+		return maxPerPage
+	}
+
+	return n
+}
+
+// listReviewComments returns all the review comments of a pull request,
+// following the pagination. If since is not zero, only the comments updated
+// at or after it are requested. Each page has up to perPage comments.
+// If a GitHub API request fails, ErrGitHubAPI is returned.
+func listReviewComments(
+	ctx context.Context,
+	client *Client,
+	owner, repo string,
+	pr int,
+	since time.Time,
+	perPage int,
+) ([]*github.PullRequestComment, error) {
+	opts := &github.PullRequestListCommentsOptions{
+		Since:       since,
+		ListOptions: github.ListOptions{PerPage: perPage},
+	}
+
+	var result []*github.PullRequestComment
+	for {
+		comments, resp, err := client.PullRequests.ListComments(ctx, owner, repo, pr, opts)
+		if err != nil {
+			return nil, ErrGitHubAPI.Wrap(err)
+		}
+
+		result = append(result, comments...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+
+		opts.Page = resp.NextPage
+	}
+
+	return result, nil
+}
+
+// sinceMargin is subtracted from the time of the previous listing of the
+// review comments, to not miss the ones updated meanwhile because of a clock
+// skew with GitHub. The comments listed twice are merged by their ID
+const sinceMargin = time.Minute
+
+// cachedReviewComments are the review comments of a pull request, and the
+// time they were listed
+type cachedReviewComments struct {
+	Listed   time.Time                    `json:"listed"`
+	Comments []*github.PullRequestComment `json:"comments"`
+}
+
+// reviewCommentsCache stores the review comments listed for each pull
+// request, see ProviderConfig.ReviewCommentsCacheDir
+type reviewCommentsCache interface {
+	get(ctx context.Context, owner, repo string, pr int) (cachedReviewComments, bool, error)
+	put(ctx context.Context, owner, repo string, pr int, c cachedReviewComments) error
+}
+
+// fileReviewCommentsCache is a reviewCommentsCache saving the comments of
+// each pull request as a JSON file in a directory
+type fileReviewCommentsCache struct {
+	dir string
+}
+
+var _ reviewCommentsCache = &fileReviewCommentsCache{}
+
+func (c *fileReviewCommentsCache) path(owner, repo string, pr int) string {
+	return filepath.Join(c.dir, fmt.Sprintf("%s_%s_%d.json", owner, repo, pr))
+}
+
+func (c *fileReviewCommentsCache) get(
+	ctx context.Context,
+	owner, repo string,
+	pr int,
+) (cachedReviewComments, bool, error) {
+	b, err := ioutil.ReadFile(c.path(owner, repo, pr))
+	if os.IsNotExist(err) {
+		return cachedReviewComments{}, false, nil
+	}
+	if err != nil {
+		return cachedReviewComments{}, false, err
+	}
+
+	var cached cachedReviewComments
+	if err := json.Unmarshal(b, &cached); err != nil {
+		return cachedReviewComments{}, false, err
+	}
+
+	return cached, true, nil
+}
+
+func (c *fileReviewCommentsCache) put(
+	ctx context.Context,
+	owner, repo string,
+	pr int,
+	cached cachedReviewComments,
+) error {
+	b, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(c.path(owner, repo, pr), b, 0644)
+}
+
+// getReviewCommentsCache returns the reviewCommentsCache of
+// ReviewCommentsCacheDir, or nil if it's not set
+func (p *Poster) getReviewCommentsCache() reviewCommentsCache {
+	if p.commentsCache == nil && p.conf.ReviewCommentsCacheDir != "" {
+		p.commentsCache = &fileReviewCommentsCache{dir: p.conf.ReviewCommentsCacheDir}
+	}
+
+	return p.commentsCache
+}
+
+// reviewComments returns the review comments of a pull request. With a
+// reviewCommentsCache, only the comments updated since the previous run are
+// requested, and merged by ID into the cached ones. The comments deleted
+// since are kept until a full listing, e.g. after removing the cached file.
+func (p *Poster) reviewComments(
+	ctx context.Context,
+	client *Client,
+	budget *retryBudget,
+	owner, repo string,
+	pr int,
+) ([]*github.PullRequestComment, error) {
+	cache := p.getReviewCommentsCache()
+
+	var cached cachedReviewComments
+	if cache != nil {
+		var err error
+		cached, _, err = cache.get(ctx, owner, repo, pr)
+		if err != nil {
+			ctxlog.Get(ctx).Errorf(err, "can't read the cached review comments")
+			cached = cachedReviewComments{}
+		}
+	}
+
+	var since time.Time
+	if !cached.Listed.IsZero() {
+		since = cached.Listed.Add(-sinceMargin)
+	}
+
+	listed := p.clock()
+	var comments []*github.PullRequestComment
+	err := budget.do(ctx, "list review comments", func() error {
+		var err error
+		comments, err = listReviewComments(ctx, client, owner, repo, pr, since, p.perPage())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if cache == nil {
+		return comments, nil
+	}
+
+	comments = mergeReviewComments(cached.Comments, comments)
+	err = cache.put(ctx, owner, repo, pr, cachedReviewComments{
+		Listed:   listed,
+		Comments: comments,
+	})
+	if err != nil {
+		ctxlog.Get(ctx).Errorf(err, "can't cache the review comments")
+	}
+
+	return comments, nil
+}
+
+// mergeReviewComments returns the cached comments with the updated ones,
+// replacing the cached comments with the same ID
+func mergeReviewComments(
+	cached, updated []*github.PullRequestComment,
+) []*github.PullRequestComment {
+	if len(cached) == 0 {
+		return updated
+	}
+
+	index := make(map[int64]int, len(cached))
+	result := make([]*github.PullRequestComment, len(cached))
+	for i, c := range cached {
+		index[c.GetID()] = i
+		result[i] = c
+	}
+
+	for _, c := range updated {
+		if i, ok := index[c.GetID()]; ok {
+			result[i] = c
+			continue
+		}
+
+		index[c.GetID()] = len(result)
+		result = append(result, c)
+	}
+
+	return result
+}
@@ -0,0 +1,204 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/src-d/lookout/util/cache"
+
+	"github.com/google/go-github/github"
+	"github.com/gregjones/httpcache"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type CommentsTestSuite struct {
+	suite.Suite
+	mux    *http.ServeMux
+	server *httptest.Server
+	pool   *ClientPool
+
+	comments []*github.PullRequestComment
+	pages    int
+}
+
+func (s *CommentsTestSuite) SetupTest() {
+	s.mux = http.NewServeMux()
+	s.server = httptest.NewServer(s.mux)
+
+	cache := cache.NewValidableCache(httpcache.NewMemoryCache())
+	githubURL, _ := url.Parse(s.server.URL + "/")
+
+	repoURLs := []string{"github.com/foo/bar"}
+	s.pool = newTestPool(s.Suite, repoURLs, githubURL, cache)
+
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.comments = nil
+	for i := 0; i < 5; i++ {
+		updatedAt := start.Add(time.Duration(i) * time.Hour)
+		s.comments = append(s.comments, &github.PullRequestComment{
+			ID:        int64ptr(int64(i)),
+			UpdatedAt: &updatedAt,
+		})
+	}
+
+	s.pages = 0
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/comments", func(w http.ResponseWriter, r *http.Request) {
+		s.pages++
+
+		var filtered []*github.PullRequestComment
+		since, _ := time.Parse(time.RFC3339, r.URL.Query().Get("since"))
+		for _, c := range s.comments {
+			if !c.UpdatedAt.Before(since) {
+				filtered = append(filtered, c)
+			}
+		}
+
+		perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+
+		from := (page - 1) * perPage
+		to := from + perPage
+		if to < len(filtered) {
+			next := *r.URL
+			q := next.Query()
+			q.Set("page", strconv.Itoa(page+1))
+			next.RawQuery = q.Encode()
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s>; rel="next"`, s.server.URL, next.String()))
+		} else {
+			to = len(filtered)
+		}
+
+		json.NewEncoder(w).Encode(filtered[from:to])
+	})
+}
+
+func (s *CommentsTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *CommentsTestSuite) TestListReviewComments() {
+	client, _ := s.pool.Client("foo", "bar")
+	comments, err := listReviewComments(context.Background(), client, "foo", "bar", 42, time.Time{}, 2)
+	s.NoError(err)
+	s.Len(comments, 5)
+	s.Equal(3, s.pages)
+}
+
+func (s *CommentsTestSuite) TestListReviewCommentsSince() {
+	client, _ := s.pool.Client("foo", "bar")
+	since := *s.comments[3].UpdatedAt
+	comments, err := listReviewComments(context.Background(), client, "foo", "bar", 42, since, 2)
+	s.NoError(err)
+	s.Len(comments, 2)
+	s.Equal(int64(3), comments[0].GetID())
+	s.Equal(int64(4), comments[1].GetID())
+	s.Equal(1, s.pages)
+}
+
+func (s *CommentsTestSuite) TestReviewCommentsCached() {
+	require := s.Require()
+
+	dir, err := ioutil.TempDir("", "lookout-review-comments")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	p, err := NewPoster(s.pool, ProviderConfig{
+		PerPage:                2,
+		ReviewCommentsCacheDir: dir,
+	})
+	require.NoError(err)
+
+	// the previous run was after the 4th comment was updated
+	now := s.comments[3].UpdatedAt.Add(30 * time.Minute)
+	p.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	client, _ := s.pool.Client("foo", "bar")
+	comments, err := p.reviewComments(ctx, client, p.newRetryBudget(0), "foo", "bar", 42)
+	require.NoError(err)
+	require.Len(comments, 5)
+	require.Equal(3, s.pages)
+
+	updatedAt := now.Add(time.Hour)
+	s.comments[1].Body = strptr("edited")
+	s.comments[1].UpdatedAt = &updatedAt
+
+	s.pages = 0
+	comments, err = p.reviewComments(ctx, client, p.newRetryBudget(0), "foo", "bar", 42)
+	require.NoError(err)
+	require.Len(comments, 5)
+	require.Equal(1, s.pages)
+	require.Equal(int64(1), comments[1].GetID())
+	require.Equal("edited", comments[1].GetBody())
+}
+
+func (s *CommentsTestSuite) TestReviewCommentsNoCache() {
+	require := s.Require()
+
+	p, err := NewPoster(s.pool, ProviderConfig{PerPage: 2})
+	require.NoError(err)
+
+	ctx := context.Background()
+	client, _ := s.pool.Client("foo", "bar")
+	for i := 0; i < 2; i++ {
+		comments, err := p.reviewComments(ctx, client, p.newRetryBudget(0), "foo", "bar", 42)
+		require.NoError(err)
+		require.Len(comments, 5)
+	}
+
+	require.Equal(6, s.pages)
+}
+
+func TestMergeReviewComments(t *testing.T) {
+	require := require.New(t)
+
+	cached := []*github.PullRequestComment{
+		{ID: int64ptr(1), Body: strptr("a")},
+		{ID: int64ptr(2), Body: strptr("b")},
+	}
+	updated := []*github.PullRequestComment{
+		{ID: int64ptr(2), Body: strptr("b2")},
+		{ID: int64ptr(3), Body: strptr("c")},
+	}
+
+	merged := mergeReviewComments(cached, updated)
+	require.Len(merged, 3)
+	require.Equal("a", merged[0].GetBody())
+	require.Equal("b2", merged[1].GetBody())
+	require.Equal("c", merged[2].GetBody())
+}
+
+func (s *CommentsTestSuite) TestListReviewCommentsHttpError() {
+	s.mux.HandleFunc("/repos/foo/bar/pulls/43/comments", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	client, _ := s.pool.Client("foo", "bar")
+	_, err := listReviewComments(context.Background(), client, "foo", "bar", 43, time.Time{}, maxPerPage)
+	s.True(ErrGitHubAPI.Is(err))
+}
+
+func TestPageSize(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal(maxPerPage, pageSize(0))
+	require.Equal(30, pageSize(30))
+	require.Equal(maxPerPage, pageSize(1000))
+}
+
+func TestCommentsTestSuite(t *testing.T) {
+	suite.Run(t, new(CommentsTestSuite))
+}
@@ -0,0 +1,91 @@
+package github
+
+import (
+	"context"
+	"sync"
+)
+
+// installationLimiter limits the number of concurrent operations performed
+// with the client of each installation, so a flood of events for one
+// installation can't starve the others.
+type installationLimiter struct {
+	defaultLimit int
+	overrides    map[int64]int
+
+	mutex sync.Mutex
+	sems  map[limiterKey]chan struct{}
+}
+
+// limiterKey identifies the semaphore of a client. The clients of the
+// installations are replaced when their tokens are renewed, so they are
+// identified by their installation, and the clients not authenticated as
+// an installation, created once, by the client itself.
+type limiterKey struct {
+	installationID int64
+	client         *Client
+}
+
+func newLimiterKey(c *Client) limiterKey {
+	if c.installationID != 0 {
+		return limiterKey{installationID: c.installationID}
+	}
+
+	return limiterKey{client: c}
+}
+
+func newInstallationLimiter(defaultLimit int, overrides map[int64]int) *installationLimiter {
+	return &installationLimiter{
+		defaultLimit: defaultLimit,
+		overrides:    overrides,
+		sems:         make(map[limiterKey]chan struct{}),
+	}
+}
+
+func (l *installationLimiter) limit(c *Client) int {
+	if limit, ok := l.overrides[c.installationID]; ok {
+		return limit
+	}
+
+	return l.defaultLimit
+}
+
+func (l *installationLimiter) semaphore(c *Client) chan struct{} {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	key := newLimiterKey(c)
+	sem, ok := l.sems[key]
+	if !ok {
+		limit := l.limit(c)
+		if limit <= 0 {
+			return nil
+		}
+
+		sem = make(chan struct{}, limit)
+		l.sems[key] = sem
+	}
+
+	return sem
+}
+
+// acquire blocks until there is a free slot for the given client, or the
+// context is done. The returned function must be called to release the slot.
+// A nil limiter, or a limit lower than 1, doesn't limit anything.
+func (l *installationLimiter) acquire(ctx context.Context, c *Client) (func(), error) {
+	noop := func() {}
+	if l == nil {
+		return noop, nil
+	}
+
+	sem := l.semaphore(c)
+	if sem == nil {
+		return noop, nil
+	}
+
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return noop, ctx.Err()
+	}
+}
@@ -0,0 +1,102 @@
+package github
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstallationLimiter(t *testing.T) {
+	require := require.New(t)
+
+	clientA := &Client{installationID: 1}
+	clientB := &Client{installationID: 2}
+
+	l := newInstallationLimiter(1, nil)
+
+	releaseA, err := l.acquire(context.Background(), clientA)
+	require.NoError(err)
+
+	// A is at its limit, B must not be blocked by it
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	releaseB, err := l.acquire(ctx, clientB)
+	require.NoError(err)
+	releaseB()
+
+	_, err = l.acquire(ctx, clientA)
+	require.Equal(context.DeadlineExceeded, err)
+
+	releaseA()
+
+	releaseA, err = l.acquire(context.Background(), clientA)
+	require.NoError(err)
+	releaseA()
+}
+
+func TestInstallationLimiterOverride(t *testing.T) {
+	require := require.New(t)
+
+	clientA := &Client{installationID: 1}
+	clientB := &Client{installationID: 2}
+
+	l := newInstallationLimiter(1, map[int64]int{2: 2})
+
+	_, err := l.acquire(context.Background(), clientA)
+	require.NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = l.acquire(ctx, clientA)
+	require.Equal(context.DeadlineExceeded, err)
+
+	_, err = l.acquire(context.Background(), clientB)
+	require.NoError(err)
+	_, err = l.acquire(context.Background(), clientB)
+	require.NoError(err)
+}
+
+func TestInstallationLimiterRenewedClient(t *testing.T) {
+	require := require.New(t)
+
+	l := newInstallationLimiter(1, nil)
+
+	_, err := l.acquire(context.Background(), &Client{installationID: 1})
+	require.NoError(err)
+
+	// the client of the same installation, renewed, shares the limit
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = l.acquire(ctx, &Client{installationID: 1})
+	require.Equal(context.DeadlineExceeded, err)
+	require.Len(l.sems, 1)
+
+	// the clients not authenticated as an installation have their own
+	_, err = l.acquire(context.Background(), &Client{})
+	require.NoError(err)
+	_, err = l.acquire(context.Background(), &Client{})
+	require.NoError(err)
+	require.Len(l.sems, 3)
+}
+
+func TestInstallationLimiterUnlimited(t *testing.T) {
+	require := require.New(t)
+
+	client := &Client{installationID: 1}
+
+	var l *installationLimiter
+	release, err := l.acquire(context.Background(), client)
+	require.NoError(err)
+	release()
+
+	l = newInstallationLimiter(0, nil)
+	for i := 0; i < 10; i++ {
+		_, err := l.acquire(context.Background(), client)
+		require.NoError(err)
+	}
+}
@@ -0,0 +1,73 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/src-d/lookout"
+)
+
+const (
+	// orgConfigRepository is the repository of an organization holding its
+	// default configuration
+	orgConfigRepository = ".github"
+	orgConfigPath       = ".lookout.yml"
+)
+
+// OrgConfigGetter retrieves the organization-wide .lookout.yml, stored in the
+// .github repository of the organization.
+type OrgConfigGetter struct {
+	pool *ClientPool
+}
+
+var _ lookout.OrgConfigGetter = &OrgConfigGetter{}
+
+// NewOrgConfigGetter creates a new OrgConfigGetter for the GitHub API.
+func NewOrgConfigGetter(pool *ClientPool) *OrgConfigGetter {
+	return &OrgConfigGetter{pool: pool}
+}
+
+// OrgConfig returns the contents of the .lookout.yml in the .github repository
+// of the owner of the event repository, or nil if it doesn't exist.
+// If a GitHub API request fails, ErrGitHubAPI is returned.
+func (g *OrgConfigGetter) OrgConfig(ctx context.Context, e lookout.Event) ([]byte, error) {
+	base := e.Revision().Base
+	owner, err := extractOwner(base)
+	if err != nil {
+		return nil, ErrEventNotSupported.Wrap(err)
+	}
+
+	repo, err := extractRepo(base)
+	if err != nil {
+		return nil, ErrEventNotSupported.Wrap(err)
+	}
+
+	// the .github repository may not be part of the installation, so the
+	// client of the event repository is used
+	client, ok := g.pool.Client(owner, repo)
+	if !ok {
+		return nil, fmt.Errorf("client for %s/%s doesn't exists", owner, repo)
+	}
+
+	file, _, resp, err := client.Repositories.GetContents(
+		ctx, owner, orgConfigRepository, orgConfigPath, nil)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, ErrGitHubAPI.Wrap(err)
+	}
+
+	if file == nil {
+		return nil, nil
+	}
+
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, ErrGitHubAPI.Wrap(err)
+	}
+
+	return []byte(content), nil
+}
@@ -0,0 +1,81 @@
+package github
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/src-d/lookout/util/cache"
+
+	"github.com/google/go-github/github"
+	"github.com/gregjones/httpcache"
+	"github.com/stretchr/testify/suite"
+)
+
+type OrgConfigTestSuite struct {
+	suite.Suite
+	mux    *http.ServeMux
+	server *httptest.Server
+	pool   *ClientPool
+}
+
+func (s *OrgConfigTestSuite) SetupTest() {
+	s.mux = http.NewServeMux()
+	s.server = httptest.NewServer(s.mux)
+
+	cache := cache.NewValidableCache(httpcache.NewMemoryCache())
+	githubURL, _ := url.Parse(s.server.URL + "/")
+
+	repoURLs := []string{"github.com/foo/bar"}
+	s.pool = newTestPool(s.Suite, repoURLs, githubURL, cache)
+}
+
+func (s *OrgConfigTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *OrgConfigTestSuite) TestOrgConfig() {
+	content := "analyzers:\n - name: mock\n"
+
+	s.mux.HandleFunc("/repos/foo/.github/contents/.lookout.yml", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.RepositoryContent{
+			Type:     strptr("file"),
+			Encoding: strptr("base64"),
+			Content:  strptr(base64.StdEncoding.EncodeToString([]byte(content))),
+		})
+	})
+
+	g := NewOrgConfigGetter(s.pool)
+	b, err := g.OrgConfig(context.Background(), mockEvent)
+	s.NoError(err)
+	s.Equal(content, string(b))
+}
+
+func (s *OrgConfigTestSuite) TestOrgConfigNotFound() {
+	s.mux.HandleFunc("/repos/foo/.github/contents/.lookout.yml", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	g := NewOrgConfigGetter(s.pool)
+	b, err := g.OrgConfig(context.Background(), mockEvent)
+	s.NoError(err)
+	s.Nil(b)
+}
+
+func (s *OrgConfigTestSuite) TestOrgConfigHttpError() {
+	s.mux.HandleFunc("/repos/foo/.github/contents/.lookout.yml", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	g := NewOrgConfigGetter(s.pool)
+	_, err := g.OrgConfig(context.Background(), mockEvent)
+	s.True(ErrGitHubAPI.Is(err))
+}
+
+func TestOrgConfigTestSuite(t *testing.T) {
+	suite.Run(t, new(OrgConfigTestSuite))
+}
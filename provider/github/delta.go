@@ -0,0 +1,91 @@
+package github
+
+import (
+	"context"
+	"sync"
+
+	"github.com/src-d/lookout"
+
+	"github.com/google/go-github/github"
+)
+
+// lastHeads records the last head commit posted for each pull request, to
+// know the changes of the latest push
+type lastHeads struct {
+	mu    sync.Mutex
+	heads map[string]string
+}
+
+// get returns the last head of the pull request, or an empty string if it
+// wasn't posted yet
+func (h *lastHeads) get(pr string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.heads[pr]
+}
+
+// set records hash as the last head of the pull request
+func (h *lastHeads) set(pr, hash string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.heads == nil {
+		h.heads = make(map[string]string)
+	}
+
+	h.heads[pr] = hash
+}
+
+// latestPushFiles returns the files changed between the previous head and the
+// new one, or nil if all the files must be posted, because there is no
+// previous head
+func (p *Poster) latestPushFiles(
+	ctx context.Context,
+	client *Client,
+	budget *retryBudget,
+	owner, repo, prev, head string,
+) (map[string]bool, error) {
+	if prev == "" || prev == head {
+		return nil, nil
+	}
+
+	var cc *github.CommitsComparison
+	err := budget.do(ctx, "compare latest push", func() error {
+		ctx, cancel := withTimeout(ctx, p.compareTimeout)
+		defer cancel()
+
+		var resp *github.Response
+		var err error
+		cc, resp, err = client.Repositories.CompareCommits(ctx, owner, repo, prev, head)
+		return p.handleAPIError(resp, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]bool, len(cc.Files))
+	for _, f := range cc.Files {
+		files[f.GetFilename()] = true
+	}
+
+	return files, nil
+}
+
+// filterFiles returns the comments on the given files, and the global ones
+func filterFiles(
+	aCommentsList []lookout.AnalyzerComments,
+	files map[string]bool,
+) []lookout.AnalyzerComments {
+	result := make([]lookout.AnalyzerComments, len(aCommentsList))
+	for i, aComments := range aCommentsList {
+		result[i] = lookout.AnalyzerComments{Config: aComments.Config}
+		for _, c := range aComments.Comments {
+			if c.File == "" || files[c.File] {
+				result[i].Comments = append(result[i].Comments, c)
+			}
+		}
+	}
+
+	return result
+}
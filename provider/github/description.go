@@ -0,0 +1,162 @@
+package github
+
+import (
+	"context"
+	"strings"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/util/ctxlog"
+
+	"github.com/google/go-github/github"
+)
+
+const (
+	// DescriptionCommentsReview posts the comments on the pull request
+	// description in their own section of the review body
+	DescriptionCommentsReview = "review"
+	// DescriptionCommentsEdit appends the comments on the pull request
+	// description to the description itself, updated on each analysis
+	DescriptionCommentsEdit = "edit"
+)
+
+const (
+	descriptionHeader      = "**About the pull request description**"
+	descriptionBlockStart  = "<!-- lookout-description -->"
+	descriptionBlockEnd    = "<!-- /lookout-description -->"
+	descriptionBlockHeader = "**lookout** notes on this description:"
+)
+
+// descriptionNote is a rendered comment on the pull request description
+type descriptionNote struct {
+	analyzer string
+	comment  *lookout.Comment
+	text     string
+}
+
+// splitDescriptionComments returns the list without the comments targeting
+// the pull request description, and those comments rendered
+func (p *Poster) splitDescriptionComments(
+	ctx context.Context,
+	aCommentsList []lookout.AnalyzerComments,
+) ([]lookout.AnalyzerComments, []descriptionNote) {
+	renderer := p.getRenderer()
+
+	var notes []descriptionNote
+	result := make([]lookout.AnalyzerComments, 0, len(aCommentsList))
+	for _, aComments := range aCommentsList {
+		var comments []*lookout.Comment
+		for _, c := range aComments.Comments {
+			if !c.TargetDescription {
+				comments = append(comments, c)
+				continue
+			}
+
+			rc := &RenderContext{Analyzer: aComments.Config, Comment: c}
+			notes = append(notes, descriptionNote{
+				analyzer: aComments.Config.Name,
+				comment:  c,
+				text:     renderer.Render(ctx, rc),
+			})
+		}
+
+		result = append(result, lookout.AnalyzerComments{
+			Config:   aComments.Config,
+			Comments: comments,
+		})
+	}
+
+	return result, notes
+}
+
+// descriptionSection returns the section of the review body with the
+// comments on the pull request description
+func descriptionSection(notes []string) string {
+	return descriptionHeader + "\n\n" + strings.Join(notes, "\n\n")
+}
+
+// withDescriptionBlock returns the description of the pull request with the
+// block of notes replacing the one of the previous analysis, if any, or
+// appended at its end. With no notes the previous block is removed.
+func withDescriptionBlock(description string, notes []descriptionNote) string {
+	if start := strings.Index(description, descriptionBlockStart); start >= 0 {
+		end := strings.Index(description[start:], descriptionBlockEnd)
+		if end >= 0 {
+			end += start + len(descriptionBlockEnd)
+			description = description[:start] + description[end:]
+		}
+	}
+
+	description = strings.TrimRight(description, "\n")
+	if len(notes) == 0 {
+		return description
+	}
+
+	lines := []string{descriptionBlockStart, descriptionBlockHeader, ""}
+	for _, n := range notes {
+		text := strings.Replace(strings.TrimSpace(n.text), "\n", "\n  ", -1)
+		lines = append(lines, "- "+text)
+	}
+	lines = append(lines, descriptionBlockEnd)
+
+	block := strings.Join(lines, "\n")
+	if description == "" {
+		return block
+	}
+
+	return description + "\n\n" + block
+}
+
+// updateDescription keeps the block of notes of the pull request
+// description up to date, editing the description only if it changes.
+// Errors are only logged, the rest of the comments are posted anyway.
+func (p *Poster) updateDescription(
+	ctx context.Context,
+	client *Client,
+	budget *retryBudget,
+	owner, repo string,
+	pr int,
+	notes []descriptionNote,
+) {
+	results := getResults(ctx)
+	dropAll := func(err error) {
+		ctxlog.Get(ctx).Errorf(err, "can't update the pull request description")
+		for _, n := range notes {
+			results.dropped(n.analyzer, n.comment, reasonNoDescription)
+		}
+	}
+
+	var pull *github.PullRequest
+	err := budget.do(ctx, "get pull request", func() error {
+		ctx, cancel := withTimeout(ctx, RequestTimeout)
+		defer cancel()
+
+		var resp *github.Response
+		var err error
+		pull, resp, err = client.PullRequests.Get(ctx, owner, repo, pr)
+		return p.handleAPIError(resp, err)
+	})
+	if err != nil {
+		dropAll(err)
+		return
+	}
+
+	body := withDescriptionBlock(pull.GetBody(), notes)
+	if body != strings.TrimRight(pull.GetBody(), "\n") {
+		err = budget.do(ctx, "edit pull request", func() error {
+			ctx, cancel := withTimeout(ctx, p.postTimeout)
+			defer cancel()
+
+			_, resp, err := client.PullRequests.Edit(ctx, owner, repo, pr,
+				&github.PullRequest{Body: &body})
+			return p.handleAPIError(resp, err)
+		})
+		if err != nil {
+			dropAll(err)
+			return
+		}
+	}
+
+	for _, n := range notes {
+		results.posted(n.analyzer, n.comment)
+	}
+}
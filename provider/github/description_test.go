@@ -0,0 +1,146 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/src-d/lookout"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithDescriptionBlock(t *testing.T) {
+	require := require.New(t)
+
+	notes := []descriptionNote{
+		{text: "Missing changelog entry"},
+		{text: "Missing issue reference\n\nSee the guidelines"},
+	}
+
+	block := descriptionBlockStart + "\n" +
+		descriptionBlockHeader + "\n" +
+		"\n" +
+		"- Missing changelog entry\n" +
+		"- Missing issue reference\n  \n  See the guidelines\n" +
+		descriptionBlockEnd
+
+	require.Equal(block, withDescriptionBlock("", notes))
+	require.Equal("Fixes things\n\n"+block, withDescriptionBlock("Fixes things\n", notes))
+
+	// the block of the previous analysis is replaced
+	previous := "Fixes things\n\n" + descriptionBlockStart + "\nold notes\n" + descriptionBlockEnd
+	require.Equal("Fixes things\n\n"+block, withDescriptionBlock(previous, notes))
+
+	// and removed without notes
+	require.Equal("Fixes things", withDescriptionBlock(previous, nil))
+	require.Equal("Fixes things", withDescriptionBlock("Fixes things", nil))
+}
+
+var descriptionAnalyzerComments = []lookout.AnalyzerComments{
+	lookout.AnalyzerComments{
+		Config: lookout.AnalyzerConfig{Name: "mock"},
+		Comments: []*lookout.Comment{
+			&lookout.Comment{Text: "Global comment"},
+			&lookout.Comment{Text: "Missing changelog entry", TargetDescription: true},
+			&lookout.Comment{File: "main.go", Line: 5, Text: "Line comment"},
+		},
+	}}
+
+func (s *PosterTestSuite) TestPostDescriptionComments() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	var reviews []*github.PullRequestReviewRequest
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		reviews = append(reviews, &req)
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42", func(w http.ResponseWriter, r *http.Request) {
+		s.Failf("unexpected request", "%s %s", r.Method, r.URL)
+	})
+
+	p := &Poster{pool: s.pool}
+	err := p.Post(context.Background(), mockEvent, descriptionAnalyzerComments)
+	s.NoError(err)
+
+	s.Require().Len(reviews, 1)
+	s.Equal(descriptionHeader+"\n\n"+
+		"Missing changelog entry\n\n"+
+		"Global comment", reviews[0].GetBody())
+	s.Require().Len(reviews[0].Comments, 1)
+	s.Equal("Line comment", reviews[0].Comments[0].GetBody())
+}
+
+func (s *PosterTestSuite) TestPostDescriptionCommentsEdit() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	var reviews []*github.PullRequestReviewRequest
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		reviews = append(reviews, &req)
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	description := "Fixes things"
+	var edited []string
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			json.NewEncoder(w).Encode(&github.PullRequest{Body: &description})
+		case "PATCH":
+			var pr github.PullRequest
+			s.NoError(json.NewDecoder(r.Body).Decode(&pr))
+			description = pr.GetBody()
+			edited = append(edited, description)
+
+			json.NewEncoder(w).Encode(&pr)
+		default:
+			s.Failf("unexpected request", "%s %s", r.Method, r.URL)
+		}
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{DescriptionComments: DescriptionCommentsEdit}}
+	err := p.Post(context.Background(), mockEvent, descriptionAnalyzerComments)
+	s.NoError(err)
+
+	s.Require().Len(edited, 1)
+	s.Equal("Fixes things\n\n"+
+		descriptionBlockStart+"\n"+
+		descriptionBlockHeader+"\n\n"+
+		"- Missing changelog entry\n"+
+		descriptionBlockEnd, edited[0])
+
+	// the note is not part of the review
+	s.Require().Len(reviews, 1)
+	s.Equal("Global comment", reviews[0].GetBody())
+	s.Len(reviews[0].Comments, 1)
+
+	// the same notes don't edit the description again
+	compareCalled = false
+	err = p.Post(context.Background(), mockEvent, descriptionAnalyzerComments)
+	s.NoError(err)
+	s.Len(edited, 1)
+
+	// and without notes the block is removed
+	compareCalled = false
+	aCommentsList := []lookout.AnalyzerComments{lookout.AnalyzerComments{
+		Config:   lookout.AnalyzerConfig{Name: "mock"},
+		Comments: []*lookout.Comment{&lookout.Comment{Text: "Global comment"}},
+	}}
+	err = p.Post(context.Background(), mockEvent, aCommentsList)
+	s.NoError(err)
+	s.Require().Len(edited, 2)
+	s.Equal("Fixes things", edited[1])
+}
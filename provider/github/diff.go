@@ -56,6 +56,11 @@ type posRange struct {
 type parsedFile struct {
 	ranges     []*posRange
 	linesAdded map[int]bool
+	// headers are the positions of the hunk headers in the patch diff
+	headers map[int]bool
+	// contents of the lines in the new version of the file, by line number.
+	// It is only filled on demand, see diffLines.LineContent
+	contents map[int]string
 }
 
 func newDiffLines(cc *github.CommitsComparison) *diffLines {
@@ -81,6 +86,11 @@ func (d *diffLines) ConvertLine(file string, line int, strict bool) (int, error)
 		return 0, err
 	}
 
+	// GitHub rejects the comments on the hunk headers
+	if parsedFile.headers[diffLine] {
+		return 0, ErrLineOutOfDiff.New()
+	}
+
 	if strict {
 		if !parsedFile.linesAdded[diffLine] {
 			return 0, ErrLineNotAddition.New()
@@ -90,6 +100,60 @@ func (d *diffLines) ConvertLine(file string, line int, strict bool) (int, error)
 	return diffLine, nil
 }
 
+// ConvertBlockEnd takes a line number on the original file, and returns the
+// line number in the patch diff of the last added line of the block, of
+// contiguous + lines in the patch diff, containing it. The errors are the
+// ones of ConvertLine with strict set to true.
+func (d *diffLines) ConvertBlockEnd(file string, line int) (int, error) {
+	diffLine, err := d.ConvertLine(file, line, true)
+	if err != nil {
+		return 0, err
+	}
+
+	parsedFile, err := d.parseFile(file)
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		next, err := d.convertLine(parsedFile.ranges, line+1)
+		if err != nil || next != diffLine+1 || !parsedFile.linesAdded[next] {
+			return diffLine, nil
+		}
+
+		line, diffLine = line+1, next
+	}
+}
+
+// LineContent returns the content of the given line in the new version of
+// the file, as long as the line is part of the patch diff (changed lines plus
+// context). ErrLineOutOfDiff is returned otherwise.
+func (d *diffLines) LineContent(file string, line int) (string, error) {
+	parsedFile, err := d.parseFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	if parsedFile.contents == nil {
+		patch, err := d.filePatch(file)
+		if err != nil {
+			return "", err
+		}
+
+		parsedFile.contents, err = parseContents(patch)
+		if err != nil {
+			return "", ErrBadPatch.Wrap(err)
+		}
+	}
+
+	content, ok := parsedFile.contents[line]
+	if !ok {
+		return "", ErrLineOutOfDiff.New()
+	}
+
+	return content, nil
+}
+
 func (d *diffLines) convertLine(ranges []*posRange, line int) (int, error) {
 	for _, r := range ranges {
 		if line >= r.AbsStart && line < r.AbsEnd {
@@ -110,11 +174,33 @@ func (d *diffLines) parseFile(file string) (*parsedFile, error) {
 		return nil, err
 	}
 
+	patch, err := d.filePatch(file)
+	if err != nil {
+		return nil, err
+	}
+
 	ranges := convertRanges(hunks)
-	d.parsed[file] = &parsedFile{ranges: ranges, linesAdded: linesAdded}
+	d.parsed[file] = &parsedFile{
+		ranges:     ranges,
+		linesAdded: linesAdded,
+		headers:    hunkHeaders(patch),
+	}
 	return d.parsed[file], nil
 }
 
+// hunkHeaders returns the positions of the hunk headers in the patch diff
+func hunkHeaders(s string) map[int]bool {
+	headers := make(map[int]bool)
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for i := 0; scanner.Scan(); i++ {
+		if strings.HasPrefix(scanner.Text(), "@@") {
+			headers[i] = true
+		}
+	}
+
+	return headers
+}
+
 func (d *diffLines) filePatch(file string) (string, error) {
 	var ff *github.CommitFile
 	for _, f := range d.cc.Files {
@@ -205,6 +291,45 @@ func parseHunks(s string) ([]*hunk, map[int]bool, error) {
 	return hs, linesAdded, nil
 }
 
+// parseContents returns the lines of the new version of the file contained
+// in the patch, by line number.
+func parseContents(s string) (map[int]string, error) {
+	scanner := bufio.NewScanner(strings.NewReader(s))
+
+	contents := make(map[int]string)
+	line := 0
+	for scanner.Scan() {
+		l := scanner.Text()
+		switch true {
+		case strings.HasPrefix(l, "@@"):
+			h, err := parseHunkHeader(l)
+			if err != nil {
+				return nil, err
+			}
+			line = h.NewStartLine
+		case strings.HasPrefix(l, "-"):
+			continue
+		case strings.HasPrefix(l, "+"), strings.HasPrefix(l, " "):
+			contents[line] = l[1:]
+			line++
+		default:
+			// lines like "\ No newline at end of file" or empty context lines
+			if l != "" {
+				continue
+			}
+
+			contents[line] = l
+			line++
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return contents, nil
+}
+
 func parseHunkHeader(line string) (*hunk, error) {
 	var (
 		err error
@@ -255,13 +380,15 @@ func convertRanges(hunks []*hunk) []*posRange {
 	ranges := make([]*posRange, 0)
 	// relative position of the last range end
 	lastRelEnd := 0
+	// number of lines in diff to skip before the next range, kept across
+	// hunks so the deleted lines at the end of a hunk are not lost
+	skipLines := 0
 	for _, hunk := range hunks {
 		absStart := hunk.NewStartLine
 
-		// number of lines in diff to skip
 		// each hunk has a header line which should be skipped
 		// delete lines should be also skipped
-		skipLines := 1
+		skipLines++
 		// number of lines for the range
 		lines := 0
 
@@ -276,6 +403,7 @@ func convertRanges(hunks []*hunk) []*posRange {
 
 			absStart = r.AbsEnd
 			lastRelEnd = r.RelEnd
+			skipLines = 0
 		}
 
 		for _, chunk := range hunk.Chunks {
@@ -286,16 +414,14 @@ func convertRanges(hunks []*hunk) []*posRange {
 				if lines > 0 {
 					newRange()
 					lines = 0
-
 				}
 
-				skipLines = chunk.Lines
+				skipLines += chunk.Lines
 				continue
 			}
 		}
 		if lines > 0 {
 			newRange()
-			skipLines = 0
 		}
 	}
 
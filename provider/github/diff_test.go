@@ -478,3 +478,216 @@ func TestConvertLines_issue213(t *testing.T) {
 	_, err := dl.ConvertLine(filename, 42, false)
 	require.EqualError(err, ErrLineOutOfDiff.Message)
 }
+
+// a single hunk that interleaves additions, deletions and context lines
+var mixedPatch = `@@ -3,4 +3,6 @@
+ a
+-b
++B
++B2
+ c
+-d
++D
++E`
+
+func TestConvertLinesMixedHunk(t *testing.T) {
+	filename := "main.go"
+	patch := mixedPatch
+
+	dl := newDiffLines(&github.CommitsComparison{
+		Files: []github.CommitFile{{Filename: &filename, Patch: &patch}},
+	})
+
+	lineTestCases := []struct {
+		fileLine, diffLine int
+		strictErr          error
+	}{
+		// before the hunk
+		{2, 0, ErrLineOutOfDiff.New()},
+		// context line a
+		{3, 1, ErrLineNotAddition.New()},
+		// B and B2, after the deleted b
+		{4, 3, nil},
+		{5, 4, nil},
+		// context line c
+		{6, 5, ErrLineNotAddition.New()},
+		// D and E, after the deleted d
+		{7, 7, nil},
+		{8, 8, nil},
+		// after the hunk
+		{9, 0, ErrLineOutOfDiff.New()},
+	}
+
+	for _, tc := range lineTestCases {
+		t.Run(fmt.Sprintf("file line %v", tc.fileLine), func(t *testing.T) {
+			assert := assert.New(t)
+
+			diffLine, err := dl.ConvertLine(filename, tc.fileLine, false)
+			if tc.diffLine == 0 {
+				assert.EqualError(err, ErrLineOutOfDiff.New().Error())
+			} else {
+				assert.NoError(err)
+				assert.Equal(tc.diffLine, diffLine)
+			}
+
+			diffLine, err = dl.ConvertLine(filename, tc.fileLine, true)
+			if tc.strictErr != nil {
+				assert.Equal(0, diffLine)
+				assert.EqualError(err, tc.strictErr.Error())
+			} else {
+				assert.NoError(err)
+				assert.Equal(tc.diffLine, diffLine)
+			}
+		})
+	}
+}
+
+// deletedLinesPatch has hunks starting and ending with deleted lines, that
+// shift the positions of the next hunks
+var deletedLinesPatch = `@@ -1,2 +1,2 @@
+-a
++b
+ c
+-d
+@@ -10,2 +10,2 @@
+ e
++f
+-g`
+
+func TestConvertLinesDeletedLines(t *testing.T) {
+	require := require.New(t)
+
+	filename := "main.go"
+	patch := deletedLinesPatch
+
+	dl := newDiffLines(&github.CommitsComparison{
+		Files: []github.CommitFile{{Filename: &filename, Patch: &patch}},
+	})
+
+	expected := map[int]int{
+		// b, after the deleted a
+		1: 2,
+		// c
+		2: 3,
+		// e and f, after the deleted d and the hunk header
+		10: 6,
+		11: 7,
+	}
+	for line, diffLine := range expected {
+		converted, err := dl.ConvertLine(filename, line, false)
+		require.NoError(err, fmt.Sprintf("line %d", line))
+		require.Equal(diffLine, converted, fmt.Sprintf("line %d", line))
+	}
+
+	diffLine, err := dl.ConvertLine(filename, 11, true)
+	require.NoError(err)
+	require.Equal(7, diffLine)
+
+	_, err = dl.ConvertLine(filename, 10, true)
+	require.True(ErrLineNotAddition.Is(err))
+}
+
+func TestConvertLineHunkHeader(t *testing.T) {
+	require := require.New(t)
+
+	filename := "main.go"
+	patch := deletedLinesPatch
+
+	dl := newDiffLines(&github.CommitsComparison{
+		Files: []github.CommitFile{{Filename: &filename, Patch: &patch}},
+	})
+
+	// a naive mapping ignoring the deleted line at the end of the first
+	// hunk, that maps the line e to the header of the second hunk
+	file, err := dl.parseFile(filename)
+	require.NoError(err)
+	file.ranges = []*posRange{
+		{AbsStart: 1, AbsEnd: 3, RelStart: 2, RelEnd: 4},
+		{AbsStart: 10, AbsEnd: 12, RelStart: 5, RelEnd: 7},
+	}
+
+	_, err = dl.ConvertLine(filename, 10, false)
+	require.True(ErrLineOutOfDiff.Is(err))
+
+	_, err = dl.ConvertLine(filename, 10, true)
+	require.True(ErrLineOutOfDiff.Is(err))
+}
+
+func TestConvertBlockEnd(t *testing.T) {
+	require := require.New(t)
+
+	filename := "main.go"
+	patch := mixedPatch
+
+	dl := newDiffLines(&github.CommitsComparison{
+		Files: []github.CommitFile{{Filename: &filename, Patch: &patch}},
+	})
+
+	// B and B2 end before the context line c
+	for _, line := range []int{4, 5} {
+		diffLine, err := dl.ConvertBlockEnd(filename, line)
+		require.NoError(err)
+		require.Equal(4, diffLine)
+	}
+
+	// D and E end with the hunk
+	for _, line := range []int{7, 8} {
+		diffLine, err := dl.ConvertBlockEnd(filename, line)
+		require.NoError(err)
+		require.Equal(8, diffLine)
+	}
+
+	_, err := dl.ConvertBlockEnd(filename, 3)
+	require.True(ErrLineNotAddition.Is(err))
+
+	_, err = dl.ConvertBlockEnd(filename, 9)
+	require.True(ErrLineOutOfDiff.Is(err))
+}
+
+func TestLineContent(t *testing.T) {
+	require := require.New(t)
+
+	filename := "some_file"
+	patch := `@@ -5,4 +5,5 @@ header-line
+ context-line1
+-old-line1
++new-line1
++new-line2
+ context-line2
+
+@@ -20,2 +21,2 @@ header-line
+-old-line2
++new-line3
+ context-line3`
+
+	cc := &github.CommitsComparison{
+		Files: []github.CommitFile{
+			{
+				Filename: &filename,
+				Patch:    &patch,
+			},
+		},
+	}
+	dl := newDiffLines(cc)
+
+	expected := map[int]string{
+		5:  "context-line1",
+		6:  "new-line1",
+		7:  "new-line2",
+		8:  "context-line2",
+		9:  "",
+		21: "new-line3",
+		22: "context-line3",
+	}
+	for line, content := range expected {
+		c, err := dl.LineContent(filename, line)
+		require.NoError(err)
+		require.Equal(content, c, fmt.Sprintf("line %d", line))
+	}
+
+	_, err := dl.LineContent(filename, 15)
+	require.True(ErrLineOutOfDiff.Is(err))
+
+	_, err = dl.LineContent("other_file", 5)
+	require.True(ErrFileNotFound.Is(err))
+}
@@ -0,0 +1,39 @@
+package github
+
+import (
+	"github.com/src-d/lookout"
+)
+
+type duplicateKey struct {
+	File string
+	Line int32
+	Text string
+}
+
+// dropDuplicates drops the comments identical to a previous one of the same
+// analyzer, with the same file, line and text, if enabled. The given comments
+// are not modified.
+func dropDuplicates(enabled bool, aCommentsList []lookout.AnalyzerComments) []lookout.AnalyzerComments {
+	if !enabled {
+		return aCommentsList
+	}
+
+	result := make([]lookout.AnalyzerComments, len(aCommentsList))
+	for i, aComments := range aCommentsList {
+		result[i] = aComments
+		result[i].Comments = nil
+
+		seen := make(map[duplicateKey]bool, len(aComments.Comments))
+		for _, c := range aComments.Comments {
+			key := duplicateKey{c.File, c.Line, c.Text}
+			if seen[key] {
+				continue
+			}
+
+			seen[key] = true
+			result[i].Comments = append(result[i].Comments, c)
+		}
+	}
+
+	return result
+}
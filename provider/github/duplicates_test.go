@@ -0,0 +1,81 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/src-d/lookout"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+func duplicatedComments() []lookout.AnalyzerComments {
+	return []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "Line comment"},
+				&lookout.Comment{File: "main.go", Line: 5, Text: "Line comment"},
+				&lookout.Comment{File: "main.go", Line: 5, Text: "Other comment"},
+				&lookout.Comment{File: "main.go", Line: 6, Text: "Line comment"},
+			},
+		},
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "other"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "Line comment"},
+			},
+		},
+	}
+}
+
+func TestDropDuplicates(t *testing.T) {
+	require := require.New(t)
+
+	list := duplicatedComments()
+	require.Equal(list, dropDuplicates(false, list))
+
+	unique := dropDuplicates(true, list)
+	require.Len(unique, 2)
+	require.Equal([]*lookout.Comment{
+		list[0].Comments[0],
+		list[0].Comments[2],
+		list[0].Comments[3],
+	}, unique[0].Comments)
+	// the same comment of another analyzer is kept
+	require.Equal(list[1].Comments, unique[1].Comments)
+
+	// the given comments are not modified
+	require.Len(list[0].Comments, 4)
+}
+
+func (s *PosterTestSuite) TestPostUniqueComments() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		s.Require().Len(req.Comments, 1)
+		s.Equal("Line comment", req.Comments[0].GetBody())
+		s.Equal(3, req.Comments[0].GetPosition())
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{UniqueComments: true}}
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "Line comment"},
+				&lookout.Comment{File: "main.go", Line: 5, Text: "Line comment"},
+			},
+		}})
+	s.NoError(err)
+	s.True(compareCalled)
+}
@@ -0,0 +1,107 @@
+package github
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+var formatVerbPattern = regexp.MustCompile(`%%|%(?:\[\d+\])?[a-z]`)
+
+// footerPattern returns the regular expression matching the footer of the
+// CommentFooter format string, with any feedback URL, preceded by the
+// blank line separating it from the text
+func footerPattern(tmpl string) *regexp.Regexp {
+	var pattern strings.Builder
+	pattern.WriteString(`\n\n`)
+
+	last := 0
+	for _, m := range formatVerbPattern.FindAllStringIndex(tmpl, -1) {
+		pattern.WriteString(regexp.QuoteMeta(tmpl[last:m[0]]))
+		if tmpl[m[0]:m[1]] == "%%" {
+			pattern.WriteString("%")
+		} else {
+			pattern.WriteString(`\S*`)
+		}
+
+		last = m[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(tmpl[last:]))
+
+	return regexp.MustCompile(pattern.String())
+}
+
+// bodyNormalizer returns a function normalizing the body of the comments to
+// compare them: the footer of CommentFooter and the anchor marker are
+// removed, so a changed feedback URL or a moved line don't make the same
+// comment look different
+func (p *Poster) bodyNormalizer() func(body string) string {
+	var footer *regexp.Regexp
+	if p.conf.CommentFooter != "" {
+		footer = footerPattern(p.conf.CommentFooter)
+	}
+
+	return func(body string) string {
+		if text, _, ok := parseAnchor(body); ok {
+			body = text
+		} else if text, _, ok := parseZeroWidthAnchor(body); ok {
+			body = text
+		}
+
+		if footer != nil {
+			body = footer.ReplaceAllString(body, "")
+		}
+
+		return strings.TrimSpace(body)
+	}
+}
+
+// existingComments returns the keys, with the ProviderConfig.DedupeBy mode,
+// of the review comments already posted in the pull request. The key line is
+// the position in the diff, and the rule the one of the anchor marker, if
+// any. The outdated comments have no position and are ignored.
+func (p *Poster) existingComments(
+	ctx context.Context,
+	comments []*github.PullRequestComment,
+	normalize func(string) string,
+) map[anchoredKey]bool {
+	result := make(map[anchoredKey]bool, len(comments))
+	for _, c := range comments {
+		if c.GetPosition() == 0 {
+			continue
+		}
+
+		_, a, _ := p.parseMarker(ctx, c.GetID(), c.GetBody())
+		result[newAnchoredKey(p.conf.DedupeBy, c.GetPath(), c.GetPosition(),
+			normalize(c.GetBody()), a.Rule)] = true
+	}
+
+	return result
+}
+
+// skipExistingComments returns a copy of the review without the comments
+// already posted, with the same key as given by existingComments, and the
+// number of comments skipped
+func skipExistingComments(
+	req *github.PullRequestReviewRequest,
+	existing map[anchoredKey]bool,
+	mode string,
+	normalize func(string) string,
+) (*github.PullRequestReviewRequest, int) {
+	r := *req
+	r.Comments = nil
+	for _, c := range req.Comments {
+		_, a, _ := parseAnchor(c.GetBody())
+		key := newAnchoredKey(mode, c.GetPath(), c.GetPosition(),
+			normalize(c.GetBody()), a.Rule)
+		if existing[key] {
+			continue
+		}
+
+		r.Comments = append(r.Comments, c)
+	}
+
+	return &r, len(req.Comments) - len(r.Comments)
+}
@@ -0,0 +1,82 @@
+package github
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBodyNormalizer(t *testing.T) {
+	require := require.New(t)
+
+	a := anchor{File: "main.go", Line: 5, Hash: lineHash("foo")}
+	p := &Poster{conf: ProviderConfig{CommentFooter: "[Feedback](%s) 100%%"}}
+	normalize := p.bodyNormalizer()
+
+	require.Equal("text", normalize("text"))
+	require.Equal("text", normalize("text\n\n[Feedback](https://foo.bar) 100%"))
+	require.Equal("text\n\n[Links](https://foo.bar)",
+		normalize("text\n\n[Feedback](https://foo.bar) 100%\n\n[Links](https://foo.bar)"))
+	require.Equal("text", normalize("text\n\n[Feedback](https://foo.bar) 100%\n\n"+a.marker()))
+	require.Equal("text", normalize("text"+a.zeroWidthMarker()))
+	require.Equal("text\n\nFeedback: https://foo.bar",
+		normalize("text\n\nFeedback: https://foo.bar"))
+
+	p = &Poster{}
+	require.Equal("text\n\nFeedback: https://foo.bar",
+		p.bodyNormalizer()("text\n\nFeedback: https://foo.bar"))
+}
+
+func TestSkipExistingComments(t *testing.T) {
+	require := require.New(t)
+
+	normalize := (&Poster{}).bodyNormalizer()
+	existing := map[anchoredKey]bool{
+		newAnchoredKey(DedupeExact, "main.go", 3, "foo", ""): true,
+	}
+
+	req := &github.PullRequestReviewRequest{
+		Body: strptr("body"),
+		Comments: []*github.DraftReviewComment{
+			{Path: strptr("main.go"), Position: intptr(3), Body: strptr("foo")},
+			{Path: strptr("main.go"), Position: intptr(4), Body: strptr("foo")},
+			{Path: strptr("main.go"), Position: intptr(3), Body: strptr("bar")},
+			{Path: strptr("other.go"), Position: intptr(3), Body: strptr("foo")},
+		}}
+
+	r, skipped := skipExistingComments(req, existing, DedupeExact, normalize)
+	require.Equal(1, skipped)
+	require.Equal("body", r.GetBody())
+	require.Equal(req.Comments[1:], r.Comments)
+	require.Len(req.Comments, 4)
+}
+
+func TestSkipExistingCommentsDedupeBy(t *testing.T) {
+	require := require.New(t)
+
+	a := anchor{File: "main.go", Line: 5, Hash: lineHash("foo"), Rule: "SEC001"}
+	other := anchor{File: "main.go", Line: 5, Hash: lineHash("foo"), Rule: "SEC002"}
+	posted := []*github.PullRequestComment{
+		{Path: strptr("main.go"), Position: intptr(3), Body: strptr("old text\n\n" + a.marker())},
+	}
+	req := &github.PullRequestReviewRequest{
+		Comments: []*github.DraftReviewComment{
+			{Path: strptr("main.go"), Position: intptr(3), Body: strptr("new text\n\n" + a.marker())},
+			{Path: strptr("main.go"), Position: intptr(3), Body: strptr("new text\n\n" + other.marker())},
+		}}
+
+	for mode, expected := range map[string]int{
+		DedupeExact:        0,
+		DedupeFileLine:     2,
+		DedupeFileLineRule: 1,
+	} {
+		p := &Poster{conf: ProviderConfig{DedupeBy: mode}}
+		normalize := p.bodyNormalizer()
+		existing := p.existingComments(context.Background(), posted, normalize)
+
+		_, skipped := skipExistingComments(req, existing, mode, normalize)
+		require.Equal(expected, skipped, mode)
+	}
+}
@@ -0,0 +1,119 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/util/ctxlog"
+)
+
+// FindingsStore stores the full findings of an analysis, so they can be
+// retrieved from the target URL of the commit status, which can't hold the
+// details of each comment.
+type FindingsStore interface {
+	// Store saves the payload with the given key, and returns the URL to
+	// retrieve it.
+	Store(ctx context.Context, key string, payload []byte) (string, error)
+}
+
+// FileFindingsStore is a FindingsStore saving the findings as files in a
+// directory.
+type FileFindingsStore struct {
+	// Dir is the directory where the files are written
+	Dir string
+	// BaseURL is the URL serving Dir. If empty, file:// URLs are returned
+	BaseURL string
+}
+
+var _ FindingsStore = &FileFindingsStore{}
+
+// NewFileFindingsStore returns a new FileFindingsStore.
+func NewFileFindingsStore(dir, baseURL string) *FileFindingsStore {
+	return &FileFindingsStore{Dir: dir, BaseURL: baseURL}
+}
+
+// Store implements the FindingsStore interface. The payload is written to the
+// file key.json inside Dir, key can contain slashes.
+func (s *FileFindingsStore) Store(ctx context.Context, key string, payload []byte) (string, error) {
+	name := key + ".json"
+	path := filepath.Join(s.Dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+
+	if err := ioutil.WriteFile(path, payload, 0644); err != nil {
+		return "", err
+	}
+
+	if s.BaseURL == "" {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return "", err
+		}
+
+		return "file://" + filepath.ToSlash(abs), nil
+	}
+
+	return strings.TrimSuffix(s.BaseURL, "/") + "/" + name, nil
+}
+
+// findingsPayload is the stored document with the findings of an analysis
+type findingsPayload struct {
+	Repository string             `json:"repository"`
+	Base       string             `json:"base"`
+	Head       string             `json:"head"`
+	Analyzers  []analyzerFindings `json:"analyzers"`
+}
+
+type analyzerFindings struct {
+	Name     string             `json:"name"`
+	Comments []*lookout.Comment `json:"comments"`
+}
+
+// storeFindings stores the posted comments of the event, and returns the URL
+// to retrieve them. ok is false if there is no FindingsStore, or the comments
+// couldn't be stored.
+func (p *Poster) storeFindings(
+	ctx context.Context,
+	owner, repo string,
+	e *lookout.ReviewEvent,
+	aCommentsList []lookout.AnalyzerComments,
+) (url string, ok bool) {
+	if p.findings == nil {
+		return "", false
+	}
+
+	payload := findingsPayload{
+		Repository: owner + "/" + repo,
+		Base:       e.Base.Hash,
+		Head:       e.Head.Hash,
+		Analyzers:  make([]analyzerFindings, 0, len(aCommentsList)),
+	}
+	for _, aComments := range aCommentsList {
+		payload.Analyzers = append(payload.Analyzers, analyzerFindings{
+			Name:     aComments.Config.Name,
+			Comments: aComments.Comments,
+		})
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		ctxlog.Get(ctx).Errorf(err, "can't encode the findings")
+		return "", false
+	}
+
+	key := fmt.Sprintf("%s/%s/%s", owner, repo, e.Head.Hash)
+	url, err = p.findings.Store(ctx, key, b)
+	if err != nil {
+		ctxlog.Get(ctx).Errorf(err, "can't store the findings")
+		return "", false
+	}
+
+	return url, true
+}
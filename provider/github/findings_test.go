@@ -0,0 +1,43 @@
+package github
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileFindingsStore(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "lookout-findings")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	s := NewFileFindingsStore(dir, "")
+	url, err := s.Store(context.Background(), "foo/bar/hash", []byte("payload"))
+	require.NoError(err)
+
+	path := filepath.Join(dir, "foo", "bar", "hash.json")
+	require.Equal("file://"+filepath.ToSlash(path), url)
+
+	b, err := ioutil.ReadFile(path)
+	require.NoError(err)
+	require.Equal("payload", string(b))
+}
+
+func TestFileFindingsStoreBaseURL(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "lookout-findings")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	s := NewFileFindingsStore(dir, "https://example.com/findings")
+	url, err := s.Store(context.Background(), "foo/bar/hash", []byte("payload"))
+	require.NoError(err)
+	require.Equal("https://example.com/findings/foo/bar/hash.json", url)
+}
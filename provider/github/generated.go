@@ -0,0 +1,99 @@
+package github
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"regexp"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/util/ctxlog"
+
+	log "gopkg.in/src-d/go-log.v1"
+)
+
+// generatedPattern matches the header of generated files, e.g.
+// "// Code generated by protoc-gen-go. DO NOT EDIT."
+var generatedPattern = regexp.MustCompile(`^\s*(//|#|--|/\*|\*)\s*Code generated .*DO NOT EDIT\.?`)
+
+// generatedHeaderLines is the number of lines at the beginning of the files
+// where the generated header is looked for
+const generatedHeaderLines = 20
+
+// isGenerated returns true if the content has the header of generated files
+// in its first lines
+func isGenerated(content []byte) bool {
+	lines := bufio.NewScanner(bytes.NewReader(content))
+	for i := 0; i < generatedHeaderLines && lines.Scan(); i++ {
+		if generatedPattern.Match(lines.Bytes()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filterGenerated drops the comments on generated files, or downgrades them
+// to GeneratedFilesMaxSeverity if it's set, when SkipGeneratedFiles is
+// enabled. The files are retrieved in the given revision using the data
+// service. The comments on the files that can't be retrieved are kept. The
+// given comments are not modified.
+func (p *Poster) filterGenerated(
+	ctx context.Context,
+	rev *lookout.ReferencePointer,
+	aCommentsList []lookout.AnalyzerComments,
+) []lookout.AnalyzerComments {
+	if !p.conf.SkipGeneratedFiles || p.fileGetter == nil {
+		return aCommentsList
+	}
+
+	max, err := parseSeverity(p.conf.GeneratedFilesMaxSeverity)
+	if err != nil {
+		ctxlog.Get(ctx).Errorf(err, "can't filter the comments on generated files, posting anyway")
+		return aCommentsList
+	}
+
+	generated := make(map[string]bool)
+	check := func(file string) bool {
+		is, ok := generated[file]
+		if ok {
+			return is
+		}
+
+		content, err := fileContent(ctx, p.fileGetter, rev, file)
+		if err != nil {
+			ctxlog.Get(ctx).With(log.Fields{"file": file}).
+				Errorf(err, "can't check if the file is generated")
+		}
+
+		is = err == nil && isGenerated(content)
+		generated[file] = is
+		return is
+	}
+
+	result := make([]lookout.AnalyzerComments, len(aCommentsList))
+	for i, aComments := range aCommentsList {
+		result[i] = aComments
+		result[i].Comments = nil
+		for _, c := range aComments.Comments {
+			if c.File == "" || !check(c.File) {
+				result[i].Comments = append(result[i].Comments, c)
+				continue
+			}
+
+			if max == lookout.UnspecifiedSeverity {
+				continue
+			}
+
+			if c.Severity > max {
+				downgraded := *c
+				downgraded.Severity = max
+				c = &downgraded
+			}
+
+			result[i].Comments = append(result[i].Comments, c)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,78 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/src-d/lookout"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsGenerated(t *testing.T) {
+	require := require.New(t)
+
+	require.True(isGenerated([]byte("// Code generated by protoc-gen-go. DO NOT EDIT.\npackage pb\n")))
+	require.True(isGenerated([]byte("// Copyright\n\n// Code generated by go-bindata. DO NOT EDIT.\n")))
+	require.True(isGenerated([]byte("# Code generated by tool. DO NOT EDIT.\n")))
+	require.False(isGenerated([]byte("package main\n\n// Code generated by hand, feel free to edit\n")))
+	require.False(isGenerated([]byte("package main\n")))
+}
+
+func TestFilterGeneratedDowngrade(t *testing.T) {
+	require := require.New(t)
+
+	p := &Poster{
+		conf: ProviderConfig{
+			SkipGeneratedFiles:        true,
+			GeneratedFilesMaxSeverity: "info",
+		},
+		fileGetter: newFileGetterMock(t, "main.go", "// Code generated by tool. DO NOT EDIT.\n"),
+	}
+
+	c := &lookout.Comment{File: "main.go", Line: 5, Text: "error", Severity: lookout.ErrorSeverity}
+	result := p.filterGenerated(context.Background(), &mockEvent.Head, []lookout.AnalyzerComments{{
+		Config:   lookout.AnalyzerConfig{Name: "mock"},
+		Comments: []*lookout.Comment{c, {Text: "Global comment"}},
+	}})
+
+	require.Len(result[0].Comments, 2)
+	require.Equal(lookout.InfoSeverity, result[0].Comments[0].Severity)
+	require.Equal(lookout.ErrorSeverity, c.Severity)
+	require.Equal("Global comment", result[0].Comments[1].Text)
+}
+
+func (s *PosterTestSuite) TestPostSkipGeneratedFiles() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	var req *github.PullRequestReviewRequest
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		req = &github.PullRequestReviewRequest{}
+		s.NoError(json.NewDecoder(r.Body).Decode(req))
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{SkipGeneratedFiles: true}}
+	p.SetFileGetter(newFileGetterMock(s.T(), "main.go",
+		"// Code generated by mockgen. DO NOT EDIT.\n\npackage main\n"))
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{Text: "Global comment"},
+				&lookout.Comment{File: "main.go", Line: 5, Text: "Line comment"},
+			},
+		}})
+	s.NoError(err)
+
+	// the comment on the generated file is dropped
+	s.Require().NotNil(req)
+	s.Equal("Global comment", req.GetBody())
+	s.Empty(req.Comments)
+}
@@ -2,13 +2,19 @@ package github
 
 import (
 	"context"
+	"fmt"
+	"math/rand"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/bradleyfalzon/ghinstallation"
 	"github.com/google/go-github/github"
 	"github.com/src-d/lookout"
 	"github.com/src-d/lookout/util/cache"
 	vcsurl "gopkg.in/sourcegraph/go-vcsurl.v1"
+	"gopkg.in/src-d/go-errors.v1"
 	log "gopkg.in/src-d/go-log.v1"
 )
 
@@ -17,17 +23,137 @@ type Installations struct {
 	appID      int
 	privateKey string
 	appClient  *github.Client
+	conf       InstallationsConfig
 
 	cache *cache.ValidableCache
 
 	// [installationID]installationClient
 	clients map[int64]*Client
+	// clientsMutex guards the changes of clients made by Sync, as it's also
+	// read by the token refresh
+	clientsMutex sync.RWMutex
+	// syncMutex avoids concurrent calls to Sync
+	syncMutex sync.Mutex
+	// refreshMutex guards stopRefresh, that stops the token refresh if it
+	// was started
+	refreshMutex sync.Mutex
+	stopRefresh  func()
+	// listRepos returns the repositories of an installation client, it is
+	// getRepos except in the tests
+	listRepos func(context.Context, *Client) ([]*lookout.RepositoryInfo, error)
+
+	// retryDelay is the parsed InstallationsConfig.SyncRetryDelay
+	retryDelay time.Duration
 
 	Pool *ClientPool
 }
 
-// NewInstallations creates a new Installations using the App ID and private key
-func NewInstallations(appID int, privateKey string, cache *cache.ValidableCache) (*Installations, error) {
+// ErrInstallationSync is returned by Sync when an installation can't be
+// synced
+var ErrInstallationSync = errors.NewKind("can't sync installation %d")
+
+// time to wait before the first retry of a failed request of Sync, if
+// InstallationsConfig.SyncRetryDelay is not set
+var syncRetryDelay = time.Second
+
+// max number of retries of each failed request of Sync, if
+// InstallationsConfig.SyncRetries is not set
+var defaultSyncRetries = 3
+
+var _ Syncer = &Installations{}
+
+// InstallationsConfig is the configuration of the sync and the clients of
+// the installations
+type InstallationsConfig struct {
+	// WatchMinInterval is the min interval between the requests watching
+	// the repositories of each installation, e.g. "30s". If empty, the
+	// default one is used
+	WatchMinInterval string
+	// SyncConcurrency is the max number of installations whose repositories
+	// are listed concurrently by Sync. If 0, they are listed one at a time
+	SyncConcurrency int
+	// PerPage is the page size of the listings of installations and
+	// repositories, see ProviderConfig.PerPage
+	PerPage int
+	// UserTokens are user-to-server OAuth tokens by installation ID, see
+	// ProviderConfig.InstallationUserTokens
+	UserTokens map[int64]string
+	// SyncRetries is the max number of retries of each failed GitHub API
+	// request of Sync. If 0, defaultSyncRetries is used
+	SyncRetries int
+	// SyncRetryDelay is the time to wait before the first retry of a
+	// request, e.g. "2s", doubled for each following one. If empty,
+	// syncRetryDelay is used
+	SyncRetryDelay string
+	// RefreshTokens makes the clients of the installations able to refresh
+	// their tokens before they expire, see StartTokenRefresh
+	RefreshTokens bool
+}
+
+// Validate returns an error if the configuration is not valid
+func (c InstallationsConfig) Validate() error {
+	if c.WatchMinInterval != "" {
+		if _, err := time.ParseDuration(c.WatchMinInterval); err != nil {
+			return fmt.Errorf("can't parse watch min interval %q: %s", c.WatchMinInterval, err)
+		}
+	}
+
+	if _, err := c.syncRetryDelay(); err != nil {
+		return err
+	}
+
+	for _, n := range []struct {
+		name  string
+		value int
+	}{
+		{"sync concurrency", c.SyncConcurrency},
+		{"per page", c.PerPage},
+		{"sync retries", c.SyncRetries},
+	} {
+		if n.value < 0 {
+			return fmt.Errorf("bad %s %d: it can't be negative", n.name, n.value)
+		}
+	}
+
+	return nil
+}
+
+// syncRetryDelay returns the parsed SyncRetryDelay, or syncRetryDelay if
+// it's empty
+func (c InstallationsConfig) syncRetryDelay() (time.Duration, error) {
+	if c.SyncRetryDelay == "" {
+		return syncRetryDelay, nil
+	}
+
+	d, err := time.ParseDuration(c.SyncRetryDelay)
+	if err != nil {
+		return 0, fmt.Errorf("can't parse sync retry delay %q: %s", c.SyncRetryDelay, err)
+	}
+
+	if d < 0 {
+		return 0, fmt.Errorf("bad sync retry delay %q: it can't be negative", c.SyncRetryDelay)
+	}
+
+	return d, nil
+}
+
+// NewInstallations creates a new Installations using the App ID and private
+// key. The configuration is validated before contacting GitHub, and the
+// request getting the App is cancelled once ctx is done.
+func NewInstallations(
+	ctx context.Context,
+	appID int,
+	privateKey string,
+	cache *cache.ValidableCache,
+	conf InstallationsConfig,
+) (*Installations, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	// the delay was validated
+	retryDelay, _ := conf.syncRetryDelay()
+
 	// Use App authorization to list installations
 	appTr, err := ghinstallation.NewAppsTransportKeyFromFile(
 		http.DefaultTransport, appID, privateKey)
@@ -36,7 +162,7 @@ func NewInstallations(appID int, privateKey string, cache *cache.ValidableCache)
 	}
 
 	appClient := github.NewClient(&http.Client{Transport: appTr})
-	app, _, err := appClient.Apps.Get(context.TODO(), "")
+	app, _, err := appClient.Apps.Get(ctx, "")
 	if err != nil {
 		return nil, err
 	}
@@ -47,19 +173,26 @@ func NewInstallations(appID int, privateKey string, cache *cache.ValidableCache)
 		appID:      appID,
 		privateKey: privateKey,
 		appClient:  appClient,
+		conf:       conf,
 		cache:      cache,
 		clients:    make(map[int64]*Client),
+		retryDelay: retryDelay,
 		Pool:       NewClientPool(),
 	}
+	i.listRepos = i.getRepos
 
 	return i, nil
 }
 
-// Sync update state from github
-func (t *Installations) Sync() error {
+// Sync update state from github. The GitHub API requests are cancelled once
+// the context is done, and its error is returned.
+func (t *Installations) Sync(ctx context.Context) error {
+	t.syncMutex.Lock()
+	defer t.syncMutex.Unlock()
+
 	log.Infof("syncing installations with github")
 
-	installations, _, err := t.appClient.Apps.ListInstallations(context.TODO(), &github.ListOptions{})
+	installations, err := t.listInstallations(ctx)
 	if err != nil {
 		return err
 	}
@@ -78,34 +211,161 @@ func (t *Installations) Sync() error {
 		}
 	}
 
-	// add new installations
+	// add new installations, the ones failing are retried on the next sync
+	var addErr error
 	for id := range new {
 		if _, ok := t.clients[id]; !ok {
 			log.Debugf("add installation %d", id)
-			t.addInstallation(id)
+			if err := t.addInstallation(ctx, id); err != nil {
+				log.Errorf(err, "can't add installation %d", id)
+				if addErr == nil {
+					addErr = err
+				}
+			}
 		}
 	}
 
 	// sync repos for all available installations
-	for id, c := range t.clients {
-		repos, err := t.getRepos(c)
-		if err != nil {
+	if err := t.syncRepos(ctx); err != nil {
+		return err
+	}
+
+	return addErr
+}
+
+// retry calls fn, retrying it up to SyncRetries times while it fails,
+// except for the client errors, waiting between the attempts an
+// exponentially growing delay with jitter, up to maxRetryDelay. It gives up
+// once the context is done, returning its error.
+func (t *Installations) retry(ctx context.Context, op string, fn func() error) error {
+	delay := t.retryDelay
+	if delay <= 0 {
+		delay = syncRetryDelay
+	}
+
+	max := t.conf.SyncRetries
+	if max <= 0 {
+		max = defaultSyncRetries
+	}
+
+	for retries := 0; ; retries++ {
+		err := fn()
+		if err == nil || retries >= max || isClientError(err) {
 			return err
 		}
-		log.Debugf("%d repositories found for installation %d", len(repos), id)
-		t.Pool.Update(c, repos)
+
+		wait := jitter(delay)
+		log.With(log.Fields{
+			"operation":    op,
+			"retries-left": max - retries - 1,
+			"delay":        wait,
+		}).Warningf("github api request failed, retrying: %s", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
 	}
+}
 
-	return nil
+// jitter returns a random duration between half of d and d, so the retries
+// of several installations failing at once are spread
+func jitter(d time.Duration) time.Duration {
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
 }
 
-func (t *Installations) addInstallation(id int64) error {
-	c, err := t.createClient(id)
-	if err != nil {
+// syncRepos updates the pool with the repositories of all the installations,
+// listing up to InstallationsConfig.SyncConcurrency of them at a time. Once
+// a listing fails no more installations are listed, and the first error is
+// returned. The same happens once the context is done, returning its error.
+func (t *Installations) syncRepos(ctx context.Context) error {
+	workers := t.conf.SyncConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errMutex sync.Mutex
+		firstErr error
+	)
+
+	failed := func() bool {
+		errMutex.Lock()
+		defer errMutex.Unlock()
+		return firstErr != nil
+	}
+
+	jobs := make(chan int64)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range jobs {
+				c := t.clients[id]
+				repos, err := t.listRepos(ctx, c)
+				if err != nil && !c.Healthy() {
+					// the rest of the installations can still be synced
+					log.Errorf(err, "can't list the repositories of unhealthy installation %d", id)
+					continue
+				}
+
+				if err != nil {
+					errMutex.Lock()
+					if firstErr == nil {
+						firstErr = ErrInstallationSync.Wrap(err, id)
+					}
+					errMutex.Unlock()
+					continue
+				}
+
+				log.Debugf("%d repositories found for installation %d", len(repos), id)
+				t.Pool.Update(c, repos)
+			}
+		}()
+	}
+
+	for id := range t.clients {
+		if failed() || ctx.Err() != nil {
+			break
+		}
+
+		jobs <- id
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+
+	return firstErr
+}
+
+func (t *Installations) addInstallation(ctx context.Context, id int64) error {
+	var c *Client
+	err := t.retry(ctx, "create client", func() error {
+		var err error
+		c, err = t.createClient(id)
 		return err
+	})
+	if err != nil {
+		return ErrInstallationSync.Wrap(err, id)
 	}
 
+	t.clientsMutex.Lock()
 	t.clients[id] = c
+	t.clientsMutex.Unlock()
 
 	return nil
 }
@@ -113,25 +373,186 @@ func (t *Installations) addInstallation(id int64) error {
 func (t *Installations) removeInstallation(id int64) {
 	t.Pool.RemoveClient(t.clients[id])
 
+	t.clientsMutex.Lock()
 	delete(t.clients, id)
+	t.clientsMutex.Unlock()
 }
 
 func (t *Installations) createClient(installationID int64) (*Client, error) {
-	itr, err := ghinstallation.NewKeyFromFile(http.DefaultTransport,
-		t.appID, int(installationID), t.privateKey)
+	if token := t.conf.UserTokens[installationID]; token != "" {
+		return newUserTokenClient(installationID, http.DefaultTransport, token,
+			t.cache, t.conf.WatchMinInterval), nil
+	}
+
+	newTransport := func() (installationTransport, error) {
+		return newAppTransport(t.appID, int(installationID), t.privateKey)
+	}
+
+	itr, err := newTransport()
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO (carlosms): hardcoded, take from config
-	watchMinInterval := ""
-	return NewClient(itr, t.cache, watchMinInterval), nil
+	if t.conf.RefreshTokens {
+		rtr := newRefreshingTransport(newTransport)
+		rtr.current = itr
+		itr = rtr
+	}
+
+	return newInstallationClient(installationID, itr, itr, t.cache,
+		t.conf.WatchMinInterval), nil
 }
 
-func (t *Installations) getRepos(iClient *Client) ([]*lookout.RepositoryInfo, error) {
-	ghRepos, _, err := iClient.Apps.ListRepos(context.TODO(), &github.ListOptions{})
-	if err != nil {
-		return nil, err
+// ErrInstallationToken is returned by the requests of the installation
+// clients when the installation token can't be obtained
+var ErrInstallationToken = errors.NewKind("can't get the token of installation %d")
+
+// tokenSource returns the installation token, renewing it if needed.
+// *ghinstallation.Transport fulfills this interface.
+type tokenSource interface {
+	Token() (string, error)
+}
+
+// newInstallationClient returns the client of the installation using the
+// given transport, authenticated with the tokens of the source.
+func newInstallationClient(
+	installationID int64,
+	base http.RoundTripper,
+	tokens tokenSource,
+	cache *cache.ValidableCache,
+	watchMinInterval string,
+) *Client {
+	tr := &tokenRoundTripper{Base: base, tokens: tokens}
+
+	c := NewClient(tr, cache, watchMinInterval)
+	c.installationID = installationID
+	c.tokens = tokens
+	tr.client = c
+
+	return c
+}
+
+// staticToken is a tokenSource always returning the same token
+type staticToken string
+
+func (t staticToken) Token() (string, error) {
+	return string(t), nil
+}
+
+// newUserTokenClient returns the client of the installation authenticated
+// with a user-to-server token, so the comments and statuses it posts are
+// attributed to the user instead of the app.
+func newUserTokenClient(
+	installationID int64,
+	base http.RoundTripper,
+	token string,
+	cache *cache.ValidableCache,
+	watchMinInterval string,
+) *Client {
+	tr := &userTokenRoundTripper{Base: base, Token: token}
+	c := newInstallationClient(installationID, tr, staticToken(token), cache, watchMinInterval)
+	c.userToken = true
+
+	return c
+}
+
+// tokenRoundTripper checks that the installation token can be obtained
+// before each request, marking the client unhealthy if it can't, and healthy
+// again once it can.
+type tokenRoundTripper struct {
+	Base   http.RoundTripper
+	tokens tokenSource
+	client *Client
+}
+
+func (t *tokenRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, err := t.tokens.Token(); err != nil {
+		atomic.AddInt64(&t.client.tokenErrors, 1)
+		// only log the first failure, the rest of the requests would fail the
+		// same way until the token can be obtained again
+		if t.client.setHealthy(false) {
+			log.With(log.Fields{"installation": t.client.installationID}).
+				Errorf(err, "can't get the installation token, the installation is skipped until it's synced")
+		}
+
+		return nil, ErrInstallationToken.Wrap(err, t.client.installationID)
+	}
+
+	if t.client.setHealthy(true) {
+		log.With(log.Fields{"installation": t.client.installationID}).
+			Infof("installation token obtained again")
+	}
+
+	return t.Base.RoundTrip(req)
+}
+
+func (t *Installations) listOptions() *github.ListOptions {
+	return &github.ListOptions{PerPage: pageSize(t.conf.PerPage)}
+}
+
+// listInstallations returns all the installations of the app, following
+// the pagination. Each page request is retried on its own.
+func (t *Installations) listInstallations(ctx context.Context) ([]*github.Installation, error) {
+	opts := t.listOptions()
+
+	var result []*github.Installation
+	for {
+		var installations []*github.Installation
+		var resp *github.Response
+		err := t.retry(ctx, "list installations", func() error {
+			var err error
+			installations, resp, err = t.appClient.Apps.ListInstallations(ctx, opts)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, installations...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+
+		opts.Page = resp.NextPage
+	}
+
+	return result, nil
+}
+
+// getRepos returns all the repositories of the installation, following the
+// pagination. Each page request is retried on its own.
+func (t *Installations) getRepos(ctx context.Context, iClient *Client) ([]*lookout.RepositoryInfo, error) {
+	opts := t.listOptions()
+
+	var ghRepos []*github.Repository
+	for {
+		var page []*github.Repository
+		var resp *github.Response
+		err := t.retry(ctx, "list repositories", func() error {
+			var err error
+			// the user-to-server tokens can't list the repositories of the
+			// installation with the endpoint of the installation tokens
+			if iClient.userToken {
+				page, resp, err = iClient.Apps.ListUserRepos(ctx,
+					iClient.installationID, opts)
+			} else {
+				page, resp, err = iClient.Apps.ListRepos(ctx, opts)
+			}
+
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		ghRepos = append(ghRepos, page...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+
+		opts.Page = resp.NextPage
 	}
 
 	repos := make([]*lookout.RepositoryInfo, len(ghRepos))
@@ -146,3 +567,74 @@ func (t *Installations) getRepos(iClient *Client) ([]*lookout.RepositoryInfo, er
 
 	return repos, nil
 }
+
+// Syncer synchronizes the repositories of a ClientPool.
+// *Installations fulfills this interface.
+type Syncer interface {
+	// Sync updates the repositories and clients of the pool
+	Sync(ctx context.Context) error
+}
+
+// min time between on-demand syncs, see debouncedSyncer
+var onDemandSyncInterval = time.Minute
+
+// debouncedSyncer calls Sync on the wrapped Syncer at most once every
+// interval after a successful sync, calls within the interval do nothing.
+// The calls made while a sync is in flight wait for it.
+type debouncedSyncer struct {
+	syncer   Syncer
+	interval time.Duration
+
+	mutex sync.Mutex
+	last  time.Time
+	// running is the sync in flight, nil if there is none
+	running *syncCall
+}
+
+// syncCall is a sync of a debouncedSyncer, err is set before done is closed
+type syncCall struct {
+	done chan struct{}
+	err  error
+}
+
+func newDebouncedSyncer(s Syncer, interval time.Duration) *debouncedSyncer {
+	return &debouncedSyncer{syncer: s, interval: interval}
+}
+
+// Sync calls the wrapped Syncer, unless it was synced successfully within
+// the interval. If a sync is in flight, it waits for it and returns its
+// result instead. It returns true if the sync was performed.
+func (s *debouncedSyncer) Sync(ctx context.Context) (bool, error) {
+	s.mutex.Lock()
+	if call := s.running; call != nil {
+		s.mutex.Unlock()
+
+		select {
+		case <-call.done:
+			return true, call.err
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+
+	if !s.last.IsZero() && time.Since(s.last) < s.interval {
+		s.mutex.Unlock()
+		return false, nil
+	}
+
+	call := &syncCall{done: make(chan struct{})}
+	s.running = call
+	s.mutex.Unlock()
+
+	call.err = s.syncer.Sync(ctx)
+
+	s.mutex.Lock()
+	s.running = nil
+	if call.err == nil {
+		s.last = time.Now()
+	}
+	s.mutex.Unlock()
+
+	close(call.done)
+	return true, call.err
+}
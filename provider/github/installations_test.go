@@ -0,0 +1,584 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/util/cache"
+
+	"github.com/google/go-github/github"
+	"github.com/gregjones/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+type syncerMock struct {
+	calls int
+	fn    func()
+	err   error
+}
+
+func (s *syncerMock) Sync(ctx context.Context) error {
+	s.calls++
+	if s.fn != nil {
+		s.fn()
+	}
+
+	return s.err
+}
+
+func TestDebouncedSyncer(t *testing.T) {
+	require := require.New(t)
+
+	m := &syncerMock{}
+	s := newDebouncedSyncer(m, 50*time.Millisecond)
+
+	synced, err := s.Sync(context.Background())
+	require.NoError(err)
+	require.True(synced)
+
+	synced, err = s.Sync(context.Background())
+	require.NoError(err)
+	require.False(synced)
+	require.Equal(1, m.calls)
+
+	time.Sleep(60 * time.Millisecond)
+
+	synced, err = s.Sync(context.Background())
+	require.NoError(err)
+	require.True(synced)
+	require.Equal(2, m.calls)
+}
+
+func TestDebouncedSyncerError(t *testing.T) {
+	require := require.New(t)
+
+	m := &syncerMock{err: fmt.Errorf("sync error")}
+	s := newDebouncedSyncer(m, time.Hour)
+
+	synced, err := s.Sync(context.Background())
+	require.EqualError(err, "sync error")
+	require.True(synced)
+
+	// a failed sync is retried on the next call
+	m.err = nil
+	synced, err = s.Sync(context.Background())
+	require.NoError(err)
+	require.True(synced)
+	require.Equal(2, m.calls)
+
+	synced, err = s.Sync(context.Background())
+	require.NoError(err)
+	require.False(synced)
+	require.Equal(2, m.calls)
+}
+
+func TestDebouncedSyncerInFlight(t *testing.T) {
+	require := require.New(t)
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	m := &syncerMock{fn: func() {
+		close(started)
+		<-unblock
+	}}
+	s := newDebouncedSyncer(m, time.Hour)
+
+	results := make(chan bool, 2)
+	go func() {
+		synced, err := s.Sync(context.Background())
+		require.NoError(err)
+		results <- synced
+	}()
+
+	<-started
+
+	// the calls during the sync wait for it, without a sync of their own
+	go func() {
+		synced, err := s.Sync(context.Background())
+		require.NoError(err)
+		results <- synced
+	}()
+
+	// a call giving up doesn't wait for the sync
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	synced, err := s.Sync(ctx)
+	require.Equal(context.DeadlineExceeded, err)
+	require.False(synced)
+
+	close(unblock)
+	require.True(<-results)
+	require.True(<-results)
+	require.Equal(1, m.calls)
+}
+
+// poolState returns the repositories in the pool by installation ID
+func poolState(p *ClientPool) map[int64][]string {
+	state := make(map[int64][]string)
+	for c, repos := range p.Clients() {
+		for _, r := range repos {
+			state[c.installationID] = append(state[c.installationID], r.FullName)
+		}
+	}
+
+	return state
+}
+
+func syncedPoolState(t *testing.T, concurrency int) map[int64][]string {
+	require := require.New(t)
+
+	clients := make(map[int64]*Client)
+	for id := int64(1); id <= 20; id++ {
+		clients[id] = &Client{installationID: id}
+	}
+
+	var running, maxRunning int32
+	i := &Installations{
+		clients: clients,
+		Pool:    NewClientPool(),
+		listRepos: func(ctx context.Context, c *Client) ([]*lookout.RepositoryInfo, error) {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				max := atomic.LoadInt32(&maxRunning)
+				if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+					break
+				}
+			}
+
+			time.Sleep(5 * time.Millisecond)
+
+			var repos []*lookout.RepositoryInfo
+			for r := int64(0); r < c.installationID%3+1; r++ {
+				repos = append(repos, &lookout.RepositoryInfo{
+					FullName: fmt.Sprintf("org%d/repo%d", c.installationID, r),
+				})
+			}
+
+			return repos, nil
+		},
+		conf: InstallationsConfig{SyncConcurrency: concurrency},
+	}
+
+	require.NoError(i.syncRepos(context.Background()))
+
+	limit := concurrency
+	if limit < 1 {
+		limit = 1
+	}
+	require.True(int(maxRunning) <= limit)
+
+	return poolState(i.Pool)
+}
+
+func TestInstallationsSyncReposConcurrency(t *testing.T) {
+	require := require.New(t)
+
+	serial := syncedPoolState(t, 0)
+	require.Len(serial, 20)
+	require.Equal(serial, syncedPoolState(t, 8))
+}
+
+func TestInstallationsSyncReposError(t *testing.T) {
+	require := require.New(t)
+
+	i := &Installations{
+		clients: map[int64]*Client{1: &Client{installationID: 1}},
+		Pool:    NewClientPool(),
+		listRepos: func(ctx context.Context, c *Client) ([]*lookout.RepositoryInfo, error) {
+			return nil, fmt.Errorf("list error")
+		},
+		conf: InstallationsConfig{SyncConcurrency: 4},
+	}
+
+	err := i.syncRepos(context.Background())
+	require.True(ErrInstallationSync.Is(err))
+	require.EqualError(err, "can't sync installation 1: list error")
+	require.Empty(i.Pool.Repos())
+}
+
+type tokenSourceMock struct {
+	err error
+}
+
+func (s *tokenSourceMock) Token() (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+
+	return "token", nil
+}
+
+func TestInstallationClientTokenFailure(t *testing.T) {
+	require := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 1}`)
+	}))
+	defer server.Close()
+
+	tokens := &tokenSourceMock{err: fmt.Errorf("installation suspended")}
+	c := newInstallationClient(42, http.DefaultTransport, tokens,
+		cache.NewValidableCache(httpcache.NewMemoryCache()), "")
+	c.BaseURL, _ = url.Parse(server.URL + "/")
+
+	pool := NewClientPool()
+	pool.Update(c, []*lookout.RepositoryInfo{&lookout.RepositoryInfo{FullName: "foo/bar"}})
+
+	_, _, err := c.Repositories.GetByID(context.Background(), 1)
+	require.Error(err)
+	urlErr, ok := err.(*url.Error)
+	require.True(ok)
+	require.True(ErrInstallationToken.Is(urlErr.Err))
+
+	require.False(c.Healthy())
+	require.EqualValues(1, c.TokenErrors())
+	_, ok = pool.Client("foo", "bar")
+	require.False(ok)
+
+	// once the token can be obtained the client is healthy again
+	tokens.err = nil
+	_, _, err = c.Repositories.GetByID(context.Background(), 1)
+	require.NoError(err)
+
+	require.True(c.Healthy())
+	require.EqualValues(1, c.TokenErrors())
+	_, ok = pool.Client("foo", "bar")
+	require.True(ok)
+}
+
+func TestInstallationsSyncReposUnhealthy(t *testing.T) {
+	require := require.New(t)
+
+	unhealthy := &Client{installationID: 1, unhealthy: 1}
+	healthy := &Client{installationID: 2}
+	i := &Installations{
+		clients: map[int64]*Client{1: unhealthy, 2: healthy},
+		Pool:    NewClientPool(),
+		listRepos: func(ctx context.Context, c *Client) ([]*lookout.RepositoryInfo, error) {
+			if c == unhealthy {
+				return nil, ErrInstallationToken.New(1)
+			}
+
+			return []*lookout.RepositoryInfo{&lookout.RepositoryInfo{FullName: "foo/bar"}}, nil
+		},
+	}
+
+	// the unhealthy installation doesn't prevent syncing the rest
+	require.NoError(i.syncRepos(context.Background()))
+	require.Equal([]string{"foo/bar"}, i.Pool.Repos())
+}
+
+func TestInstallationsGetReposPerPage(t *testing.T) {
+	require := require.New(t)
+
+	var perPage []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal("/installation/repositories", r.URL.Path)
+		perPage = append(perPage, r.URL.Query().Get("per_page"))
+		fmt.Fprint(w, `{"repositories": [{"html_url": "https://github.com/foo/bar"}]}`)
+	}))
+	defer server.Close()
+
+	c := newInstallationClient(42, http.DefaultTransport, &tokenSourceMock{},
+		cache.NewValidableCache(httpcache.NewMemoryCache()), "")
+	c.BaseURL, _ = url.Parse(server.URL + "/")
+
+	i := &Installations{conf: InstallationsConfig{PerPage: 50}}
+	repos, err := i.getRepos(context.Background(), c)
+	require.NoError(err)
+	require.Len(repos, 1)
+	require.Equal("foo/bar", repos[0].FullName)
+
+	// larger page sizes than allowed by GitHub are capped
+	i.conf.PerPage = 1000
+	_, err = i.getRepos(context.Background(), c)
+	require.NoError(err)
+
+	require.Equal([]string{"50", "100"}, perPage)
+}
+
+func TestInstallationsSyncPagination(t *testing.T) {
+	require := require.New(t)
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		if page == "" {
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s?page=2>; rel="next"`, server.URL, r.URL.Path))
+		}
+
+		switch r.URL.Path + "@" + page {
+		case "/app/installations@":
+			fmt.Fprint(w, `[{"id": 1}]`)
+		case "/app/installations@2":
+			fmt.Fprint(w, `[{"id": 2}]`)
+		case "/user/installations/1/repositories@":
+			fmt.Fprint(w, `{"repositories": [{"html_url": "https://github.com/foo/bar"}]}`)
+		case "/user/installations/1/repositories@2":
+			fmt.Fprint(w, `{"repositories": [{"html_url": "https://github.com/foo/baz"}]}`)
+		case "/user/installations/2/repositories@":
+			fmt.Fprint(w, `{"repositories": [{"html_url": "https://github.com/qux/bar"}]}`)
+		case "/user/installations/2/repositories@2":
+			fmt.Fprint(w, `{"repositories": [{"html_url": "https://github.com/qux/baz"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	appClient := github.NewClient(nil)
+	appClient.BaseURL, _ = url.Parse(server.URL + "/")
+
+	i := &Installations{
+		appClient: appClient,
+		cache:     cache.NewValidableCache(httpcache.NewMemoryCache()),
+		clients:   make(map[int64]*Client),
+		Pool:      NewClientPool(),
+		conf: InstallationsConfig{
+			UserTokens: map[int64]string{1: "token1", 2: "token2"},
+		},
+	}
+	i.listRepos = func(ctx context.Context, c *Client) ([]*lookout.RepositoryInfo, error) {
+		c.BaseURL = appClient.BaseURL
+		return i.getRepos(ctx, c)
+	}
+
+	require.NoError(i.Sync(context.Background()))
+
+	state := poolState(i.Pool)
+	for _, repos := range state {
+		sort.Strings(repos)
+	}
+	require.Equal(map[int64][]string{
+		1: []string{"foo/bar", "foo/baz"},
+		2: []string{"qux/bar", "qux/baz"},
+	}, state)
+}
+
+func TestInstallationsSyncCancel(t *testing.T) {
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/app/installations":
+			fmt.Fprint(w, `[{"id": 1}]`)
+		default:
+			// the sync is cancelled while listing the repositories
+			cancel()
+			<-r.Context().Done()
+		}
+	}))
+	defer server.Close()
+
+	appClient := github.NewClient(nil)
+	appClient.BaseURL, _ = url.Parse(server.URL + "/")
+
+	i := &Installations{
+		appClient: appClient,
+		cache:     cache.NewValidableCache(httpcache.NewMemoryCache()),
+		clients:   make(map[int64]*Client),
+		Pool:      NewClientPool(),
+		conf:      InstallationsConfig{UserTokens: map[int64]string{1: "user-token"}},
+	}
+	i.listRepos = func(ctx context.Context, c *Client) ([]*lookout.RepositoryInfo, error) {
+		c.BaseURL = appClient.BaseURL
+		return i.getRepos(ctx, c)
+	}
+
+	err := i.Sync(ctx)
+	require.True(ErrInstallationSync.Is(err))
+	require.Contains(err.Error(), context.Canceled.Error())
+	require.Empty(i.Pool.Repos())
+}
+
+func TestInstallationsGetReposRetry(t *testing.T) {
+	require := require.New(t)
+
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		fmt.Fprint(w, `{"repositories": [{"html_url": "https://github.com/foo/bar"}]}`)
+	}))
+	defer server.Close()
+
+	c := newInstallationClient(42, http.DefaultTransport, &tokenSourceMock{},
+		cache.NewValidableCache(httpcache.NewMemoryCache()), "")
+	c.BaseURL, _ = url.Parse(server.URL + "/")
+
+	i := &Installations{
+		conf:       InstallationsConfig{SyncRetries: 1},
+		retryDelay: time.Millisecond,
+	}
+	_, err := i.getRepos(context.Background(), c)
+	require.Error(err)
+	require.Equal(2, calls)
+
+	calls = 0
+	i.conf.SyncRetries = 3
+	repos, err := i.getRepos(context.Background(), c)
+	require.NoError(err)
+	require.Len(repos, 1)
+	require.Equal(3, calls)
+}
+
+func TestInstallationsRetryDefault(t *testing.T) {
+	require := require.New(t)
+
+	var calls int
+	i := &Installations{retryDelay: time.Millisecond}
+	err := i.retry(context.Background(), "test", func() error {
+		calls++
+		return ErrGitHubAPI.New()
+	})
+	require.Error(err)
+	require.Equal(defaultSyncRetries+1, calls)
+}
+
+func TestInstallationsRetryClientError(t *testing.T) {
+	require := require.New(t)
+
+	var calls int
+	i := &Installations{
+		conf:       InstallationsConfig{SyncRetries: 3},
+		retryDelay: time.Millisecond,
+	}
+	err := i.retry(context.Background(), "test", func() error {
+		calls++
+		return &github.ErrorResponse{Response: &http.Response{
+			StatusCode: http.StatusUnauthorized,
+			Request:    &http.Request{Method: "GET", URL: &url.URL{}},
+		}}
+	})
+	require.Error(err)
+	require.Equal(1, calls)
+}
+
+func TestJitter(t *testing.T) {
+	require := require.New(t)
+
+	for i := 0; i < 100; i++ {
+		d := jitter(time.Second)
+		require.True(d >= 500*time.Millisecond && d <= time.Second, d)
+	}
+
+	require.Equal(time.Duration(0), jitter(0))
+}
+
+func TestInstallationsConfigWatchMinInterval(t *testing.T) {
+	require := require.New(t)
+
+	userTokens := map[int64]string{42: "user-token"}
+	conf := InstallationsConfig{WatchMinInterval: "30s", UserTokens: userTokens}
+	require.NoError(conf.Validate())
+	require.NoError(InstallationsConfig{}.Validate())
+
+	i := &Installations{
+		conf:  conf,
+		cache: cache.NewValidableCache(httpcache.NewMemoryCache()),
+	}
+	c, err := i.createClient(42)
+	require.NoError(err)
+	require.Equal(30*time.Second, c.watchMinInterval)
+
+	i.conf = InstallationsConfig{UserTokens: userTokens}
+	c, err = i.createClient(42)
+	require.NoError(err)
+	require.Equal(minInterval, c.watchMinInterval)
+
+	// the configuration is validated before reading the key or contacting
+	// GitHub
+	_, err = NewInstallations(context.Background(), 1, "/does/not/exist.pem", i.cache,
+		InstallationsConfig{WatchMinInterval: "30 seconds"})
+	require.Error(err)
+	require.Contains(err.Error(), `can't parse watch min interval "30 seconds"`)
+}
+
+func TestInstallationsConfigValidate(t *testing.T) {
+	require := require.New(t)
+
+	require.NoError(InstallationsConfig{
+		SyncConcurrency: 4,
+		PerPage:         50,
+		SyncRetries:     3,
+		SyncRetryDelay:  "2s",
+	}.Validate())
+
+	for _, c := range []struct {
+		conf InstallationsConfig
+		err  string
+	}{
+		{InstallationsConfig{SyncRetryDelay: "2 seconds"}, `can't parse sync retry delay "2 seconds"`},
+		{InstallationsConfig{SyncRetryDelay: "-2s"}, `bad sync retry delay "-2s"`},
+		{InstallationsConfig{SyncConcurrency: -1}, "bad sync concurrency -1"},
+		{InstallationsConfig{PerPage: -1}, "bad per page -1"},
+		{InstallationsConfig{SyncRetries: -1}, "bad sync retries -1"},
+	} {
+		err := c.conf.Validate()
+		require.Error(err)
+		require.Contains(err.Error(), c.err)
+	}
+
+	d, err := InstallationsConfig{}.syncRetryDelay()
+	require.NoError(err)
+	require.Equal(syncRetryDelay, d)
+}
+
+func TestUserTokenClient(t *testing.T) {
+	require := require.New(t)
+
+	var auths, paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auths = append(auths, r.Header.Get("Authorization"))
+		paths = append(paths, r.URL.Path)
+
+		switch r.URL.Path {
+		case "/user/installations/42/repositories":
+			fmt.Fprint(w, `{"repositories": [{"html_url": "https://github.com/foo/bar"}]}`)
+		default:
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"id": 1}`)
+		}
+	}))
+	defer server.Close()
+
+	i := &Installations{
+		conf:  InstallationsConfig{UserTokens: map[int64]string{42: "user-token"}},
+		cache: cache.NewValidableCache(httpcache.NewMemoryCache()),
+	}
+	c, err := i.createClient(42)
+	require.NoError(err)
+	c.BaseURL, _ = url.Parse(server.URL + "/")
+
+	// the repositories are listed with the endpoint of the user tokens
+	repos, err := i.getRepos(context.Background(), c)
+	require.NoError(err)
+	require.Len(repos, 1)
+	require.Equal("foo/bar", repos[0].FullName)
+
+	// and the comments are posted as the user
+	body := "comment"
+	_, _, err = c.Issues.CreateComment(context.Background(), "foo", "bar", 1,
+		&github.IssueComment{Body: &body})
+	require.NoError(err)
+
+	require.Equal([]string{"/user/installations/42/repositories", "/repos/foo/bar/issues/1/comments"}, paths)
+	require.Equal([]string{"token user-token", "token user-token"}, auths)
+	require.True(c.Healthy())
+}
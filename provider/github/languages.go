@@ -0,0 +1,106 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/src-d/lookout"
+)
+
+// languagesTTL is how long the languages of a repository are cached
+const languagesTTL = time.Hour
+
+// LanguageGetter retrieves the languages of the repositories from the GitHub
+// API. The languages of each repository are fetched once and cached for an
+// hour.
+type LanguageGetter struct {
+	pool *ClientPool
+	// now returns the current time, if nil time.Now is used
+	now func() time.Time
+
+	m     sync.Mutex
+	cache map[string]cachedLanguages
+}
+
+type cachedLanguages struct {
+	languages []string
+	expires   time.Time
+}
+
+var _ lookout.LanguageGetter = &LanguageGetter{}
+
+// NewLanguageGetter creates a new LanguageGetter for the GitHub API.
+func NewLanguageGetter(pool *ClientPool) *LanguageGetter {
+	return &LanguageGetter{
+		pool:  pool,
+		cache: make(map[string]cachedLanguages),
+	}
+}
+
+func (g *LanguageGetter) getNow() time.Time {
+	if g.now == nil {
+		return time.Now()
+	}
+
+	return g.now()
+}
+
+// Languages returns the languages of the repository of the event, from the
+// most used to the least used. If a GitHub API request fails, ErrGitHubAPI is
+// returned.
+func (g *LanguageGetter) Languages(ctx context.Context, e lookout.Event) ([]string, error) {
+	base := e.Revision().Base
+	owner, err := extractOwner(base)
+	if err != nil {
+		return nil, ErrEventNotSupported.Wrap(err)
+	}
+
+	repo, err := extractRepo(base)
+	if err != nil {
+		return nil, ErrEventNotSupported.Wrap(err)
+	}
+
+	key := owner + "/" + repo
+	now := g.getNow()
+
+	g.m.Lock()
+	cached, ok := g.cache[key]
+	g.m.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.languages, nil
+	}
+
+	client, ok := g.pool.Client(owner, repo)
+	if !ok {
+		return nil, fmt.Errorf("client for %s/%s doesn't exists", owner, repo)
+	}
+
+	bytes, _, err := client.Repositories.ListLanguages(ctx, owner, repo)
+	if err != nil {
+		return nil, ErrGitHubAPI.Wrap(err)
+	}
+
+	languages := make([]string, 0, len(bytes))
+	for lang := range bytes {
+		languages = append(languages, lang)
+	}
+	sort.Slice(languages, func(i, j int) bool {
+		if bytes[languages[i]] != bytes[languages[j]] {
+			return bytes[languages[i]] > bytes[languages[j]]
+		}
+
+		return languages[i] < languages[j]
+	})
+
+	g.m.Lock()
+	if g.cache == nil {
+		g.cache = make(map[string]cachedLanguages)
+	}
+	g.cache[key] = cachedLanguages{languages: languages, expires: now.Add(languagesTTL)}
+	g.m.Unlock()
+
+	return languages, nil
+}
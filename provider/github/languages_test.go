@@ -0,0 +1,79 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/src-d/lookout/util/cache"
+
+	"github.com/gregjones/httpcache"
+	"github.com/stretchr/testify/suite"
+)
+
+type LanguageGetterTestSuite struct {
+	suite.Suite
+	mux    *http.ServeMux
+	server *httptest.Server
+	pool   *ClientPool
+}
+
+func (s *LanguageGetterTestSuite) SetupTest() {
+	s.mux = http.NewServeMux()
+	s.server = httptest.NewServer(s.mux)
+
+	cache := cache.NewValidableCache(httpcache.NewMemoryCache())
+	githubURL, _ := url.Parse(s.server.URL + "/")
+
+	repoURLs := []string{"github.com/foo/bar"}
+	s.pool = newTestPool(s.Suite, repoURLs, githubURL, cache)
+}
+
+func (s *LanguageGetterTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *LanguageGetterTestSuite) TestLanguages() {
+	calls := 0
+	s.mux.HandleFunc("/repos/foo/bar/languages", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		json.NewEncoder(w).Encode(map[string]int{"Markdown": 10, "Go": 300, "Shell": 10})
+	})
+
+	now := time.Now()
+	g := NewLanguageGetter(s.pool)
+	g.now = func() time.Time { return now }
+
+	langs, err := g.Languages(context.Background(), mockEvent)
+	s.NoError(err)
+	s.Equal([]string{"Go", "Markdown", "Shell"}, langs)
+
+	// the languages are cached
+	langs, err = g.Languages(context.Background(), mockEvent)
+	s.NoError(err)
+	s.Equal([]string{"Go", "Markdown", "Shell"}, langs)
+	s.Equal(1, calls)
+
+	now = now.Add(languagesTTL)
+	_, err = g.Languages(context.Background(), mockEvent)
+	s.NoError(err)
+	s.Equal(2, calls)
+}
+
+func (s *LanguageGetterTestSuite) TestLanguagesHttpError() {
+	s.mux.HandleFunc("/repos/foo/bar/languages", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	g := NewLanguageGetter(s.pool)
+	_, err := g.Languages(context.Background(), mockEvent)
+	s.True(ErrGitHubAPI.Is(err))
+}
+
+func TestLanguageGetterTestSuite(t *testing.T) {
+	suite.Run(t, new(LanguageGetterTestSuite))
+}
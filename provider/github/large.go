@@ -0,0 +1,65 @@
+package github
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/util/ctxlog"
+
+	"github.com/google/go-github/github"
+	log "gopkg.in/src-d/go-log.v1"
+)
+
+// defaultLargePRMessage is posted on the pull requests with more files than
+// ProviderConfig.MaxDiffFiles if LargePRMessage is empty
+const defaultLargePRMessage = "This pull request changes %[1]d files, " +
+	"too many to post the comments inline. %[2]d findings were not posted."
+
+// isLargePR returns true if the comparison has more files than MaxDiffFiles
+func (p *Poster) isLargePR(cc *github.CommitsComparison) bool {
+	return p.conf.MaxDiffFiles > 0 && len(cc.Files) > p.conf.MaxDiffFiles
+}
+
+// postLargePR posts a review with only the LargePRMessage, explaining that
+// the comments were not posted because the pull request is too large.
+func (p *Poster) postLargePR(
+	ctx context.Context,
+	client *Client,
+	budget *retryBudget,
+	owner, repo string,
+	pr int,
+	e *lookout.ReviewEvent,
+	cc *github.CommitsComparison,
+	aCommentsList []lookout.AnalyzerComments,
+) error {
+	findings := 0
+	for _, aComments := range aCommentsList {
+		findings += len(aComments.Comments)
+	}
+
+	if findings == 0 {
+		ctxlog.Get(ctx).Debugf("skipping posting analysis, there are no comments")
+		return nil
+	}
+
+	ctxlog.Get(ctx).With(log.Fields{
+		"files":    len(cc.Files),
+		"findings": findings,
+	}).Infof("pull request too large, posting only the large pull request message")
+
+	msg := p.conf.LargePRMessage
+	if msg == "" {
+		msg = defaultLargePRMessage
+	}
+
+	commitID := prCommit(e)
+	body := fmt.Sprintf(msg, len(cc.Files), findings)
+	req := &github.PullRequestReviewRequest{
+		CommitID: &commitID,
+		Body:     &body,
+		Event:    &commentEvent,
+	}
+
+	return p.createReview(ctx, client, budget, owner, repo, pr, req)
+}
@@ -0,0 +1,97 @@
+package github
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/src-d/lookout"
+)
+
+type limitedComment struct {
+	group   int
+	comment *lookout.Comment
+}
+
+// limitLineComments keeps the first max line comments of all the analyzers,
+// sorted by file and line, and drops the rest. A global comment with the
+// number of comments dropped is added to the first analyzer with dropped
+// comments. Only the comments that can be placed on the diff count, the
+// ones out of its range are left as is; without a diff all the line
+// comments count. Global and file comments are left as is. A max lower than
+// 1 drops nothing. The given comments are not modified.
+func limitLineComments(
+	max int,
+	dl *diffLines,
+	aCommentsList []lookout.AnalyzerComments,
+) []lookout.AnalyzerComments {
+	if max < 1 {
+		return aCommentsList
+	}
+
+	var cs []limitedComment
+	for i, aComments := range aCommentsList {
+		for _, c := range aComments.Comments {
+			if c.File == "" || c.Line < 1 || c.TargetDescription {
+				continue
+			}
+
+			if dl != nil {
+				if _, err := commentPosition(dl, c); err != nil {
+					continue
+				}
+			}
+
+			cs = append(cs, limitedComment{i, c})
+		}
+	}
+
+	if len(cs) <= max {
+		return aCommentsList
+	}
+
+	sort.SliceStable(cs, func(i, j int) bool {
+		if cs[i].comment.File != cs[j].comment.File {
+			return cs[i].comment.File < cs[j].comment.File
+		}
+
+		return cs[i].comment.Line < cs[j].comment.Line
+	})
+
+	dropped := make(map[*lookout.Comment]bool, len(cs)-max)
+	noted := len(aCommentsList)
+	for _, c := range cs[max:] {
+		dropped[c.comment] = true
+		if c.group < noted {
+			noted = c.group
+		}
+	}
+
+	result := make([]lookout.AnalyzerComments, len(aCommentsList))
+	for i, aComments := range aCommentsList {
+		result[i] = aComments
+		result[i].Comments = nil
+		for _, c := range aComments.Comments {
+			if !dropped[c] {
+				result[i].Comments = append(result[i].Comments, c)
+			}
+		}
+
+		if i == noted {
+			result[i].Comments = append(result[i].Comments, &lookout.Comment{
+				Text: maxCommentsNote(len(dropped)),
+			})
+		}
+	}
+
+	return result
+}
+
+// maxCommentsNote returns the text of the global comment noting the number
+// of line comments dropped by limitLineComments
+func maxCommentsNote(n int) string {
+	if n == 1 {
+		return "1 additional issue was found but not shown"
+	}
+
+	return fmt.Sprintf("%d additional issues were found but not shown", n)
+}
@@ -0,0 +1,109 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/src-d/lookout"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+func limitComments() []lookout.AnalyzerComments {
+	return []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "style"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "b.go", Line: 1, Text: "style b.go"},
+				&lookout.Comment{File: "a.go", Line: 9, Text: "style a.go"},
+				&lookout.Comment{Text: "global"},
+			},
+		},
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "sec"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "a.go", Line: 2, Text: "sec a.go"},
+				&lookout.Comment{File: "c.go", Line: 1, Text: "sec c.go"},
+				&lookout.Comment{File: "c.go", Text: "file"},
+			},
+		},
+	}
+}
+
+func TestLimitLineComments(t *testing.T) {
+	require := require.New(t)
+
+	list := limitComments()
+	limited := limitLineComments(2, nil, list)
+
+	require.Len(limited, 2)
+	require.Equal([]*lookout.Comment{
+		list[0].Comments[1],
+		list[0].Comments[2],
+		&lookout.Comment{Text: "2 additional issues were found but not shown"},
+	}, limited[0].Comments)
+	require.Equal([]*lookout.Comment{
+		list[1].Comments[0],
+		list[1].Comments[2],
+	}, limited[1].Comments)
+
+	// the given comments are not modified
+	require.Equal(limitComments(), list)
+}
+
+func TestLimitLineCommentsOne(t *testing.T) {
+	require := require.New(t)
+
+	list := limitComments()
+	limited := limitLineComments(3, nil, list)
+
+	require.Equal(list[0].Comments, limited[0].Comments)
+	require.Equal([]*lookout.Comment{
+		list[1].Comments[0],
+		list[1].Comments[2],
+		&lookout.Comment{Text: "1 additional issue was found but not shown"},
+	}, limited[1].Comments)
+}
+
+func TestLimitLineCommentsNotOver(t *testing.T) {
+	require := require.New(t)
+
+	list := limitComments()
+	require.Equal(list, limitLineComments(0, nil, list))
+	require.Equal(list, limitLineComments(4, nil, list))
+	require.Equal(list, limitLineComments(10, nil, list))
+}
+
+func TestLimitLineCommentsDiff(t *testing.T) {
+	require := require.New(t)
+
+	dl := newDiffLines(&github.CommitsComparison{
+		Files: []github.CommitFile{github.CommitFile{
+			Filename: strptr("main.go"),
+			Patch:    strptr(mockedPatch),
+		}},
+	})
+
+	list := []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "style"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 50, Text: "out"},
+				&lookout.Comment{File: "main.go", Line: 60, Text: "out"},
+				&lookout.Comment{File: "main.go", Line: 5, Text: "in"},
+				&lookout.Comment{File: "main.go", Line: 6, Text: "in"},
+			},
+		},
+	}
+
+	// the comments out of the diff don't count, and are left as is
+	limited := limitLineComments(1, dl, list)
+	require.Equal([]*lookout.Comment{
+		list[0].Comments[0],
+		list[0].Comments[1],
+		list[0].Comments[2],
+		&lookout.Comment{Text: "1 additional issue was found but not shown"},
+	}, limited[0].Comments)
+
+	require.Equal(list, limitLineComments(2, dl, list))
+}
@@ -0,0 +1,155 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/util/ctxlog"
+
+	"github.com/google/go-github/github"
+	log "gopkg.in/src-d/go-log.v1"
+)
+
+// linkedIssueMarker returns the hidden marker of the comment posted on a
+// linked issue for the findings of a pull request, used to find it in the
+// next analyses
+func linkedIssueMarker(pr int) string {
+	return fmt.Sprintf("<!-- lookout-linked-issue #%d -->", pr)
+}
+
+// linkedIssues returns the comments of the list by the issue they
+// reference, and the referenced issues sorted by number
+func linkedIssues(aCommentsList []lookout.AnalyzerComments) ([]int, map[int][]*lookout.Comment) {
+	byIssue := make(map[int][]*lookout.Comment)
+	for _, aComments := range aCommentsList {
+		for _, c := range aComments.Comments {
+			if c.IssueRef <= 0 {
+				continue
+			}
+
+			byIssue[int(c.IssueRef)] = append(byIssue[int(c.IssueRef)], c)
+		}
+	}
+
+	issues := make([]int, 0, len(byIssue))
+	for issue := range byIssue {
+		issues = append(issues, issue)
+	}
+	sort.Ints(issues)
+
+	return issues, byIssue
+}
+
+// linkedIssueBody returns the body of the comment on a linked issue, listing
+// the findings of the pull request referencing it, with a link to the inline
+// comments of the pull request if filesURL is not empty
+func linkedIssueBody(pr int, comments []*lookout.Comment, filesURL string) string {
+	lines := []string{
+		linkedIssueMarker(pr),
+		fmt.Sprintf("**lookout** findings in #%d reference this issue:", pr),
+		"",
+	}
+
+	for _, c := range comments {
+		text := strings.TrimSpace(strings.SplitN(strings.TrimSpace(c.Text), "\n", 2)[0])
+		switch {
+		case c.File == "":
+			lines = append(lines, fmt.Sprintf("- %s", text))
+		case c.Line == 0:
+			lines = append(lines, fmt.Sprintf("- `%s`: %s", c.File, text))
+		default:
+			lines = append(lines, fmt.Sprintf("- `%s:%d`: %s", c.File, c.Line, text))
+		}
+	}
+
+	if filesURL != "" {
+		lines = append(lines, "", fmt.Sprintf("[See the inline comments](%s)", filesURL))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// postLinkedIssues keeps a comment up to date on each issue referenced by
+// the comments, by their IssueRef, if PostToLinkedIssues is enabled. Errors
+// are only logged, the review is already posted.
+func (p *Poster) postLinkedIssues(
+	ctx context.Context,
+	client *Client,
+	budget *retryBudget,
+	owner, repo string,
+	pr int,
+	e *lookout.ReviewEvent,
+	aCommentsList []lookout.AnalyzerComments,
+) {
+	if !p.conf.PostToLinkedIssues {
+		return
+	}
+
+	issues, byIssue := linkedIssues(aCommentsList)
+	for _, issue := range issues {
+		if issue == pr {
+			continue
+		}
+
+		body := linkedIssueBody(pr, byIssue[issue], prFilesURL(e, pr))
+		err := p.updateLinkedIssue(ctx, client, budget, owner, repo, pr, issue, body)
+		if err != nil {
+			ctxlog.Get(ctx).With(log.Fields{"issue": issue}).
+				Errorf(err, "can't update the comment on the linked issue")
+		}
+	}
+}
+
+// updateLinkedIssue creates the comment on the linked issue, or edits the one
+// posted by a previous analysis of the pull request, found by its marker.
+func (p *Poster) updateLinkedIssue(
+	ctx context.Context,
+	client *Client,
+	budget *retryBudget,
+	owner, repo string,
+	pr, issue int,
+	body string,
+) error {
+	var existing *github.IssueComment
+	err := budget.do(ctx, "list comments", func() error {
+		var err error
+		existing, err = p.findMarkedComment(ctx, client, owner, repo, issue, linkedIssueMarker(pr))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if existing != nil && existing.GetBody() == body {
+		return nil
+	}
+
+	comment := &github.IssueComment{Body: &body}
+	// creating the comment is not idempotent
+	retry := budget.do
+	if existing == nil {
+		retry = budget.doCreate
+	}
+
+	return retry(ctx, "update linked issue", func() error {
+		ctx, cancel := withTimeout(ctx, p.postTimeout)
+		defer cancel()
+
+		var resp *github.Response
+		var err error
+		if existing == nil {
+			_, resp, err = client.Issues.CreateComment(ctx, owner, repo, issue, comment)
+			if err == nil && resp.StatusCode == http.StatusCreated {
+				return nil
+			}
+		} else {
+			_, resp, err = client.Issues.EditComment(ctx, owner, repo, int(existing.GetID()), comment)
+		}
+
+		return p.handleAPIError(resp, err)
+	})
+}
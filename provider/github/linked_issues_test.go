@@ -0,0 +1,138 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/src-d/lookout"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+var linkedComments = []lookout.AnalyzerComments{
+	lookout.AnalyzerComments{
+		Config: lookout.AnalyzerConfig{Name: "mock"},
+		Comments: []*lookout.Comment{
+			&lookout.Comment{File: "main.go", Line: 5, Text: "Line comment\n\nmore details", IssueRef: 7},
+			&lookout.Comment{File: "main.go", Text: "File comment", IssueRef: 7},
+			&lookout.Comment{Text: "Global comment", IssueRef: 3},
+			&lookout.Comment{File: "main.go", Line: 5, Text: "Unlinked comment"},
+		},
+	}}
+
+func TestLinkedIssueBody(t *testing.T) {
+	require := require.New(t)
+
+	issues, byIssue := linkedIssues(linkedComments)
+	require.Equal([]int{3, 7}, issues)
+
+	expected := linkedIssueMarker(42) + "\n" +
+		"**lookout** findings in #42 reference this issue:\n" +
+		"\n" +
+		"- `main.go:5`: Line comment\n" +
+		"- `main.go`: File comment\n" +
+		"\n" +
+		"[See the inline comments](https://github.com/foo/bar/pull/42/files)"
+	require.Equal(expected, linkedIssueBody(42, byIssue[7], "https://github.com/foo/bar/pull/42/files"))
+
+	require.Equal(linkedIssueMarker(42)+"\n"+
+		"**lookout** findings in #42 reference this issue:\n"+
+		"\n"+
+		"- Global comment", linkedIssueBody(42, byIssue[3], ""))
+}
+
+func (s *PosterTestSuite) TestPostToLinkedIssues() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	var posted []*github.IssueComment
+	s.mux.HandleFunc("/repos/foo/bar/issues/7/comments", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			comments := []*github.IssueComment{&github.IssueComment{
+				ID:   int64ptr(6),
+				Body: strptr(linkedIssueMarker(41) + "\nanother pull request"),
+			}}
+			comments = append(comments, posted...)
+			json.NewEncoder(w).Encode(comments)
+		case "POST":
+			var c github.IssueComment
+			s.NoError(json.NewDecoder(r.Body).Decode(&c))
+			c.ID = int64ptr(8)
+			posted = append(posted, &c)
+
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(c)
+		default:
+			s.Failf("unexpected request", "%s %s", r.Method, r.URL)
+		}
+	})
+
+	var edited []string
+	s.mux.HandleFunc("/repos/foo/bar/issues/comments/8", func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("PATCH", r.Method)
+
+		var c github.IssueComment
+		s.NoError(json.NewDecoder(r.Body).Decode(&c))
+		edited = append(edited, c.GetBody())
+
+		json.NewEncoder(w).Encode(c)
+	})
+
+	aCommentsList := []lookout.AnalyzerComments{lookout.AnalyzerComments{
+		Config:   lookout.AnalyzerConfig{Name: "mock"},
+		Comments: linkedComments[0].Comments[:2],
+	}}
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{PostToLinkedIssues: true}}
+
+	// the first analysis comments on the issue
+	err := p.Post(context.Background(), mockEvent, aCommentsList)
+	s.NoError(err)
+	s.Require().Len(posted, 1)
+	s.Equal(linkedIssueBody(42, aCommentsList[0].Comments, "https://github.com/foo/bar/pull/42/files"),
+		posted[0].GetBody())
+
+	// the next one with the same findings doesn't change it
+	compareCalled = false
+	err = p.Post(context.Background(), mockEvent, aCommentsList)
+	s.NoError(err)
+	s.Len(posted, 1)
+	s.Len(edited, 0)
+
+	// and the one with other findings edits it
+	compareCalled = false
+	aCommentsList[0].Comments = aCommentsList[0].Comments[1:]
+	err = p.Post(context.Background(), mockEvent, aCommentsList)
+	s.NoError(err)
+	s.Len(posted, 1)
+	s.Require().Len(edited, 1)
+	s.NotContains(edited[0], "Line comment")
+	s.Contains(edited[0], "File comment")
+}
+
+func (s *PosterTestSuite) TestPostToLinkedIssuesDisabled() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	s.mux.HandleFunc("/repos/foo/bar/issues/7/comments", func(w http.ResponseWriter, r *http.Request) {
+		s.Failf("unexpected request", "%s %s", r.Method, r.URL)
+	})
+
+	p := &Poster{pool: s.pool}
+	err := p.Post(context.Background(), mockEvent, linkedComments)
+	s.NoError(err)
+}
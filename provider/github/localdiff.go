@@ -0,0 +1,208 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/util/ctxlog"
+
+	"github.com/google/go-github/github"
+	"github.com/sergi/go-diff/diffmatchpatch"
+	fdiff "gopkg.in/src-d/go-git.v4/plumbing/format/diff"
+	"gopkg.in/src-d/go-git.v4/utils/diff"
+	log "gopkg.in/src-d/go-log.v1"
+)
+
+// fillMissingPatches computes the patches of the files of the comparison
+// omitted by GitHub, e.g. because their diff is too large, from the contents
+// of the files in the merge base and the head, if LocalDiffFallback is
+// enabled. Binary and renamed files, and the files whose contents can't be
+// retrieved, are left without patch.
+func (p *Poster) fillMissingPatches(
+	ctx context.Context,
+	client *Client,
+	budget *retryBudget,
+	owner, repo string,
+	e *lookout.ReviewEvent,
+	cc *github.CommitsComparison,
+) {
+	if !p.conf.LocalDiffFallback {
+		return
+	}
+
+	base := cc.GetMergeBaseCommit().GetSHA()
+	if base == "" {
+		base = e.Base.Hash
+	}
+
+	for i := range cc.Files {
+		f := &cc.Files[i]
+		// the previous name of the renamed files is not known
+		if f.Patch != nil || f.GetStatus() == "removed" || f.GetStatus() == "renamed" {
+			continue
+		}
+
+		logger := ctxlog.Get(ctx).With(log.Fields{"file": f.GetFilename()})
+
+		patch, err := p.localPatch(ctx, client, budget, owner, repo, base, f)
+		if err != nil {
+			logger.Errorf(err, "can't compute the diff of the file locally")
+			continue
+		}
+
+		if patch == "" {
+			logger.Debugf("skipping the local diff of a binary or unchanged file")
+			continue
+		}
+
+		logger.Debugf("using the local diff of a file without patch")
+		f.Patch = &patch
+	}
+}
+
+// localPatch returns the patch of the file between the base and its blob in
+// the head, or an empty string if the file is binary or unchanged
+func (p *Poster) localPatch(
+	ctx context.Context,
+	client *Client,
+	budget *retryBudget,
+	owner, repo, base string,
+	f *github.CommitFile,
+) (string, error) {
+	to, err := p.getBlob(ctx, client, budget, owner, repo, f.GetSHA())
+	if err != nil {
+		return "", err
+	}
+
+	var from string
+	if f.GetStatus() != "added" {
+		sha, err := p.getBlobSHA(ctx, client, budget, owner, repo, f.GetFilename(), base)
+		if err != nil {
+			return "", err
+		}
+
+		from, err = p.getBlob(ctx, client, budget, owner, repo, sha)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if strings.IndexByte(from, 0) >= 0 || strings.IndexByte(to, 0) >= 0 {
+		return "", nil
+	}
+
+	return unifiedPatch(from, to)
+}
+
+// getBlobSHA returns the SHA of the blob of the file at the given revision
+func (p *Poster) getBlobSHA(
+	ctx context.Context,
+	client *Client,
+	budget *retryBudget,
+	owner, repo, path, ref string,
+) (string, error) {
+	var sha string
+	err := budget.do(ctx, "get contents", func() error {
+		ctx, cancel := withTimeout(ctx, p.compareTimeout)
+		defer cancel()
+
+		content, _, resp, err := client.Repositories.GetContents(ctx, owner, repo, path,
+			&github.RepositoryContentGetOptions{Ref: ref})
+		if err == nil && content == nil {
+			err = fmt.Errorf("%s is not a file", path)
+		}
+		if err == nil {
+			sha = content.GetSHA()
+		}
+
+		return p.handleAPIError(resp, err)
+	})
+
+	return sha, err
+}
+
+// getBlob returns the content of the blob with the given SHA
+func (p *Poster) getBlob(
+	ctx context.Context,
+	client *Client,
+	budget *retryBudget,
+	owner, repo, sha string,
+) (string, error) {
+	var blob *github.Blob
+	err := budget.do(ctx, "get blob", func() error {
+		ctx, cancel := withTimeout(ctx, p.compareTimeout)
+		defer cancel()
+
+		var resp *github.Response
+		var err error
+		blob, resp, err = client.Git.GetBlob(ctx, owner, repo, sha)
+		return p.handleAPIError(resp, err)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	switch blob.GetEncoding() {
+	case "base64":
+		b, err := base64.StdEncoding.DecodeString(blob.GetContent())
+		return string(b), err
+	case "", "utf-8":
+		return blob.GetContent(), nil
+	default:
+		return "", fmt.Errorf("unsupported blob encoding: %s", blob.GetEncoding())
+	}
+}
+
+// unifiedPatch returns the hunks of the unified diff between from and to,
+// with the same number of context lines as GitHub and without the headers
+// of the files, like the patches of the comparisons of the GitHub API
+func unifiedPatch(from, to string) (string, error) {
+	var chunks []fdiff.Chunk
+	for _, d := range diff.Do(from, to) {
+		op := fdiff.Equal
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			op = fdiff.Add
+		case diffmatchpatch.DiffDelete:
+			op = fdiff.Delete
+		}
+
+		chunks = append(chunks, localChunk{content: d.Text, op: op})
+	}
+
+	var buf bytes.Buffer
+	err := fdiff.NewUnifiedEncoder(&buf, fdiff.DefaultContextLines).
+		Encode(localFilePatch{chunks: chunks})
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// localFilePatch is the patch of a single file, without the files, so only
+// its hunks are encoded
+type localFilePatch struct {
+	chunks []fdiff.Chunk
+}
+
+var _ fdiff.Patch = localFilePatch{}
+var _ fdiff.FilePatch = localFilePatch{}
+
+func (p localFilePatch) FilePatches() []fdiff.FilePatch { return []fdiff.FilePatch{p} }
+func (p localFilePatch) Message() string                { return "" }
+func (p localFilePatch) IsBinary() bool                 { return false }
+func (p localFilePatch) Files() (from, to fdiff.File)   { return nil, nil }
+func (p localFilePatch) Chunks() []fdiff.Chunk          { return p.chunks }
+
+type localChunk struct {
+	content string
+	op      fdiff.Operation
+}
+
+func (c localChunk) Content() string       { return c.content }
+func (c localChunk) Type() fdiff.Operation { return c.op }
@@ -0,0 +1,108 @@
+package github
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/src-d/lookout"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnifiedPatch(t *testing.T) {
+	require := require.New(t)
+
+	from := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	to := "1\n2\n3\n4\n5\nsix\n7\n8\n9\n10\n11\n"
+
+	// like git, the header of the hunk includes the line before it
+	patch, err := unifiedPatch(from, to)
+	require.NoError(err)
+	require.Equal(`@@ -3,8 +3,9 @@ 2
+ 3
+ 4
+ 5
+-6
++six
+ 7
+ 8
+ 9
+ 10
++11`, patch)
+
+	// the patch can be used to convert the lines
+	dl := newDiffLines(&github.CommitsComparison{Files: []github.CommitFile{
+		github.CommitFile{Filename: strptr("a.txt"), Patch: &patch},
+	}})
+	line, err := dl.ConvertLine("a.txt", 6, true)
+	require.NoError(err)
+	require.Equal(5, line)
+
+	patch, err = unifiedPatch(from, from)
+	require.NoError(err)
+	require.Equal("", patch)
+}
+
+func (s *PosterTestSuite) TestPostLocalDiffFallback() {
+	s.mux.HandleFunc("/repos/foo/bar/compare/"+hash1+"..."+hash2, func(w http.ResponseWriter, r *http.Request) {
+		cc := &github.CommitsComparison{
+			MergeBaseCommit: &github.RepositoryCommit{SHA: strptr("mergebase")},
+			Files: []github.CommitFile{github.CommitFile{
+				Filename: strptr("large.txt"),
+				SHA:      strptr("headblob"),
+				Status:   strptr("modified"),
+			}}}
+		json.NewEncoder(w).Encode(cc)
+	})
+
+	s.mux.HandleFunc("/repos/foo/bar/contents/large.txt", func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("mergebase", r.URL.Query().Get("ref"))
+		json.NewEncoder(w).Encode(&github.RepositoryContent{
+			Type: strptr("file"),
+			SHA:  strptr("baseblob"),
+		})
+	})
+
+	blobs := map[string]string{
+		"baseblob": "1\n2\n3\n4\n5\n",
+		"headblob": "1\n2\n3\nfour\n5\n",
+	}
+	s.mux.HandleFunc("/repos/foo/bar/git/blobs/", func(w http.ResponseWriter, r *http.Request) {
+		content, ok := blobs[r.URL.Path[len("/repos/foo/bar/git/blobs/"):]]
+		s.True(ok)
+		json.NewEncoder(w).Encode(&github.Blob{
+			Content:  strptr(base64.StdEncoding.EncodeToString([]byte(content))),
+			Encoding: strptr("base64"),
+		})
+	})
+
+	var comments []*github.DraftReviewComment
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		comments = append(comments, req.Comments...)
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{LocalDiffFallback: true}}
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "large.txt", Line: 4, Text: "Line comment"},
+			},
+		}})
+	s.NoError(err)
+
+	s.Equal([]*github.DraftReviewComment{&github.DraftReviewComment{
+		Path:     strptr("large.txt"),
+		Position: intptr(5),
+		Body:     strptr("Line comment"),
+	}}, comments)
+}
@@ -0,0 +1,104 @@
+package github
+
+import (
+	"regexp"
+	"strings"
+)
+
+// tagAttrs matches the well-formed attributes of an HTML tag, up to its
+// closing, so text like "a<b && c>d" is not taken as a tag
+const tagAttrs = `(?:\s+[a-zA-Z_:][-a-zA-Z0-9_:.]*(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?)*\s*/?`
+
+var (
+	// fencePattern matches fenced code blocks, including suggestion blocks.
+	// A fence without closing is considered to end with the text.
+	fencePattern = regexp.MustCompile("(?s)```.*?(?:```|\\z)")
+
+	preTagPattern  = regexp.MustCompile(`(?is)<pre` + tagAttrs + `>(.*?)</pre\s*>`)
+	codeTagPattern = regexp.MustCompile(`(?is)</?code` + tagAttrs + `>`)
+
+	unsafeTagsPattern = regexp.MustCompile(
+		`(?is)<(?:script|style|iframe)` + tagAttrs + `>.*?</(?:script|style|iframe)\s*>`)
+
+	htmlReplacements = []struct {
+		pattern     *regexp.Regexp
+		replacement string
+	}{
+		{regexp.MustCompile(`(?is)<(?:b|strong)` + tagAttrs + `>(.*?)</(?:b|strong)\s*>`), "**$1**"},
+		{regexp.MustCompile(`(?is)<(?:i|em)` + tagAttrs + `>(.*?)</(?:i|em)\s*>`), "_${1}_"},
+		{regexp.MustCompile(`(?is)<code` + tagAttrs + `>(.*?)</code\s*>`), "`$1`"},
+		{regexp.MustCompile(`(?is)<a\s[^<>]*href=["']([^"']*)["'][^<>]*>(.*?)</a\s*>`), "[$2]($1)"},
+		{regexp.MustCompile(`(?i)<br\s*/?>`), "\n"},
+		{regexp.MustCompile(`(?is)<p` + tagAttrs + `>(.*?)</p\s*>`), "$1\n\n"},
+	}
+
+	anyTagPattern = regexp.MustCompile(`</?([a-zA-Z][a-zA-Z0-9]*)` + tagAttrs + `>`)
+
+	// strippedTags are the HTML tags not supported in the comments. Any
+	// other text between angle brackets, e.g. "List<String>", is kept, as
+	// well as the tags rendered by GitHub without a Markdown equivalent,
+	// e.g. details, summary, sub, sup or kbd.
+	strippedTags = map[string]bool{
+		"a": true, "abbr": true, "b": true, "big": true, "blockquote": true,
+		"body": true, "center": true, "cite": true, "code": true,
+		"dd": true, "del": true, "div": true, "dl": true, "dt": true,
+		"em": true, "font": true, "h1": true, "h2": true, "h3": true,
+		"h4": true, "h5": true, "h6": true, "head": true, "hr": true,
+		"html": true, "i": true, "img": true, "ins": true, "li": true,
+		"mark": true, "ol": true, "p": true, "pre": true, "s": true,
+		"small": true, "span": true, "strike": true, "strong": true,
+		"table": true, "tbody": true, "td": true, "tfoot": true, "th": true,
+		"thead": true, "tr": true, "tt": true, "u": true, "ul": true,
+	}
+)
+
+// normalizeHTML converts the known HTML tags in the text to Markdown, and
+// strips the ones not supported. Fenced code blocks, like suggestions, are
+// kept untouched.
+func normalizeHTML(text string) string {
+	var result strings.Builder
+	last := 0
+	for _, loc := range fencePattern.FindAllStringIndex(text, -1) {
+		result.WriteString(normalizeHTMLSegment(text[last:loc[0]]))
+		result.WriteString(text[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	result.WriteString(normalizeHTMLSegment(text[last:]))
+
+	return strings.TrimSpace(result.String())
+}
+
+// normalizeHTMLSegment normalizes a text without fenced code blocks. Its pre
+// blocks are converted to fenced ones, and kept untouched from then on.
+func normalizeHTMLSegment(text string) string {
+	var result strings.Builder
+	last := 0
+	for _, loc := range preTagPattern.FindAllStringSubmatchIndex(text, -1) {
+		result.WriteString(normalizeHTMLTags(text[last:loc[0]]))
+
+		content := codeTagPattern.ReplaceAllString(text[loc[2]:loc[3]], "")
+		result.WriteString("\n```\n" + strings.Trim(content, "\n") + "\n```\n")
+		last = loc[1]
+	}
+	result.WriteString(normalizeHTMLTags(text[last:]))
+
+	return result.String()
+}
+
+// normalizeHTMLTags normalizes a text without code blocks
+func normalizeHTMLTags(text string) string {
+	text = unsafeTagsPattern.ReplaceAllString(text, "")
+
+	for _, r := range htmlReplacements {
+		text = r.pattern.ReplaceAllString(text, r.replacement)
+	}
+
+	return anyTagPattern.ReplaceAllStringFunc(text, func(tag string) string {
+		name := anyTagPattern.FindStringSubmatch(tag)[1]
+		if strippedTags[strings.ToLower(name)] {
+			return ""
+		}
+
+		return tag
+	})
+}
@@ -0,0 +1,53 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeHTML(t *testing.T) {
+	require := require.New(t)
+
+	cases := []struct {
+		text, expected string
+	}{
+		{"plain text", "plain text"},
+		{"<b>bold</b> and <strong>strong</strong>", "**bold** and **strong**"},
+		{"call <code>foo()</code> instead", "call `foo()` instead"},
+		{"<i>italic</i>", "_italic_"},
+		{`see <a href="https://foo.bar">docs</a>`, "see [docs](https://foo.bar)"},
+		{"line1<br>line2<br/>line3", "line1\nline2\nline3"},
+		{"<p>one</p><p>two</p>", "one\n\ntwo"},
+		{"safe<script>alert('xss')</script> text", "safe text"},
+		{"<span class=\"x\">unknown</span> tag", "unknown tag"},
+		{"<details><summary>more</summary>hidden</details>",
+			"<details><summary>more</summary>hidden</details>"},
+		{"<pre><code>x := 1</code></pre>", "```\nx := 1\n```"},
+		{"<!-- marker --> comment", "<!-- marker --> comment"},
+		{"use List<String> instead", "use List<String> instead"},
+		{"Map<String, List<Integer>> type", "Map<String, List<Integer>> type"},
+		{"when a<b && c>d holds", "when a<b && c>d holds"},
+		{"<div align=center>centered</div>", "centered"},
+		{"<pre>a <b>b</b></pre> and <i>c</i>", "```\na <b>b</b>\n```\n and _c_"},
+	}
+
+	for _, c := range cases {
+		require.Equal(c.expected, normalizeHTML(c.text), c.text)
+	}
+}
+
+func TestNormalizeHTMLSuggestion(t *testing.T) {
+	require := require.New(t)
+
+	text := "use <b>this</b>:\n```suggestion\nif a < b && c > <d> {\n```\nand <code>that</code>"
+	expected := "use **this**:\n```suggestion\nif a < b && c > <d> {\n```\nand `that`"
+	require.Equal(expected, normalizeHTML(text))
+
+	text = "unclosed:\n```suggestion\n<b>kept</b>"
+	require.Equal(text, normalizeHTML(text))
+
+	// the pre tags inside fenced blocks are kept too
+	text = "```\n<pre><b>kept</b></pre>\n```"
+	require.Equal(text, normalizeHTML(text))
+}
@@ -0,0 +1,306 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/src-d/lookout/util/ctxlog"
+
+	"github.com/google/go-github/github"
+	log "gopkg.in/src-d/go-log.v1"
+)
+
+const (
+	// MarkerHTML stores the anchor of the comments as a hidden HTML comment
+	// at the end of their body
+	MarkerHTML = "html"
+	// MarkerZeroWidth stores the anchor of the comments as a suffix of
+	// zero-width characters, kept if GitHub strips the HTML comments or the
+	// body is pasted elsewhere
+	MarkerZeroWidth = "zero-width"
+	// MarkerIndex stores the anchor of the comments outside of GitHub, in
+	// MarkerIndexDir, keyed by the comment ID, leaving their body untouched
+	MarkerIndex = "index"
+)
+
+const (
+	// zeroWidthDelim encloses the bits of the zero-width markers
+	zeroWidthDelim = "\u2060"
+	zeroWidthZero  = "\u200b"
+	zeroWidthOne   = "\u200c"
+)
+
+// zeroWidthMarker returns the zero-width marker of the anchor, the bits of
+// its HTML marker encoded as zero-width characters
+func (a anchor) zeroWidthMarker() string {
+	var b strings.Builder
+	b.WriteString(zeroWidthDelim)
+	for _, c := range []byte(a.marker()) {
+		for i := 7; i >= 0; i-- {
+			if c&(1<<uint(i)) != 0 {
+				b.WriteString(zeroWidthOne)
+			} else {
+				b.WriteString(zeroWidthZero)
+			}
+		}
+	}
+	b.WriteString(zeroWidthDelim)
+
+	return b.String()
+}
+
+// parseZeroWidthAnchor returns the text of a comment body without the
+// zero-width anchor marker, and the anchor. ok is false if the body doesn't
+// end with a valid marker.
+func parseZeroWidthAnchor(body string) (text string, a anchor, ok bool) {
+	if !strings.HasSuffix(body, zeroWidthDelim) {
+		return body, anchor{}, false
+	}
+
+	trimmed := strings.TrimSuffix(body, zeroWidthDelim)
+	start := strings.LastIndex(trimmed, zeroWidthDelim)
+	if start < 0 {
+		return body, anchor{}, false
+	}
+
+	var bits []byte
+	for _, r := range trimmed[start+len(zeroWidthDelim):] {
+		switch string(r) {
+		case zeroWidthZero:
+			bits = append(bits, 0)
+		case zeroWidthOne:
+			bits = append(bits, 1)
+		default:
+			return body, anchor{}, false
+		}
+	}
+
+	if len(bits) == 0 || len(bits)%8 != 0 {
+		return body, anchor{}, false
+	}
+
+	marker := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		marker[i/8] = marker[i/8]<<1 | bit
+	}
+
+	if _, a, ok = parseAnchor(string(marker)); !ok {
+		return body, anchor{}, false
+	}
+
+	return trimmed[:start], a, true
+}
+
+// anchorIndex stores the anchors of the comments posted with MarkerIndex
+type anchorIndex interface {
+	get(ctx context.Context, id int64) (anchor, bool, error)
+	put(ctx context.Context, id int64, a anchor) error
+}
+
+// fileAnchorIndex is an anchorIndex saving each anchor as a JSON file,
+// named after the comment ID, in a directory
+type fileAnchorIndex struct {
+	dir string
+}
+
+var _ anchorIndex = &fileAnchorIndex{}
+
+func (i *fileAnchorIndex) path(id int64) string {
+	return filepath.Join(i.dir, strconv.FormatInt(id, 10)+".json")
+}
+
+func (i *fileAnchorIndex) get(ctx context.Context, id int64) (anchor, bool, error) {
+	b, err := ioutil.ReadFile(i.path(id))
+	if os.IsNotExist(err) {
+		return anchor{}, false, nil
+	}
+	if err != nil {
+		return anchor{}, false, err
+	}
+
+	var a anchor
+	if err := json.Unmarshal(b, &a); err != nil {
+		return anchor{}, false, err
+	}
+
+	return a, true, nil
+}
+
+func (i *fileAnchorIndex) put(ctx context.Context, id int64, a anchor) error {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(i.dir, 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(i.path(id), b, 0644)
+}
+
+// getAnchorIndex returns the anchorIndex of MarkerIndexDir, or nil if it's
+// not set
+func (p *Poster) getAnchorIndex() anchorIndex {
+	if p.anchorIndex == nil && p.conf.MarkerIndexDir != "" {
+		p.anchorIndex = &fileAnchorIndex{dir: p.conf.MarkerIndexDir}
+	}
+
+	return p.anchorIndex
+}
+
+// encodeMarker returns the rendered body, with the HTML marker added by
+// AnchorDecorator, with the marker stored as set by MarkerStrategy, and its
+// anchor. The HTML marker is kept for MarkerIndex without MarkerIndexDir. ok
+// is false if the body has no marker.
+func (p *Poster) encodeMarker(body string) (string, anchor, bool) {
+	text, a, ok := parseAnchor(body)
+	if !ok {
+		return body, anchor{}, false
+	}
+
+	switch p.conf.MarkerStrategy {
+	case MarkerZeroWidth:
+		return text + a.zeroWidthMarker(), a, true
+	case MarkerIndex:
+		if p.getAnchorIndex() == nil {
+			return body, a, true
+		}
+
+		return text, a, true
+	default:
+		return body, a, true
+	}
+}
+
+// parseMarker returns the text of a posted comment without its marker, and
+// its anchor. The markers of all the strategies are recognized, so changing
+// MarkerStrategy doesn't lose the anchors of the comments already posted.
+func (p *Poster) parseMarker(ctx context.Context, id int64, body string) (text string, a anchor, ok bool) {
+	if text, a, ok := parseAnchor(body); ok {
+		return text, a, true
+	}
+
+	if text, a, ok := parseZeroWidthAnchor(body); ok {
+		return text, a, true
+	}
+
+	index := p.getAnchorIndex()
+	if index == nil {
+		return body, anchor{}, false
+	}
+
+	a, ok, err := index.get(ctx, id)
+	if err != nil {
+		ctxlog.Get(ctx).With(log.Fields{"comment": id}).
+			Errorf(err, "can't get the anchor of the comment from the index")
+		return body, anchor{}, false
+	}
+
+	return body, a, ok
+}
+
+type indexedCommentKey struct {
+	path     string
+	position int
+	body     string
+}
+
+// encodeMarkers returns a copy of the review with the markers of its
+// comments stored as set by MarkerStrategy, and the anchors to be indexed
+// once it is posted if the strategy is MarkerIndex.
+func (p *Poster) encodeMarkers(
+	req *github.PullRequestReviewRequest,
+) (*github.PullRequestReviewRequest, map[indexedCommentKey]anchor) {
+	if p.conf.MarkerStrategy != MarkerZeroWidth && p.conf.MarkerStrategy != MarkerIndex {
+		return req, nil
+	}
+
+	var anchors map[indexedCommentKey]anchor
+	r := *req
+	r.Comments = make([]*github.DraftReviewComment, len(req.Comments))
+	for i, c := range req.Comments {
+		body, a, ok := p.encodeMarker(c.GetBody())
+		if !ok {
+			r.Comments[i] = c
+			continue
+		}
+
+		comment := *c
+		comment.Body = &body
+		r.Comments[i] = &comment
+
+		if body != c.GetBody() && p.conf.MarkerStrategy == MarkerIndex {
+			if anchors == nil {
+				anchors = make(map[indexedCommentKey]anchor)
+			}
+
+			anchors[indexedCommentKey{c.GetPath(), c.GetPosition(), body}] = a
+		}
+	}
+
+	return &r, anchors
+}
+
+// indexAnchors stores in the anchorIndex the anchors of the comments of a
+// posted review, found by their path, position and body. Errors are only
+// logged, the comments without anchor are posted again on the next analysis.
+func (p *Poster) indexAnchors(
+	ctx context.Context,
+	client *Client,
+	budget *retryBudget,
+	owner, repo string,
+	pr int,
+	reviewID int64,
+	anchors map[indexedCommentKey]anchor,
+) {
+	index := p.getAnchorIndex()
+	if index == nil || len(anchors) == 0 {
+		return
+	}
+
+	logger := ctxlog.Get(ctx).With(log.Fields{"review": reviewID})
+
+	opts := &github.ListOptions{PerPage: p.perPage()}
+	for {
+		var comments []*github.PullRequestComment
+		var resp *github.Response
+		err := budget.do(ctx, "list review comments", func() error {
+			ctx, cancel := withTimeout(ctx, p.postTimeout)
+			defer cancel()
+
+			var err error
+			comments, resp, err = client.PullRequests.ListReviewComments(
+				ctx, owner, repo, int64(pr), reviewID, opts)
+			return p.handleAPIError(resp, err)
+		})
+		if err != nil {
+			logger.Errorf(err, "can't list the comments of the review to index their anchors")
+			return
+		}
+
+		for _, c := range comments {
+			key := indexedCommentKey{c.GetPath(), c.GetPosition(), c.GetBody()}
+			a, ok := anchors[key]
+			if !ok {
+				continue
+			}
+
+			if err := index.put(ctx, c.GetID(), a); err != nil {
+				logger.Errorf(err, "can't index the anchor of the comment")
+				return
+			}
+		}
+
+		if resp.NextPage == 0 {
+			return
+		}
+
+		opts.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,194 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/src-d/lookout"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseZeroWidthAnchor(t *testing.T) {
+	require := require.New(t)
+
+	a := anchor{File: "dir/file:name.go", Line: 12, Hash: lineHash("foo()"), Rule: "SEC001"}
+	marker := a.zeroWidthMarker()
+	for _, r := range marker {
+		require.Contains([]string{zeroWidthDelim, zeroWidthZero, zeroWidthOne}, string(r))
+	}
+
+	text, parsed, ok := parseZeroWidthAnchor("some text" + marker)
+	require.True(ok)
+	require.Equal("some text", text)
+	require.Equal(a, parsed)
+
+	text, _, ok = parseZeroWidthAnchor("some text")
+	require.False(ok)
+	require.Equal("some text", text)
+
+	// the marker is not valid if its bits are cut
+	cut := "some text" + zeroWidthDelim + zeroWidthOne + zeroWidthDelim
+	text, _, ok = parseZeroWidthAnchor(cut)
+	require.False(ok)
+	require.Equal(cut, text)
+}
+
+func TestMarkerStrategies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lookout-markers")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	a := anchor{File: "main.go", Line: 5, Hash: lineHash("3"), Rule: "SEC001"}
+	rendered := "some text\n\n" + a.marker()
+
+	for _, strategy := range []string{"", MarkerHTML, MarkerZeroWidth, MarkerIndex} {
+		t.Run(strategy, func(t *testing.T) {
+			require := require.New(t)
+
+			p := &Poster{conf: ProviderConfig{
+				MarkerStrategy: strategy,
+				MarkerIndexDir: dir,
+			}}
+
+			body, encoded, ok := p.encodeMarker(rendered)
+			require.True(ok)
+			require.Equal(a, encoded)
+
+			switch strategy {
+			case MarkerZeroWidth:
+				require.True(strings.HasPrefix(body, "some text"+zeroWidthDelim))
+				require.NotContains(body, "<!--")
+			case MarkerIndex:
+				require.Equal("some text", body)
+				require.NoError(p.getAnchorIndex().put(context.TODO(), 7, a))
+
+				_, _, ok := p.parseMarker(context.TODO(), 8, body)
+				require.False(ok)
+			default:
+				require.Equal(rendered, body)
+			}
+
+			text, parsed, ok := p.parseMarker(context.TODO(), 7, body)
+			require.True(ok)
+			require.Equal("some text", text)
+			require.Equal(a, parsed)
+		})
+	}
+}
+
+func TestMarkerIndexWithoutDir(t *testing.T) {
+	require := require.New(t)
+
+	a := anchor{File: "main.go", Line: 5, Hash: lineHash("3")}
+	rendered := "some text\n\n" + a.marker()
+
+	p := &Poster{conf: ProviderConfig{MarkerStrategy: MarkerIndex}}
+	body, _, ok := p.encodeMarker(rendered)
+	require.True(ok)
+	require.Equal(rendered, body)
+}
+
+func (s *PosterTestSuite) TestPostAnchoredIndex() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/comments", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.PullRequestComment{})
+	})
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		s.Require().Len(req.Comments, 1)
+		s.Equal("Line comment", req.Comments[0].GetBody())
+
+		json.NewEncoder(w).Encode(&github.PullRequestReview{ID: int64ptr(7)})
+	})
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews/7/comments", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.PullRequestComment{{
+			ID:       int64ptr(100),
+			Path:     strptr("main.go"),
+			Position: intptr(3),
+			Body:     strptr("Line comment"),
+		}})
+	})
+
+	dir, err := ioutil.TempDir("", "lookout-markers")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	p := s.newPoster(ProviderConfig{
+		AnchorComments: true,
+		MarkerStrategy: MarkerIndex,
+		MarkerIndexDir: dir,
+	})
+	p.SetFileGetter(newFileGetterMock(s.T(), "main.go", ""))
+	err = p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "Line comment"},
+			},
+		}})
+	s.NoError(err)
+
+	a, ok, err := p.getAnchorIndex().get(context.TODO(), 100)
+	s.NoError(err)
+	s.True(ok)
+	s.Equal(anchor{File: "main.go", Line: 5, Hash: lineHash("3")}, a)
+}
+
+func (s *PosterTestSuite) TestPostAnchoredIndexLookup() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	dir, err := ioutil.TempDir("", "lookout-markers")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	// comment posted on a previous analysis on line 2, with content "3",
+	// without marker in its body
+	index := &fileAnchorIndex{dir: dir}
+	a := anchor{File: "main.go", Line: 2, Hash: lineHash("3")}
+	s.Require().NoError(index.put(context.TODO(), 100, a))
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/comments", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.PullRequestComment{{
+			ID:   int64ptr(100),
+			Path: strptr("main.go"),
+			Body: strptr("Line comment"),
+		}})
+	})
+
+	posted := false
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		posted = true
+		json.NewEncoder(w).Encode(&github.PullRequestReview{ID: int64ptr(7)})
+	})
+
+	p := s.newPoster(ProviderConfig{
+		AnchorComments: true,
+		MarkerStrategy: MarkerIndex,
+		MarkerIndexDir: dir,
+	})
+	p.SetFileGetter(newFileGetterMock(s.T(), "main.go", "package main\n\n1\n2\n3\n"))
+	err = p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "Line comment"},
+			},
+		}})
+	s.NoError(err)
+
+	// the line comment now on line 5 is not posted again
+	s.False(posted)
+}
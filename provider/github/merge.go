@@ -0,0 +1,191 @@
+package github
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/src-d/lookout"
+)
+
+const (
+	// MergeSameLineCombine combines the comments on the same line into a
+	// single one, with the texts of all of them
+	MergeSameLineCombine = "combine"
+	// MergeSameLinePriority keeps only the comment of the analyzer with the
+	// highest priority on each line, the first one on ties
+	MergeSameLinePriority = "priority"
+	// MergeSameLineDedupe collapses the comments on the same line with the
+	// same text into one, and combines the ones with different texts as
+	// MergeSameLineCombine. It's the default mode
+	MergeSameLineDedupe = "dedupe"
+	// MergeSameLineNone posts all the comments on the same line
+	MergeSameLineNone = "none"
+)
+
+// fileLine is the file and position in the diff of a line comment, or its
+// line if there is no diff
+type fileLine struct {
+	File string
+	Line int32
+}
+
+type sameLineComment struct {
+	group   int
+	comment *lookout.Comment
+}
+
+// mergeSameLineMode returns the ProviderConfig.MergeSameLine mode, or
+// MergeSameLineDedupe if it's empty
+func (p *Poster) mergeSameLineMode() string {
+	if p.conf.MergeSameLine == "" {
+		return MergeSameLineDedupe
+	}
+
+	return p.conf.MergeSameLine
+}
+
+// mergeSameLine merges the comments on the same file and position of the
+// diff, from the same or different analyzers, with the given
+// ProviderConfig.MergeSameLine mode. The comments that can't be placed on
+// the diff, like the ones out of its range, are left as is; without a diff
+// the comments on the same line are merged. The merged comment is posted by
+// the analyzer with the highest AnalyzerConfig.Priority. Unknown modes and
+// global or file comments are left as is. The given comments are not
+// modified.
+func mergeSameLine(
+	mode string,
+	dl *diffLines,
+	aCommentsList []lookout.AnalyzerComments,
+) []lookout.AnalyzerComments {
+	if mode != MergeSameLineCombine && mode != MergeSameLinePriority &&
+		mode != MergeSameLineDedupe {
+		return aCommentsList
+	}
+
+	lines := make(map[fileLine][]sameLineComment)
+	for i, aComments := range aCommentsList {
+		for _, c := range aComments.Comments {
+			if c.File == "" || c.Line < 1 || c.TargetDescription {
+				continue
+			}
+
+			key := fileLine{c.File, c.Line}
+			if dl != nil {
+				pos, err := commentPosition(dl, c)
+				if err != nil {
+					continue
+				}
+
+				key.Line = int32(pos)
+			}
+
+			lines[key] = append(lines[key], sameLineComment{i, c})
+		}
+	}
+
+	// replaced has the merged comment of each winning comment, and nil for
+	// the comments merged into another one
+	replaced := make(map[*lookout.Comment]*lookout.Comment)
+	for _, cs := range lines {
+		if len(cs) < 2 {
+			continue
+		}
+
+		sort.SliceStable(cs, func(i, j int) bool {
+			return aCommentsList[cs[i].group].Config.Priority >
+				aCommentsList[cs[j].group].Config.Priority
+		})
+
+		merged := *cs[0].comment
+		switch mode {
+		case MergeSameLineCombine:
+			combineComments(&merged, aCommentsList, cs)
+		case MergeSameLineDedupe:
+			if unique := uniqueTexts(cs); len(unique) > 1 {
+				combineComments(&merged, aCommentsList, unique)
+			} else {
+				merged.Severity = maxSeverity(cs)
+			}
+		}
+
+		replaced[cs[0].comment] = &merged
+		for _, c := range cs[1:] {
+			replaced[c.comment] = nil
+		}
+	}
+
+	if len(replaced) == 0 {
+		return aCommentsList
+	}
+
+	result := make([]lookout.AnalyzerComments, len(aCommentsList))
+	for i, aComments := range aCommentsList {
+		result[i] = aComments
+		result[i].Comments = nil
+
+		for _, c := range aComments.Comments {
+			if merged, ok := replaced[c]; ok {
+				if merged == nil {
+					continue
+				}
+
+				c = merged
+			}
+
+			result[i].Comments = append(result[i].Comments, c)
+		}
+	}
+
+	return result
+}
+
+// combineComments sets in merged the texts and items of all the comments,
+// prefixed with the name of their analyzer, and the highest severity
+func combineComments(
+	merged *lookout.Comment,
+	aCommentsList []lookout.AnalyzerComments,
+	cs []sameLineComment,
+) {
+	texts := make([]string, len(cs))
+	merged.Items = nil
+	for i, c := range cs {
+		name := aCommentsList[c.group].Config.ShownName()
+		texts[i] = fmt.Sprintf("**%s**: %s", name, c.comment.Text)
+		merged.Items = append(merged.Items, c.comment.Items...)
+
+		if c.comment.Severity > merged.Severity {
+			merged.Severity = c.comment.Severity
+		}
+	}
+
+	merged.Text = strings.Join(texts, "\n\n")
+}
+
+// uniqueTexts returns the first comment of cs with each text, in order
+func uniqueTexts(cs []sameLineComment) []sameLineComment {
+	seen := make(map[string]bool, len(cs))
+	var result []sameLineComment
+	for _, c := range cs {
+		if seen[c.comment.Text] {
+			continue
+		}
+
+		seen[c.comment.Text] = true
+		result = append(result, c)
+	}
+
+	return result
+}
+
+// maxSeverity returns the highest severity of the comments
+func maxSeverity(cs []sameLineComment) lookout.Severity {
+	var max lookout.Severity
+	for _, c := range cs {
+		if c.comment.Severity > max {
+			max = c.comment.Severity
+		}
+	}
+
+	return max
+}
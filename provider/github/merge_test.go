@@ -0,0 +1,167 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/src-d/lookout"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+func sameLineComments() []lookout.AnalyzerComments {
+	return []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "style"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "style",
+					Severity: lookout.WarningSeverity, Items: []string{"indent"}},
+				&lookout.Comment{File: "main.go", Line: 6, Text: "alone"},
+				&lookout.Comment{File: "main.go", Text: "file"},
+			},
+		},
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "sec", DisplayName: "Security", Priority: 1},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "sec",
+					Severity: lookout.ErrorSeverity, RuleID: "SEC001"},
+				&lookout.Comment{File: "main.go", Text: "file"},
+			},
+		},
+	}
+}
+
+func TestMergeSameLineCombine(t *testing.T) {
+	require := require.New(t)
+
+	list := sameLineComments()
+	merged := mergeSameLine(MergeSameLineCombine, nil, list)
+
+	require.Len(merged, 2)
+	require.Equal([]*lookout.Comment{list[0].Comments[1], list[0].Comments[2]},
+		merged[0].Comments)
+	require.Equal([]*lookout.Comment{
+		&lookout.Comment{
+			File:     "main.go",
+			Line:     5,
+			Text:     "**Security**: sec\n\n**style**: style",
+			Severity: lookout.ErrorSeverity,
+			RuleID:   "SEC001",
+			Items:    []string{"indent"},
+		},
+		list[1].Comments[1],
+	}, merged[1].Comments)
+
+	// the given comments are not modified
+	require.Equal(sameLineComments(), list)
+}
+
+func TestMergeSameLinePriority(t *testing.T) {
+	require := require.New(t)
+
+	list := sameLineComments()
+	merged := mergeSameLine(MergeSameLinePriority, nil, list)
+
+	require.Equal([]*lookout.Comment{list[0].Comments[1], list[0].Comments[2]},
+		merged[0].Comments)
+	require.Equal(list[1].Comments, merged[1].Comments)
+
+	// on ties the first comment wins
+	list[1].Config.Priority = 0
+	merged = mergeSameLine(MergeSameLinePriority, nil, list)
+	require.Equal(list[0].Comments, merged[0].Comments)
+	require.Equal([]*lookout.Comment{list[1].Comments[1]}, merged[1].Comments)
+}
+
+func TestMergeSameLineDedupe(t *testing.T) {
+	require := require.New(t)
+
+	list := sameLineComments()
+	list = append(list, lookout.AnalyzerComments{
+		Config: lookout.AnalyzerConfig{Name: "lint"},
+		Comments: []*lookout.Comment{
+			&lookout.Comment{File: "main.go", Line: 5, Text: "style"},
+			&lookout.Comment{File: "main.go", Line: 6, Text: "alone",
+				Severity: lookout.ErrorSeverity},
+		},
+	})
+
+	merged := mergeSameLine(MergeSameLineDedupe, nil, list)
+
+	require.Len(merged, 3)
+	// identical comments are collapsed, keeping the highest severity
+	require.Equal([]*lookout.Comment{
+		&lookout.Comment{
+			File:     "main.go",
+			Line:     6,
+			Text:     "alone",
+			Severity: lookout.ErrorSeverity,
+		},
+		list[0].Comments[2],
+	}, merged[0].Comments)
+	// different texts are combined, without repeating the duplicated ones
+	require.Equal([]*lookout.Comment{
+		&lookout.Comment{
+			File:     "main.go",
+			Line:     5,
+			Text:     "**Security**: sec\n\n**style**: style",
+			Severity: lookout.ErrorSeverity,
+			RuleID:   "SEC001",
+			Items:    []string{"indent"},
+		},
+		list[1].Comments[1],
+	}, merged[1].Comments)
+	require.Empty(merged[2].Comments)
+}
+
+func TestMergeSameLineDisabled(t *testing.T) {
+	require := require.New(t)
+
+	list := sameLineComments()
+	require.Equal(list, mergeSameLine(MergeSameLineNone, nil, list))
+	require.Equal(list, mergeSameLine("unknown", nil, list))
+}
+
+func TestMergeSameLineDiff(t *testing.T) {
+	require := require.New(t)
+
+	dl := newDiffLines(&github.CommitsComparison{
+		Files: []github.CommitFile{github.CommitFile{
+			Filename: strptr("main.go"),
+			Patch:    strptr(mockedPatch),
+		}},
+	})
+
+	list := []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "style"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "dup"},
+				&lookout.Comment{File: "main.go", Line: 50, Text: "out"},
+			},
+		},
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "lint"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "dup"},
+				&lookout.Comment{File: "main.go", Line: 50, Text: "out"},
+			},
+		},
+	}
+
+	merged := mergeSameLine(MergeSameLineDedupe, dl, list)
+
+	// the comments out of the diff are not placed, and left as is
+	require.Equal(list[0].Comments, merged[0].Comments)
+	require.Equal([]*lookout.Comment{list[1].Comments[1]}, merged[1].Comments)
+}
+
+func TestMergeSameLineMode(t *testing.T) {
+	require := require.New(t)
+
+	p := &Poster{}
+	require.Equal(MergeSameLineDedupe, p.mergeSameLineMode())
+
+	p.conf.MergeSameLine = MergeSameLineNone
+	require.Equal(MergeSameLineNone, p.mergeSameLineMode())
+}
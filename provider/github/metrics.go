@@ -0,0 +1,78 @@
+package github
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/src-d/lookout"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	posterCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lookout_poster_calls_total",
+		Help: "Number of calls to the Post and Status methods of the poster, by result.",
+	}, []string{"provider", "operation", "result"})
+	apiRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "lookout_github_api_request_duration_seconds",
+		Help:    "Round-trip latency of the GitHub API requests.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+)
+
+func init() {
+	prometheus.MustRegister(posterCalls, apiRequestDuration)
+}
+
+// results of the poster calls, besides the errors
+const (
+	resultSuccess  = "success"
+	resultDeferred = "deferred"
+	resultOther    = "other"
+)
+
+// observeCall records the result of a Post or Status call of the poster
+func observeCall(operation string, err error) {
+	posterCalls.WithLabelValues(Provider, operation, callResult(err)).Inc()
+}
+
+// callResult returns the result label of a poster call that returned err
+func callResult(err error) string {
+	switch {
+	case err == nil:
+		return resultSuccess
+	case ErrEventNotSupported.Is(err):
+		return "ErrEventNotSupported"
+	case ErrRepoNotAccessible.Is(err):
+		return "ErrRepoNotAccessible"
+	case ErrGitHubAPI.Is(err):
+		return "ErrGitHubAPI"
+	}
+
+	if _, ok := err.(*lookout.PostDeferredError); ok {
+		return resultDeferred
+	}
+
+	return resultOther
+}
+
+// durationRoundTripper records the round-trip latency of the requests. If
+// Base is nil, http.DefaultTransport is used
+type durationRoundTripper struct {
+	Base http.RoundTripper
+}
+
+func (t *durationRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt := t.Base
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	start := time.Now()
+	defer func() {
+		apiRequestDuration.WithLabelValues(req.Method).Observe(time.Since(start).Seconds())
+	}()
+
+	return rt.RoundTrip(req)
+}
@@ -0,0 +1,40 @@
+package github
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/src-d/lookout"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+// callsValue returns the number of poster calls with the given labels
+func callsValue(operation, result string) float64 {
+	return testutil.ToFloat64(posterCalls.WithLabelValues(Provider, operation, result))
+}
+
+// requestsCount returns the number of GitHub API requests observed with the
+// given method
+func requestsCount(t *testing.T, method string) uint64 {
+	var m dto.Metric
+	h := apiRequestDuration.WithLabelValues(method).(prometheus.Histogram)
+	require.NoError(t, h.Write(&m))
+
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestCallResult(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal("success", callResult(nil))
+	require.Equal("ErrGitHubAPI", callResult(ErrGitHubAPI.New()))
+	require.Equal("ErrEventNotSupported", callResult(ErrEventNotSupported.New()))
+	require.Equal("ErrRepoNotAccessible", callResult(ErrRepoNotAccessible.New()))
+	require.Equal("deferred", callResult(&lookout.PostDeferredError{Until: time.Now()}))
+	require.Equal("other", callResult(fmt.Errorf("foo")))
+}
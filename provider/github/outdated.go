@@ -0,0 +1,88 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/src-d/lookout/util/ctxlog"
+
+	"github.com/google/go-github/github"
+	log "gopkg.in/src-d/go-log.v1"
+)
+
+// outdatedPrefix starts the body of the comments marked as outdated, it's
+// used to not mark them again
+const outdatedPrefix = "_Outdated: the commented line was changed._"
+
+// outdatedBody returns the body of an outdated comment, with its previous
+// text collapsed
+func outdatedBody(text string) string {
+	return fmt.Sprintf("%s\n\n<details>\n<summary>Previous comment</summary>\n\n%s\n\n</details>",
+		outdatedPrefix, strings.TrimSpace(text))
+}
+
+// anchorInDiff returns true if the content of the anchored line is still in
+// the patch of its file in the diff. Files without patch, e.g. too large,
+// are considered to still have it, as they can't be checked.
+func anchorInDiff(dl *diffLines, a anchor) bool {
+	patch, err := dl.filePatch(a.File)
+	if ErrFileNotFound.Is(err) {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+
+	contents, err := parseContents(patch)
+	if err != nil {
+		return true
+	}
+
+	for _, content := range contents {
+		if lineHash(content) == a.Hash {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveOutdatedComments marks as outdated the anchored review comments,
+// among the ones already posted in the pull request, whose line is not in
+// the new diff anymore, collapsing their text. The comments that still apply
+// are left untouched, so nobody is notified again. Errors are only logged.
+func (p *Poster) resolveOutdatedComments(
+	ctx context.Context,
+	client *Client,
+	budget *retryBudget,
+	owner, repo string,
+	comments []*github.PullRequestComment,
+	dl *diffLines,
+) {
+	for _, c := range comments {
+		if strings.HasPrefix(c.GetBody(), outdatedPrefix) {
+			continue
+		}
+
+		text, a, ok := p.parseMarker(ctx, c.GetID(), c.GetBody())
+		if !ok || anchorInDiff(dl, a) {
+			continue
+		}
+
+		body := outdatedBody(text)
+		err := budget.do(ctx, "resolve outdated comment", func() error {
+			ctx, cancel := withTimeout(ctx, p.postTimeout)
+			defer cancel()
+
+			_, resp, err := client.PullRequests.EditComment(ctx, owner, repo,
+				int(c.GetID()), &github.PullRequestComment{Body: &body})
+			return p.handleAPIError(resp, err)
+		})
+		if err != nil {
+			ctxlog.Get(ctx).With(log.Fields{
+				"comment": c.GetID(),
+			}).Errorf(err, "can't resolve the outdated comment")
+		}
+	}
+}
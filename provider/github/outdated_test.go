@@ -0,0 +1,22 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnchorInDiff(t *testing.T) {
+	require := require.New(t)
+
+	dl := newDiffLines(&github.CommitsComparison{Files: []github.CommitFile{
+		{Filename: strptr("main.go"), Patch: strptr(mockedPatch)},
+		{Filename: strptr("large.go")},
+	}})
+
+	require.True(anchorInDiff(dl, anchor{File: "main.go", Line: 1, Hash: lineHash("3")}))
+	require.False(anchorInDiff(dl, anchor{File: "main.go", Line: 5, Hash: lineHash("11")}))
+	require.False(anchorInDiff(dl, anchor{File: "other.go", Line: 5, Hash: lineHash("3")}))
+	require.True(anchorInDiff(dl, anchor{File: "large.go", Line: 5, Hash: lineHash("3")}))
+}
@@ -0,0 +1,118 @@
+package github
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/src-d/lookout"
+
+	"github.com/google/go-github/github"
+)
+
+// fileFinding is a rendered comment grouped in the comment of its file when
+// OneCommentPerFile is enabled
+type fileFinding struct {
+	analyzer string
+	comment  *lookout.Comment
+	text     string
+	// position in the diff of the commented line, 0 for the findings out of
+	// the diff
+	position int
+}
+
+// item returns the list item of the finding in the comment of its file,
+// without the anchor marker and with its line, if any
+func (f fileFinding) item() string {
+	text, _, _ := parseAnchor(f.text)
+	text = strings.Replace(strings.TrimSpace(text), "\n", "\n  ", -1)
+	if f.comment.Line < 1 {
+		return "- " + text
+	}
+
+	return fmt.Sprintf("- Line %d: %s", f.comment.Line, text)
+}
+
+// fileFindings groups the findings of a review by file, to post a single
+// inline comment for each file
+type fileFindings struct {
+	files     []string
+	inDiff    map[string][]fileFinding
+	outOfDiff map[string][]fileFinding
+}
+
+func newFileFindings() *fileFindings {
+	return &fileFindings{
+		inDiff:    make(map[string][]fileFinding),
+		outOfDiff: make(map[string][]fileFinding),
+	}
+}
+
+func (f *fileFindings) addFile(file string) {
+	if _, ok := f.inDiff[file]; ok {
+		return
+	}
+
+	if _, ok := f.outOfDiff[file]; ok {
+		return
+	}
+
+	f.files = append(f.files, file)
+}
+
+// add adds a finding on a line of the diff, or a file comment
+func (f *fileFindings) add(analyzer string, c *lookout.Comment, text string, position int) {
+	f.addFile(c.File)
+	f.inDiff[c.File] = append(f.inDiff[c.File], fileFinding{analyzer, c, text, position})
+}
+
+// addOutOfDiff adds a finding on a line out of the diff
+func (f *fileFindings) addOutOfDiff(analyzer string, c *lookout.Comment, text string) {
+	f.addFile(c.File)
+	f.outOfDiff[c.File] = append(f.outOfDiff[c.File], fileFinding{analyzer, c, text, 0})
+}
+
+// comments returns an inline comment for each file with findings in the
+// diff, anchored at the first of them, listing all the findings of the file
+// by line, followed by the ones out of the diff. The findings out of the diff
+// of the files without findings in the diff are returned as not posted.
+func (f *fileFindings) comments(results *eventResults) ([]*github.DraftReviewComment, []fileFinding) {
+	var comments []*github.DraftReviewComment
+	var notPosted []fileFinding
+	for _, file := range f.files {
+		inDiff := f.inDiff[file]
+		outOfDiff := f.outOfDiff[file]
+		if len(inDiff) == 0 {
+			notPosted = append(notPosted, outOfDiff...)
+			continue
+		}
+
+		byLine := func(list []fileFinding) {
+			sort.SliceStable(list, func(i, j int) bool {
+				return list[i].comment.Line < list[j].comment.Line
+			})
+		}
+		byLine(inDiff)
+		byLine(outOfDiff)
+
+		var items []string
+		for _, finding := range inDiff {
+			items = append(items, finding.item())
+		}
+		for _, finding := range outOfDiff {
+			items = append(items, finding.item())
+			results.posted(finding.analyzer, finding.comment)
+		}
+
+		path := file
+		position := inDiff[0].position
+		body := strings.Join(items, "\n")
+		comments = append(comments, &github.DraftReviewComment{
+			Path:     &path,
+			Position: &position,
+			Body:     &body,
+		})
+	}
+
+	return comments, notPosted
+}
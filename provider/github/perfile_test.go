@@ -0,0 +1,33 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/src-d/lookout"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileFindingsComments(t *testing.T) {
+	require := require.New(t)
+
+	a := anchor{File: "main.go", Line: 5, Hash: lineHash("3")}
+	fileComment := &lookout.Comment{File: "main.go", Text: "File comment"}
+	lineComment := &lookout.Comment{File: "main.go", Line: 5, Text: "Line comment"}
+	outOfDiff := &lookout.Comment{File: "other.go", Line: 40, Text: "Out of range comment"}
+
+	files := newFileFindings()
+	files.add("mock", lineComment, "Line comment\n\n"+a.marker(), 3)
+	files.addOutOfDiff("mock", outOfDiff, "Out of range comment")
+	files.add("mock", fileComment, "File comment", 1)
+
+	comments, notPosted := files.comments(nil)
+	require.Len(comments, 1)
+	require.Equal("main.go", comments[0].GetPath())
+	require.Equal(1, comments[0].GetPosition())
+	require.Equal("- File comment\n- Line 5: Line comment", comments[0].GetBody())
+
+	// the file has no findings in the diff
+	require.Len(notPosted, 1)
+	require.Equal(outOfDiff, notPosted[0].comment)
+}
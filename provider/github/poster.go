@@ -2,10 +2,16 @@ package github
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/store"
 	"github.com/src-d/lookout/util/ctxlog"
 
 	"github.com/google/go-github/github"
@@ -18,6 +24,7 @@ import (
 // with 32 comments they got posted by GH return 502 Server Error
 // issue: https://github.com/src-d/lookout/issues/264
 // issue in go-github: https://github.com/google/go-github/issues/540
+// It can be changed with ProviderConfig.MaxCommentsPerReview
 var batchReviewComments = 30
 
 var (
@@ -26,107 +33,610 @@ var (
 	// ErrEventNotSupported signals that this provider does not support the
 	// given event for a given operation.
 	ErrEventNotSupported = errors.NewKind("event not supported")
+	// ErrRepoNotAccessible signals that the GitHub API returned 404 for the
+	// repository, usually because the installation lost access to it.
+	ErrRepoNotAccessible = errors.NewKind("repository not accessible")
 	// errNoComments signals that the PullRequestReviewRequest was not created
 	// because it would not contain any comments
 	errNoComments = errors.NewKind("no comments to post")
+	// errApproveRejected is returned when GitHub rejects an approval
+	errApproveRejected = errors.NewKind("approval rejected")
 )
 
+// IsPermanentError returns true if the error posting an event would happen
+// again when posting it later: the event is not supported, e.g. because of a
+// bad reference, or the repository is not accessible.
+func IsPermanentError(err error) bool {
+	return ErrEventNotSupported.Is(err) || ErrRepoNotAccessible.Is(err)
+}
+
 const (
-	statusTargetURL = "https://github.com/src-d/lookout"
-	statusContext   = "lookout"
+	statusTargetURL      = "https://github.com/src-d/lookout"
+	defaultStatusContext = "lookout"
+	// emptyDiffDescription is the description of the final status of the
+	// pull requests without changed files, if EmptyDiffStatus is enabled
+	emptyDiffDescription = "Nothing to analyze"
 )
 
 // Poster posts comments as Pull Request Reviews.
 type Poster struct {
-	pool *ClientPool
-	conf ProviderConfig
+	pool    *ClientPool
+	conf    ProviderConfig
+	limiter *installationLimiter
+	// timeouts for each request fetching the diff, and for each request
+	// posting to GitHub. If 0, only the caller context applies
+	compareTimeout time.Duration
+	postTimeout    time.Duration
+	// dedupTTL is the age after which the anchored comments already posted
+	// are forgotten, see ProviderConfig.DedupTTL. If 0, they never are
+	dedupTTL time.Duration
+	// retryDelay is the time to wait before the first retry of a failed
+	// request, see ProviderConfig.RetryDelay. If 0, retryDelay is used
+	retryDelay time.Duration
+	// renderer for the comments body, if nil the default one for conf is used
+	renderer CommentRenderer
+	// now returns the current time, if nil time.Now is used
+	now func() time.Time
+	// fileGetter is used to relocate the anchored comments
+	fileGetter lookout.FileGetter
+	// syncer is used to sync the pool on demand when a repository is
+	// missing, it can be nil
+	syncer *debouncedSyncer
+	// posted holds the results of the posted comments until the final status
+	posted postedCommits
+	// heads holds the newest head of the pull requests the statuses are
+	// posted for
+	heads prHeads
+	// lastHeads holds the last head posted for each pull request, used by
+	// LatestPushOnly
+	lastHeads lastHeads
+	// repoLimiter holds the rate limit of each repository, see
+	// ProviderConfig.PerRepoRateLimit
+	repoLimiter repoRateLimiter
+	// findings stores the posted comments to be linked from the final status,
+	// it can be nil
+	findings FindingsStore
+	// anchorIndex stores the anchors of the comments posted with
+	// MarkerIndex, if nil the one of MarkerIndexDir is used
+	anchorIndex anchorIndex
+	// states stores the resolution state of the findings, it can be nil
+	states store.CommentStateOperator
+	// commentsCache stores the review comments listed for each pull request,
+	// if nil the one of ReviewCommentsCacheDir is used
+	commentsCache reviewCommentsCache
 }
 
 var _ lookout.Poster = &Poster{}
 
-// NewPoster creates a new poster for the GitHub API.
-func NewPoster(pool *ClientPool, conf ProviderConfig) *Poster {
-	return &Poster{
+// NewPoster creates a new poster for the GitHub API. An error is returned if
+// the configuration is not valid.
+func NewPoster(pool *ClientPool, conf ProviderConfig) (*Poster, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	p := &Poster{
 		pool: pool,
 		conf: conf,
+		limiter: newInstallationLimiter(
+			conf.InstallationConcurrency,
+			conf.InstallationConcurrencyOverrides),
+		renderer: NewDefaultRenderer(conf),
 	}
+
+	// the durations were validated
+	p.compareTimeout, _ = parseDuration("compare_timeout", conf.CompareTimeout)
+	p.postTimeout, _ = parseDuration("post_timeout", conf.PostTimeout)
+	p.dedupTTL, _ = parseDuration("dedup_ttl", conf.DedupTTL)
+	p.retryDelay, _ = parseDuration("retry_delay", conf.RetryDelay)
+
+	if conf.FindingsDir != "" {
+		p.findings = NewFileFindingsStore(conf.FindingsDir, conf.FindingsURL)
+	}
+
+	return p, nil
 }
 
-// Post posts comments as a Pull Request Review.
-// If the event is not a GitHub Pull Request, ErrEventNotSupported is returned.
-// If a GitHub API request fails, ErrGitHubAPI is returned.
+// SetRenderer sets the CommentRenderer used to render the body of the posted
+// comments, replacing the default one.
+func (p *Poster) SetRenderer(r CommentRenderer) {
+	p.renderer = r
+}
+
+// SetFileGetter sets the FileGetter used to retrieve the files to relocate
+// the anchored comments already posted, see ProviderConfig.AnchorComments.
+func (p *Poster) SetFileGetter(fg lookout.FileGetter) {
+	p.fileGetter = fg
+}
+
+// SetSyncer sets the Syncer used to update the pool of clients when there is
+// no client for the repository of an event, e.g. because the repository was
+// just installed. The pool is synced at most once per minute.
+func (p *Poster) SetSyncer(s Syncer) {
+	p.syncer = newDebouncedSyncer(s, onDemandSyncInterval)
+}
+
+// SetFindingsStore sets the FindingsStore used to store the posted comments
+// of each analysis, to be linked from the target URL of its final status.
+func (p *Poster) SetFindingsStore(s FindingsStore) {
+	p.findings = s
+}
+
+// SetCommentStates sets the CommentStateOperator used to record the state of
+// the findings of each pull request after posting them: open while they are
+// reported, and resolved or outdated once they are not.
+func (p *Poster) SetCommentStates(s store.CommentStateOperator) {
+	p.states = s
+}
+
+// perPage returns the page size of the listings, see ProviderConfig.PerPage
+func (p *Poster) perPage() int {
+	return pageSize(p.conf.PerPage)
+}
+
+func (p *Poster) getRenderer() CommentRenderer {
+	if p.renderer == nil {
+		return NewDefaultRenderer(p.conf)
+	}
+
+	return p.renderer
+}
+
+func (p *Poster) clock() time.Time {
+	if p.now == nil {
+		return time.Now()
+	}
+
+	return p.now()
+}
+
+// parseDuration returns the duration of the config value with the given
+// name, or 0 if it's empty. An error is returned if it's malformed or
+// negative.
+func parseDuration(name, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("can't parse %s: %s", name, err)
+	}
+
+	if d < 0 {
+		return 0, fmt.Errorf("%s can't be negative: %s", name, value)
+	}
+
+	return d, nil
+}
+
+// withTimeout returns a copy of ctx with the given timeout, or a cancelable
+// copy if the timeout is 0
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, d)
+}
+
+// Post posts comments as a Pull Request Review, or as commit comments for
+// push events if PostPushComments is enabled.
+// If the event is not a GitHub Pull Request or such a push,
+// ErrEventNotSupported is returned.
+// If a GitHub API request fails, ErrGitHubAPI is returned once the retry
+// budget of the event is exhausted, or ErrRepoNotAccessible if the API
+// returned 404 for the repository.
+// If posting is not allowed now by the PostSchedule, or the repository
+// exceeded its PerRepoRateLimit, a *lookout.PostDeferredError is returned.
 func (p *Poster) Post(ctx context.Context, e lookout.Event,
-	aCommentsList []lookout.AnalyzerComments) error {
+	aCommentsList []lookout.AnalyzerComments) (err error) {
+	defer func() { observeCall("post", err) }()
+
 	switch ev := e.(type) {
 	case *lookout.ReviewEvent:
-		if ev.Provider != Provider {
+		if provider := p.eventProvider(ev.Provider, ev.Base); provider != Provider {
 			return ErrEventNotSupported.Wrap(
-				fmt.Errorf("unsupported provider: %s", ev.Provider))
+				fmt.Errorf("unsupported provider: %s", provider))
 		}
 
-		return p.postPR(ctx, ev, aCommentsList)
-	default:
-		return ErrEventNotSupported.Wrap(fmt.Errorf("unsupported event type"))
+		return p.syncIfNotAccessible(ctx, p.postPR(ctx, ev, aCommentsList))
+	case *lookout.PushEvent:
+		if !p.conf.PostPushComments {
+			break
+		}
+
+		if provider := p.eventProvider(ev.Provider, ev.Base); provider != Provider {
+			return ErrEventNotSupported.Wrap(
+				fmt.Errorf("unsupported provider: %s", provider))
+		}
+
+		return p.syncIfNotAccessible(ctx, p.postPush(ctx, ev, aCommentsList))
 	}
+
+	return ErrEventNotSupported.Wrap(fmt.Errorf("unsupported event type"))
 }
 
 func (p *Poster) postPR(ctx context.Context, e *lookout.ReviewEvent,
-	aCommentsList []lookout.AnalyzerComments) error {
+	aCommentsList []lookout.AnalyzerComments) (err error) {
 
 	owner, repo, pr, err := p.validatePR(e)
 	if err != nil {
 		return err
 	}
 
-	client, err := p.getClient(owner, repo)
+	until, err := p.conf.PostSchedule.nextAllowed(p.clock())
+	if err != nil {
+		ctxlog.Get(ctx).Errorf(err, "can't check the post schedule, posting anyway")
+	} else if !until.IsZero() {
+		return &lookout.PostDeferredError{Until: until}
+	}
+
+	if err := p.checkRepoRateLimit(ctx, owner, repo); err != nil {
+		return err
+	}
+
+	ctx, results := p.withResults(ctx)
+	defer func() { p.writeResults(ctx, owner, repo, e.Revision(), results, err) }()
+
+	analyzed := aCommentsList
+	aCommentsList = p.filterComments(ctx, aCommentsList)
+	aCommentsList = results.filtered(reasonGenerated,
+		aCommentsList, p.filterGenerated(ctx, &e.Head, aCommentsList))
+
+	client, err := p.getClient(ctx, owner, repo)
+	if err != nil {
+		return err
+	}
+
+	release, err := p.limiter.acquire(ctx, client)
 	if err != nil {
 		return err
 	}
+	defer release()
+
+	budget := p.newRetryBudget(p.conf.RetryBudget)
+	compareBudget := p.compareBudget(budget)
 
 	// TODO: make this request lazily, only if there are comments using
 	// positions.
-	cc, resp, err := client.Repositories.CompareCommits(ctx, owner, repo,
-		e.Base.Hash,
-		e.Head.Hash)
-	if err = p.handleAPIError(resp, err); err != nil {
+	// The positions are mapped against the diff of the commit the review is
+	// posted on, the head of the pull request also for the merge previews.
+	var cc *github.CommitsComparison
+	err = compareBudget.do(ctx, "compare", func() error {
+		ctx, cancel := withTimeout(ctx, p.compareTimeout)
+		defer cancel()
+
+		var resp *github.Response
+		cc, resp, err = client.Repositories.CompareCommits(ctx, owner, repo,
+			e.Base.Hash,
+			prCommit(e))
+		return p.handleAPIError(resp, err)
+	})
+	if err != nil {
 		return err
 	}
 
+	p.fillMissingPatches(ctx, client, budget, owner, repo, e, cc)
 	dl := newDiffLines(cc)
-	review, err := p.createReviewRequest(ctx, aCommentsList, dl, e.Head.Hash)
-	if errNoComments.Is(err) {
-		ctxlog.Get(ctx).Debugf("skipping posting analysis, there are no comments")
+	aCommentsList = p.filterResolvedComments(ctx, dl, aCommentsList)
+
+	blocking := hasBlockingComments(dl, aCommentsList, p.conf.StatusAddedLinesOnly)
+	posted := postedResult{
+		blocking:  blocking,
+		comments:  aCommentsList,
+		analyzers: p.analyzerStatuses(dl, analyzed, aCommentsList),
+	}
+	if len(cc.Files) == 0 && p.conf.EmptyDiffStatus {
+		posted.description = emptyDiffDescription
+	}
+	p.posted.set(e.Head.Hash, posted)
+
+	// there are no lines to comment on, and a review would be empty
+	if len(cc.Files) == 0 {
+		ctxlog.Get(ctx).Infof("skipping posting analysis, the pull request doesn't change any file")
+		results.droppedAll(aCommentsList, reasonEmptyDiff)
 		return nil
 	}
-	if err != nil {
-		return err
+
+	// work in progress pull requests only get the statuses
+	if p.isWIP(ctx, client, budget, owner, repo, pr) {
+		ctxlog.Get(ctx).Infof("skipping posting the comments of a work in progress pull request")
+		results.droppedAll(aCommentsList, reasonWIP)
+		return nil
 	}
 
-	for _, req := range splitReview(review, batchReviewComments) {
-		_, resp, err = client.PullRequests.CreateReview(ctx, owner, repo, pr, req)
-		if err = p.handleAPIError(resp, err); err != nil {
+	if p.conf.UploadSARIF {
+		err := p.uploadSARIF(ctx, client, budget, owner, repo, e, e.Head, aCommentsList)
+		if err != nil {
 			return err
 		}
 	}
 
+	if p.isLargePR(cc) {
+		results.droppedAll(aCommentsList, reasonLargePR)
+		return p.postLargePR(ctx, client, budget, owner, repo, pr, e, cc, aCommentsList)
+	}
+
+	// the summary tallies all the findings, also the ones filtered out below
+	all := aCommentsList
+
+	if p.conf.LatestPushOnly {
+		key := fmt.Sprintf("%s/%s#%d", owner, repo, pr)
+		files, err := p.latestPushFiles(ctx, client, compareBudget, owner, repo,
+			p.lastHeads.get(key), e.Head.Hash)
+		if err != nil {
+			return err
+		}
+
+		if files != nil {
+			aCommentsList = results.filtered(reasonNotPushed,
+				aCommentsList, filterFiles(aCommentsList, files))
+		}
+
+		// the head is recorded once posting succeeds, so the comments of a
+		// failed post are not skipped on the next push
+		defer func() {
+			if err == nil {
+				p.lastHeads.set(key, e.Head.Hash)
+			}
+		}()
+	}
+
+	if p.conf.DescriptionComments == DescriptionCommentsEdit {
+		var notes []descriptionNote
+		aCommentsList, notes = p.splitDescriptionComments(ctx, aCommentsList)
+		p.updateDescription(ctx, client, budget, owner, repo, pr, notes)
+	}
+
+	if p.conf.UseChecks {
+		results.postedAll(aCommentsList)
+		if p.conf.AggregateCheckRun {
+			err = p.postAggregateCheckRun(ctx, client, budget, owner, repo, e, aCommentsList)
+		} else {
+			err = p.postCheckRun(ctx, client, budget, owner, repo, e, aCommentsList)
+		}
+		if err != nil {
+			return err
+		}
+
+		p.postSummary(ctx, client, budget, owner, repo, pr, e, all)
+		p.postLinkedIssues(ctx, client, budget, owner, repo, pr, e, all)
+		p.recordStates(ctx, e, dl, all)
+		return nil
+	}
+
+	// the review comments already posted are listed once, for all the steps
+	// needing them
+	anchored := p.conf.AnchorComments && p.fileGetter != nil
+	var comments []*github.PullRequestComment
+	listed := false
+	if anchored || p.conf.ResolveOutdatedComments || p.conf.SkipExistingComments {
+		var err error
+		comments, err = p.reviewComments(ctx, client, budget, owner, repo, pr)
+		if err != nil {
+			ctxlog.Get(ctx).Errorf(err, "can't list the review comments already posted")
+		}
+
+		listed = err == nil
+	}
+
+	// the files read to relocate the anchors are reused to quote the lines
+	// out of the diff
+	contents := p.fileContents(&e.Head)
+
+	var existing map[anchoredKey]bool
+	if anchored && listed {
+		existing, err = p.anchoredComments(ctx, comments, contents)
+		if err != nil {
+			ctxlog.Get(ctx).Errorf(err, "can't get the anchored comments already posted")
+		}
+	}
+
+	if p.conf.ResolveOutdatedComments && listed {
+		p.resolveOutdatedComments(ctx, client, budget, owner, repo, comments, dl)
+	}
+
+	var previous map[anchoredKey]bool
+	normalize := p.bodyNormalizer()
+	if p.conf.SkipExistingComments && listed {
+		previous = p.existingComments(ctx, comments, normalize)
+	}
+
+	// by default all the analyzers post a single review
+	groups := [][]lookout.AnalyzerComments{aCommentsList}
+	if p.conf.PerAnalyzerReviews {
+		groups = make([][]lookout.AnalyzerComments, 0, len(aCommentsList))
+		for _, aComments := range aCommentsList {
+			groups = append(groups, []lookout.AnalyzerComments{aComments})
+		}
+	}
+
+	for _, group := range groups {
+		review, err := p.createReviewRequest(ctx, group, dl, contents, existing, prCommit(e))
+		if errNoComments.Is(err) {
+			ctxlog.Get(ctx).Debugf("skipping posting analysis, there are no comments")
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if previous != nil {
+			var skipped int
+			review, skipped = skipExistingComments(review, previous, p.conf.DedupeBy, normalize)
+			if skipped > 0 {
+				ctxlog.Get(ctx).With(log.Fields{"skipped": skipped}).
+					Debugf("skipping comments already posted")
+			}
+
+			if review.GetBody() == "" && len(review.Comments) == 0 {
+				ctxlog.Get(ctx).Debugf("skipping posting analysis, all the comments were already posted")
+				continue
+			}
+		}
+
+		event := p.reviewEvent(group)
+		review.Event = &event
+		if event == requestChangesEvent {
+			review = withChangesRequestedMarker(review)
+		}
+
+		parts := lookout.GetPostedParts(ctx)
+		chunks := splitReview(review, p.maxCommentsPerReview(), p.conf.BodyChunkPlacement)
+		for i, req := range chunks {
+			key := chunkKey(owner, repo, pr, req)
+			if parts.Has(key) {
+				ctxlog.Get(ctx).With(log.Fields{
+					"chunk":  i + 1,
+					"chunks": len(chunks),
+				}).Debugf("skipping the review chunk already posted")
+				continue
+			}
+
+			err = p.createReview(ctx, client, budget, owner, repo, pr, req)
+			if err != nil {
+				ctxlog.Get(ctx).With(log.Fields{
+					"chunk":  i + 1,
+					"chunks": len(chunks),
+				}).Errorf(err, "can't post the review chunk, skipping the next ones")
+				return chunkError(err, i, len(chunks))
+			}
+
+			parts.Add(key)
+		}
+	}
+
+	// the changes requested by previous analyses were addressed
+	if p.conf.RequestChangesSeverity != "" && !p.requestsChanges(aCommentsList) {
+		p.dismissChangeRequests(ctx, client, budget, owner, repo, pr)
+	}
+
+	p.updateRequestedReviewer(ctx, client, budget, owner, repo, pr, blocking)
+	p.postSummary(ctx, client, budget, owner, repo, pr, e, all)
+	p.postLinkedIssues(ctx, client, budget, owner, repo, pr, e, all)
+	p.recordStates(ctx, e, dl, all)
+
 	return nil
 }
 
-func splitReview(review *github.PullRequestReviewRequest, n int) []*github.PullRequestReviewRequest {
+// createReview posts the review. Approvals are posted as comments if
+// AllowApprove is disabled, or if GitHub rejects them, e.g. because the app
+// is not allowed to approve the pull requests of its own user.
+func (p *Poster) createReview(
+	ctx context.Context,
+	client *Client,
+	budget *retryBudget,
+	owner, repo string,
+	pr int,
+	req *github.PullRequestReviewRequest,
+) error {
+	if req.GetEvent() == approveEvent && !p.conf.AllowApprove {
+		req = withReviewEvent(req, commentEvent)
+	}
+
+	req, anchors := p.encodeMarkers(req)
+
+	var review *github.PullRequestReview
+	post := func(req *github.PullRequestReviewRequest) error {
+		return budget.doCreate(ctx, "create review", func() error {
+			ctx, cancel := withTimeout(ctx, p.postTimeout)
+			defer cancel()
+
+			var resp *github.Response
+			var err error
+			review, resp, err = client.PullRequests.CreateReview(ctx, owner, repo, pr, req)
+			if req.GetEvent() == approveEvent && resp != nil &&
+				resp.StatusCode == http.StatusUnprocessableEntity {
+				// not retried, the approval would be rejected again
+				return errApproveRejected.Wrap(err)
+			}
+
+			return p.handleAPIError(resp, err)
+		})
+	}
+
+	err := post(req)
+	if errApproveRejected.Is(err) {
+		ctxlog.Get(ctx).Warningf("approving the pull request was rejected, "+
+			"posting the review as a comment: %s", err)
+		err = post(withReviewEvent(req, commentEvent))
+	}
+
+	if err == nil && anchors != nil {
+		p.indexAnchors(ctx, client, budget, owner, repo, pr, review.GetID(), anchors)
+	}
+
+	return err
+}
+
+// withReviewEvent returns a copy of the review with the given event
+func withReviewEvent(req *github.PullRequestReviewRequest, event string) *github.PullRequestReviewRequest {
+	r := *req
+	r.Event = &event
+	return &r
+}
+
+const (
+	// BodyChunkLast posts the body of the reviews split in several chunks
+	// with the last one
+	BodyChunkLast = "last"
+	// BodyChunkFirst posts the body of the reviews split in several chunks
+	// with the first one
+	BodyChunkFirst = "first"
+)
+
+// maxCommentsPerReview returns the max number of comments posted in each
+// review, MaxCommentsPerReview or batchReviewComments if it's not set
+func (p *Poster) maxCommentsPerReview() int {
+	if p.conf.MaxCommentsPerReview > 0 {
+		return p.conf.MaxCommentsPerReview
+	}
+
+	return batchReviewComments
+}
+
+// chunkKey returns the key of a review chunk in lookout.PostedParts, the
+// hash of its request, so the same chunk is not posted twice when the same
+// comments are posted again
+func chunkKey(owner, repo string, pr int, req *github.PullRequestReviewRequest) string {
+	data, _ := json.Marshal(req)
+	sum := sha1.Sum(data)
+	return fmt.Sprintf("%s/%s#%d/review/%s", owner, repo, pr, hex.EncodeToString(sum[:]))
+}
+
+// chunkError returns the error posting the chunk i of a review split in n
+// chunks. The GitHub API errors report which chunk failed.
+func chunkError(err error, i, n int) error {
+	if n == 1 || !ErrGitHubAPI.Is(err) {
+		return err
+	}
+
+	return ErrGitHubAPI.Wrap(fmt.Errorf("review chunk %d of %d: %s",
+		i+1, n, err.(*errors.Error).Cause()))
+}
+
+// splitReview splits the review in chunks of up to n comments. The body is
+// set only to one of them, the first or the last one depending on placement,
+// BodyChunkFirst or BodyChunkLast. An empty or unknown placement is
+// BodyChunkLast. The rest of the chunks have no body, instead of an empty
+// one, so it is omitted from their requests.
+func splitReview(
+	review *github.PullRequestReviewRequest,
+	n int,
+	placement string,
+) []*github.PullRequestReviewRequest {
 	if len(review.Comments) <= n {
 		return []*github.PullRequestReviewRequest{review}
 	}
 
 	var result []*github.PullRequestReviewRequest
 	comments := review.Comments
-	// set body only to the last review
-	emptyBody := ""
 
 	for len(comments) > n {
 		result = append(result, &github.PullRequestReviewRequest{
 			CommitID: review.CommitID,
 			Event:    review.Event,
-			Body:     &emptyBody,
 			Comments: comments[:n],
 		})
 
@@ -137,12 +647,30 @@ func splitReview(review *github.PullRequestReviewRequest, n int) []*github.PullR
 		result = append(result, &github.PullRequestReviewRequest{
 			CommitID: review.CommitID,
 			Event:    review.Event,
-			Body:     &emptyBody,
 			Comments: comments,
 		})
 	}
 
-	result[len(result)-1].Body = review.Body
+	body := review.Body
+	if body != nil && *body == "" {
+		body = nil
+	}
+
+	bodyChunk := result[len(result)-1]
+	if placement == BodyChunkFirst {
+		bodyChunk = result[0]
+	}
+	bodyChunk.Body = body
+
+	// only the chunk with the body requests changes, the others would be
+	// change requests of their own
+	if review.GetEvent() == requestChangesEvent {
+		for _, r := range result {
+			if r != bodyChunk {
+				r.Event = &commentEvent
+			}
+		}
+	}
 
 	return result
 }
@@ -163,16 +691,105 @@ func (p *Poster) validatePR(
 		return
 	}
 
-	name := e.Head.ReferenceName.String()
-	if _, err = fmt.Sscanf(name, "refs/pull/%d/head", &pr); err != nil {
-		err = ErrEventNotSupported.Wrap(fmt.Errorf("bad PR: %s", name))
+	if pr, _, err = parsePRRef(e.Head.ReferenceName); err != nil {
+		err = ErrEventNotSupported.Wrap(err)
+		return
+	}
+
+	if !matchBaseRef(p.conf.BaseRefs, base.ReferenceName) {
+		err = ErrEventNotSupported.Wrap(
+			fmt.Errorf("base reference filtered out: %s", base.ReferenceName))
 		return
 	}
 
 	return
 }
 
+// prCommit returns the commit of the pull request to post reviews and
+// statuses on. When the event head is the merge preview, that's the head of
+// the source branch, since the merge commit is not part of the pull request.
+func prCommit(e *lookout.ReviewEvent) string {
+	if _, side, _ := parsePRRef(e.Head.ReferenceName); side == prMergeSide && e.Source.Hash != "" {
+		return e.Source.Hash
+	}
+
+	return e.Head.Hash
+}
+
+// analysisErrorComments replaces the failed analyses in the list with a
+// global comment explaining the failure, if CommentOnError is enabled, or
+// removes them otherwise.
+func (p *Poster) analysisErrorComments(
+	aCommentsList []lookout.AnalyzerComments,
+) []lookout.AnalyzerComments {
+	result := make([]lookout.AnalyzerComments, 0, len(aCommentsList))
+	for _, aComments := range aCommentsList {
+		if aComments.Error == "" {
+			result = append(result, aComments)
+			continue
+		}
+
+		if !p.conf.CommentOnError {
+			continue
+		}
+
+		result = append(result, lookout.AnalyzerComments{
+			Config: aComments.Config,
+			Comments: []*lookout.Comment{&lookout.Comment{
+				Text: fmt.Sprintf("Analysis failed: %s", aComments.Error),
+			}},
+		})
+	}
+
+	return result
+}
+
+// dropEmptyComments removes the comments without text, or only whitespace,
+// that would be posted as blank comments, unless KeepEmptyComments is
+// enabled. Comments with items are kept, since the items are rendered.
+func (p *Poster) dropEmptyComments(
+	ctx context.Context,
+	aCommentsList []lookout.AnalyzerComments,
+) []lookout.AnalyzerComments {
+	if p.conf.KeepEmptyComments {
+		return aCommentsList
+	}
+
+	result := make([]lookout.AnalyzerComments, len(aCommentsList))
+	for i, aComments := range aCommentsList {
+		result[i] = aComments
+		result[i].Comments = nil
+
+		dropped := 0
+		for _, c := range aComments.Comments {
+			if strings.TrimSpace(c.Text) == "" && len(c.Items) == 0 {
+				dropped++
+				continue
+			}
+
+			result[i].Comments = append(result[i].Comments, c)
+		}
+
+		if dropped > 0 {
+			ctxlog.Get(ctx).With(log.Fields{
+				"analyzer": aComments.Config.Name,
+				"dropped":  dropped,
+			}).Warningf("skipping comments with empty text")
+		}
+	}
+
+	return result
+}
+
 func (p *Poster) handleAPIError(resp *github.Response, err error) error {
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		if err == nil {
+			err = fmt.Errorf("bad HTTP status: %d", resp.StatusCode)
+		}
+
+		return ErrRepoNotAccessible.Wrap(err)
+	}
+
 	if err != nil {
 		return ErrGitHubAPI.Wrap(err)
 	}
@@ -184,27 +801,39 @@ func (p *Poster) handleAPIError(resp *github.Response, err error) error {
 	return ErrGitHubAPI.Wrap(fmt.Errorf("bad HTTP status: %d", resp.StatusCode))
 }
 
-func (p *Poster) addFootnote(aConf lookout.AnalyzerConfig, c *lookout.Comment) string {
-	tmpl := p.conf.CommentFooter
-	url := aConf.Feedback
-
-	if tmpl == "" || url == "" {
-		return c.Text
-	}
-
-	return fmt.Sprintf("%s\n\n%s", c.Text, fmt.Sprintf(tmpl, url))
-}
-
 var (
 	approveEvent        = "APPROVE"
 	requestChangesEvent = "REQUEST_CHANGES"
 	commentEvent        = "COMMENT"
 )
 
+// alreadyPosted returns true if an anchored comment equivalent to c, with
+// the rendered text, was already posted
+func (p *Poster) alreadyPosted(existing map[anchoredKey]bool, c *lookout.Comment, text string) bool {
+	if existing == nil {
+		return false
+	}
+
+	stripped, _, _ := parseAnchor(text)
+	return existing[newAnchoredKey(p.conf.DedupeBy, c.File, int(c.Line), stripped, c.RuleID)]
+}
+
+// commentPosition returns the position in the diff of a line comment, at
+// the end of its block if it's anchored there
+func commentPosition(dl *diffLines, c *lookout.Comment) (int, error) {
+	if c.AnchorPosition == lookout.AnchorEnd {
+		return dl.ConvertBlockEnd(c.File, int(c.Line))
+	}
+
+	return dl.ConvertLine(c.File, int(c.Line), true)
+}
+
 func (p *Poster) createReviewRequest(
 	ctx context.Context,
 	aCommentsList []lookout.AnalyzerComments,
 	dl *diffLines,
+	contents *fileContents,
+	existing map[anchoredKey]bool,
 	commitID string,
 ) (*github.PullRequestReviewRequest, error) {
 	req := &github.PullRequestReviewRequest{
@@ -213,31 +842,71 @@ func (p *Poster) createReviewRequest(
 	}
 
 	logger := ctxlog.Get(ctx)
+	renderer := p.getRenderer()
+	results := getResults(ctx)
 
-	var bodyComments []string
+	var bodySections []string
+	var outOfRange []string
+	var description []string
+	// number of global comments rendered in the body, see MaxGlobalComments
+	var globalShown int
+
+	var files *fileFindings
+	if p.conf.OneCommentPerFile {
+		files = newFileFindings()
+	}
 
 	for _, aComments := range aCommentsList {
+		var bodyComments []string
 		for _, c := range aComments.Comments {
-			text := p.addFootnote(aComments.Config, c)
+			rc := &RenderContext{Analyzer: aComments.Config, Comment: c, dl: dl, files: contents}
 
-			if c.File == "" {
-				bodyComments = append(bodyComments, text)
+			if c.TargetDescription {
+				description = append(description, renderer.Render(ctx, rc))
+				results.posted(aComments.Config.Name, c)
+			} else if c.File == "" {
+				bodyComments = append(bodyComments, renderer.Render(ctx, rc))
+				results.posted(aComments.Config.Name, c)
 			} else if c.Line < 1 {
 				line := 1
+				text := renderer.Render(ctx, rc)
+				if p.alreadyPosted(existing, c, text) {
+					logger.With(log.Fields{
+						"analyzer": aComments.Config.Name,
+						"file":     c.File,
+						"line":     c.Line,
+					}).Debugf("skipping comment already posted")
+					results.dropped(aComments.Config.Name, c, reasonAlreadyPosted)
+					continue
+				}
+
+				if files != nil {
+					files.add(aComments.Config.Name, c, text, line)
+					results.posted(aComments.Config.Name, c)
+					continue
+				}
+
 				comment := &github.DraftReviewComment{
 					Path:     &c.File,
 					Position: &line,
 					Body:     &text,
 				}
 				req.Comments = append(req.Comments, comment)
+				results.posted(aComments.Config.Name, c)
 			} else {
-				line, err := dl.ConvertLine(c.File, int(c.Line), true)
+				line, err := commentPosition(dl, c)
 				if ErrLineOutOfDiff.Is(err) {
 					logger.With(log.Fields{
 						"analyzer": aComments.Config.Name,
 						"file":     c.File,
 						"line":     c.Line,
 					}).Debugf("skipping comment out the diff range")
+					if files != nil {
+						files.addOutOfDiff(aComments.Config.Name, c, renderer.Render(ctx, rc))
+						continue
+					}
+					outOfRange = append(outOfRange, outOfRangeItem(c))
+					results.dropped(aComments.Config.Name, c, reasonOutOfDiff)
 					continue
 				}
 				if ErrLineNotAddition.Is(err) {
@@ -246,6 +915,7 @@ func (p *Poster) createReviewRequest(
 						"file":     c.File,
 						"line":     c.Line,
 					}).Debugf("skipping comment not on an added line (+ in diff)")
+					results.dropped(aComments.Config.Name, c, reasonNotAddition)
 					continue
 				}
 				if ErrFileNotFound.Is(err) {
@@ -254,6 +924,7 @@ func (p *Poster) createReviewRequest(
 						"file":     c.File,
 						"line":     c.Line,
 					}).Warningf("skipping comment on a file not part of the diff")
+					results.dropped(aComments.Config.Name, c, reasonFileNotFound)
 					continue
 				}
 				if ErrBadPatch.Is(err) {
@@ -263,6 +934,7 @@ func (p *Poster) createReviewRequest(
 						"file":     c.File,
 						"patch":    patch,
 					}).Errorf(err, "skipping comment because the diff could not be parsed")
+					results.dropped(aComments.Config.Name, c, reasonBadPatch)
 					continue
 				}
 
@@ -270,17 +942,84 @@ func (p *Poster) createReviewRequest(
 					return nil, err
 				}
 
+				text := renderer.Render(ctx, rc)
+				if p.alreadyPosted(existing, c, text) {
+					logger.With(log.Fields{
+						"analyzer": aComments.Config.Name,
+						"file":     c.File,
+						"line":     c.Line,
+					}).Debugf("skipping comment already posted")
+					results.dropped(aComments.Config.Name, c, reasonAlreadyPosted)
+					continue
+				}
+
+				if files != nil {
+					files.add(aComments.Config.Name, c, text, line)
+					results.posted(aComments.Config.Name, c)
+					continue
+				}
+
 				comment := &github.DraftReviewComment{
 					Path:     &c.File,
 					Position: &line,
 					Body:     &text,
 				}
 				req.Comments = append(req.Comments, comment)
+				results.posted(aComments.Config.Name, c)
+			}
+		}
+
+		if len(bodyComments) == 0 {
+			continue
+		}
+
+		shown, hidden := bodyComments, []string(nil)
+		if max := p.conf.MaxGlobalComments; max > 0 {
+			n := max - globalShown
+			if n < 0 {
+				n = 0
+			}
+
+			if n < len(bodyComments) {
+				shown, hidden = bodyComments[:n], bodyComments[n:]
 			}
 		}
+		globalShown += len(shown)
+
+		section := globalCommentsSection(shown, hidden)
+		// the analyzers are only told apart when they share the review
+		if len(aCommentsList) > 1 {
+			section = fmt.Sprintf("**%s**\n\n%s", aComments.Config.ShownName(), section)
+		}
+
+		bodySections = append(bodySections, section)
+	}
+
+	// the notes on the description go first, apart from the code findings
+	if len(description) > 0 {
+		bodySections = append([]string{descriptionSection(description)}, bodySections...)
+	}
+
+	if files != nil {
+		comments, notPosted := files.comments(results)
+		req.Comments = append(req.Comments, comments...)
+		for _, f := range notPosted {
+			outOfRange = append(outOfRange, outOfRangeItem(f.comment))
+			results.dropped(f.analyzer, f.comment, reasonOutOfDiff)
+		}
+	}
+
+	if len(outOfRange) > 0 && p.conf.ReportOutOfRange {
+		bodySections = append(bodySections, fmt.Sprintf("%s\n\n%s",
+			outOfRangeHeader, strings.Join(outOfRange, "\n")))
 	}
 
-	body := strings.Join(bodyComments, "\n\n")
+	body := strings.Join(bodySections, "\n\n")
+	// without the notice nothing would be posted
+	if body == "" && len(req.Comments) == 0 && len(outOfRange) > 0 && p.conf.NotifyAllOutOfRange {
+		body = fmt.Sprintf("%s\n\n%s", allOutOfRangeNotice(len(outOfRange)),
+			strings.Join(outOfRange, "\n"))
+	}
 	req.Body = &body
 
 	if *req.Body == "" && len(req.Comments) == 0 {
@@ -290,17 +1029,59 @@ func (p *Poster) createReviewRequest(
 	return req, nil
 }
 
+// globalCommentsSection returns the section of the body with the global
+// comments of an analyzer, the hidden ones collapsed in a <details> block
+func globalCommentsSection(shown, hidden []string) string {
+	section := strings.Join(shown, "\n\n")
+	if len(hidden) == 0 {
+		return section
+	}
+
+	summary := fmt.Sprintf("%d more comments", len(hidden))
+	if len(hidden) == 1 {
+		summary = "1 more comment"
+	}
+
+	collapsed := fmt.Sprintf("<details>\n<summary>%s</summary>\n\n%s\n\n</details>",
+		summary, strings.Join(hidden, "\n\n"))
+	if section == "" {
+		return collapsed
+	}
+
+	return section + "\n\n" + collapsed
+}
+
+const outOfRangeHeader = "**Findings outside the diff**"
+
+// allOutOfRangeNotice returns the header of the review posted when all its
+// line comments are out of the diff range
+func allOutOfRangeNotice(n int) string {
+	if n == 1 {
+		return "1 finding was outside the changed lines"
+	}
+
+	return fmt.Sprintf("%d findings were outside the changed lines", n)
+}
+
+// outOfRangeItem returns the list item of the body section for a comment on
+// a line out of the diff, collapsing its text into a single line
+func outOfRangeItem(c *lookout.Comment) string {
+	return fmt.Sprintf("- `%s:%d` %s", c.File, c.Line, strings.Join(strings.Fields(c.Text), " "))
+}
+
 // Status sets the Pull Request global status, visible from the GitHub UI
 // If a GitHub API request fails, ErrGitHubAPI is returned.
-func (p *Poster) Status(ctx context.Context, e lookout.Event, status lookout.AnalysisStatus) error {
+func (p *Poster) Status(ctx context.Context, e lookout.Event, status lookout.AnalysisStatus) (err error) {
+	defer func() { observeCall("status", err) }()
+
 	switch ev := e.(type) {
 	case *lookout.ReviewEvent:
-		if ev.Provider != Provider {
+		if provider := p.eventProvider(ev.Provider, ev.Base); provider != Provider {
 			return ErrEventNotSupported.Wrap(
-				fmt.Errorf("unsupported provider: %s", ev.Provider))
+				fmt.Errorf("unsupported provider: %s", provider))
 		}
 
-		return p.statusPR(ctx, ev, status)
+		return p.syncIfNotAccessible(ctx, p.statusPR(ctx, ev, status))
 	default:
 		return ErrEventNotSupported.Wrap(fmt.Errorf("unsupported event type"))
 	}
@@ -327,46 +1108,163 @@ func statusStrings(s lookout.AnalysisStatus) (string, string, error) {
 		return "pending", "The analysis is in progress", nil
 	case lookout.SuccessAnalysisStatus:
 		return "success", "The analysis was performed", nil
+	case lookout.SkippedAnalysisStatus:
+		// legacy statuses don't have a neutral state
+		return "success", "The analysis was skipped", nil
 	default:
 		return "", "", fmt.Errorf("unsupported AnalysisStatus %s", s)
 	}
 }
 
 func (p *Poster) statusPR(ctx context.Context, e *lookout.ReviewEvent, status lookout.AnalysisStatus) error {
-	owner, repo, _, err := p.validatePR(e)
+	owner, repo, pr, err := p.validatePR(e)
 	if err != nil {
 		return err
 	}
 
-	statusStr, description, err := statusStrings(status)
+	sha, ok := p.heads.target(fmt.Sprintf("%s/%s#%d", owner, repo, pr), prCommit(e),
+		e.UpdatedAt, status != lookout.PendingAnalysisStatus, p.conf.StatusCopyForward)
+	if !ok {
+		ctxlog.Get(ctx).With(log.Fields{
+			"commit": prCommit(e),
+		}).Infof("skipping status, the commit was superseded by a newer head")
+		return nil
+	}
+
+	targetURL := statusTargetURL
+	var analyzers []analyzerStatus
+	var description string
+	var issues int
+	if status != lookout.PendingAnalysisStatus {
+		if posted, ok := p.posted.take(e.Head.Hash); ok {
+			analyzers = posted.analyzers
+			description = posted.description
+			issues = countComments(posted.comments)
+
+			// the final status fails if the posted comments were blocking
+			if posted.blocking && status == lookout.SuccessAnalysisStatus {
+				status = lookout.FailureAnalysisStatus
+			}
+
+			if url, ok := p.storeFindings(ctx, owner, repo, e, posted.comments); ok {
+				targetURL = url
+			}
+		}
+	}
+
+	repoStatus, err := newRepoStatus(status, targetURL,
+		statusContext(p.conf.StatusContextPrefix, ""))
 	if err != nil {
 		return err
 	}
-	targetURL := statusTargetURL
-	context := statusContext
 
-	repoStatus := &github.RepoStatus{
-		State:       &statusStr,
-		TargetURL:   &targetURL,
-		Description: &description,
-		Context:     &context,
+	if description != "" && status == lookout.SuccessAnalysisStatus {
+		repoStatus.Description = &description
+	} else if p.conf.ShowDurationInStatus &&
+		(status == lookout.SuccessAnalysisStatus || status == lookout.FailureAnalysisStatus) {
+		if start, ok := lookout.AnalysisStart(ctx); ok {
+			description := durationDescription(time.Since(start), issues)
+			repoStatus.Description = &description
+		}
+	}
+
+	repoStatuses := []*github.RepoStatus{repoStatus}
+	for _, a := range analyzers {
+		// if posting the comments failed, no analyzer succeeded
+		aStatus := a.status
+		if status == lookout.ErrorAnalysisStatus {
+			aStatus = status
+		}
+
+		repoStatus, err := newRepoStatus(aStatus, targetURL,
+			statusContext(p.conf.StatusContextPrefix, a.name))
+		if err != nil {
+			return err
+		}
+
+		repoStatuses = append(repoStatuses, repoStatus)
 	}
 
-	client, err := p.getClient(owner, repo)
+	client, err := p.getClient(ctx, owner, repo)
 	if err != nil {
 		return err
 	}
 
-	_, _, err = client.Repositories.CreateStatus(ctx, owner, repo, e.CommitRevision.Head.Hash, repoStatus)
+	release, err := p.limiter.acquire(ctx, client)
 	if err != nil {
-		return ErrGitHubAPI.Wrap(err)
+		return err
+	}
+	defer release()
+
+	budget := p.newRetryBudget(p.conf.RetryBudget)
+	for _, repoStatus := range repoStatuses {
+		err := budget.do(ctx, "create status", func() error {
+			ctx, cancel := withTimeout(ctx, p.postTimeout)
+			defer cancel()
+
+			_, resp, err := client.Repositories.CreateStatus(ctx, owner, repo, sha, repoStatus)
+			if err != nil {
+				return p.handleAPIError(resp, err)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (p *Poster) getClient(username, repository string) (*Client, error) {
+func newRepoStatus(
+	status lookout.AnalysisStatus,
+	targetURL, context string,
+) (*github.RepoStatus, error) {
+	state, description, err := statusStrings(status)
+	if err != nil {
+		return nil, err
+	}
+
+	return &github.RepoStatus{
+		State:       &state,
+		TargetURL:   &targetURL,
+		Description: &description,
+		Context:     &context,
+	}, nil
+}
+
+// syncIfNotAccessible syncs the pool of clients if err is
+// ErrRepoNotAccessible and there is a Syncer, so a change in the permissions
+// of the installation is picked up. It returns err.
+func (p *Poster) syncIfNotAccessible(ctx context.Context, err error) error {
+	if p.syncer == nil || !ErrRepoNotAccessible.Is(err) {
+		return err
+	}
+
+	if _, syncErr := p.syncer.Sync(ctx); syncErr != nil {
+		ctxlog.Get(ctx).Errorf(syncErr, "can't sync the clients pool")
+	}
+
+	return err
+}
+
+func (p *Poster) getClient(ctx context.Context, username, repository string) (*Client, error) {
 	client, ok := p.pool.Client(username, repository)
+	if !ok && p.syncer != nil {
+		logger := ctxlog.Get(ctx).With(log.Fields{
+			"repository": username + "/" + repository,
+		})
+
+		synced, err := p.syncer.Sync(ctx)
+		if err != nil {
+			logger.Errorf(err, "can't sync the clients pool")
+		} else if synced {
+			logger.Infof("no client for the repository, clients pool synced")
+			client, ok = p.pool.Client(username, repository)
+		}
+	}
+
 	if !ok {
 		return nil, fmt.Errorf("client for %s/%s doesn't exists", username, repository)
 	}
@@ -3,10 +3,16 @@ package github
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -15,6 +21,7 @@ import (
 	"github.com/google/go-github/github"
 	"github.com/gregjones/httpcache"
 	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/store"
 	"github.com/src-d/lookout/util/cache"
 	"github.com/stretchr/testify/suite"
 	"gopkg.in/src-d/go-git.v4/plumbing"
@@ -109,6 +116,14 @@ func (s *PosterTestSuite) TearDownTest() {
 	s.server.Close()
 }
 
+// newPoster returns a new Poster with the given configuration, that must be
+// valid
+func (s *PosterTestSuite) newPoster(conf ProviderConfig) *Poster {
+	p, err := NewPoster(s.pool, conf)
+	s.Require().NoError(err)
+	return p
+}
+
 var mockedPatch = `@@ -3,0 +3,10 @@
 +1
 +2
@@ -219,41 +234,1492 @@ func (s *PosterTestSuite) TestPostFooter() {
 	s.True(createReviewsCalled)
 }
 
-func (s *PosterTestSuite) TestPostBadProvider() {
-	p := &Poster{pool: s.pool}
+func (s *PosterTestSuite) TestPostQuoteOffendingLine() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	createReviewsCalled := false
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		s.False(createReviewsCalled)
+		createReviewsCalled = true
+
+		body, err := ioutil.ReadAll(r.Body)
+		s.NoError(err)
+
+		expected, _ := json.Marshal(&github.PullRequestReviewRequest{
+			CommitID: &mockEvent.Head.Hash,
+			Body:     strptr("Global comment\n\nAnother global comment"),
+			Event:    strptr(commentEvent),
+			Comments: []*github.DraftReviewComment{&github.DraftReviewComment{
+				Path:     strptr("main.go"),
+				Body:     strptr("File comment"),
+				Position: intptr(1),
+			}, &github.DraftReviewComment{
+				Path:     strptr("main.go"),
+				Position: intptr(3),
+				Body:     strptr("> ```\n> 3\n> ```\n\nLine comment"),
+			}}})
+		s.JSONEq(string(expected), string(body))
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	p := &Poster{
+		pool: s.pool,
+		conf: ProviderConfig{QuoteOffendingLine: true},
+	}
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.NoError(err)
+
+	s.True(createReviewsCalled)
+}
+
+type upperRenderer struct{}
+
+func (r *upperRenderer) Render(ctx context.Context, rc *RenderContext) string {
+	return strings.ToUpper(rc.Comment.Text)
+}
+
+func (s *PosterTestSuite) TestPostCustomRenderer() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	createReviewsCalled := false
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		createReviewsCalled = true
+
+		body, err := ioutil.ReadAll(r.Body)
+		s.NoError(err)
+
+		expected, _ := json.Marshal(&github.PullRequestReviewRequest{
+			CommitID: &mockEvent.Head.Hash,
+			Body:     strptr("GLOBAL COMMENT\n\nANOTHER GLOBAL COMMENT"),
+			Event:    strptr(commentEvent),
+			Comments: []*github.DraftReviewComment{&github.DraftReviewComment{
+				Path:     strptr("main.go"),
+				Body:     strptr("FILE COMMENT"),
+				Position: intptr(1),
+			}, &github.DraftReviewComment{
+				Path:     strptr("main.go"),
+				Position: intptr(3),
+				Body:     strptr("LINE COMMENT"),
+			}}})
+		s.JSONEq(string(expected), string(body))
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	p := s.newPoster(ProviderConfig{QuoteOffendingLine: true})
+	p.SetRenderer(&upperRenderer{})
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.NoError(err)
+
+	s.True(createReviewsCalled)
+}
+
+func (s *PosterTestSuite) TestPostInsideSchedule() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	createReviewsCalled := false
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		createReviewsCalled = true
+	})
+
+	p := &Poster{
+		pool: s.pool,
+		conf: ProviderConfig{PostSchedule: PostSchedule{
+			Windows: []PostWindow{{Start: "09:00", End: "18:00"}},
+		}},
+		now: func() time.Time { return time.Date(2018, 10, 10, 12, 0, 0, 0, time.UTC) },
+	}
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.NoError(err)
+
+	s.True(createReviewsCalled)
+}
+
+func (s *PosterTestSuite) TestPostOutsideSchedule() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	createReviewsCalled := false
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		createReviewsCalled = true
+	})
+
+	p := &Poster{
+		pool: s.pool,
+		conf: ProviderConfig{PostSchedule: PostSchedule{
+			Windows: []PostWindow{{Start: "09:00", End: "18:00"}},
+		}},
+		now: func() time.Time { return time.Date(2018, 10, 10, 20, 0, 0, 0, time.UTC) },
+	}
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.IsType(&lookout.PostDeferredError{}, err)
+	s.Equal(time.Date(2018, 10, 11, 9, 0, 0, 0, time.UTC), err.(*lookout.PostDeferredError).Until)
+
+	s.False(compareCalled)
+	s.False(createReviewsCalled)
+}
+
+var twoAnalyzerComments = []lookout.AnalyzerComments{
+	lookout.AnalyzerComments{
+		Config: lookout.AnalyzerConfig{Name: "first"},
+		Comments: []*lookout.Comment{
+			&lookout.Comment{Text: "First global"},
+			&lookout.Comment{File: "main.go", Line: 5, Text: "First line"},
+		},
+	},
+	lookout.AnalyzerComments{
+		Config: lookout.AnalyzerConfig{Name: "second"},
+		Comments: []*lookout.Comment{
+			&lookout.Comment{Text: "Second global"},
+			&lookout.Comment{File: "main.go", Line: 6, Text: "Second line"},
+		},
+	},
+}
+
+func (s *PosterTestSuite) TestPostTwoAnalyzers() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	createReviewsCalls := 0
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		createReviewsCalls++
+
+		body, err := ioutil.ReadAll(r.Body)
+		s.NoError(err)
+
+		expected, _ := json.Marshal(&github.PullRequestReviewRequest{
+			CommitID: &mockEvent.Head.Hash,
+			Body:     strptr("**first**\n\nFirst global\n\n**second**\n\nSecond global"),
+			Event:    strptr(commentEvent),
+			Comments: []*github.DraftReviewComment{&github.DraftReviewComment{
+				Path:     strptr("main.go"),
+				Position: intptr(3),
+				Body:     strptr("First line"),
+			}, &github.DraftReviewComment{
+				Path:     strptr("main.go"),
+				Position: intptr(4),
+				Body:     strptr("Second line"),
+			}}})
+		s.JSONEq(string(expected), string(body))
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{}}
+	err := p.Post(context.Background(), mockEvent, twoAnalyzerComments)
+	s.NoError(err)
+
+	s.Equal(1, createReviewsCalls)
+}
+
+func (s *PosterTestSuite) TestPostTwoAnalyzersDisplayName() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	var body string
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		body = req.GetBody()
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+	s.mux.HandleFunc("/repos/foo/bar/statuses/"+hash2, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("{}"))
+	})
+
+	dir, err := ioutil.TempDir("", "lookout-findings")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{}}
+	p.SetFindingsStore(NewFileFindingsStore(dir, ""))
+
+	aComments := make([]lookout.AnalyzerComments, len(twoAnalyzerComments))
+	copy(aComments, twoAnalyzerComments)
+	aComments[0].Config.DisplayName = "First Analyzer"
+
+	s.NoError(p.Post(context.Background(), mockEvent, aComments))
+	s.NoError(p.Status(context.Background(), mockEvent, lookout.SuccessAnalysisStatus))
+
+	// the display name is shown in the header
+	s.Equal("**First Analyzer**\n\nFirst global\n\n**second**\n\nSecond global", body)
+
+	// the identifier is kept in the stored findings
+	b, err := ioutil.ReadFile(filepath.Join(dir, "foo", "bar", hash2+".json"))
+	s.Require().NoError(err)
+
+	var payload findingsPayload
+	s.Require().NoError(json.Unmarshal(b, &payload))
+	s.Require().Len(payload.Analyzers, 2)
+	s.Equal("first", payload.Analyzers[0].Name)
+	s.Equal("second", payload.Analyzers[1].Name)
+}
+
+func (s *PosterTestSuite) TestPostReviewPerAnalyzer() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	var bodies []string
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		s.Len(req.Comments, 1)
+		bodies = append(bodies, req.GetBody())
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{PerAnalyzerReviews: true}}
+	err := p.Post(context.Background(), mockEvent, twoAnalyzerComments)
+	s.NoError(err)
+
+	s.Equal([]string{"First global", "Second global"}, bodies)
+}
+
+func (s *PosterTestSuite) TestPostCheckRun() {
+	defer func(n int) { batchCheckAnnotations = n }(batchCheckAnnotations)
+	batchCheckAnnotations = 4
+
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	var created *checkRun
+	s.mux.HandleFunc("/repos/foo/bar/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("POST", r.Method)
+		s.Equal(checksPreviewMediaType, r.Header.Get("Accept"))
+		s.NoError(json.NewDecoder(r.Body).Decode(&created))
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": 7}`))
+	})
+
+	var updated *checkRun
+	s.mux.HandleFunc("/repos/foo/bar/check-runs/7", func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("PATCH", r.Method)
+		s.NoError(json.NewDecoder(r.Body).Decode(&updated))
+
+		w.Write([]byte(`{"id": 7}`))
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{UseChecks: true}}
+	err := p.Post(context.Background(), mockEvent, ruleComments)
+	s.NoError(err)
+
+	s.Require().NotNil(created)
+	s.Equal(mockEvent.Head.Hash, created.HeadSHA)
+	s.Contains(created.Output.Summary, "- SEC001: 3")
+	s.Contains(created.Output.Summary, "**Total: 6**")
+	s.Len(created.Output.Annotations, 4)
+
+	s.Require().NotNil(updated)
+	s.Equal(created.Output.Summary, updated.Output.Summary)
+	s.Len(updated.Output.Annotations, 2)
+	s.Equal("sec 2", updated.Output.Annotations[0].Message)
+	s.Equal("sec 3", updated.Output.Annotations[1].Message)
+}
+
+func (s *PosterTestSuite) TestPostAggregateCheckRun() {
+	defer func(n int) { batchCheckAnnotations = n }(batchCheckAnnotations)
+	batchCheckAnnotations = 2
+
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	var created *checkRun
+	s.mux.HandleFunc("/repos/foo/bar/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("POST", r.Method)
+		s.NoError(json.NewDecoder(r.Body).Decode(&created))
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": 7}`))
+	})
+
+	var updates []*checkRun
+	s.mux.HandleFunc("/repos/foo/bar/check-runs/7", func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("PATCH", r.Method)
+
+		var updated *checkRun
+		s.NoError(json.NewDecoder(r.Body).Decode(&updated))
+		updates = append(updates, updated)
+
+		w.Write([]byte(`{"id": 7}`))
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{UseChecks: true, AggregateCheckRun: true}}
+	err := p.Post(context.Background(), mockEvent, ruleComments)
+	s.NoError(err)
+
+	s.Require().NotNil(created)
+	s.Equal(checkRunName, created.Name)
+	s.Equal(mockEvent.Head.Hash, created.HeadSHA)
+	s.Equal(checkRunInProgress, created.Status)
+	s.Empty(created.Output.Annotations)
+
+	// each analyzer has 3 annotations, posted in 2 batches
+	s.Require().Len(updates, 4)
+
+	first := "### first\n\n" +
+		"- (no rule): 1\n- LINT002: 1\n- SEC001: 1\n\n**Total: 3**\n\nGlobal"
+	for _, u := range updates[:2] {
+		s.Equal(first, u.Output.Summary)
+		s.Empty(u.Status)
+	}
+	s.Equal([]string{"file comment", "lint 1"}, annotationMessages(updates[0]))
+	s.Equal([]string{"sec 1"}, annotationMessages(updates[1]))
+
+	second := first + "\n\n### second\n\n" +
+		"- LINT002: 1\n- SEC001: 2\n\n**Total: 3**"
+	for _, u := range updates[2:] {
+		s.Equal(second, u.Output.Summary)
+	}
+	s.Equal([]string{"lint 2", "sec 2"}, annotationMessages(updates[2]))
+	s.Equal([]string{"sec 3"}, annotationMessages(updates[3]))
+
+	// only the last update completes the check run
+	s.Empty(updates[2].Status)
+	s.Equal(checkRunCompleted, updates[3].Status)
+	s.Equal(checkConclusionNeutral, updates[3].Conclusion)
+}
+
+func annotationMessages(run *checkRun) []string {
+	var messages []string
+	for _, a := range run.Output.Annotations {
+		messages = append(messages, a.Message)
+	}
+
+	return messages
+}
+
+// postEmptyDiff posts mockAnalyzerComments on a pull request without
+// changed files, asserting no review is created, and returns the description
+// of the final status
+func (s *PosterTestSuite) postEmptyDiff(conf ProviderConfig) string {
+	s.mux.HandleFunc("/repos/foo/bar/compare/"+hash1+"..."+hash2, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.CommitsComparison{})
+	})
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		s.Fail("no review must be created")
+	})
+
+	var status *github.RepoStatus
+	s.mux.HandleFunc("/repos/foo/bar/statuses/"+hash2, func(w http.ResponseWriter, r *http.Request) {
+		s.NoError(json.NewDecoder(r.Body).Decode(&status))
+		json.NewEncoder(w).Encode(status)
+	})
+
+	p := &Poster{pool: s.pool, conf: conf}
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.NoError(err)
+
+	err = p.Status(context.Background(), mockEvent, lookout.SuccessAnalysisStatus)
+	s.NoError(err)
+
+	s.Require().NotNil(status)
+	s.Equal("success", status.GetState())
+	return status.GetDescription()
+}
+
+func (s *PosterTestSuite) TestPostEmptyDiff() {
+	s.Equal("The analysis was performed", s.postEmptyDiff(ProviderConfig{}))
+}
+
+func (s *PosterTestSuite) TestPostEmptyDiffStatus() {
+	s.Equal(emptyDiffDescription, s.postEmptyDiff(ProviderConfig{EmptyDiffStatus: true}))
+}
+
+func (s *PosterTestSuite) TestStatusDuration() {
+	s.compareHandle(new(bool))
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(&github.PullRequestReview{})
+	})
+
+	var status *github.RepoStatus
+	s.mux.HandleFunc("/repos/foo/bar/statuses/"+hash2, func(w http.ResponseWriter, r *http.Request) {
+		s.NoError(json.NewDecoder(r.Body).Decode(&status))
+		json.NewEncoder(w).Encode(status)
+	})
+
+	ctx := lookout.WithAnalysisStart(context.Background(), time.Now().Add(-4*time.Second))
+	p := &Poster{pool: s.pool, conf: ProviderConfig{ShowDurationInStatus: true}}
+	s.NoError(p.Post(ctx, mockEvent, mockAnalyzerComments))
+	s.NoError(p.Status(ctx, mockEvent, lookout.SuccessAnalysisStatus))
+
+	s.Require().NotNil(status)
+	s.Equal("success", status.GetState())
+	s.Regexp(`^Analyzed in 4(\.\d)?s, 4 issues found$`, status.GetDescription())
+}
+
+var mockPushEvent = &lookout.PushEvent{
+	Provider: Provider,
+	CommitRevision: lookout.CommitRevision{
+		Base: lookout.ReferencePointer{
+			InternalRepositoryURL: "https://github.com/foo/bar",
+			ReferenceName:         "refs/heads/master",
+			Hash:                  hash1,
+		},
+		Head: lookout.ReferencePointer{
+			InternalRepositoryURL: "https://github.com/foo/bar",
+			ReferenceName:         "refs/heads/master",
+			Hash:                  hash2,
+		}}}
+
+func (s *PosterTestSuite) TestPostPushCommitComments() {
+	var comments []*github.RepositoryComment
+	s.mux.HandleFunc("/repos/foo/bar/commits/"+hash2+"/comments", func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("POST", r.Method)
+
+		var c *github.RepositoryComment
+		s.NoError(json.NewDecoder(r.Body).Decode(&c))
+		comments = append(comments, c)
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(c)
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{
+		PostPushComments: true,
+		EnvironmentLabel: "staging",
+		MaxComments:      1,
+	}}
+	err := p.Post(context.Background(), mockPushEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{Text: "Global comment"},
+				&lookout.Comment{File: "main.go", Line: 5, Text: "Line comment"},
+				&lookout.Comment{File: "main.go", Line: 9, Text: "Other comment"},
+			},
+		}})
+	s.NoError(err)
+
+	// the global comment noting the rest of the line comments is posted last
+	s.Require().Len(comments, 3)
+	s.Equal("**[staging]** Global comment", comments[0].GetBody())
+	s.Equal("", comments[0].GetPath())
+	s.Equal("**[staging]** Line 5: Line comment", comments[1].GetBody())
+	s.Equal("main.go", comments[1].GetPath())
+	s.Contains(comments[2].GetBody(), "**[staging]**")
+	s.Equal("", comments[2].GetPath())
+}
+
+func (s *PosterTestSuite) TestPostAnchoredMovedComment() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	// comment posted on a previous analysis on line 2, with content "3"
+	a := anchor{File: "main.go", Line: 2, Hash: lineHash("3")}
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/comments", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.PullRequestComment{{
+			Path: strptr("main.go"),
+			Body: strptr("Line comment\n\n" + a.marker()),
+		}})
+	})
+
+	createReviewsCalled := false
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		createReviewsCalled = true
+
+		body, err := ioutil.ReadAll(r.Body)
+		s.NoError(err)
+
+		// the line comment now on line 5 is not posted again
+		expected, _ := json.Marshal(&github.PullRequestReviewRequest{
+			CommitID: &mockEvent.Head.Hash,
+			Body:     strptr("Global comment\n\nAnother global comment"),
+			Event:    strptr(commentEvent),
+			Comments: []*github.DraftReviewComment{&github.DraftReviewComment{
+				Path:     strptr("main.go"),
+				Body:     strptr("File comment"),
+				Position: intptr(1),
+			}}})
+		s.JSONEq(string(expected), string(body))
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	p := s.newPoster(ProviderConfig{AnchorComments: true})
+	p.SetFileGetter(newFileGetterMock(s.T(), "main.go", "package main\n\n1\n2\n3\n"))
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.NoError(err)
+
+	s.True(createReviewsCalled)
+}
+
+func (s *PosterTestSuite) TestPostResolveOutdatedComments() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	kept := anchor{File: "main.go", Line: 5, Hash: lineHash("3")}
+	changed := anchor{File: "main.go", Line: 6, Hash: lineHash("removed")}
+	removed := anchor{File: "other.go", Line: 1, Hash: lineHash("3")}
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/comments", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.PullRequestComment{
+			{ID: int64ptr(1), Body: strptr("Still applies\n\n" + kept.marker())},
+			{ID: int64ptr(2), Body: strptr("Line changed\n\n" + changed.marker())},
+			{ID: int64ptr(3), Body: strptr("File removed\n\n" + removed.marker())},
+			{ID: int64ptr(4), Body: strptr("Not anchored")},
+			{ID: int64ptr(5), Body: strptr(outdatedBody("Already outdated"))},
+		})
+	})
+
+	edited := make(map[string]string)
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		id := id
+		s.mux.HandleFunc("/repos/foo/bar/pulls/comments/"+id, func(w http.ResponseWriter, r *http.Request) {
+			s.Equal("PATCH", r.Method)
+
+			var c github.PullRequestComment
+			s.NoError(json.NewDecoder(r.Body).Decode(&c))
+			edited[id] = c.GetBody()
+			json.NewEncoder(w).Encode(&c)
+		})
+	}
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.PullRequestReview{})
+	})
+
+	p := s.newPoster(ProviderConfig{ResolveOutdatedComments: true})
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.NoError(err)
+
+	s.Equal(map[string]string{
+		"2": outdatedBody("Line changed"),
+		"3": outdatedBody("File removed"),
+	}, edited)
+}
+
+func (s *PosterTestSuite) TestPostSkipExistingComments() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	// posted on a previous analysis, when the analyzer had another feedback
+	// URL
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/comments", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.PullRequestComment{
+			{Path: strptr("main.go"), Position: intptr(3),
+				Body: strptr("Line comment\n\nFeedback: https://old.example.com")},
+			{Path: strptr("main.go"), Position: intptr(4),
+				Body: strptr("Another line comment\n\nFeedback: https://old.example.com")},
+		})
+	})
+
+	var comments []*github.DraftReviewComment
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		comments = append(comments, req.Comments...)
+
+		json.NewEncoder(w).Encode(&github.PullRequestReview{})
+	})
+
+	p := s.newPoster(ProviderConfig{
+		SkipExistingComments: true,
+		CommentFooter:        "Feedback: %s",
+	})
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{
+				Name:     "mock",
+				Feedback: "https://new.example.com",
+			},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "Line comment"},
+				&lookout.Comment{File: "main.go", Line: 6, Text: "Changed text"},
+			},
+		}})
+	s.NoError(err)
+
+	s.Require().Len(comments, 1)
+	s.Equal("Changed text\n\nFeedback: https://new.example.com", comments[0].GetBody())
+}
+
+func (s *PosterTestSuite) TestPostListReviewCommentsOnce() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	listCalls := 0
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/comments", func(w http.ResponseWriter, r *http.Request) {
+		listCalls++
+		json.NewEncoder(w).Encode([]*github.PullRequestComment{})
+	})
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.PullRequestReview{})
+	})
+
+	p := s.newPoster(ProviderConfig{
+		AnchorComments:          true,
+		ResolveOutdatedComments: true,
+		SkipExistingComments:    true,
+	})
+	p.SetFileGetter(newFileGetterMock(s.T(), "main.go", "package main\n\n1\n2\n3\n"))
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.NoError(err)
+
+	s.Equal(1, listCalls)
+}
+
+func (s *PosterTestSuite) TestPostAllExistingComments() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/comments", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.PullRequestComment{
+			{Path: strptr("main.go"), Position: intptr(3), Body: strptr("Line comment")},
+		})
+	})
+
+	createReviewsCalled := false
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		createReviewsCalled = true
+		json.NewEncoder(w).Encode(&github.PullRequestReview{})
+	})
+
+	p := s.newPoster(ProviderConfig{SkipExistingComments: true})
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "Line comment"},
+			},
+		}})
+	s.NoError(err)
+
+	s.False(createReviewsCalled)
+}
+
+// postDeduped posts a comment on line 5 of main.go, where a comment with a
+// different text from the rule SEC001 was already posted, and returns if the
+// comment was posted again
+func (s *PosterTestSuite) postDeduped(dedupeBy, rule string) bool {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	a := anchor{File: "main.go", Line: 5, Hash: lineHash("3"), Rule: "SEC001"}
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/comments", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.PullRequestComment{{
+			Path: strptr("main.go"),
+			Body: strptr("Old text\n\n" + a.marker()),
+		}})
+	})
+
+	posted := false
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		posted = true
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	p := s.newPoster(ProviderConfig{AnchorComments: true, DedupeBy: dedupeBy})
+	p.SetFileGetter(newFileGetterMock(s.T(), "main.go", "package main\n\n1\n2\n3\n"))
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "New text", RuleID: rule},
+			},
+		}})
+	s.NoError(err)
+
+	return posted
+}
+
+func (s *PosterTestSuite) TestPostDedupeExact() {
+	s.True(s.postDeduped(DedupeExact, "SEC001"))
+}
+
+func (s *PosterTestSuite) TestPostDedupeFileLine() {
+	s.False(s.postDeduped(DedupeFileLine, "LINT002"))
+}
+
+func (s *PosterTestSuite) TestPostDedupeFileLineRule() {
+	s.False(s.postDeduped(DedupeFileLineRule, "SEC001"))
+}
+
+func (s *PosterTestSuite) TestPostDedupeFileLineOtherRule() {
+	s.True(s.postDeduped(DedupeFileLineRule, "LINT002"))
+}
+
+// postWithDedupTTL posts a comment on line 5 of main.go, where the same
+// comment was already posted age ago, with a DedupTTL of a day, and returns
+// if the comment was posted again
+func (s *PosterTestSuite) postWithDedupTTL(age time.Duration) bool {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	now := time.Date(2019, time.March, 1, 12, 0, 0, 0, time.UTC)
+	created := now.Add(-age)
+
+	a := anchor{File: "main.go", Line: 5, Hash: lineHash("3")}
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/comments", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.PullRequestComment{{
+			Path:      strptr("main.go"),
+			Body:      strptr("Line comment\n\n" + a.marker()),
+			CreatedAt: &created,
+		}})
+	})
+
+	posted := false
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		posted = true
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	p := s.newPoster(ProviderConfig{AnchorComments: true, DedupTTL: "24h"})
+	p.now = func() time.Time { return now }
+	p.SetFileGetter(newFileGetterMock(s.T(), "main.go", "package main\n\n1\n2\n3\n"))
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "Line comment"},
+			},
+		}})
+	s.NoError(err)
+
+	return posted
+}
+
+func (s *PosterTestSuite) TestPostDedupTTLExpired() {
+	s.True(s.postWithDedupTTL(48 * time.Hour))
+}
+
+func (s *PosterTestSuite) TestPostDedupTTLFresh() {
+	s.False(s.postWithDedupTTL(time.Hour))
+}
+
+func (s *PosterTestSuite) TestPostAnchoredMarker() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/comments", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.PullRequestComment{})
+	})
+
+	createReviewsCalled := false
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		createReviewsCalled = true
+
+		var req github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		s.Len(req.Comments, 2)
+
+		a := anchor{File: "main.go", Line: 5, Hash: lineHash("3")}
+		s.Equal("Line comment\n\n"+a.marker(), req.Comments[1].GetBody())
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	p := s.newPoster(ProviderConfig{AnchorComments: true})
+	p.SetFileGetter(newFileGetterMock(s.T(), "main.go", ""))
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.NoError(err)
+
+	s.True(createReviewsCalled)
+}
+
+func (s *PosterTestSuite) TestPostSyncOnMissingRepo() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	createReviewsCalled := false
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		createReviewsCalled = true
+	})
+
+	// the repository is only in the pool after syncing it
+	client, _ := s.pool.Client("foo", "bar")
+	repos := s.pool.ReposByClient(client)
+	pool := NewClientPool()
+	syncer := &syncerMock{fn: func() { pool.Update(client, repos) }}
+
+	p := &Poster{pool: pool}
+	p.SetSyncer(syncer)
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.NoError(err)
+
+	s.Equal(1, syncer.calls)
+	s.True(createReviewsCalled)
+}
+
+func (s *PosterTestSuite) TestPostMissingRepoNoSyncer() {
+	p := &Poster{pool: NewClientPool()}
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.EqualError(err, "client for foo/bar doesn't exists")
+}
+
+func (s *PosterTestSuite) TestPostRepoNotAccessible() {
+	s.mux.HandleFunc("/repos/foo/bar/compare/"+hash1+"..."+hash2, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	syncer := &syncerMock{}
+	p := &Poster{pool: s.pool, conf: ProviderConfig{RetryBudget: 2}}
+	p.SetSyncer(syncer)
+
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.True(ErrRepoNotAccessible.Is(err))
+	s.False(ErrGitHubAPI.Is(err))
+	s.Equal(1, syncer.calls)
+}
+
+func (s *PosterTestSuite) TestStatusRepoNotAccessible() {
+	s.mux.HandleFunc("/repos/foo/bar/statuses/"+hash2, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	p := &Poster{pool: s.pool}
+	err := p.Status(context.Background(), mockEvent, lookout.PendingAnalysisStatus)
+	s.True(ErrRepoNotAccessible.Is(err))
+}
+
+func (s *PosterTestSuite) TestPostBadProvider() {
+	p := &Poster{pool: s.pool}
+
+	err := p.Post(context.Background(), badProviderEvent, mockAnalyzerComments)
+	s.True(ErrEventNotSupported.Is(err))
+	s.Equal("event not supported: unsupported provider: badprovider", err.Error())
+}
+
+func (s *PosterTestSuite) TestPostPushEvent() {
+	p := &Poster{pool: s.pool}
+
+	err := p.Post(context.Background(), &lookout.PushEvent{Provider: Provider}, mockAnalyzerComments)
+	s.True(ErrEventNotSupported.Is(err))
+	s.Equal("event not supported: unsupported event type", err.Error())
+}
+
+func (s *PosterTestSuite) TestPostInferredProvider() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	createReviewsCalled := false
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		createReviewsCalled = true
+		json.NewEncoder(w).Encode(&github.PullRequestReview{})
+	})
+
+	e := *mockEvent
+	e.Provider = ""
+
+	p := &Poster{pool: s.pool}
+	err := p.Post(context.Background(), &e, mockAnalyzerComments)
+	s.True(ErrEventNotSupported.Is(err))
+	s.False(createReviewsCalled)
+
+	p = &Poster{pool: s.pool, conf: ProviderConfig{InferProvider: true}}
+	err = p.Post(context.Background(), &e, mockAnalyzerComments)
+	s.NoError(err)
+	s.True(createReviewsCalled)
+}
+
+func (s *PosterTestSuite) TestPostBadReferenceNoRepository() {
+	p := &Poster{pool: s.pool}
+
+	err := p.Post(context.Background(), noRepoEvent, mockAnalyzerComments)
+	s.True(ErrEventNotSupported.Is(err))
+	s.Equal("event not supported: nil repository", err.Error())
+}
+
+func (s *PosterTestSuite) TestPostBadReference() {
+	p := &Poster{pool: s.pool}
+
+	err := p.Post(context.Background(), badReferenceEvent, mockAnalyzerComments)
+	s.True(ErrEventNotSupported.Is(err))
+	s.Equal("event not supported: bad PR: BAD", err.Error())
+}
+
+func (s *PosterTestSuite) TestPostFilteredBaseRef() {
+	p := &Poster{
+		pool: s.pool,
+		conf: ProviderConfig{BaseRefs: []string{"master"}},
+	}
+
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.True(ErrEventNotSupported.Is(err))
+	s.Equal("event not supported: base reference filtered out: base", err.Error())
+}
+
+func (s *PosterTestSuite) TestPostMatchingBaseRef() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	createReviewsCalled := false
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		createReviewsCalled = true
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	p := &Poster{
+		pool: s.pool,
+		conf: ProviderConfig{BaseRefs: []string{"master", "ba*"}},
+	}
+
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.NoError(err)
+	s.True(createReviewsCalled)
+}
+
+func (s *PosterTestSuite) TestPostHttpError() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	p := &Poster{pool: s.pool}
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.IsType(ErrGitHubAPI.New(), err)
+}
+
+func (s *PosterTestSuite) TestPostHttpErrorMetrics() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	failed := callsValue("post", "ErrGitHubAPI")
+	requests := requestsCount(s.T(), "POST")
+
+	p := &Poster{pool: s.pool}
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.True(ErrGitHubAPI.Is(err))
+
+	s.Equal(failed+1, callsValue("post", "ErrGitHubAPI"))
+	s.Equal(requests+1, requestsCount(s.T(), "POST"))
+}
+
+func (s *PosterTestSuite) TestPostRequestChanges() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	var events, bodies []string
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		events = append(events, req.GetEvent())
+		bodies = append(bodies, req.GetBody())
+
+		json.NewEncoder(w).Encode(&github.PullRequestReview{})
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{
+		RequestChangesSeverity: "ERROR",
+		PerAnalyzerReviews:     true,
+		MergeSameLine:          MergeSameLineNone,
+	}}
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "lint"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "warning",
+					Severity: lookout.WarningSeverity},
+			},
+		},
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "sec"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "error",
+					Severity: lookout.ErrorSeverity},
+			},
+		}})
+	s.NoError(err)
+
+	s.Equal([]string{commentEvent, requestChangesEvent}, events)
+	// the change request is marked to dismiss it later
+	s.Equal([]string{"", changesRequestedMarker}, bodies)
+}
+
+func (s *PosterTestSuite) TestPostSkipPostedChunks() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	// the second chunk fails the first time
+	var requests []github.PullRequestReviewRequest
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		requests = append(requests, req)
+
+		if len(requests) == 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&github.PullRequestReview{})
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{MaxCommentsPerReview: 1}}
+	parts := lookout.NewPostedParts(nil)
+	ctx := lookout.WithPostedParts(context.Background(), parts)
+
+	err := p.Post(ctx, mockEvent, mockAnalyzerComments)
+	s.True(ErrGitHubAPI.Is(err))
+	s.Len(parts.Keys(), 1)
+
+	// posting again only posts the chunk that failed
+	compareCalled = false
+	s.NoError(p.Post(ctx, mockEvent, mockAnalyzerComments))
+	s.Len(requests, 3)
+	s.Equal(requests[1], requests[2])
+	s.Len(parts.Keys(), 2)
+}
+
+func (s *PosterTestSuite) TestPostRecordStates() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.PullRequestReview{})
+	})
+
+	ctx := context.Background()
+	states := &recordingStates{
+		MemCommentStateOperator: store.NewMemCommentStateOperator(),
+		resolutions:             make(map[string]store.CommentResolution),
+	}
+	dl := newDiffLines(&github.CommitsComparison{
+		Files: []github.CommitFile{github.CommitFile{
+			Filename: strptr("main.go"),
+			Patch:    strptr(mockedPatch),
+		}}})
+	fixed := &lookout.Comment{File: "main.go", Line: 7, Text: "fixed"}
+	removed := &lookout.Comment{File: "old.go", Line: 1, Text: "removed"}
+	for _, c := range []*lookout.Comment{fixed, removed, mockComments[2]} {
+		s.NoError(states.UpsertState(ctx, mockEvent, &store.CommentState{
+			ExternalID: commentStateID(dl, c),
+			Analyzer:   "mock",
+			Comment:    *c,
+			Resolution: store.CommentResolutionOpen,
+		}))
+	}
+
+	p := &Poster{pool: s.pool}
+	p.SetCommentStates(states)
+	s.NoError(p.Post(ctx, mockEvent, mockAnalyzerComments))
+
+	open, err := states.OpenFindings(ctx, mockEvent)
+	s.NoError(err)
+
+	var texts []string
+	for _, st := range open {
+		s.Equal("mock", st.Analyzer)
+		texts = append(texts, st.Comment.Text)
+	}
+	s.ElementsMatch([]string{
+		"Global comment", "File comment", "Line comment", "Another global comment",
+	}, texts)
+
+	// the findings not reported anymore are closed
+	s.Equal(store.CommentResolutionResolved, states.resolutions[commentStateID(dl, fixed)])
+	s.Equal(store.CommentResolutionOutdated, states.resolutions[commentStateID(dl, removed)])
+}
+
+// recordingStates is a CommentStateOperator recording the last resolution
+// upserted for each ExternalID
+type recordingStates struct {
+	*store.MemCommentStateOperator
+	resolutions map[string]store.CommentResolution
+}
+
+func (o *recordingStates) UpsertState(ctx context.Context, e lookout.Event, s *store.CommentState) error {
+	o.resolutions[s.ExternalID] = s.Resolution
+	return o.MemCommentStateOperator.UpsertState(ctx, e, s)
+}
+
+func (s *PosterTestSuite) TestPostDismissChangeRequests() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	var events []string
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			fmt.Fprintf(w, `[
+				{"id": 1, "state": "CHANGES_REQUESTED", "body": "%[1]s"},
+				{"id": 2, "state": "CHANGES_REQUESTED", "body": "by someone else"},
+				{"id": 3, "state": "DISMISSED", "body": "%[1]s"},
+				{"id": 4, "state": "COMMENTED"}
+			]`, changesRequestedMarker)
+			return
+		}
+
+		var req github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		events = append(events, req.GetEvent())
+
+		json.NewEncoder(w).Encode(&github.PullRequestReview{})
+	})
+
+	var dismissed []string
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews/", func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("PUT", r.Method)
+		dismissed = append(dismissed, r.URL.Path)
+
+		json.NewEncoder(w).Encode(&github.PullRequestReview{})
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{RequestChangesSeverity: "ERROR"}}
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "lint"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "warning",
+					Severity: lookout.WarningSeverity},
+			},
+		}})
+	s.NoError(err)
+
+	s.Equal([]string{commentEvent}, events)
+	// only the change requests of lookout still requesting changes
+	s.Equal([]string{"/repos/foo/bar/pulls/42/reviews/1/dismissals"}, dismissed)
+}
+
+func (s *PosterTestSuite) TestPostMinSeverity() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	var bodies []string
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		for _, c := range req.Comments {
+			bodies = append(bodies, c.GetBody())
+		}
+
+		json.NewEncoder(w).Encode(&github.PullRequestReview{})
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{
+		MinSeverity:   "WARNING",
+		MergeSameLine: MergeSameLineNone,
+	}}
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "info",
+					Severity: lookout.InfoSeverity},
+				&lookout.Comment{File: "main.go", Line: 5, Text: "warning",
+					Severity: lookout.WarningSeverity},
+				&lookout.Comment{File: "main.go", Line: 5, Text: "error",
+					Severity: lookout.ErrorSeverity},
+				&lookout.Comment{File: "main.go", Line: 5, Text: "no severity"},
+			},
+		}})
+	s.NoError(err)
+
+	s.Equal([]string{"warning", "error", "no severity"}, bodies)
+}
+
+func (s *PosterTestSuite) TestPostAllUnderMinSeverity() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	createReviewsCalled := false
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		createReviewsCalled = true
+		json.NewEncoder(w).Encode(&github.PullRequestReview{})
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{MinSeverity: "WARNING"}}
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "info",
+					Severity: lookout.InfoSeverity},
+			},
+		}})
+	s.NoError(err)
+
+	s.False(createReviewsCalled)
+}
+
+func (s *PosterTestSuite) TestPostFailedReviewChunk() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	calls := 0
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 2 {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&github.PullRequestReview{})
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{MaxCommentsPerReview: 1}}
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "first"},
+				&lookout.Comment{File: "main.go", Line: 6, Text: "second"},
+				&lookout.Comment{File: "main.go", Line: 7, Text: "third"},
+			},
+		}})
+	s.True(ErrGitHubAPI.Is(err))
+	s.Contains(err.Error(), "review chunk 2 of 3")
+	s.Equal(2, calls)
+}
+
+func (s *PosterTestSuite) TestPostRetryBudget() {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = 0
+
+	compareCalls := 0
+	s.mux.HandleFunc("/repos/foo/bar/compare/"+hash1+"..."+hash2, func(w http.ResponseWriter, r *http.Request) {
+		compareCalls++
+		if compareCalls == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		cc := &github.CommitsComparison{
+			Files: []github.CommitFile{github.CommitFile{
+				Filename: strptr("main.go"),
+				Patch:    strptr(mockedPatch),
+			}}}
+		json.NewEncoder(w).Encode(cc)
+	})
+
+	reviewCalls := 0
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		reviewCalls++
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{RetryBudget: 2}}
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.True(ErrGitHubAPI.Is(err))
+
+	s.Equal(2, compareCalls)
+	s.Equal(2, reviewCalls)
+}
+
+func (s *PosterTestSuite) TestPostReviewServerErrorNotRetried() {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = 0
+
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	// the review may have been posted anyway, it's not posted again
+	reviewCalls := 0
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		reviewCalls++
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{RetryBudget: 2}}
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.True(ErrGitHubAPI.Is(err))
+	s.Equal(1, reviewCalls)
+}
+
+func (s *PosterTestSuite) TestPostAnchorBlockEnd() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		s.Require().Len(req.Comments, 2)
+
+		// the block of the ten added lines ends at the last one
+		s.Equal("Block comment", req.Comments[0].GetBody())
+		s.Equal(10, req.Comments[0].GetPosition())
+		s.Equal("Line comment", req.Comments[1].GetBody())
+		s.Equal(3, req.Comments[1].GetPosition())
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	p := &Poster{pool: s.pool}
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 3, Text: "Block comment", AnchorPosition: lookout.AnchorEnd},
+				&lookout.Comment{File: "main.go", Line: 5, Text: "Line comment", AnchorPosition: lookout.AnchorStart},
+			},
+		}})
+	s.NoError(err)
+	s.True(compareCalled)
+}
+
+func (s *PosterTestSuite) TestPostOneCommentPerFile() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		s.Equal("", req.GetBody())
+		s.Require().Len(req.Comments, 1)
+
+		s.Equal("main.go", req.Comments[0].GetPath())
+		s.Equal(2, req.Comments[0].GetPosition())
+		s.Equal("- Line 4: First comment\n"+
+			"- Line 5: Second comment\n"+
+			"  with details\n"+
+			"- Line 40: Out of range comment", req.Comments[0].GetBody())
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{OneCommentPerFile: true}}
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "Second comment\nwith details"},
+				&lookout.Comment{File: "main.go", Line: 40, Text: "Out of range comment"},
+				&lookout.Comment{File: "main.go", Line: 4, Text: "First comment"},
+			},
+		}})
+	s.NoError(err)
+	s.True(compareCalled)
+}
+
+func (s *PosterTestSuite) TestPostCompareRetries() {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = 0
+
+	compareCalls := 0
+	s.mux.HandleFunc("/repos/foo/bar/compare/"+hash1+"..."+hash2, func(w http.ResponseWriter, r *http.Request) {
+		compareCalls++
+		if compareCalls <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		cc := &github.CommitsComparison{
+			Files: []github.CommitFile{github.CommitFile{
+				Filename: strptr("main.go"),
+				Patch:    strptr(mockedPatch),
+			}}}
+		json.NewEncoder(w).Encode(cc)
+	})
+
+	reviewCalls := 0
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		reviewCalls++
+		if reviewCalls == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	// the compare retries don't consume the retry budget of posting
+	p := &Poster{pool: s.pool, conf: ProviderConfig{RetryBudget: 1, CompareRetries: 2}}
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.NoError(err)
+
+	s.Equal(3, compareCalls)
+	s.Equal(2, reviewCalls)
+}
+
+func (s *PosterTestSuite) TestPostCompareRetriesExhausted() {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = 0
+
+	compareCalls := 0
+	s.mux.HandleFunc("/repos/foo/bar/compare/"+hash1+"..."+hash2, func(w http.ResponseWriter, r *http.Request) {
+		compareCalls++
+		w.WriteHeader(http.StatusBadGateway)
+	})
 
-	err := p.Post(context.Background(), badProviderEvent, mockAnalyzerComments)
-	s.True(ErrEventNotSupported.Is(err))
-	s.Equal("event not supported: unsupported provider: badprovider", err.Error())
+	p := &Poster{pool: s.pool, conf: ProviderConfig{RetryBudget: 5, CompareRetries: 1}}
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.True(ErrGitHubAPI.Is(err))
+
+	s.Equal(2, compareCalls)
 }
 
-func (s *PosterTestSuite) TestPostBadReferenceNoRepository() {
-	p := &Poster{pool: s.pool}
+func (s *PosterTestSuite) TestPostAbuseRetryAfter() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
 
-	err := p.Post(context.Background(), noRepoEvent, mockAnalyzerComments)
-	s.True(ErrEventNotSupported.Is(err))
-	s.Equal("event not supported: nil repository", err.Error())
-}
+	var calls []time.Time
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, time.Now())
+		if len(calls) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(&github.ErrorResponse{
+				Message:          "You have triggered an abuse detection mechanism",
+				DocumentationURL: "https://developer.github.com/v3/#abuse-rate-limits",
+			})
+			return
+		}
 
-func (s *PosterTestSuite) TestPostBadReference() {
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	// retry budget is 0, abuse-detection retries don't consume it
 	p := &Poster{pool: s.pool}
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.NoError(err)
 
-	err := p.Post(context.Background(), badReferenceEvent, mockAnalyzerComments)
-	s.True(ErrEventNotSupported.Is(err))
-	s.Equal("event not supported: bad PR: BAD", err.Error())
+	s.Len(calls, 2)
+	s.True(calls[1].Sub(calls[0]) >= time.Second)
 }
 
-func (s *PosterTestSuite) TestPostHttpError() {
+func (s *PosterTestSuite) TestPostAbuseRetryAfterContext() {
 	compareCalled := false
 	s.compareHandle(&compareCalled)
 
+	calls := 0
 	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusInternalServerError)
+		calls++
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&github.ErrorResponse{
+			Message:          "You have triggered an abuse detection mechanism",
+			DocumentationURL: "https://developer.github.com/v3/#abuse-rate-limits",
+		})
 	})
 
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
 	p := &Poster{pool: s.pool}
-	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
-	s.IsType(ErrGitHubAPI.New(), err)
+	err := p.Post(ctx, mockEvent, mockAnalyzerComments)
+	s.True(ErrGitHubAPI.Is(err))
+	s.Equal(1, calls)
 }
 
 func (s *PosterTestSuite) TestPostHttpTimeout() {
@@ -274,6 +1740,53 @@ func (s *PosterTestSuite) TestPostHttpTimeout() {
 	s.IsType(ErrGitHubAPI.New(), err)
 }
 
+func (s *PosterTestSuite) TestPostCompareTimeout() {
+	s.mux.HandleFunc("/repos/foo/bar/compare/"+hash1+"..."+hash2, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	})
+
+	createReviewsCalled := false
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		createReviewsCalled = true
+	})
+
+	p := s.newPoster(ProviderConfig{
+		CompareTimeout: "10ms",
+		PostTimeout:    "1s",
+	})
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.True(ErrGitHubAPI.Is(err))
+	s.False(createReviewsCalled)
+}
+
+func (s *PosterTestSuite) TestPostReviewTimeout() {
+	s.mux.HandleFunc("/repos/foo/bar/compare/"+hash1+"..."+hash2, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+
+		cc := &github.CommitsComparison{
+			Files: []github.CommitFile{github.CommitFile{
+				Filename: strptr("main.go"),
+				Patch:    strptr(mockedPatch),
+			}}}
+		json.NewEncoder(w).Encode(cc)
+	})
+
+	// the handler is still running when the request times out
+	var createReviewsCalled int32
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		atomic.StoreInt32(&createReviewsCalled, 1)
+		time.Sleep(50 * time.Millisecond)
+	})
+
+	p := s.newPoster(ProviderConfig{
+		CompareTimeout: "1s",
+		PostTimeout:    "10ms",
+	})
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.True(ErrGitHubAPI.Is(err))
+	s.EqualValues(1, atomic.LoadInt32(&createReviewsCalled))
+}
+
 func (s *PosterTestSuite) TestPostHttpJSONErr() {
 	compareCalled := false
 	s.compareHandle(&compareCalled)
@@ -385,6 +1898,52 @@ func (s *PosterTestSuite) TestPostAllOutOfRange() {
 	s.False(createReviewsCalled)
 }
 
+func (s *PosterTestSuite) TestPostNotifyAllOutOfRange() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	var reviews []*github.PullRequestReviewRequest
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		reviews = append(reviews, &req)
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	outRangeAnalyzerComments := []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 1, Text: "out of range comment before"},
+				&lookout.Comment{File: "main.go", Line: 205, Text: "out of range comment after"},
+			},
+		}}
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{NotifyAllOutOfRange: true}}
+	err := p.Post(context.Background(), mockEvent, outRangeAnalyzerComments)
+	s.NoError(err)
+
+	s.Require().Len(reviews, 1)
+	s.Len(reviews[0].Comments, 0)
+	s.Equal("2 findings were outside the changed lines\n\n"+
+		"- `main.go:1` out of range comment before\n"+
+		"- `main.go:205` out of range comment after", reviews[0].GetBody())
+
+	// there is no notice if any comment is in the diff
+	compareCalled = false
+	reviews = nil
+	outRangeAnalyzerComments[0].Comments = append(outRangeAnalyzerComments[0].Comments,
+		&lookout.Comment{File: "main.go", Line: 5, Text: "Line comment"})
+	err = p.Post(context.Background(), mockEvent, outRangeAnalyzerComments)
+	s.NoError(err)
+
+	s.Require().Len(reviews, 1)
+	s.Len(reviews[0].Comments, 1)
+	s.Equal("", reviews[0].GetBody())
+}
+
 func (s *PosterTestSuite) TestPostOutOfRangeAndBody() {
 	compareCalled := false
 	s.compareHandle(&compareCalled)
@@ -435,7 +1994,399 @@ func (s *PosterTestSuite) TestPostOutOfRangeAndBody() {
 	err := p.Post(context.Background(), mockEvent, outRangeAnalyzerComments)
 	s.NoError(err)
 
-	s.True(createReviewsCalled)
+	s.True(createReviewsCalled)
+}
+
+func (s *PosterTestSuite) TestPostReportOutOfRange() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	var req github.PullRequestReviewRequest
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{ReportOutOfRange: true}}
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 1, Text: "out of range comment before"},
+				&lookout.Comment{Text: "Body comment"},
+				&lookout.Comment{File: "main.go", Line: 5, Text: "Line comment"},
+				&lookout.Comment{File: "main.go", Line: 205, Text: "out of range\ncomment after"},
+			},
+		}})
+	s.NoError(err)
+
+	s.Equal("Body comment\n\n"+
+		"**Findings outside the diff**\n\n"+
+		"- `main.go:1` out of range comment before\n"+
+		"- `main.go:205` out of range comment after", req.GetBody())
+	s.Len(req.Comments, 1)
+}
+
+// postEmptyComments posts comments with empty text and returns the review
+// created
+func (s *PosterTestSuite) postEmptyComments(p *Poster) *github.PullRequestReviewRequest {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	var req *github.PullRequestReviewRequest
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{Text: " \n"},
+				&lookout.Comment{File: "main.go", Line: 5},
+				&lookout.Comment{File: "main.go", Line: 6, Items: []string{"fix this"}},
+			},
+		}})
+	s.NoError(err)
+	s.Require().NotNil(req)
+
+	return req
+}
+
+func (s *PosterTestSuite) TestPostEmptyCommentsDropped() {
+	p := &Poster{pool: s.pool}
+	req := s.postEmptyComments(p)
+
+	s.Equal("", req.GetBody())
+	s.Require().Len(req.Comments, 1)
+	s.Equal("- [ ] fix this", req.Comments[0].GetBody())
+}
+
+func (s *PosterTestSuite) TestPostEmptyCommentsKept() {
+	p := &Poster{pool: s.pool, conf: ProviderConfig{KeepEmptyComments: true}}
+	req := s.postEmptyComments(p)
+
+	s.Len(req.Comments, 2)
+}
+
+func (s *PosterTestSuite) TestPostMergeSameLine() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	var reqs []*github.PullRequestReviewRequest
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req *github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		reqs = append(reqs, req)
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{MergeSameLine: MergeSameLineCombine}}
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config:   lookout.AnalyzerConfig{Name: "style"},
+			Comments: []*lookout.Comment{&lookout.Comment{File: "main.go", Line: 5, Text: "style"}},
+		},
+		lookout.AnalyzerComments{
+			Config:   lookout.AnalyzerConfig{Name: "sec", Priority: 1},
+			Comments: []*lookout.Comment{&lookout.Comment{File: "main.go", Line: 5, Text: "sec"}},
+		}})
+	s.NoError(err)
+
+	s.Require().Len(reqs, 1)
+	s.Require().Len(reqs[0].Comments, 1)
+	s.Equal("main.go", reqs[0].Comments[0].GetPath())
+	s.Equal("**sec**: sec\n\n**style**: style", reqs[0].Comments[0].GetBody())
+}
+
+func (s *PosterTestSuite) TestPostMergeSameLineDefault() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	var reqs []*github.PullRequestReviewRequest
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req *github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		reqs = append(reqs, req)
+
+		json.NewEncoder(w).Encode(&github.PullRequestReview{})
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{ReportOutOfRange: true}}
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "style"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "same"},
+				&lookout.Comment{File: "main.go", Line: 50, Text: "out"},
+			},
+		},
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "lint"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "same"},
+				&lookout.Comment{File: "main.go", Line: 50, Text: "out"},
+			},
+		}})
+	s.NoError(err)
+
+	// the identical comments are collapsed, the ones out of the diff are
+	// listed as they are
+	s.Require().Len(reqs, 1)
+	s.Require().Len(reqs[0].Comments, 1)
+	s.Equal("same", reqs[0].Comments[0].GetBody())
+	s.Equal(2, strings.Count(reqs[0].GetBody(), "main.go:50"))
+}
+
+func (s *PosterTestSuite) TestPostLargePR() {
+	s.mux.HandleFunc("/repos/foo/bar/compare/"+hash1+"..."+hash2, func(w http.ResponseWriter, r *http.Request) {
+		cc := &github.CommitsComparison{}
+		for _, f := range []string{"main.go", "other.go", "README.md"} {
+			cc.Files = append(cc.Files, github.CommitFile{
+				Filename: strptr(f),
+				Patch:    strptr(mockedPatch),
+			})
+		}
+		json.NewEncoder(w).Encode(cc)
+	})
+
+	var reqs []*github.PullRequestReviewRequest
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req *github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		reqs = append(reqs, req)
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{
+		MaxDiffFiles:   2,
+		LargePRMessage: "Too large: %d files, %d findings",
+	}}
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.NoError(err)
+
+	s.Require().Len(reqs, 1)
+	s.Equal("Too large: 3 files, 4 findings", reqs[0].GetBody())
+	s.Empty(reqs[0].Comments)
+}
+
+// createApproval posts an approving review and returns the events of the
+// reviews received, the approvals are rejected with a 422 if reject is true
+func (s *PosterTestSuite) createApproval(p *Poster, reject bool) []string {
+	var events []string
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		events = append(events, req.GetEvent())
+
+		if reject && req.GetEvent() == approveEvent {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(w, `{"message": "Can not approve your own pull request"}`)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&github.PullRequestReview{})
+	})
+
+	client, ok := s.pool.Client("foo", "bar")
+	s.Require().True(ok)
+
+	err := p.createReview(context.Background(), client, &retryBudget{left: 2}, "foo", "bar", 42,
+		&github.PullRequestReviewRequest{
+			CommitID: strptr(hash2),
+			Body:     strptr("LGTM"),
+			Event:    strptr(approveEvent),
+		})
+	s.NoError(err)
+
+	return events
+}
+
+func (s *PosterTestSuite) TestCreateReviewApprove() {
+	p := &Poster{pool: s.pool, conf: ProviderConfig{AllowApprove: true}}
+	s.Equal([]string{approveEvent}, s.createApproval(p, false))
+}
+
+func (s *PosterTestSuite) TestCreateReviewApproveRejected() {
+	p := &Poster{pool: s.pool, conf: ProviderConfig{AllowApprove: true}}
+	s.Equal([]string{approveEvent, commentEvent}, s.createApproval(p, true))
+}
+
+func (s *PosterTestSuite) TestCreateReviewApproveNotAllowed() {
+	p := &Poster{pool: s.pool}
+	s.Equal([]string{commentEvent}, s.createApproval(p, false))
+}
+
+var failedAnalyzerComments = []lookout.AnalyzerComments{
+	lookout.AnalyzerComments{
+		Config: lookout.AnalyzerConfig{Name: "mock"},
+		Comments: []*lookout.Comment{&lookout.Comment{
+			File: "main.go",
+			Line: 5,
+			Text: "Line comment",
+		}},
+	},
+	lookout.AnalyzerComments{
+		Config: lookout.AnalyzerConfig{Name: "failing"},
+		Error:  "rpc error: code = Unavailable",
+	},
+}
+
+// postFailedAnalysis posts failedAnalyzerComments and returns the bodies of
+// the reviews created
+func (s *PosterTestSuite) postFailedAnalysis(p *Poster) []string {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	var bodies []string
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		bodies = append(bodies, req.GetBody())
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	err := p.Post(context.Background(), mockEvent, failedAnalyzerComments)
+	s.NoError(err)
+
+	return bodies
+}
+
+func (s *PosterTestSuite) TestPostCommentOnError() {
+	p := &Poster{pool: s.pool, conf: ProviderConfig{CommentOnError: true}}
+	s.Equal([]string{"**failing**\n\nAnalysis failed: rpc error: code = Unavailable"},
+		s.postFailedAnalysis(p))
+}
+
+func (s *PosterTestSuite) TestPostAnalysisErrorIgnored() {
+	p := &Poster{pool: s.pool}
+	s.Equal([]string{""}, s.postFailedAnalysis(p))
+}
+
+func (s *PosterTestSuite) TestPostLatestPushOnly() {
+	hash3 := "9c6d3fb3cd8a3bc5fb3b5a4e76a2c0e366f5ce6c"
+	compareFiles := func(w http.ResponseWriter, files ...string) {
+		cc := &github.CommitsComparison{}
+		for _, f := range files {
+			cc.Files = append(cc.Files, github.CommitFile{
+				Filename: strptr(f),
+				Patch:    strptr(mockedPatch),
+			})
+		}
+		json.NewEncoder(w).Encode(cc)
+	}
+
+	s.mux.HandleFunc("/repos/foo/bar/compare/"+hash1+"..."+hash2, func(w http.ResponseWriter, r *http.Request) {
+		compareFiles(w, "main.go", "other.go")
+	})
+	s.mux.HandleFunc("/repos/foo/bar/compare/"+hash1+"..."+hash3, func(w http.ResponseWriter, r *http.Request) {
+		compareFiles(w, "main.go", "other.go")
+	})
+	// only other.go changed in the latest push
+	s.mux.HandleFunc("/repos/foo/bar/compare/"+hash2+"..."+hash3, func(w http.ResponseWriter, r *http.Request) {
+		compareFiles(w, "other.go")
+	})
+
+	var paths [][]string
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+
+		var reviewPaths []string
+		for _, c := range req.Comments {
+			reviewPaths = append(reviewPaths, c.GetPath())
+		}
+		paths = append(paths, reviewPaths)
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	comments := []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "main"},
+				&lookout.Comment{File: "other.go", Line: 5, Text: "other"},
+			},
+		}}
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{LatestPushOnly: true}}
+	s.NoError(p.Post(context.Background(), mockEvent, comments))
+
+	pushed := *mockEvent
+	pushed.Head.Hash = hash3
+	s.NoError(p.Post(context.Background(), &pushed, comments))
+
+	// the first analysis posts all the comments, the next one skips main.go,
+	// unchanged since the previous head
+	s.Equal([][]string{{"main.go", "other.go"}, {"other.go"}}, paths)
+}
+
+// postRequestedReviewer posts a comment with the given severity and returns
+// the requests made to the requested reviewers of the pull request
+func (s *PosterTestSuite) postRequestedReviewer(
+	p *Poster,
+	severity lookout.Severity,
+) []string {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	var calls []string
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/requested_reviewers", func(w http.ResponseWriter, r *http.Request) {
+		var req github.ReviewersRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		calls = append(calls, r.Method+" "+strings.Join(req.Reviewers, ","))
+
+		json.NewEncoder(w).Encode(&github.PullRequest{})
+	})
+
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{&lookout.Comment{
+				File:     "main.go",
+				Line:     5,
+				Text:     "comment",
+				Severity: severity,
+			}},
+		}})
+	s.NoError(err)
+
+	return calls
+}
+
+func (s *PosterTestSuite) TestPostRequestReviewerBlocking() {
+	p := &Poster{pool: s.pool, conf: ProviderConfig{RequestReviewer: "lookout-bot"}}
+	s.Equal([]string{"POST lookout-bot"},
+		s.postRequestedReviewer(p, lookout.ErrorSeverity))
+}
+
+func (s *PosterTestSuite) TestPostRequestReviewerClean() {
+	p := &Poster{pool: s.pool, conf: ProviderConfig{RequestReviewer: "lookout-bot"}}
+	s.Equal([]string{"DELETE lookout-bot"},
+		s.postRequestedReviewer(p, lookout.WarningSeverity))
+}
+
+func (s *PosterTestSuite) TestPostRequestReviewerDisabled() {
+	p := &Poster{pool: s.pool}
+	s.Empty(s.postRequestedReviewer(p, lookout.ErrorSeverity))
 }
 
 func (s *PosterTestSuite) TestPostOKAndWrongFile() {
@@ -538,6 +2489,356 @@ func (s *PosterTestSuite) TestStatusOK() {
 	s.True(createStatusCalled)
 }
 
+func (s *PosterTestSuite) TestStatusContextPrefix() {
+	var status github.RepoStatus
+	s.mux.HandleFunc("/repos/foo/bar/statuses/"+hash2, func(w http.ResponseWriter, r *http.Request) {
+		s.NoError(json.NewDecoder(r.Body).Decode(&status))
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(&status)
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{StatusContextPrefix: "lookout-staging"}}
+	err := p.Status(context.Background(), mockEvent, lookout.PendingAnalysisStatus)
+	s.NoError(err)
+
+	s.Equal("lookout-staging", status.GetContext())
+}
+
+// analyzerStatuses posts the comments of a successful, a blocking and a
+// failed analyzer, then sets the final status, and returns the states of the
+// statuses posted by context
+func (s *PosterTestSuite) analyzerStatuses(p *Poster, final lookout.AnalysisStatus) map[string]string {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	var comments int
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		comments += len(req.Comments)
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	states := make(map[string]string)
+	s.mux.HandleFunc("/repos/foo/bar/statuses/"+hash2, func(w http.ResponseWriter, r *http.Request) {
+		var status github.RepoStatus
+		s.NoError(json.NewDecoder(r.Body).Decode(&status))
+		states[status.GetContext()] = status.GetState()
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(&status)
+	})
+
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "clean"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "Info", Severity: lookout.InfoSeverity},
+			},
+		},
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "blocking"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 6, Text: "Error", Severity: lookout.ErrorSeverity},
+			},
+		},
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "failing"},
+			Error:  "rpc error: code = Unavailable",
+		},
+	})
+	s.NoError(err)
+
+	// the comments of the analyzers that succeeded are posted
+	s.Equal(2, comments)
+
+	err = p.Status(context.Background(), mockEvent, final)
+	s.NoError(err)
+
+	return states
+}
+
+func (s *PosterTestSuite) TestStatusAnalyzerStatuses() {
+	p := &Poster{pool: s.pool, conf: ProviderConfig{AnalyzerStatuses: true}}
+	s.Equal(map[string]string{
+		"lookout":          "failure",
+		"lookout/clean":    "success",
+		"lookout/blocking": "failure",
+		"lookout/failing":  "error",
+	}, s.analyzerStatuses(p, lookout.SuccessAnalysisStatus))
+}
+
+func (s *PosterTestSuite) TestStatusAnalyzerStatusesPostError() {
+	p := &Poster{pool: s.pool, conf: ProviderConfig{AnalyzerStatuses: true}}
+	s.Equal(map[string]string{
+		"lookout":          "error",
+		"lookout/clean":    "error",
+		"lookout/blocking": "error",
+		"lookout/failing":  "error",
+	}, s.analyzerStatuses(p, lookout.ErrorAnalysisStatus))
+}
+
+func (s *PosterTestSuite) TestStatusAnalyzerStatusesDisabled() {
+	p := &Poster{pool: s.pool}
+	s.Equal(map[string]string{
+		"lookout": "failure",
+	}, s.analyzerStatuses(p, lookout.SuccessAnalysisStatus))
+}
+
+// outOfOrderStatuses sets the statuses of two heads of the same pull request,
+// the newest one first, and returns the commits the statuses were posted on
+func (s *PosterTestSuite) outOfOrderStatuses(p *Poster) []string {
+	var mutex sync.Mutex
+	var targets []string
+	s.mux.HandleFunc("/repos/foo/bar/statuses/", func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		targets = append(targets, strings.TrimPrefix(r.URL.Path, "/repos/foo/bar/statuses/"))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("{}"))
+	})
+
+	now := time.Now()
+	older := *mockEvent
+	older.UpdatedAt = now.Add(-time.Minute)
+	newer := *mockEvent
+	newer.Head.Hash = "9c6d3fb3cd8a3bc5fb3b5a4e76a2c0e366f5ce6c"
+	newer.UpdatedAt = now
+
+	ctx := context.Background()
+	s.NoError(p.Status(ctx, &newer, lookout.PendingAnalysisStatus))
+	s.NoError(p.Status(ctx, &older, lookout.PendingAnalysisStatus))
+	s.NoError(p.Status(ctx, &older, lookout.SuccessAnalysisStatus))
+	s.NoError(p.Status(ctx, &newer, lookout.SuccessAnalysisStatus))
+	s.NoError(p.Status(ctx, &older, lookout.ErrorAnalysisStatus))
+
+	return targets
+}
+
+func (s *PosterTestSuite) TestStatusSupersededHead() {
+	p := &Poster{pool: s.pool}
+	newest := "9c6d3fb3cd8a3bc5fb3b5a4e76a2c0e366f5ce6c"
+	s.Equal([]string{newest, newest}, s.outOfOrderStatuses(p))
+}
+
+func (s *PosterTestSuite) TestStatusCopyForward() {
+	p := &Poster{pool: s.pool, conf: ProviderConfig{StatusCopyForward: true}}
+	newest := "9c6d3fb3cd8a3bc5fb3b5a4e76a2c0e366f5ce6c"
+	// the statuses of the older head are copied until the newest is final
+	s.Equal([]string{newest, newest, newest, newest}, s.outOfOrderStatuses(p))
+}
+
+func (s *PosterTestSuite) TestPostMixedPatchPositions() {
+	s.mux.HandleFunc("/repos/foo/bar/compare/"+hash1+"..."+hash2, func(w http.ResponseWriter, r *http.Request) {
+		cc := &github.CommitsComparison{
+			Files: []github.CommitFile{github.CommitFile{
+				Filename: strptr("main.go"),
+				Patch:    strptr(mixedPatch),
+			}}}
+		json.NewEncoder(w).Encode(cc)
+	})
+
+	var positions []int
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		for _, c := range req.Comments {
+			positions = append(positions, c.GetPosition())
+		}
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	var comments []*lookout.Comment
+	for _, line := range []int32{3, 4, 5, 6, 7, 8} {
+		comments = append(comments, &lookout.Comment{File: "main.go", Line: line, Text: "comment"})
+	}
+
+	p := &Poster{pool: s.pool}
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config:   lookout.AnalyzerConfig{Name: "mock"},
+			Comments: comments,
+		}})
+	s.NoError(err)
+
+	// only the added lines are commented, skipping the deleted lines
+	s.Equal([]int{3, 4, 7, 8}, positions)
+}
+
+func (s *PosterTestSuite) TestPostMergeRef() {
+	mergeHash := "9c6d3fb3cd8a3bc5fb3b5a4e76a2c0e366f5ce6c"
+	e := *mockEvent
+	e.Head = lookout.ReferencePointer{
+		InternalRepositoryURL: "https://github.com/foo/bar",
+		ReferenceName:         plumbing.ReferenceName("refs/pull/42/merge"),
+		Hash:                  mergeHash,
+	}
+	e.Source = mockEvent.Head
+
+	compareCalled := false
+	s.mux.HandleFunc("/repos/foo/bar/compare/"+hash1+"..."+hash2, func(w http.ResponseWriter, r *http.Request) {
+		compareCalled = true
+
+		cc := &github.CommitsComparison{
+			Files: []github.CommitFile{github.CommitFile{
+				Filename: strptr("main.go"),
+				Patch:    strptr(mockedPatch),
+			}}}
+		json.NewEncoder(w).Encode(cc)
+	})
+
+	var req github.PullRequestReviewRequest
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	p := &Poster{pool: s.pool}
+	err := p.Post(context.Background(), &e, mockAnalyzerComments)
+	s.NoError(err)
+
+	s.True(compareCalled)
+	// the positions are mapped against the diff of the head of the pull
+	// request, where the review is posted
+	s.Equal(hash2, req.GetCommitID())
+	s.Len(req.Comments, 2)
+	s.Equal(3, req.Comments[1].GetPosition())
+}
+
+// context line 3, added line 4
+var contextPatch = `@@ -3,2 +3,3 @@
+ a
++b
+ c`
+
+// postErrorAndStatus posts an error comment on the given line of contextPatch,
+// sets the success status and returns the status that was created
+func (s *PosterTestSuite) postErrorAndStatus(p *Poster, line int32) *github.RepoStatus {
+	s.mux.HandleFunc("/repos/foo/bar/compare/"+hash1+"..."+hash2, func(w http.ResponseWriter, r *http.Request) {
+		cc := &github.CommitsComparison{
+			Files: []github.CommitFile{github.CommitFile{
+				Filename: strptr("main.go"),
+				Patch:    strptr(contextPatch),
+			}}}
+		json.NewEncoder(w).Encode(cc)
+	})
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	var rs *github.RepoStatus
+	s.mux.HandleFunc("/repos/foo/bar/statuses/02801e1a27a0a906d59530aeb81f4cd137f2c717", func(w http.ResponseWriter, r *http.Request) {
+		s.NoError(json.NewDecoder(r.Body).Decode(&rs))
+		json.NewEncoder(w).Encode(rs)
+	})
+
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{&lookout.Comment{
+				File:     "main.go",
+				Line:     line,
+				Text:     "error",
+				Severity: lookout.ErrorSeverity,
+			}},
+		}})
+	s.NoError(err)
+
+	err = p.Status(context.Background(), mockEvent, lookout.SuccessAnalysisStatus)
+	s.NoError(err)
+	s.Require().NotNil(rs)
+
+	return rs
+}
+
+func (s *PosterTestSuite) TestStatusErrorComment() {
+	p := &Poster{pool: s.pool}
+	s.Equal("failure", s.postErrorAndStatus(p, 3).GetState())
+}
+
+func (s *PosterTestSuite) TestStatusSeverityPolicyDowngrade() {
+	p := &Poster{pool: s.pool, conf: ProviderConfig{
+		SeverityPolicies: SeverityPolicies{{Paths: []string{"*.go"}, MaxSeverity: "WARNING"}},
+	}}
+	s.Equal("success", s.postErrorAndStatus(p, 3).GetState())
+}
+
+func (s *PosterTestSuite) TestStatusAddedLinesOnlyContextLine() {
+	p := &Poster{pool: s.pool, conf: ProviderConfig{StatusAddedLinesOnly: true}}
+	s.Equal("success", s.postErrorAndStatus(p, 3).GetState())
+}
+
+func (s *PosterTestSuite) TestStatusAddedLinesOnlyAddedLine() {
+	p := &Poster{pool: s.pool, conf: ProviderConfig{StatusAddedLinesOnly: true}}
+	s.Equal("failure", s.postErrorAndStatus(p, 4).GetState())
+}
+
+func (s *PosterTestSuite) TestStatusFindingsURL() {
+	dir, err := ioutil.TempDir("", "lookout-findings")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	p := &Poster{pool: s.pool}
+	p.SetFindingsStore(NewFileFindingsStore(dir, "https://findings.example.com/"))
+
+	rs := s.postErrorAndStatus(p, 3)
+	s.Equal("https://findings.example.com/foo/bar/"+hash2+".json", rs.GetTargetURL())
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "foo", "bar", hash2+".json"))
+	s.Require().NoError(err)
+
+	var payload findingsPayload
+	s.Require().NoError(json.Unmarshal(b, &payload))
+	s.Equal("foo/bar", payload.Repository)
+	s.Equal(hash2, payload.Head)
+	s.Require().Len(payload.Analyzers, 1)
+	s.Equal("mock", payload.Analyzers[0].Name)
+	s.Require().Len(payload.Analyzers[0].Comments, 1)
+	s.Equal("error", payload.Analyzers[0].Comments[0].Text)
+	s.Equal(lookout.ErrorSeverity, payload.Analyzers[0].Comments[0].Severity)
+}
+
+func (s *PosterTestSuite) TestStatusNoFindingsStore() {
+	p := &Poster{pool: s.pool}
+	s.Equal(statusTargetURL, s.postErrorAndStatus(p, 3).GetTargetURL())
+}
+
+func (s *PosterTestSuite) TestStatusSkipped() {
+	createStatusCalled := false
+
+	s.mux.HandleFunc("/repos/foo/bar/statuses/02801e1a27a0a906d59530aeb81f4cd137f2c717", func(w http.ResponseWriter, r *http.Request) {
+		createStatusCalled = true
+
+		body, err := ioutil.ReadAll(r.Body)
+		s.NoError(err)
+
+		expected, _ := json.Marshal(&github.RepoStatus{
+			State:       strptr("success"),
+			TargetURL:   strptr("https://github.com/src-d/lookout"),
+			Description: strptr("The analysis was skipped"),
+			Context:     strptr("lookout"),
+		})
+		s.JSONEq(string(expected), string(body))
+
+		json.NewEncoder(w).Encode(&github.RepoStatus{})
+	})
+
+	p := &Poster{pool: s.pool}
+	err := p.Status(context.Background(), mockEvent, lookout.SkippedAnalysisStatus)
+	s.NoError(err)
+
+	s.True(createStatusCalled)
+}
+
 func (s *PosterTestSuite) TestStatusBadProvider() {
 	p := &Poster{pool: s.pool}
 	err := p.Status(context.Background(), badProviderEvent, lookout.PendingAnalysisStatus)
@@ -625,7 +2926,7 @@ func TestSplitReview(t *testing.T) {
 		{Body: strptr("comment1")},
 	}
 
-	r := splitReview(rw, n)
+	r := splitReview(rw, n, "")
 	require.Len(r, 1)
 	require.Equal([]*github.PullRequestReviewRequest{rw}, r)
 
@@ -635,12 +2936,11 @@ func TestSplitReview(t *testing.T) {
 		{Body: strptr("comment3")},
 	}
 
-	r = splitReview(rw, n)
+	r = splitReview(rw, n, "")
 	require.Len(r, 2)
 	require.Equal([]*github.PullRequestReviewRequest{
 		{
 			Event: strptr(commentEvent),
-			Body:  strptr(""),
 			Comments: []*github.DraftReviewComment{
 				{Body: strptr("comment1")},
 				{Body: strptr("comment2")},
@@ -664,6 +2964,226 @@ func TestSplitReview(t *testing.T) {
 		{Body: strptr("comment6")},
 	}
 
-	r = splitReview(rw, n)
+	r = splitReview(rw, n, "")
+	require.Len(r, 3)
+	require.Nil(r[0].Body)
+	require.Equal(strptr("body"), r[2].Body)
+
+	r = splitReview(rw, n, BodyChunkLast)
+	require.Len(r, 3)
+	require.Nil(r[0].Body)
+	require.Equal(strptr("body"), r[2].Body)
+
+	// the body is omitted from the requests of the chunks without it
+	b, err := json.Marshal(r[0])
+	require.NoError(err)
+	var fields map[string]interface{}
+	require.NoError(json.Unmarshal(b, &fields))
+	require.NotContains(fields, "body")
+	require.Contains(fields, "comments")
+
+	rw.Body = strptr("")
+	for _, chunk := range splitReview(rw, n, "") {
+		require.Nil(chunk.Body)
+	}
+}
+
+func TestSplitReviewMaxCommentsPerReview(t *testing.T) {
+	require := require.New(t)
+
+	rw := &github.PullRequestReviewRequest{
+		Event: strptr(commentEvent),
+		Body:  strptr("body"),
+	}
+	for i := 0; i < 65; i++ {
+		rw.Comments = append(rw.Comments, &github.DraftReviewComment{
+			Body: strptr(fmt.Sprintf("comment%d", i)),
+		})
+	}
+
+	for _, tc := range []struct {
+		max    int
+		chunks []int
+	}{
+		{0, []int{30, 30, 5}},
+		{50, []int{50, 15}},
+		{65, []int{65}},
+		{100, []int{65}},
+	} {
+		p := &Poster{conf: ProviderConfig{MaxCommentsPerReview: tc.max}}
+		r := splitReview(rw, p.maxCommentsPerReview(), "")
+
+		var chunks []int
+		for _, chunk := range r {
+			chunks = append(chunks, len(chunk.Comments))
+		}
+		require.Equal(tc.chunks, chunks, "max %d", tc.max)
+		require.Equal(strptr("body"), r[len(r)-1].Body, "max %d", tc.max)
+		for _, chunk := range r[:len(r)-1] {
+			require.Nil(chunk.Body, "max %d", tc.max)
+		}
+	}
+}
+
+func TestNewPosterDurations(t *testing.T) {
+	require := require.New(t)
+
+	p, err := NewPoster(nil, ProviderConfig{
+		CompareTimeout: "1s",
+		PostTimeout:    "2s",
+		DedupTTL:       "720h",
+		RetryDelay:     "100ms",
+	})
+	require.NoError(err)
+	require.Equal(time.Second, p.compareTimeout)
+	require.Equal(2*time.Second, p.postTimeout)
+	require.Equal(720*time.Hour, p.dedupTTL)
+	require.Equal(100*time.Millisecond, p.retryDelay)
+
+	_, err = NewPoster(nil, ProviderConfig{CompareTimeout: "1 second"})
+	require.Error(err)
+	require.Contains(err.Error(), "can't parse compare_timeout")
+
+	_, err = NewPoster(nil, ProviderConfig{PostTimeout: "10"})
+	require.Error(err)
+	require.Contains(err.Error(), "can't parse post_timeout")
+
+	_, err = NewPoster(nil, ProviderConfig{DedupTTL: "30d"})
+	require.Error(err)
+	require.Contains(err.Error(), "can't parse dedup_ttl")
+
+	_, err = NewPoster(nil, ProviderConfig{RetryDelay: "-1s"})
+	require.EqualError(err, "retry_delay can't be negative: -1s")
+}
+
+func TestIsPermanentError(t *testing.T) {
+	require := require.New(t)
+
+	require.True(IsPermanentError(ErrEventNotSupported.New()))
+	require.True(IsPermanentError(ErrRepoNotAccessible.New()))
+	require.False(IsPermanentError(ErrGitHubAPI.New()))
+	require.False(IsPermanentError(fmt.Errorf("foo")))
+}
+
+func TestSplitReviewRequestChanges(t *testing.T) {
+	require := require.New(t)
+
+	rw := &github.PullRequestReviewRequest{
+		Event: strptr(requestChangesEvent),
+		Body:  strptr("body"),
+		Comments: []*github.DraftReviewComment{
+			{Body: strptr("comment1")},
+			{Body: strptr("comment2")},
+			{Body: strptr("comment3")},
+		},
+	}
+
+	// only the chunk with the body requests changes
+	r := splitReview(rw, 1, "")
 	require.Len(r, 3)
+	require.Equal(commentEvent, r[0].GetEvent())
+	require.Equal(commentEvent, r[1].GetEvent())
+	require.Equal(requestChangesEvent, r[2].GetEvent())
+	require.Equal("body", r[2].GetBody())
+
+	r = splitReview(rw, 1, BodyChunkFirst)
+	require.Equal(requestChangesEvent, r[0].GetEvent())
+	require.Equal(commentEvent, r[1].GetEvent())
+	require.Equal(commentEvent, r[2].GetEvent())
+}
+
+func TestSplitReviewBodyFirst(t *testing.T) {
+	require := require.New(t)
+
+	rw := &github.PullRequestReviewRequest{
+		Event: strptr(commentEvent),
+		Body:  strptr("body"),
+		Comments: []*github.DraftReviewComment{
+			{Body: strptr("comment1")},
+			{Body: strptr("comment2")},
+			{Body: strptr("comment3")},
+		},
+	}
+
+	r := splitReview(rw, 2, BodyChunkFirst)
+	require.Equal([]*github.PullRequestReviewRequest{
+		{
+			Event: strptr(commentEvent),
+			Body:  strptr("body"),
+			Comments: []*github.DraftReviewComment{
+				{Body: strptr("comment1")},
+				{Body: strptr("comment2")},
+			},
+		},
+		{
+			Event: strptr(commentEvent),
+			Comments: []*github.DraftReviewComment{
+				{Body: strptr("comment3")},
+			},
+		},
+	}, r)
+}
+
+func (s *PosterTestSuite) TestPostMaxGlobalComments() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	var reviews []*github.PullRequestReviewRequest
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		reviews = append(reviews, &req)
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	aCommentsList := []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "first"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{Text: "Global comment 1"},
+				&lookout.Comment{Text: "Global comment 2"},
+			},
+		},
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "second"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{Text: "Global comment 3"},
+				&lookout.Comment{Text: "Global comment 4"},
+				&lookout.Comment{File: "main.go", Line: 5, Text: "Line comment"},
+			},
+		}}
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{MaxGlobalComments: 1}}
+	err := p.Post(context.Background(), mockEvent, aCommentsList)
+	s.NoError(err)
+
+	s.Require().Len(reviews, 1)
+	s.Len(reviews[0].Comments, 1)
+	s.Equal("**first**\n\n"+
+		"Global comment 1\n\n"+
+		"<details>\n<summary>1 more comment</summary>\n\n"+
+		"Global comment 2\n\n"+
+		"</details>\n\n"+
+		"**second**\n\n"+
+		"<details>\n<summary>2 more comments</summary>\n\n"+
+		"Global comment 3\n\n"+
+		"Global comment 4\n\n"+
+		"</details>", reviews[0].GetBody())
+
+	// without the limit all the comments are shown
+	compareCalled = false
+	reviews = nil
+	p.conf.MaxGlobalComments = 0
+	err = p.Post(context.Background(), mockEvent, aCommentsList)
+	s.NoError(err)
+
+	s.Require().Len(reviews, 1)
+	s.Equal("**first**\n\n"+
+		"Global comment 1\n\n"+
+		"Global comment 2\n\n"+
+		"**second**\n\n"+
+		"Global comment 3\n\n"+
+		"Global comment 4", reviews[0].GetBody())
 }
@@ -0,0 +1,37 @@
+package github
+
+import (
+	"path"
+
+	"github.com/src-d/lookout"
+)
+
+// prefixPaths prepends the AnalyzerConfig.PathPrefix of each analyzer to the
+// files of its comments, so the comments of the analyzers running on a
+// subdirectory of the repository match the files of the diff. Global comments
+// are left as is. The given comments are not modified.
+func prefixPaths(aCommentsList []lookout.AnalyzerComments) []lookout.AnalyzerComments {
+	result := make([]lookout.AnalyzerComments, len(aCommentsList))
+	for i, aComments := range aCommentsList {
+		result[i] = aComments
+
+		prefix := aComments.Config.PathPrefix
+		if prefix == "" {
+			continue
+		}
+
+		result[i].Comments = make([]*lookout.Comment, len(aComments.Comments))
+		for j, c := range aComments.Comments {
+			if c.File == "" {
+				result[i].Comments[j] = c
+				continue
+			}
+
+			prefixed := *c
+			prefixed.File = path.Join(prefix, c.File)
+			result[i].Comments[j] = &prefixed
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,79 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/src-d/lookout"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixPaths(t *testing.T) {
+	require := require.New(t)
+
+	global := &lookout.Comment{Text: "global"}
+	file := &lookout.Comment{File: "main.go", Line: 3, Text: "line"}
+	other := &lookout.Comment{File: "main.go", Line: 3, Text: "other"}
+
+	result := prefixPaths([]lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config:   lookout.AnalyzerConfig{Name: "foo", PathPrefix: "services/foo/"},
+			Comments: []*lookout.Comment{global, file},
+		},
+		lookout.AnalyzerComments{
+			Config:   lookout.AnalyzerConfig{Name: "root"},
+			Comments: []*lookout.Comment{other},
+		},
+	})
+
+	require.Len(result, 2)
+	require.Equal([]*lookout.Comment{
+		global,
+		&lookout.Comment{File: "services/foo/main.go", Line: 3, Text: "line"},
+	}, result[0].Comments)
+	require.Equal([]*lookout.Comment{other}, result[1].Comments)
+
+	// the given comments are not modified
+	require.Equal("main.go", file.File)
+}
+
+func (s *PosterTestSuite) TestPostPathPrefix() {
+	s.mux.HandleFunc("/repos/foo/bar/compare/"+hash1+"..."+hash2, func(w http.ResponseWriter, r *http.Request) {
+		cc := &github.CommitsComparison{
+			Files: []github.CommitFile{github.CommitFile{
+				Filename: strptr("services/foo/main.go"),
+				Patch:    strptr(mockedPatch),
+			}}}
+		json.NewEncoder(w).Encode(cc)
+	})
+
+	var comments []*github.DraftReviewComment
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req github.PullRequestReviewRequest
+		s.NoError(json.NewDecoder(r.Body).Decode(&req))
+		comments = append(comments, req.Comments...)
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	p := &Poster{pool: s.pool}
+	err := p.Post(context.Background(), mockEvent, []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock", PathPrefix: "services/foo"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 5, Text: "Line comment"},
+			},
+		}})
+	s.NoError(err)
+
+	s.Equal([]*github.DraftReviewComment{&github.DraftReviewComment{
+		Path:     strptr("services/foo/main.go"),
+		Position: intptr(3),
+		Body:     strptr("Line comment"),
+	}}, comments)
+}
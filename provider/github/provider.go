@@ -0,0 +1,37 @@
+package github
+
+import (
+	"strings"
+
+	"github.com/src-d/lookout"
+)
+
+// providerHosts are the providers of the repositories in well known hosts,
+// used to infer the provider of the events without one
+var providerHosts = map[string]string{
+	"github.com":    Provider,
+	"gitlab.com":    "gitlab",
+	"bitbucket.org": "bitbucket",
+}
+
+// eventProvider returns the provider of an event. If it's empty and
+// InferProvider is enabled, it's inferred from the host of the repository
+// URL of ref, looked up in ProviderHosts and then in the well known hosts. It
+// returns an empty string if the provider can't be inferred.
+func (p *Poster) eventProvider(provider string, ref lookout.ReferencePointer) string {
+	if provider != "" || !p.conf.InferProvider {
+		return provider
+	}
+
+	info := ref.Repository()
+	if info == nil {
+		return ""
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(string(info.RepoHost)), "www.")
+	if provider, ok := p.conf.ProviderHosts[host]; ok {
+		return provider
+	}
+
+	return providerHosts[host]
+}
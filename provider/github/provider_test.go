@@ -0,0 +1,31 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/src-d/lookout"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventProvider(t *testing.T) {
+	require := require.New(t)
+
+	ref := func(url string) lookout.ReferencePointer {
+		return lookout.ReferencePointer{InternalRepositoryURL: url}
+	}
+
+	p := &Poster{}
+	require.Equal("", p.eventProvider("", ref("https://github.com/foo/bar")))
+	require.Equal("json", p.eventProvider("json", ref("https://github.com/foo/bar")))
+
+	p = &Poster{conf: ProviderConfig{
+		InferProvider: true,
+		ProviderHosts: map[string]string{"git.example.com": Provider},
+	}}
+	require.Equal(Provider, p.eventProvider("", ref("https://github.com/foo/bar")))
+	require.Equal(Provider, p.eventProvider("", ref("git://www.github.com/foo/bar.git")))
+	require.Equal("gitlab", p.eventProvider("", ref("https://gitlab.com/foo/bar")))
+	require.Equal(Provider, p.eventProvider("", ref("https://git.example.com/foo/bar")))
+	require.Equal("", p.eventProvider("", ref("https://unknown.example.com/foo/bar")))
+	require.Equal("json", p.eventProvider("json", ref("https://github.com/foo/bar")))
+}
@@ -0,0 +1,145 @@
+package github
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/util/ctxlog"
+
+	"github.com/google/go-github/github"
+)
+
+// postPush posts the comments of a push event as comments on its head commit,
+// one for each lookout comment, see ProviderConfig.PostPushComments
+func (p *Poster) postPush(ctx context.Context, e *lookout.PushEvent,
+	aCommentsList []lookout.AnalyzerComments) (err error) {
+
+	owner, repo, err := p.validatePush(e)
+	if err != nil {
+		return err
+	}
+
+	until, err := p.conf.PostSchedule.nextAllowed(p.clock())
+	if err != nil {
+		ctxlog.Get(ctx).Errorf(err, "can't check the post schedule, posting anyway")
+	} else if !until.IsZero() {
+		return &lookout.PostDeferredError{Until: until}
+	}
+
+	if err := p.checkRepoRateLimit(ctx, owner, repo); err != nil {
+		return err
+	}
+
+	ctx, results := p.withResults(ctx)
+	defer func() { p.writeResults(ctx, owner, repo, e.Revision(), results, err) }()
+
+	aCommentsList = p.filterComments(ctx, aCommentsList)
+	aCommentsList = results.filtered(reasonGenerated,
+		aCommentsList, p.filterGenerated(ctx, &e.Head, aCommentsList))
+	// there is no diff to place the comments on, all the line comments count
+	aCommentsList = results.filtered(reasonMaxComments,
+		aCommentsList, limitLineComments(p.conf.MaxComments, nil, aCommentsList))
+
+	client, err := p.getClient(ctx, owner, repo)
+	if err != nil {
+		return err
+	}
+
+	release, err := p.limiter.acquire(ctx, client)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	budget := p.newRetryBudget(p.conf.RetryBudget)
+	if p.conf.UploadSARIF {
+		err := p.uploadSARIF(ctx, client, budget, owner, repo, e, e.Head, aCommentsList)
+		if err != nil {
+			return err
+		}
+	}
+
+	results.postedAll(aCommentsList)
+	for _, comment := range p.commitComments(ctx, aCommentsList, p.fileContents(&e.Head)) {
+		err := budget.do(ctx, "create commit comment", func() error {
+			ctx, cancel := withTimeout(ctx, p.postTimeout)
+			defer cancel()
+
+			_, resp, err := client.Repositories.CreateComment(ctx, owner, repo, e.Head.Hash, comment)
+			if err == nil && resp.StatusCode == 201 {
+				return nil
+			}
+
+			return p.handleAPIError(resp, err)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Poster) validatePush(e *lookout.PushEvent) (owner, repo string, err error) {
+	owner, err = extractOwner(e.Head)
+	if err != nil {
+		err = ErrEventNotSupported.Wrap(err)
+		return
+	}
+
+	repo, err = extractRepo(e.Head)
+	if err != nil {
+		err = ErrEventNotSupported.Wrap(err)
+		return
+	}
+
+	if !matchBaseRef(p.conf.BaseRefs, e.Head.ReferenceName) {
+		err = ErrEventNotSupported.Wrap(
+			fmt.Errorf("reference filtered out: %s", e.Head.ReferenceName))
+		return
+	}
+
+	return
+}
+
+// commitComments returns the commit comments to post. Commit comments can
+// only be placed on lines of the commit diff, so line comments are posted on
+// their file, with the line before the text. The files are used to quote the
+// commented lines.
+func (p *Poster) commitComments(
+	ctx context.Context,
+	aCommentsList []lookout.AnalyzerComments,
+	files *fileContents,
+) []*github.RepositoryComment {
+	renderer := p.getRenderer()
+
+	var result []*github.RepositoryComment
+	for _, aComments := range aCommentsList {
+		for _, c := range aComments.Comments {
+			comment := *c
+			if comment.File != "" && comment.Line > 0 {
+				comment.Text = fmt.Sprintf("Line %d: %s", comment.Line, comment.Text)
+			}
+
+			body := renderer.Render(ctx, &RenderContext{
+				Analyzer: aComments.Config,
+				Comment:  &comment,
+				files:    files,
+			})
+			// the anchors of commit comments are not read back, so they
+			// are not indexed
+			body, _, _ = p.encodeMarker(body)
+
+			rc := &github.RepositoryComment{Body: &body}
+			if comment.File != "" {
+				path := comment.File
+				rc.Path = &path
+			}
+
+			result = append(result, rc)
+		}
+	}
+
+	return result
+}
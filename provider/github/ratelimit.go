@@ -0,0 +1,83 @@
+package github
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/util/ctxlog"
+
+	log "gopkg.in/src-d/go-log.v1"
+)
+
+// repoRateLimiter is a token bucket for each repository, so a repository with
+// many events can't exhaust the API rate limit of its installation and starve
+// the other repositories. Each bucket holds up to limit tokens, refilled at a
+// rate of limit tokens per hour.
+type repoRateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take consumes a token of the bucket of the repository if there is one, and
+// returns the zero time. Otherwise it returns the time the next token will be
+// available, without consuming it. A limit lower than 1 doesn't limit
+// anything.
+func (l *repoRateLimiter) take(repo string, limit int, now time.Time) time.Time {
+	if limit <= 0 {
+		return time.Time{}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.buckets == nil {
+		l.buckets = make(map[string]*tokenBucket)
+	}
+
+	b, ok := l.buckets[repo]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limit), last: now}
+		l.buckets[repo] = b
+	}
+
+	rate := float64(limit) / float64(time.Hour)
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += float64(elapsed) * rate
+		if b.tokens > float64(limit) {
+			b.tokens = float64(limit)
+		}
+
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return time.Time{}
+	}
+
+	wait := time.Duration((1 - b.tokens) / rate)
+	return now.Add(wait)
+}
+
+// checkRepoRateLimit returns a *lookout.PostDeferredError if the repository
+// exceeded its PerRepoRateLimit, deferring the post until the next token of
+// its bucket is available
+func (p *Poster) checkRepoRateLimit(ctx context.Context, owner, repo string) error {
+	until := p.repoLimiter.take(owner+"/"+repo, p.conf.PerRepoRateLimit, p.clock())
+	if until.IsZero() {
+		return nil
+	}
+
+	ctxlog.Get(ctx).With(log.Fields{
+		"until": until,
+	}).Infof("repository exceeded its rate limit, deferring the post")
+
+	return &lookout.PostDeferredError{Until: until}
+}
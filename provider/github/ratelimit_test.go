@@ -0,0 +1,101 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/util/cache"
+
+	"github.com/google/go-github/github"
+	"github.com/gregjones/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepoRateLimiterTake(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Date(2018, 10, 10, 10, 0, 0, 0, time.UTC)
+	var l repoRateLimiter
+
+	require.True(l.take("foo/bar", 2, now).IsZero())
+	require.True(l.take("foo/bar", 2, now).IsZero())
+	require.Equal(now.Add(30*time.Minute), l.take("foo/bar", 2, now))
+
+	// a rejected take doesn't consume the next token
+	require.Equal(now.Add(30*time.Minute), l.take("foo/bar", 2, now))
+
+	// the tokens are refilled over time, up to the limit
+	require.True(l.take("foo/bar", 2, now.Add(30*time.Minute)).IsZero())
+	require.False(l.take("foo/bar", 2, now.Add(30*time.Minute)).IsZero())
+
+	later := now.Add(24 * time.Hour)
+	require.True(l.take("foo/bar", 2, later).IsZero())
+	require.True(l.take("foo/bar", 2, later).IsZero())
+	require.False(l.take("foo/bar", 2, later).IsZero())
+
+	// without limit, nothing is limited
+	for i := 0; i < 10; i++ {
+		require.True(l.take("foo/baz", 0, now).IsZero())
+	}
+}
+
+func (s *PosterTestSuite) TestPostPerRepoRateLimit() {
+	cache := cache.NewValidableCache(httpcache.NewMemoryCache())
+	githubURL, _ := url.Parse(s.server.URL + "/")
+	pool := newTestPool(s.Suite,
+		[]string{"github.com/foo/bar", "github.com/foo/baz"}, githubURL, cache)
+
+	reviews := make(map[string]int)
+	for _, repo := range []string{"foo/bar", "foo/baz"} {
+		repo := repo
+		s.mux.HandleFunc("/repos/"+repo+"/compare/"+hash1+"..."+hash2, func(w http.ResponseWriter, r *http.Request) {
+			cc := &github.CommitsComparison{
+				Files: []github.CommitFile{github.CommitFile{
+					Filename: strptr("main.go"),
+					Patch:    strptr(mockedPatch),
+				}}}
+			json.NewEncoder(w).Encode(cc)
+		})
+
+		s.mux.HandleFunc("/repos/"+repo+"/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+			reviews[repo]++
+			resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+			json.NewEncoder(w).Encode(resp)
+		})
+	}
+
+	otherEvent := *mockEvent
+	otherEvent.Base.InternalRepositoryURL = "https://github.com/foo/baz"
+	otherEvent.Head.InternalRepositoryURL = "https://github.com/foo/baz"
+
+	now := time.Date(2018, 10, 10, 10, 0, 0, 0, time.UTC)
+	p := &Poster{
+		pool: pool,
+		conf: ProviderConfig{PerRepoRateLimit: 2},
+		now:  func() time.Time { return now },
+	}
+
+	for i := 0; i < 2; i++ {
+		s.NoError(p.Post(context.Background(), mockEvent, mockAnalyzerComments))
+	}
+
+	// foo/bar exceeded its share
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.IsType(&lookout.PostDeferredError{}, err)
+	s.Equal(now.Add(30*time.Minute), err.(*lookout.PostDeferredError).Until)
+	s.Equal(2, reviews["foo/bar"])
+
+	// while foo/baz still posts
+	s.NoError(p.Post(context.Background(), &otherEvent, mockAnalyzerComments))
+	s.Equal(1, reviews["foo/baz"])
+
+	// and foo/bar posts again once a token is refilled
+	now = now.Add(30 * time.Minute)
+	s.NoError(p.Post(context.Background(), mockEvent, mockAnalyzerComments))
+	s.Equal(3, reviews["foo/bar"])
+}
@@ -0,0 +1,62 @@
+package github
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// matchBaseRef returns true if the given reference name matches any of the
+// glob patterns. Patterns are matched against both the short name (e.g.
+// "release/1.0") and the full name (e.g. "refs/heads/release/1.0") of the
+// reference. An empty list of patterns matches any reference.
+func matchBaseRef(patterns []string, ref plumbing.ReferenceName) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, ref.Short()); ok {
+			return true
+		}
+
+		if ok, _ := path.Match(p, ref.String()); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// prRefSide is the side of a pull request a reference points to
+type prRefSide string
+
+const (
+	// prHeadSide is the head of the pull request, refs/pull/N/head
+	prHeadSide prRefSide = "head"
+	// prMergeSide is the merge preview of the pull request, refs/pull/N/merge
+	prMergeSide prRefSide = "merge"
+)
+
+var prRefPattern = regexp.MustCompile(`(?i)^refs/pull/(\d+)/(head|merge)$`)
+
+// parsePRRef returns the number of the pull request of a reference and the
+// side it points to. The reference is matched case-insensitively, so e.g.
+// refs/pull/42/HEAD is valid too.
+func parsePRRef(ref plumbing.ReferenceName) (int, prRefSide, error) {
+	m := prRefPattern.FindStringSubmatch(ref.String())
+	if m == nil {
+		return 0, "", fmt.Errorf("bad PR: %s", ref)
+	}
+
+	pr, err := strconv.Atoi(m[1])
+	if err != nil || pr <= 0 {
+		return 0, "", fmt.Errorf("bad PR: %s", ref)
+	}
+
+	return pr, prRefSide(strings.ToLower(m[2])), nil
+}
@@ -0,0 +1,72 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+func TestMatchBaseRef(t *testing.T) {
+	require := require.New(t)
+
+	patterns := []string{"master", "release/*"}
+
+	cases := []struct {
+		ref      plumbing.ReferenceName
+		expected bool
+	}{
+		{"refs/heads/master", true},
+		{"refs/heads/release/1.0", true},
+		{"refs/heads/release/1.0/hotfix", false},
+		{"refs/heads/develop", false},
+		{"refs/heads/master-old", false},
+	}
+
+	for _, c := range cases {
+		require.Equal(c.expected, matchBaseRef(patterns, c.ref), string(c.ref))
+	}
+
+	require.True(matchBaseRef(nil, "refs/heads/develop"))
+	require.True(matchBaseRef([]string{"refs/heads/*"}, "refs/heads/develop"))
+}
+
+func TestParsePRRef(t *testing.T) {
+	require := require.New(t)
+
+	cases := []struct {
+		ref  plumbing.ReferenceName
+		pr   int
+		side prRefSide
+	}{
+		{"refs/pull/42/head", 42, prHeadSide},
+		{"refs/pull/42/merge", 42, prMergeSide},
+		{"refs/pull/7/HEAD", 7, prHeadSide},
+		{"REFS/PULL/7/Merge", 7, prMergeSide},
+	}
+
+	for _, c := range cases {
+		pr, side, err := parsePRRef(c.ref)
+		require.NoError(err, string(c.ref))
+		require.Equal(c.pr, pr, string(c.ref))
+		require.Equal(c.side, side, string(c.ref))
+	}
+
+	malformed := []plumbing.ReferenceName{
+		"BAD",
+		"",
+		"refs/heads/master",
+		"refs/pull/42",
+		"refs/pull/42/other",
+		"refs/pull/abc/head",
+		"refs/pull/0/head",
+		"refs/pull/-1/head",
+		"refs/pull/42/head/extra",
+		" refs/pull/42/head",
+	}
+
+	for _, ref := range malformed {
+		_, _, err := parsePRRef(ref)
+		require.EqualError(err, "bad PR: "+string(ref))
+	}
+}
@@ -0,0 +1,349 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/util/ctxlog"
+
+	log "gopkg.in/src-d/go-log.v1"
+)
+
+// CommentRenderer renders the final Markdown body of the comments posted to
+// GitHub.
+type CommentRenderer interface {
+	// Render returns the body for the comment of the given context.
+	Render(context.Context, *RenderContext) string
+}
+
+// RenderContext holds the comment to render and the information available
+// about it.
+type RenderContext struct {
+	// Analyzer is the configuration of the analyzer that created the comment
+	Analyzer lookout.AnalyzerConfig
+	// Comment is the comment to render
+	Comment *lookout.Comment
+
+	dl    *diffLines
+	files *fileContents
+}
+
+// IsLineComment returns true if the comment is posted on a line of the diff.
+func (rc *RenderContext) IsLineComment() bool {
+	return rc.Comment.File != "" && rc.Comment.Line > 0
+}
+
+// LineContent returns the content of the commented line. ErrLineOutOfDiff is
+// returned if the line is not part of the diff.
+func (rc *RenderContext) LineContent() (string, error) {
+	if !rc.IsLineComment() || rc.dl == nil {
+		return "", ErrLineOutOfDiff.New()
+	}
+
+	return rc.dl.LineContent(rc.Comment.File, int(rc.Comment.Line))
+}
+
+// fileLineContent returns the content of the commented line, read from the
+// file if the line is not part of the diff.
+func (rc *RenderContext) fileLineContent(ctx context.Context) (string, error) {
+	content, err := rc.LineContent()
+	if err == nil || !rc.IsLineComment() || rc.files == nil {
+		return content, err
+	}
+
+	return rc.files.line(ctx, rc.Comment.File, int(rc.Comment.Line))
+}
+
+// CommentDecorator transforms the text of a comment being rendered.
+type CommentDecorator func(ctx context.Context, rc *RenderContext, text string) string
+
+// DecoratorRenderer is a CommentRenderer that applies its decorators, in
+// order, to the text of the comment.
+type DecoratorRenderer struct {
+	Decorators []CommentDecorator
+}
+
+var _ CommentRenderer = &DecoratorRenderer{}
+
+// NewDefaultRenderer returns the CommentRenderer composing the decorators
+// enabled in the configuration, in this order: HTML normalization, code
+// language hints, task list, truncation, details link, rule documentation,
+// footer, feedback links, quote of the commented line, severity marker,
+// environment label, severity badge and anchor marker. The language hints,
+// the task list, the details link, the rule documentation and the feedback
+// links are always enabled.
+func NewDefaultRenderer(conf ProviderConfig) *DecoratorRenderer {
+	var ds []CommentDecorator
+	if conf.NormalizeHTML {
+		ds = append(ds, NormalizeHTMLDecorator)
+	}
+
+	ds = append(ds, LanguageDecorator, TaskListDecorator)
+
+	if conf.MaxCommentLength > 0 {
+		var store FindingsStore
+		if conf.FindingsDir != "" {
+			store = NewFileFindingsStore(conf.FindingsDir, conf.FindingsURL)
+		}
+
+		ds = append(ds, TruncateDecorator(
+			conf.MaxCommentLength, conf.TruncateStrategy, store))
+	}
+
+	ds = append(ds, DetailLinkDecorator, RuleDocsDecorator)
+
+	if conf.CommentFooter != "" {
+		ds = append(ds, FooterDecorator(conf.CommentFooter))
+	}
+
+	ds = append(ds, FeedbackLinksDecorator)
+
+	if conf.QuoteOffendingLine {
+		ds = append(ds, QuoteLineDecorator)
+	}
+
+	if conf.SeverityMarker != "" {
+		ds = append(ds, SeverityMarkerDecorator(conf.SeverityMarker))
+	}
+
+	if conf.EnvironmentLabel != "" {
+		ds = append(ds, EnvironmentLabelDecorator(conf.EnvironmentLabel))
+	}
+
+	if conf.SeverityBadge != "" {
+		ds = append(ds, SeverityBadgeDecorator(conf.SeverityBadge))
+	}
+
+	if conf.AnchorComments {
+		ds = append(ds, AnchorDecorator)
+	}
+
+	return &DecoratorRenderer{Decorators: ds}
+}
+
+// Render implements the CommentRenderer interface.
+func (r *DecoratorRenderer) Render(ctx context.Context, rc *RenderContext) string {
+	text := rc.Comment.Text
+	for _, d := range r.Decorators {
+		text = d(ctx, rc, text)
+	}
+
+	return text
+}
+
+// NormalizeHTMLDecorator converts the HTML in the text to Markdown.
+func NormalizeHTMLDecorator(ctx context.Context, rc *RenderContext, text string) string {
+	return normalizeHTML(text)
+}
+
+// LanguageDecorator adds the Language of the comment as the language hint of
+// the fenced code blocks without one, so GitHub highlights them.
+func LanguageDecorator(ctx context.Context, rc *RenderContext, text string) string {
+	if rc.Comment.Language == "" {
+		return text
+	}
+
+	return fencePattern.ReplaceAllStringFunc(text, func(block string) string {
+		if !strings.HasPrefix(block, "```\n") && !strings.HasPrefix(block, "```\r\n") {
+			return block
+		}
+
+		return "```" + rc.Comment.Language + block[len("```"):]
+	})
+}
+
+// TaskListDecorator appends the items of the comment to the text as a task
+// list, so they can be ticked off on GitHub.
+func TaskListDecorator(ctx context.Context, rc *RenderContext, text string) string {
+	if len(rc.Comment.Items) == 0 {
+		return text
+	}
+
+	items := make([]string, len(rc.Comment.Items))
+	for i, item := range rc.Comment.Items {
+		// a line break would end the item
+		items[i] = "- [ ] " + strings.Join(strings.Fields(item), " ")
+	}
+
+	list := strings.Join(items, "\n")
+	if strings.TrimSpace(text) == "" {
+		return list
+	}
+
+	return fmt.Sprintf("%s\n\n%s", text, list)
+}
+
+// DetailLinkDecorator appends to the text a link to the DetailURL of the
+// comment, if it has one.
+func DetailLinkDecorator(ctx context.Context, rc *RenderContext, text string) string {
+	if rc.Comment.DetailURL == "" {
+		return text
+	}
+
+	return fmt.Sprintf("%s\n\n[details](%s)", text, rc.Comment.DetailURL)
+}
+
+// RuleDocsDecorator appends to the text the documentation of the rule of the
+// comment, from the RuleDocs of its analyzer, in a collapsed <details> block.
+// Nothing is appended if the rule has no documentation.
+func RuleDocsDecorator(ctx context.Context, rc *RenderContext, text string) string {
+	if rc.Comment.RuleID == "" {
+		return text
+	}
+
+	doc := strings.TrimSpace(rc.Analyzer.RuleDocs[rc.Comment.RuleID])
+	if doc == "" {
+		return text
+	}
+
+	return fmt.Sprintf("%s\n\n<details>\n<summary>About %s</summary>\n\n%s\n\n</details>",
+		text, rc.Comment.RuleID, doc)
+}
+
+// FooterDecorator returns a decorator that appends the footer to the text,
+// formatted with the feedback URL of the analyzer. Nothing is appended if the
+// analyzer doesn't have a feedback URL.
+func FooterDecorator(tmpl string) CommentDecorator {
+	return func(ctx context.Context, rc *RenderContext, text string) string {
+		url := rc.Analyzer.Feedback
+		if tmpl == "" || url == "" {
+			return text
+		}
+
+		return fmt.Sprintf("%s\n\n%s", text, fmt.Sprintf(tmpl, url))
+	}
+}
+
+// FeedbackLinksDecorator appends to the text the FeedbackLinks of the
+// analyzer, as a line of links sorted by their label. Nothing is appended if
+// the analyzer doesn't have any.
+func FeedbackLinksDecorator(ctx context.Context, rc *RenderContext, text string) string {
+	if len(rc.Analyzer.FeedbackLinks) == 0 {
+		return text
+	}
+
+	labels := make([]string, 0, len(rc.Analyzer.FeedbackLinks))
+	for label := range rc.Analyzer.FeedbackLinks {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	links := make([]string, len(labels))
+	for i, label := range labels {
+		links[i] = fmt.Sprintf("[%s](%s)", label, rc.Analyzer.FeedbackLinks[label])
+	}
+
+	return fmt.Sprintf("%s\n\n%s", text, strings.Join(links, " · "))
+}
+
+// QuoteLineDecorator prepends the commented line, quoted as a code block, to
+// the text of line comments. Lines out of the diff are read from the file
+// when a FileGetter is available. If the line content can't be found the text
+// is returned as is.
+func QuoteLineDecorator(ctx context.Context, rc *RenderContext, text string) string {
+	if !rc.IsLineComment() {
+		return text
+	}
+
+	content, err := rc.fileLineContent(ctx)
+	if err != nil {
+		ctxlog.Get(ctx).With(log.Fields{
+			"file": rc.Comment.File,
+			"line": rc.Comment.Line,
+		}).Warningf("can't quote the commented line: %s", err)
+		return text
+	}
+
+	return fmt.Sprintf("> ```\n> %s\n> ```\n\n%s", content, text)
+}
+
+// EnvironmentLabelDecorator returns a decorator that prepends the label of the
+// lookout environment, e.g. "staging", to the text.
+func EnvironmentLabelDecorator(label string) CommentDecorator {
+	return func(ctx context.Context, rc *RenderContext, text string) string {
+		return fmt.Sprintf("**[%s]** %s", label, text)
+	}
+}
+
+const (
+	// SeverityMarkerEmoji prefixes the comments with an emoji of their
+	// severity, e.g. ⚠️ for warnings
+	SeverityMarkerEmoji = "emoji"
+	// SeverityMarkerText prefixes the comments with the name of their
+	// severity, e.g. [WARNING]
+	SeverityMarkerText = "text"
+)
+
+// severityEmojis are the markers of SeverityMarkerEmoji, by severity
+var severityEmojis = map[lookout.Severity]string{
+	lookout.ErrorSeverity:   "❌",
+	lookout.WarningSeverity: "⚠️",
+	lookout.InfoSeverity:    "ℹ️",
+}
+
+// SeverityMarkerDecorator returns a decorator that prefixes the text with a
+// marker of the severity of the comment, with the given SeverityMarkerEmoji
+// or SeverityMarkerText mode. Comments without severity and unknown modes
+// don't get a marker.
+func SeverityMarkerDecorator(mode string) CommentDecorator {
+	return func(ctx context.Context, rc *RenderContext, text string) string {
+		severity := rc.Comment.Severity
+		if severity == lookout.UnspecifiedSeverity {
+			return text
+		}
+
+		switch mode {
+		case SeverityMarkerEmoji:
+			if emoji, ok := severityEmojis[severity]; ok {
+				return fmt.Sprintf("%s %s", emoji, text)
+			}
+		case SeverityMarkerText:
+			return fmt.Sprintf("[%s] %s", severity.String(), text)
+		}
+
+		return text
+	}
+}
+
+// severityBadgeColors are the colors of the severity badges, by severity
+var severityBadgeColors = map[lookout.Severity]string{
+	lookout.ErrorSeverity:       "red",
+	lookout.WarningSeverity:     "orange",
+	lookout.InfoSeverity:        "blue",
+	lookout.UnspecifiedSeverity: "lightgrey",
+}
+
+// shieldsEscape escapes the dashes, underscores and spaces of a badge text as
+// shields.io expects them, and the rest of the text for an URL path
+func shieldsEscape(s string) string {
+	s = strings.NewReplacer("-", "--", "_", "__", " ", "_").Replace(s)
+	return url.PathEscape(s)
+}
+
+// SeverityBadgeDecorator returns a decorator that prepends to the text a
+// badge image, e.g. from shields.io, with the severity of the comment and its
+// RuleID, or the name of the analyzer if it has none. The URL of the image is
+// tmpl formatted with the severity, the rule and the color of the severity.
+// Comments without severity nor rule don't get a badge.
+func SeverityBadgeDecorator(tmpl string) CommentDecorator {
+	return func(ctx context.Context, rc *RenderContext, text string) string {
+		c := rc.Comment
+		if c.Severity == lookout.UnspecifiedSeverity && c.RuleID == "" {
+			return text
+		}
+
+		severity := strings.ToLower(c.Severity.String())
+		rule := c.RuleID
+		if rule == "" {
+			rule = rc.Analyzer.ShownName()
+		}
+
+		badge := fmt.Sprintf(tmpl, shieldsEscape(severity), shieldsEscape(rule),
+			severityBadgeColors[c.Severity])
+		return fmt.Sprintf("![%s %s](%s)\n\n%s", severity, rule, badge, text)
+	}
+}
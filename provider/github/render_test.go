@@ -0,0 +1,279 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/src-d/lookout"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultRendererOrder(t *testing.T) {
+	require := require.New(t)
+
+	r := NewDefaultRenderer(ProviderConfig{
+		NormalizeHTML:      true,
+		CommentFooter:      "_[Feedback](%s)_",
+		QuoteOffendingLine: true,
+	})
+	require.Len(r.Decorators, 8)
+
+	dl := newDiffLines(&github.CommitsComparison{
+		Files: []github.CommitFile{github.CommitFile{
+			Filename: strptr("main.go"),
+			Patch:    strptr(mockedPatch),
+		}}})
+
+	rc := &RenderContext{
+		Analyzer: lookout.AnalyzerConfig{Feedback: "https://foo.bar/feedback"},
+		Comment: &lookout.Comment{
+			File: "main.go",
+			Line: 5,
+			Text: "<b>Line</b> comment",
+		},
+		dl: dl,
+	}
+
+	expected := "> ```\n> 3\n> ```\n\n**Line** comment\n\n_[Feedback](https://foo.bar/feedback)_"
+	require.Equal(expected, r.Render(context.Background(), rc))
+}
+
+func TestDefaultRendererNoDecorators(t *testing.T) {
+	require := require.New(t)
+
+	r := NewDefaultRenderer(ProviderConfig{})
+	require.Len(r.Decorators, 5)
+
+	rc := &RenderContext{Comment: &lookout.Comment{Text: "<b>text</b>"}}
+	require.Equal("<b>text</b>", r.Render(context.Background(), rc))
+}
+
+func TestDetailLinkDecorator(t *testing.T) {
+	require := require.New(t)
+
+	r := NewDefaultRenderer(ProviderConfig{CommentFooter: "_[Feedback](%s)_"})
+
+	rc := &RenderContext{
+		Analyzer: lookout.AnalyzerConfig{Feedback: "https://foo.bar/feedback"},
+		Comment: &lookout.Comment{
+			Text:      "text",
+			DetailURL: "https://foo.bar/rules/SEC001",
+		},
+	}
+	require.Equal("text\n\n[details](https://foo.bar/rules/SEC001)\n\n_[Feedback](https://foo.bar/feedback)_",
+		r.Render(context.Background(), rc))
+
+	rc.Comment.DetailURL = ""
+	require.Equal("text\n\n_[Feedback](https://foo.bar/feedback)_",
+		r.Render(context.Background(), rc))
+}
+
+func TestFeedbackLinksDecorator(t *testing.T) {
+	require := require.New(t)
+
+	r := NewDefaultRenderer(ProviderConfig{CommentFooter: "_[Feedback](%s)_"})
+
+	rc := &RenderContext{
+		Analyzer: lookout.AnalyzerConfig{
+			Feedback: "https://foo.bar/feedback",
+			FeedbackLinks: map[string]string{
+				"Report a bug":     "https://foo.bar/bugs",
+				"False positive":   "https://foo.bar/false-positive",
+				"Suggest a change": "https://foo.bar/ideas",
+			},
+		},
+		Comment: &lookout.Comment{Text: "text"},
+	}
+	require.Equal("text\n\n"+
+		"_[Feedback](https://foo.bar/feedback)_\n\n"+
+		"[False positive](https://foo.bar/false-positive) · "+
+		"[Report a bug](https://foo.bar/bugs) · "+
+		"[Suggest a change](https://foo.bar/ideas)",
+		r.Render(context.Background(), rc))
+}
+
+func TestRuleDocsDecorator(t *testing.T) {
+	require := require.New(t)
+
+	r := NewDefaultRenderer(ProviderConfig{CommentFooter: "_[Feedback](%s)_"})
+
+	rc := &RenderContext{
+		Analyzer: lookout.AnalyzerConfig{
+			Feedback: "https://foo.bar/feedback",
+			RuleDocs: map[string]string{
+				"SEC001": "Don't use `eval`, it runs arbitrary code.\n",
+			},
+		},
+		Comment: &lookout.Comment{Text: "text", RuleID: "SEC001"},
+	}
+	require.Equal("text\n\n"+
+		"<details>\n<summary>About SEC001</summary>\n\n"+
+		"Don't use `eval`, it runs arbitrary code.\n\n"+
+		"</details>\n\n"+
+		"_[Feedback](https://foo.bar/feedback)_",
+		r.Render(context.Background(), rc))
+
+	// rules without documentation are rendered as is
+	rc.Comment.RuleID = "LINT002"
+	require.Equal("text\n\n_[Feedback](https://foo.bar/feedback)_",
+		r.Render(context.Background(), rc))
+}
+
+func TestTaskListDecorator(t *testing.T) {
+	require := require.New(t)
+
+	r := NewDefaultRenderer(ProviderConfig{})
+
+	rc := &RenderContext{
+		Comment: &lookout.Comment{
+			Text:      "3 things to fix",
+			Items:     []string{"rename `foo`", "remove the\nunused import", "add tests"},
+			DetailURL: "https://foo.bar/rules/SEC001",
+		},
+	}
+	require.Equal("3 things to fix\n\n"+
+		"- [ ] rename `foo`\n"+
+		"- [ ] remove the unused import\n"+
+		"- [ ] add tests\n\n"+
+		"[details](https://foo.bar/rules/SEC001)",
+		r.Render(context.Background(), rc))
+
+	rc.Comment.Items = nil
+	rc.Comment.DetailURL = ""
+	require.Equal("3 things to fix", r.Render(context.Background(), rc))
+}
+
+func TestLanguageDecorator(t *testing.T) {
+	require := require.New(t)
+
+	r := NewDefaultRenderer(ProviderConfig{})
+
+	rc := &RenderContext{
+		Comment: &lookout.Comment{
+			Text: "use instead:\n```\nfoo := bar()\n```\n" +
+				"or:\n```suggestion\nfoo = bar()\n```",
+			Language: "go",
+		},
+	}
+	require.Equal("use instead:\n```go\nfoo := bar()\n```\n"+
+		"or:\n```suggestion\nfoo = bar()\n```",
+		r.Render(context.Background(), rc))
+
+	rc.Comment.Language = ""
+	require.Equal(rc.Comment.Text, r.Render(context.Background(), rc))
+}
+
+func TestEnvironmentLabelDecorator(t *testing.T) {
+	require := require.New(t)
+
+	r := NewDefaultRenderer(ProviderConfig{
+		CommentFooter:    "_[Feedback](%s)_",
+		EnvironmentLabel: "staging",
+	})
+
+	rc := &RenderContext{
+		Analyzer: lookout.AnalyzerConfig{Feedback: "https://foo.bar/feedback"},
+		Comment:  &lookout.Comment{Text: "text"},
+	}
+	require.Equal("**[staging]** text\n\n_[Feedback](https://foo.bar/feedback)_",
+		r.Render(context.Background(), rc))
+}
+
+func TestSeverityBadgeDecorator(t *testing.T) {
+	require := require.New(t)
+
+	r := NewDefaultRenderer(ProviderConfig{
+		EnvironmentLabel: "staging",
+		SeverityBadge:    "https://img.shields.io/badge/%[1]s-%[2]s-%[3]s",
+	})
+
+	rc := &RenderContext{
+		Analyzer: lookout.AnalyzerConfig{Name: "mock"},
+		Comment: &lookout.Comment{
+			Text:     "text",
+			Severity: lookout.ErrorSeverity,
+			RuleID:   "SEC-001 eval",
+		},
+	}
+	require.Equal("![error SEC-001 eval](https://img.shields.io/badge/error-SEC--001_eval-red)\n\n"+
+		"**[staging]** text", r.Render(context.Background(), rc))
+
+	// without rule the name of the analyzer is shown
+	rc.Comment = &lookout.Comment{Text: "text", Severity: lookout.WarningSeverity}
+	require.Equal("![warning mock](https://img.shields.io/badge/warning-mock-orange)\n\n"+
+		"**[staging]** text", r.Render(context.Background(), rc))
+
+	// without severity nor rule there is no badge
+	rc.Comment = &lookout.Comment{Text: "text"}
+	require.Equal("**[staging]** text", r.Render(context.Background(), rc))
+}
+
+func TestSeverityMarkerDecorator(t *testing.T) {
+	require := require.New(t)
+
+	rc := &RenderContext{
+		Analyzer: lookout.AnalyzerConfig{Name: "mock"},
+		Comment:  &lookout.Comment{Text: "text", Severity: lookout.WarningSeverity},
+	}
+
+	r := NewDefaultRenderer(ProviderConfig{
+		EnvironmentLabel: "staging",
+		SeverityMarker:   SeverityMarkerEmoji,
+	})
+	require.Equal("**[staging]** ⚠️ text", r.Render(context.Background(), rc))
+
+	r = NewDefaultRenderer(ProviderConfig{SeverityMarker: SeverityMarkerText})
+	require.Equal("[WARNING] text", r.Render(context.Background(), rc))
+
+	// without severity there is no marker
+	rc.Comment = &lookout.Comment{Text: "text"}
+	require.Equal("text", r.Render(context.Background(), rc))
+
+	// nor with unknown modes
+	rc.Comment = &lookout.Comment{Text: "text", Severity: lookout.ErrorSeverity}
+	r = NewDefaultRenderer(ProviderConfig{SeverityMarker: "unknown"})
+	require.Equal("text", r.Render(context.Background(), rc))
+}
+
+func TestDecoratorRendererOrder(t *testing.T) {
+	require := require.New(t)
+
+	appendD := func(s string) CommentDecorator {
+		return func(ctx context.Context, rc *RenderContext, text string) string {
+			return fmt.Sprintf("%s-%s", text, s)
+		}
+	}
+
+	r := &DecoratorRenderer{Decorators: []CommentDecorator{
+		appendD("a"), appendD("b"), appendD("c"),
+	}}
+
+	rc := &RenderContext{Comment: &lookout.Comment{Text: "text"}}
+	require.Equal("text-a-b-c", r.Render(context.Background(), rc))
+}
+
+func TestQuoteLineDecoratorNotLineComment(t *testing.T) {
+	require := require.New(t)
+
+	rc := &RenderContext{Comment: &lookout.Comment{File: "main.go", Text: "text"}}
+	require.Equal("text", QuoteLineDecorator(context.Background(), rc, "text"))
+}
+
+func TestQuoteLineDecoratorOutOfDiff(t *testing.T) {
+	require := require.New(t)
+
+	p := &Poster{fileGetter: newFileGetterMock(t, "main.go", "package main\n\nfunc main() {}\n")}
+	rc := &RenderContext{
+		Comment: &lookout.Comment{File: "main.go", Line: 3, Text: "text"},
+		files:   p.fileContents(&mockEvent.Head),
+	}
+	require.Equal("> ```\n> func main() {}\n> ```\n\ntext",
+		QuoteLineDecorator(context.Background(), rc, "text"))
+
+	// the file is cached, the lines past its end are not quoted
+	rc.Comment = &lookout.Comment{File: "main.go", Line: 10, Text: "text"}
+	require.Equal("text", QuoteLineDecorator(context.Background(), rc, "text"))
+}
@@ -0,0 +1,246 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/src-d/lookout/util/ctxlog"
+
+	"github.com/google/go-github/github"
+	log "gopkg.in/src-d/go-log.v1"
+)
+
+// time to wait before the first retry of a failed request, if
+// ProviderConfig.RetryDelay is not set. It's doubled for each following retry
+// of the same request
+var retryDelay = 500 * time.Millisecond
+
+// max time to wait before retrying a failed request
+var maxRetryDelay = 30 * time.Second
+
+// max number of retries of a request after abuse-detection responses. These
+// retries don't consume the retry budget
+var maxAbuseRetries = 3
+
+// retryBudget limits the total number of retries of the GitHub API requests
+// made for a single event, shared by all its operations, so the worst-case
+// API usage of each event is bounded.
+type retryBudget struct {
+	left int
+	// delay is the time to wait before the first retry of each request, if
+	// 0 retryDelay is used
+	delay time.Duration
+}
+
+// newRetryBudget returns a retry budget with the given retries and the
+// RetryDelay of the configuration
+func (p *Poster) newRetryBudget(retries int) *retryBudget {
+	return &retryBudget{left: retries, delay: p.retryDelay}
+}
+
+// compareBudget returns the retry budget of the requests fetching the diffs
+// of an event: a budget of its own with CompareRetries retries if it's set,
+// as fetching is read-only and safe to retry, or the budget of the event.
+func (p *Poster) compareBudget(budget *retryBudget) *retryBudget {
+	if p.conf.CompareRetries <= 0 {
+		return budget
+	}
+
+	return p.newRetryBudget(p.conf.CompareRetries)
+}
+
+// do calls fn, retrying it while it returns ErrGitHubAPI and the budget is
+// not exhausted. Once it is, the last error is returned immediately. The
+// errors of requests rejected with a client error status, such as 422, are
+// not retried. The delay between retries grows exponentially, unless the
+// response has a Retry-After header. Abuse-detection errors with a
+// Retry-After are retried after waiting for the given duration, up to
+// maxAbuseRetries times, without consuming the budget.
+// fn must be idempotent, see doCreate otherwise.
+func (b *retryBudget) do(ctx context.Context, op string, fn func() error) error {
+	return b.retry(ctx, op, fn, func(err error) bool {
+		return !isClientError(err)
+	})
+}
+
+// doCreate is like do for the requests that are not idempotent, such as
+// creating a review. They are only retried when GitHub rejected them because
+// of a rate limit, as on server errors or timeouts they may have succeeded
+// anyway, e.g. GitHub can return 502 for reviews that were posted.
+func (b *retryBudget) doCreate(ctx context.Context, op string, fn func() error) error {
+	return b.retry(ctx, op, fn, isRateLimitError)
+}
+
+// retry calls fn, retrying it as described in do while it returns an
+// ErrGitHubAPI error for which retryable returns true
+func (b *retryBudget) retry(
+	ctx context.Context,
+	op string,
+	fn func() error,
+	retryable func(error) bool,
+) error {
+	abuseRetries := 0
+	retries := 0
+	for {
+		err := fn()
+		if err == nil || !ErrGitHubAPI.Is(err) || !retryable(err) {
+			return err
+		}
+
+		logger := ctxlog.Get(ctx).With(log.Fields{"operation": op})
+
+		var delay time.Duration
+		if retryAfter, ok := abuseRetryAfter(err); ok && abuseRetries < maxAbuseRetries {
+			abuseRetries++
+			delay = retryAfter
+			logger.With(log.Fields{
+				"retry-after": retryAfter,
+			}).Warningf("github abuse detection triggered, retrying: %s", err)
+		} else {
+			if b == nil || b.left <= 0 {
+				return err
+			}
+
+			b.left--
+			delay = b.backoff(retries)
+			if retryAfter, ok := responseRetryAfter(err); ok {
+				delay = retryAfter
+			}
+			retries++
+
+			logger.With(log.Fields{
+				"retries-left": b.left,
+				"delay":        delay,
+			}).Warningf("github api request failed, retrying: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ErrGitHubAPI.Wrap(ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoff returns the time to wait before retrying a request that was
+// already retried the given times, doubling the delay of the budget for each
+// retry, up to maxRetryDelay
+func (b *retryBudget) backoff(retries int) time.Duration {
+	delay := b.delay
+	if delay <= 0 {
+		delay = retryDelay
+	}
+
+	for i := 0; i < retries && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+
+	return delay
+}
+
+// errorResponse returns the response of the GitHub API error in the causes
+// of err, or nil if there isn't one
+func errorResponse(err error) *http.Response {
+	for err != nil {
+		if respErr, ok := err.(*github.ErrorResponse); ok {
+			return respErr.Response
+		}
+
+		cause, ok := err.(interface{ Cause() error })
+		if !ok {
+			return nil
+		}
+
+		err = cause.Cause()
+	}
+
+	return nil
+}
+
+// isClientError returns true if err is a response of the GitHub API with a
+// 4xx status that won't succeed if retried, i.e. other than the 403 and 429
+// of the rate limits
+func isClientError(err error) bool {
+	resp := errorResponse(err)
+	if resp == nil {
+		return false
+	}
+
+	code := resp.StatusCode
+	return code >= 400 && code < 500 &&
+		code != http.StatusForbidden && code != http.StatusTooManyRequests
+}
+
+// isRateLimitError returns true if err is a response of the GitHub API
+// rejecting the request because of a rate limit or the abuse detection,
+// i.e. 403 or 429, so it was not processed
+func isRateLimitError(err error) bool {
+	for err != nil {
+		switch e := err.(type) {
+		case *github.RateLimitError, *github.AbuseRateLimitError:
+			return true
+		case *github.ErrorResponse:
+			if e.Response == nil {
+				return false
+			}
+
+			code := e.Response.StatusCode
+			return code == http.StatusForbidden || code == http.StatusTooManyRequests
+		}
+
+		cause, ok := err.(interface{ Cause() error })
+		if !ok {
+			return false
+		}
+
+		err = cause.Cause()
+	}
+
+	return false
+}
+
+// responseRetryAfter returns the duration of the Retry-After header, in
+// seconds, of the response of a GitHub API error, and false if err doesn't
+// have one, e.g. on 503 Service Unavailable
+func responseRetryAfter(err error) (time.Duration, bool) {
+	resp := errorResponse(err)
+	if resp == nil {
+		return 0, false
+	}
+
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs < 0 {
+		return 0, false
+	}
+
+	return time.Duration(secs) * time.Second, true
+}
+
+// abuseRetryAfter returns the Retry-After duration of an abuse-detection
+// error, and false if err is not one or it doesn't have a Retry-After
+func abuseRetryAfter(err error) (time.Duration, bool) {
+	for err != nil {
+		if abuseErr, ok := err.(*github.AbuseRateLimitError); ok {
+			if abuseErr.RetryAfter == nil {
+				return 0, false
+			}
+
+			return *abuseErr.RetryAfter, true
+		}
+
+		cause, ok := err.(interface{ Cause() error })
+		if !ok {
+			return 0, false
+		}
+
+		err = cause.Cause()
+	}
+
+	return 0, false
+}
@@ -0,0 +1,119 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+func apiError(code int, retryAfter string) error {
+	resp := &http.Response{StatusCode: code, Header: make(http.Header)}
+	if retryAfter != "" {
+		resp.Header.Set("Retry-After", retryAfter)
+	}
+
+	return ErrGitHubAPI.Wrap(&github.ErrorResponse{Response: resp})
+}
+
+func TestRetryBudgetBackoff(t *testing.T) {
+	require := require.New(t)
+
+	b := &retryBudget{delay: time.Second}
+	require.Equal(time.Second, b.backoff(0))
+	require.Equal(2*time.Second, b.backoff(1))
+	require.Equal(8*time.Second, b.backoff(3))
+	require.Equal(maxRetryDelay, b.backoff(10))
+
+	b = &retryBudget{}
+	require.Equal(retryDelay, b.backoff(0))
+}
+
+func TestRetryBudgetRetryAfter(t *testing.T) {
+	require := require.New(t)
+
+	// the Retry-After of the response takes precedence over the delay
+	b := &retryBudget{left: 2, delay: time.Hour}
+	calls := 0
+	err := b.do(context.Background(), "test", func() error {
+		calls++
+		if calls == 1 {
+			return apiError(http.StatusServiceUnavailable, "0")
+		}
+
+		return nil
+	})
+	require.NoError(err)
+	require.Equal(2, calls)
+	require.Equal(1, b.left)
+}
+
+func TestRetryBudgetClientError(t *testing.T) {
+	require := require.New(t)
+
+	b := &retryBudget{left: 2, delay: time.Millisecond}
+	calls := 0
+	err := b.do(context.Background(), "test", func() error {
+		calls++
+		return apiError(http.StatusUnprocessableEntity, "")
+	})
+	require.True(ErrGitHubAPI.Is(err))
+	require.Equal(1, calls)
+	require.Equal(2, b.left)
+
+	calls = 0
+	err = b.do(context.Background(), "test", func() error {
+		calls++
+		return apiError(http.StatusTooManyRequests, "")
+	})
+	require.True(ErrGitHubAPI.Is(err))
+	require.Equal(3, calls)
+	require.Equal(0, b.left)
+}
+
+func TestRetryBudgetCreate(t *testing.T) {
+	require := require.New(t)
+
+	// server errors are not retried, the request may have succeeded
+	b := &retryBudget{left: 2, delay: time.Millisecond}
+	calls := 0
+	err := b.doCreate(context.Background(), "test", func() error {
+		calls++
+		return apiError(http.StatusBadGateway, "")
+	})
+	require.True(ErrGitHubAPI.Is(err))
+	require.Equal(1, calls)
+	require.Equal(2, b.left)
+
+	// rate limited requests were not processed, they are retried
+	calls = 0
+	err = b.doCreate(context.Background(), "test", func() error {
+		calls++
+		if calls == 1 {
+			return apiError(http.StatusForbidden, "0")
+		}
+
+		return nil
+	})
+	require.NoError(err)
+	require.Equal(2, calls)
+	require.Equal(1, b.left)
+}
+
+func TestRetryBudgetCanceled(t *testing.T) {
+	require := require.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	b := &retryBudget{left: 5, delay: time.Hour}
+	start := time.Now()
+	err := b.do(ctx, "test", func() error {
+		return apiError(http.StatusBadGateway, "")
+	})
+	require.True(ErrGitHubAPI.Is(err))
+	require.True(time.Since(start) < time.Minute)
+}
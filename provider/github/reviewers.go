@@ -0,0 +1,55 @@
+package github
+
+import (
+	"context"
+
+	"github.com/src-d/lookout/util/ctxlog"
+
+	"github.com/google/go-github/github"
+	log "gopkg.in/src-d/go-log.v1"
+)
+
+// updateRequestedReviewer adds ProviderConfig.RequestReviewer as a requested
+// reviewer of the pull request if the posted comments are blocking, so the
+// pull request shows a pending review, and removes it otherwise. The reviews
+// are already posted, so errors are only logged.
+func (p *Poster) updateRequestedReviewer(
+	ctx context.Context,
+	client *Client,
+	budget *retryBudget,
+	owner, repo string,
+	pr int,
+	blocking bool,
+) {
+	login := p.conf.RequestReviewer
+	if login == "" {
+		return
+	}
+
+	reviewers := github.ReviewersRequest{Reviewers: []string{login}}
+
+	op := "remove reviewer"
+	if blocking {
+		op = "request reviewer"
+	}
+
+	err := budget.do(ctx, op, func() error {
+		ctx, cancel := withTimeout(ctx, p.postTimeout)
+		defer cancel()
+
+		var resp *github.Response
+		var err error
+		if blocking {
+			_, resp, err = client.PullRequests.RequestReviewers(ctx, owner, repo, pr, reviewers)
+		} else {
+			resp, err = client.PullRequests.RemoveReviewers(ctx, owner, repo, pr, reviewers)
+		}
+
+		return p.handleAPIError(resp, err)
+	})
+	if err != nil {
+		ctxlog.Get(ctx).With(log.Fields{
+			"reviewer": login,
+		}).Errorf(err, "can't %s", op)
+	}
+}
@@ -0,0 +1,126 @@
+package github
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PostSchedule restricts posting to some time windows. Comments produced
+// outside of them are deferred until the next window starts.
+type PostSchedule struct {
+	// Timezone of the windows, e.g. "Europe/Madrid". UTC is used if empty
+	Timezone string `yaml:"timezone"`
+	// Windows when posting is allowed. If empty, posting is always allowed
+	Windows []PostWindow `yaml:"windows"`
+}
+
+// PostWindow is a daily time window when posting is allowed.
+type PostWindow struct {
+	// Days of the week the window applies to, e.g. "mon" or "sat". If empty,
+	// it applies to every day
+	Days []string `yaml:"days"`
+	// Start and End of the window in 24h "15:04" format. If End is
+	// before Start, the window ends the next day
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+}
+
+// nextAllowed returns the zero time if posting is allowed at now, or the time
+// when the next window starts otherwise.
+func (s PostSchedule) nextAllowed(now time.Time) (time.Time, error) {
+	if len(s.Windows) == 0 {
+		return time.Time{}, nil
+	}
+
+	loc := time.UTC
+	if s.Timezone != "" {
+		var err error
+		loc, err = time.LoadLocation(s.Timezone)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("bad post schedule timezone: %s", err)
+		}
+	}
+
+	now = now.In(loc)
+	var next time.Time
+	for _, w := range s.Windows {
+		start, err := parseClock(w.Start)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		end, err := parseClock(w.End)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		// the window ends the next day
+		endDays := 0
+		if !start.before(end) {
+			endDays = 1
+		}
+
+		// the window of the previous day can still be open
+		for i := -1; i <= 7; i++ {
+			day := time.Date(now.Year(), now.Month(), now.Day()+i, 0, 0, 0, 0, loc)
+			if !w.appliesTo(day.Weekday()) {
+				continue
+			}
+
+			// the times are built from the date, not added to midnight,
+			// so they are right on the days a DST change happens
+			wStart := start.on(day, 0)
+			wEnd := end.on(day, endDays)
+			if !now.Before(wStart) && now.Before(wEnd) {
+				return time.Time{}, nil
+			}
+
+			if wStart.After(now) && (next.IsZero() || wStart.Before(next)) {
+				next = wStart
+			}
+		}
+	}
+
+	return next, nil
+}
+
+func (w PostWindow) appliesTo(d time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+
+	for _, day := range w.Days {
+		if strings.EqualFold(day, d.String()[:3]) || strings.EqualFold(day, d.String()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clock is a time of day
+type clock struct {
+	hour, min int
+}
+
+// before returns whether c is earlier in the day than o
+func (c clock) before(o clock) bool {
+	return c.hour < o.hour || (c.hour == o.hour && c.min < o.min)
+}
+
+// on returns the time of c on the date of day, plus the given days, in its
+// location
+func (c clock) on(day time.Time, days int) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day()+days, c.hour, c.min, 0, 0, day.Location())
+}
+
+// parseClock returns the clock of a "15:04" time of day
+func parseClock(s string) (clock, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return clock{}, fmt.Errorf("bad post schedule time %q: %s", s, err)
+	}
+
+	return clock{t.Hour(), t.Minute()}, nil
+}
@@ -0,0 +1,128 @@
+package github
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostScheduleNextAllowed(t *testing.T) {
+	require := require.New(t)
+
+	s := PostSchedule{Windows: []PostWindow{{
+		Days:  []string{"mon", "tue", "wed", "thu", "fri"},
+		Start: "09:00",
+		End:   "18:00",
+	}}}
+
+	// Wednesday
+	date := func(day, hour, min int) time.Time {
+		return time.Date(2018, 10, day, hour, min, 0, 0, time.UTC)
+	}
+
+	cases := []struct {
+		now      time.Time
+		expected time.Time
+	}{
+		{date(10, 9, 0), time.Time{}},
+		{date(10, 17, 59), time.Time{}},
+		{date(10, 8, 0), date(10, 9, 0)},
+		{date(10, 18, 0), date(11, 9, 0)},
+		// Friday evening, deferred until Monday
+		{date(12, 20, 0), date(15, 9, 0)},
+		// Saturday
+		{date(13, 12, 0), date(15, 9, 0)},
+	}
+
+	for _, c := range cases {
+		next, err := s.nextAllowed(c.now)
+		require.NoError(err)
+		require.True(c.expected.Equal(next), "now: %s, expected: %s, got: %s", c.now, c.expected, next)
+	}
+}
+
+func TestPostScheduleEmpty(t *testing.T) {
+	require := require.New(t)
+
+	next, err := PostSchedule{}.nextAllowed(time.Now())
+	require.NoError(err)
+	require.True(next.IsZero())
+}
+
+func TestPostScheduleOvernight(t *testing.T) {
+	require := require.New(t)
+
+	s := PostSchedule{Windows: []PostWindow{{Start: "22:00", End: "06:00"}}}
+
+	next, err := s.nextAllowed(time.Date(2018, 10, 10, 23, 0, 0, 0, time.UTC))
+	require.NoError(err)
+	require.True(next.IsZero())
+
+	next, err = s.nextAllowed(time.Date(2018, 10, 11, 5, 0, 0, 0, time.UTC))
+	require.NoError(err)
+	require.True(next.IsZero())
+
+	next, err = s.nextAllowed(time.Date(2018, 10, 11, 12, 0, 0, 0, time.UTC))
+	require.NoError(err)
+	require.Equal(time.Date(2018, 10, 11, 22, 0, 0, 0, time.UTC), next)
+}
+
+func TestPostScheduleTimezone(t *testing.T) {
+	require := require.New(t)
+
+	s := PostSchedule{
+		Timezone: "America/New_York",
+		Windows:  []PostWindow{{Start: "09:00", End: "18:00"}},
+	}
+
+	// 14:00 UTC is 10:00 in New York
+	next, err := s.nextAllowed(time.Date(2018, 10, 10, 14, 0, 0, 0, time.UTC))
+	require.NoError(err)
+	require.True(next.IsZero())
+
+	// 10:00 UTC is 06:00 in New York
+	next, err = s.nextAllowed(time.Date(2018, 10, 10, 10, 0, 0, 0, time.UTC))
+	require.NoError(err)
+	require.True(time.Date(2018, 10, 10, 13, 0, 0, 0, time.UTC).Equal(next))
+}
+
+func TestPostScheduleDST(t *testing.T) {
+	require := require.New(t)
+
+	loc, err := time.LoadLocation("Europe/Madrid")
+	require.NoError(err)
+
+	s := PostSchedule{
+		Timezone: "Europe/Madrid",
+		Windows:  []PostWindow{{Start: "09:00", End: "18:00"}},
+	}
+
+	// the clocks go forward at 02:00 on 2018-03-25, and back at 03:00 on
+	// 2018-10-28
+	for _, day := range []int{25, 28} {
+		month := time.March
+		if day == 28 {
+			month = time.October
+		}
+
+		next, err := s.nextAllowed(time.Date(2018, month, day, 8, 0, 0, 0, loc))
+		require.NoError(err)
+		require.True(time.Date(2018, month, day, 9, 0, 0, 0, loc).Equal(next),
+			"day: %d, got: %s", day, next)
+
+		next, err = s.nextAllowed(time.Date(2018, month, day, 17, 30, 0, 0, loc))
+		require.NoError(err)
+		require.True(next.IsZero(), "day: %d, got: %s", day, next)
+	}
+}
+
+func TestPostScheduleBadConfig(t *testing.T) {
+	require := require.New(t)
+
+	_, err := PostSchedule{Timezone: "Bad/Zone", Windows: []PostWindow{{}}}.nextAllowed(time.Now())
+	require.Error(err)
+
+	_, err = PostSchedule{Windows: []PostWindow{{Start: "9am", End: "18:00"}}}.nextAllowed(time.Now())
+	require.Error(err)
+}
@@ -0,0 +1,212 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/util/ctxlog"
+
+	log "gopkg.in/src-d/go-log.v1"
+)
+
+// SeverityPolicy changes the severity of the comments on the files matching
+// its paths, e.g. to downgrade the findings in low-priority directories.
+type SeverityPolicy struct {
+	// Paths are glob patterns, e.g. "examples" or "internal/*". A pattern
+	// matches a file if it matches its path or any of its parent directories
+	Paths []string `yaml:"paths"`
+	// MaxSeverity downgrades the comments with a higher severity to it, e.g.
+	// "WARNING". If empty, comments are not downgraded
+	MaxSeverity string `yaml:"max_severity"`
+	// MinSeverity drops the comments with a lower severity, e.g. "WARNING".
+	// If empty, comments are not dropped
+	MinSeverity string `yaml:"min_severity"`
+}
+
+// SeverityPolicies is a list of policies, the first one matching the file of
+// a comment is applied. Global comments and comments without severity are
+// never changed.
+type SeverityPolicies []SeverityPolicy
+
+// apply returns the comments after applying the policies. The given comments
+// are not modified.
+func (ps SeverityPolicies) apply(
+	aCommentsList []lookout.AnalyzerComments,
+) ([]lookout.AnalyzerComments, error) {
+	if len(ps) == 0 {
+		return aCommentsList, nil
+	}
+
+	maxs := make([]lookout.Severity, len(ps))
+	mins := make([]lookout.Severity, len(ps))
+	for i, p := range ps {
+		var err error
+		if maxs[i], err = parseSeverity(p.MaxSeverity); err != nil {
+			return nil, err
+		}
+
+		if mins[i], err = parseSeverity(p.MinSeverity); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]lookout.AnalyzerComments, len(aCommentsList))
+	for i, aComments := range aCommentsList {
+		result[i] = lookout.AnalyzerComments{Config: aComments.Config}
+		for _, c := range aComments.Comments {
+			j := ps.match(c.File)
+			if j < 0 || c.Severity == lookout.UnspecifiedSeverity {
+				result[i].Comments = append(result[i].Comments, c)
+				continue
+			}
+
+			if mins[j] != lookout.UnspecifiedSeverity && c.Severity < mins[j] {
+				continue
+			}
+
+			if maxs[j] != lookout.UnspecifiedSeverity && c.Severity > maxs[j] {
+				downgraded := *c
+				downgraded.Severity = maxs[j]
+				c = &downgraded
+			}
+
+			result[i].Comments = append(result[i].Comments, c)
+		}
+	}
+
+	return result, nil
+}
+
+// match returns the index of the first policy matching the file, or -1
+func (ps SeverityPolicies) match(file string) int {
+	if file == "" {
+		return -1
+	}
+
+	for i, p := range ps {
+		for _, pattern := range p.Paths {
+			if matchPathOrParent(pattern, file) {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+func matchPathOrParent(pattern, file string) bool {
+	for p := file; p != "." && p != "/"; p = path.Dir(p) {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseSeverity returns the severity with the given name, case-insensitive.
+// An empty name is UnspecifiedSeverity.
+func parseSeverity(name string) (lookout.Severity, error) {
+	if name == "" {
+		return lookout.UnspecifiedSeverity, nil
+	}
+
+	v, ok := lookout.SeverityByName(strings.ToUpper(name))
+	if !ok {
+		return lookout.UnspecifiedSeverity, fmt.Errorf("unknown severity: %s", name)
+	}
+
+	return v, nil
+}
+
+// applySeverityPolicies applies the configured policies to the comments. If
+// they are not valid the comments are returned as is.
+func (p *Poster) applySeverityPolicies(
+	ctx context.Context,
+	aCommentsList []lookout.AnalyzerComments,
+) []lookout.AnalyzerComments {
+	result, err := p.conf.SeverityPolicies.apply(aCommentsList)
+	if err != nil {
+		ctxlog.Get(ctx).Errorf(err, "can't apply the severity policies, posting anyway")
+		return aCommentsList
+	}
+
+	return result
+}
+
+// applyMinSeverity drops the comments with a severity lower than
+// MinSeverity, logging how many were dropped. The comments without severity
+// are kept. If MinSeverity is not valid it's logged and the comments are
+// returned as is. The given comments are not modified.
+func (p *Poster) applyMinSeverity(
+	ctx context.Context,
+	aCommentsList []lookout.AnalyzerComments,
+) []lookout.AnalyzerComments {
+	min, err := parseSeverity(p.conf.MinSeverity)
+	if err != nil {
+		ctxlog.Get(ctx).Errorf(err, "can't parse the min severity, posting anyway")
+		return aCommentsList
+	}
+
+	if min == lookout.UnspecifiedSeverity {
+		return aCommentsList
+	}
+
+	var dropped int
+	result := make([]lookout.AnalyzerComments, len(aCommentsList))
+	for i, aComments := range aCommentsList {
+		result[i] = aComments
+		result[i].Comments = nil
+		for _, c := range aComments.Comments {
+			if c.Severity != lookout.UnspecifiedSeverity && c.Severity < min {
+				dropped++
+				continue
+			}
+
+			result[i].Comments = append(result[i].Comments, c)
+		}
+	}
+
+	if dropped > 0 {
+		ctxlog.Get(ctx).With(log.Fields{
+			"min-severity": min.String(),
+			"dropped":      dropped,
+		}).Infof("dropped the comments under the min severity")
+	}
+
+	return result
+}
+
+// reviewEvent returns the event of the review posting the comments:
+// REQUEST_CHANGES if they request changes, see requestsChanges, and COMMENT
+// otherwise.
+func (p *Poster) reviewEvent(aCommentsList []lookout.AnalyzerComments) string {
+	if p.requestsChanges(aCommentsList) {
+		return requestChangesEvent
+	}
+
+	return commentEvent
+}
+
+// requestsChanges returns true if any of the comments has a severity of at
+// least RequestChangesSeverity. The comments without severity never request
+// changes. RequestChangesSeverity is validated by NewPoster.
+func (p *Poster) requestsChanges(aCommentsList []lookout.AnalyzerComments) bool {
+	min, _ := parseSeverity(p.conf.RequestChangesSeverity)
+	if min == lookout.UnspecifiedSeverity {
+		return false
+	}
+
+	for _, aComments := range aCommentsList {
+		for _, c := range aComments.Comments {
+			if c.Severity != lookout.UnspecifiedSeverity && c.Severity >= min {
+				return true
+			}
+		}
+	}
+
+	return false
+}
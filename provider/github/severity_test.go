@@ -0,0 +1,130 @@
+package github
+
+import (
+	"context"
+	"testing"
+
+	"github.com/src-d/lookout"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testSeverityPolicies = SeverityPolicies{
+	{Paths: []string{"internal"}},
+	{Paths: []string{"examples"}, MaxSeverity: "warning", MinSeverity: "warning"},
+}
+
+func TestSeverityPoliciesApply(t *testing.T) {
+	require := require.New(t)
+
+	internal := &lookout.Comment{File: "internal/foo/bar.go", Line: 1, Severity: lookout.ErrorSeverity}
+	example := &lookout.Comment{File: "examples/foo.go", Line: 2, Severity: lookout.ErrorSeverity}
+	exampleInfo := &lookout.Comment{File: "examples/foo.go", Line: 3, Severity: lookout.InfoSeverity}
+	exampleNoSeverity := &lookout.Comment{File: "examples/foo.go", Line: 4}
+	global := &lookout.Comment{Text: "global", Severity: lookout.ErrorSeverity}
+	other := &lookout.Comment{File: "main.go", Severity: lookout.InfoSeverity}
+
+	list := []lookout.AnalyzerComments{{
+		Config: lookout.AnalyzerConfig{Name: "mock"},
+		Comments: []*lookout.Comment{
+			internal, example, exampleInfo, exampleNoSeverity, global, other,
+		},
+	}}
+
+	result, err := testSeverityPolicies.apply(list)
+	require.NoError(err)
+	require.Len(result, 1)
+	require.Equal("mock", result[0].Config.Name)
+
+	comments := result[0].Comments
+	require.Len(comments, 5)
+	// kept
+	require.Equal(internal, comments[0])
+	// downgraded, without modifying the original comment
+	require.Equal(lookout.WarningSeverity, comments[1].Severity)
+	require.Equal("examples/foo.go", comments[1].File)
+	require.Equal(lookout.ErrorSeverity, example.Severity)
+	// the info comment is dropped, the rest are not changed
+	require.Equal(exampleNoSeverity, comments[2])
+	require.Equal(global, comments[3])
+	require.Equal(other, comments[4])
+}
+
+func TestSeverityPoliciesApplyBadSeverity(t *testing.T) {
+	require := require.New(t)
+
+	ps := SeverityPolicies{{Paths: []string{"examples"}, MaxSeverity: "CRITICAL"}}
+	_, err := ps.apply(mockAnalyzerComments)
+	require.EqualError(err, "unknown severity: CRITICAL")
+}
+
+func TestMatchPathOrParent(t *testing.T) {
+	require := require.New(t)
+
+	require.True(matchPathOrParent("examples", "examples/foo.go"))
+	require.True(matchPathOrParent("examples", "examples/a/b/foo.go"))
+	require.True(matchPathOrParent("*/testdata", "pkg/testdata/foo.go"))
+	require.True(matchPathOrParent("*.pb.go", "foo.pb.go"))
+	require.False(matchPathOrParent("examples", "internal/examples/foo.go"))
+	require.False(matchPathOrParent("examples", "examples.go"))
+}
+
+func TestReviewEvent(t *testing.T) {
+	require := require.New(t)
+
+	list := []lookout.AnalyzerComments{{Comments: []*lookout.Comment{
+		&lookout.Comment{Text: "no severity"},
+		&lookout.Comment{Text: "warning", Severity: lookout.WarningSeverity},
+	}}}
+
+	p := &Poster{}
+	require.Equal(commentEvent, p.reviewEvent(list))
+
+	p = &Poster{conf: ProviderConfig{RequestChangesSeverity: "error"}}
+	require.Equal(commentEvent, p.reviewEvent(list))
+
+	p = &Poster{conf: ProviderConfig{RequestChangesSeverity: "warning"}}
+	require.Equal(requestChangesEvent, p.reviewEvent(list))
+
+	p = &Poster{conf: ProviderConfig{RequestChangesSeverity: "info"}}
+	require.Equal(commentEvent, p.reviewEvent(list[:0]))
+}
+
+func TestNewPosterRequestChangesSeverity(t *testing.T) {
+	require := require.New(t)
+
+	_, err := NewPoster(nil, ProviderConfig{RequestChangesSeverity: "warning"})
+	require.NoError(err)
+
+	_, err = NewPoster(nil, ProviderConfig{RequestChangesSeverity: "bad"})
+	require.EqualError(err, "can't parse request changes severity: unknown severity: bad")
+}
+
+func TestApplyMinSeverity(t *testing.T) {
+	require := require.New(t)
+
+	list := []lookout.AnalyzerComments{{Comments: []*lookout.Comment{
+		&lookout.Comment{Text: "no severity"},
+		&lookout.Comment{Text: "info", Severity: lookout.InfoSeverity},
+		&lookout.Comment{Text: "warning", Severity: lookout.WarningSeverity},
+		&lookout.Comment{Text: "error", Severity: lookout.ErrorSeverity},
+	}}}
+
+	ctx := context.Background()
+	p := &Poster{}
+	require.Equal(list, p.applyMinSeverity(ctx, list))
+
+	p = &Poster{conf: ProviderConfig{MinSeverity: "bad"}}
+	require.Equal(list, p.applyMinSeverity(ctx, list))
+
+	p = &Poster{conf: ProviderConfig{MinSeverity: "WARNING"}}
+	result := p.applyMinSeverity(ctx, list)
+	require.Len(result, 1)
+
+	var texts []string
+	for _, c := range result[0].Comments {
+		texts = append(texts, c.Text)
+	}
+	require.Equal([]string{"no severity", "warning", "error"}, texts)
+	require.Len(list[0].Comments, 4)
+}
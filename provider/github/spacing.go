@@ -0,0 +1,88 @@
+package github
+
+import (
+	"sort"
+
+	"github.com/src-d/lookout"
+)
+
+type spacedComment struct {
+	group   int
+	comment *lookout.Comment
+}
+
+// dropCloseComments drops the line comments within gap lines of another one
+// on the same file, from the same or different analyzers, keeping the one
+// with the highest severity, the first one on ties. Global and file
+// comments are left as is. A gap lower than 1 drops nothing. The given
+// comments are not modified.
+func dropCloseComments(gap int, aCommentsList []lookout.AnalyzerComments) []lookout.AnalyzerComments {
+	if gap < 1 {
+		return aCommentsList
+	}
+
+	byFile := make(map[string][]spacedComment)
+	for i, aComments := range aCommentsList {
+		for _, c := range aComments.Comments {
+			if c.File == "" || c.Line < 1 || c.TargetDescription {
+				continue
+			}
+
+			byFile[c.File] = append(byFile[c.File], spacedComment{i, c})
+		}
+	}
+
+	dropped := make(map[*lookout.Comment]bool)
+	for _, cs := range byFile {
+		if len(cs) < 2 {
+			continue
+		}
+
+		sort.SliceStable(cs, func(i, j int) bool {
+			return cs[i].comment.Severity > cs[j].comment.Severity
+		})
+
+		var kept []int32
+		for _, c := range cs {
+			if isClose(kept, c.comment.Line, gap) {
+				dropped[c.comment] = true
+				continue
+			}
+
+			kept = append(kept, c.comment.Line)
+		}
+	}
+
+	if len(dropped) == 0 {
+		return aCommentsList
+	}
+
+	result := make([]lookout.AnalyzerComments, len(aCommentsList))
+	for i, aComments := range aCommentsList {
+		result[i] = aComments
+		result[i].Comments = nil
+		for _, c := range aComments.Comments {
+			if !dropped[c] {
+				result[i].Comments = append(result[i].Comments, c)
+			}
+		}
+	}
+
+	return result
+}
+
+// isClose returns true if line is less than gap lines away from any of lines
+func isClose(lines []int32, line int32, gap int) bool {
+	for _, l := range lines {
+		d := l - line
+		if d < 0 {
+			d = -d
+		}
+
+		if int(d) < gap {
+			return true
+		}
+	}
+
+	return false
+}
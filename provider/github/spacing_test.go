@@ -0,0 +1,65 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/src-d/lookout"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDropCloseComments(t *testing.T) {
+	require := require.New(t)
+
+	warning := &lookout.Comment{File: "main.go", Line: 10, Text: "warning", Severity: lookout.WarningSeverity}
+	err := &lookout.Comment{File: "main.go", Line: 13, Text: "error", Severity: lookout.ErrorSeverity}
+	far := &lookout.Comment{File: "main.go", Line: 20, Text: "far"}
+	other := &lookout.Comment{File: "other.go", Line: 11, Text: "other file"}
+	file := &lookout.Comment{File: "main.go", Text: "file comment"}
+	global := &lookout.Comment{Text: "global comment"}
+
+	aCommentsList := []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config:   lookout.AnalyzerConfig{Name: "first"},
+			Comments: []*lookout.Comment{warning, far, file, global},
+		},
+		lookout.AnalyzerComments{
+			Config:   lookout.AnalyzerConfig{Name: "second"},
+			Comments: []*lookout.Comment{err, other},
+		}}
+
+	// three lines apart, under a gap of five only the error is kept
+	result := dropCloseComments(5, aCommentsList)
+	require.Len(result, 2)
+	require.Equal([]*lookout.Comment{far, file, global}, result[0].Comments)
+	require.Equal([]*lookout.Comment{err, other}, result[1].Comments)
+
+	// the given comments are not modified
+	require.Len(aCommentsList[0].Comments, 4)
+
+	// with a smaller gap both are kept
+	require.Equal(aCommentsList, dropCloseComments(3, aCommentsList))
+	require.Equal(aCommentsList, dropCloseComments(0, aCommentsList))
+}
+
+func TestDropCloseCommentsSameSeverity(t *testing.T) {
+	require := require.New(t)
+
+	aCommentsList := []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "mock"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "main.go", Line: 7, Text: "first"},
+				&lookout.Comment{File: "main.go", Line: 5, Text: "second"},
+				&lookout.Comment{File: "main.go", Line: 9, Text: "third"},
+			},
+		}}
+
+	// the first one is kept, and the others are dropped with it
+	result := dropCloseComments(3, aCommentsList)
+	require.Len(result[0].Comments, 1)
+	require.Equal("first", result[0].Comments[0].Text)
+
+	// two lines apart are far enough under a gap of two
+	require.Equal(aCommentsList, dropCloseComments(2, aCommentsList))
+}
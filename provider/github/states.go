@@ -0,0 +1,94 @@
+package github
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/store"
+	"github.com/src-d/lookout/util/ctxlog"
+)
+
+// commentStateID returns the ExternalID of the state of a comment. It
+// identifies the finding as the anchors do, by its file, the hash of the
+// content of its line and its rule, or its text if it has no rule, so it's
+// kept while the line moves from an analysis to the next. The line number
+// is used instead of the hash for the comments out of the diff.
+func commentStateID(dl *diffLines, c *lookout.Comment) string {
+	finding := c.RuleID
+	if finding == "" {
+		finding = c.Text
+	}
+
+	line := strconv.Itoa(int(c.Line))
+	if dl != nil && c.File != "" && c.Line > 0 {
+		if content, err := dl.LineContent(c.File, int(c.Line)); err == nil {
+			line = lineHash(content)
+		}
+	}
+
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s:%s:%s", c.File, line, finding)))
+	return hex.EncodeToString(sum[:])
+}
+
+// recordStates updates the states of the findings of the pull request: the
+// ones of the analysis are open, and the ones still open from previous
+// analyses are resolved, or outdated if their file is not in the diff
+// anymore. The states follow the analyses only, the resolution of the review
+// threads on GitHub is not synced. It does nothing if there is no
+// CommentStateOperator. The comments are already posted, so errors are only
+// logged.
+func (p *Poster) recordStates(
+	ctx context.Context,
+	e *lookout.ReviewEvent,
+	dl *diffLines,
+	aCommentsList []lookout.AnalyzerComments,
+) {
+	if p.states == nil {
+		return
+	}
+
+	open, err := p.states.OpenFindings(ctx, e)
+	if err != nil {
+		ctxlog.Get(ctx).Errorf(err, "can't get the open findings of the pull request")
+		return
+	}
+
+	found := make(map[string]bool)
+	for _, aComments := range aCommentsList {
+		for _, c := range aComments.Comments {
+			id := commentStateID(dl, c)
+			found[id] = true
+
+			err := p.states.UpsertState(ctx, e, &store.CommentState{
+				ExternalID: id,
+				Analyzer:   aComments.Config.Name,
+				Comment:    *c,
+				Resolution: store.CommentResolutionOpen,
+			})
+			if err != nil {
+				ctxlog.Get(ctx).Errorf(err, "can't save the state of the finding")
+				return
+			}
+		}
+	}
+
+	for _, s := range open {
+		if found[s.ExternalID] {
+			continue
+		}
+
+		s.Resolution = store.CommentResolutionResolved
+		if _, err := dl.filePatch(s.Comment.File); ErrFileNotFound.Is(err) {
+			s.Resolution = store.CommentResolutionOutdated
+		}
+
+		if err := p.states.UpsertState(ctx, e, s); err != nil {
+			ctxlog.Get(ctx).Errorf(err, "can't save the state of the finding")
+			return
+		}
+	}
+}
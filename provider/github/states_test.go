@@ -0,0 +1,45 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/src-d/lookout"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommentStateID(t *testing.T) {
+	require := require.New(t)
+
+	patch := `@@ -1,2 +1,4 @@
++foo()
+ bar()
++foo()
+ baz()`
+	dl := newDiffLines(&github.CommitsComparison{
+		Files: []github.CommitFile{{
+			Filename: strptr("main.go"),
+			Patch:    strptr(patch),
+		}}})
+
+	id := commentStateID(dl, &lookout.Comment{File: "main.go", Line: 1, Text: "a", RuleID: "R1"})
+
+	// the finding is the same on another line with the same content, and
+	// with another text of the same rule
+	require.Equal(id, commentStateID(dl, &lookout.Comment{File: "main.go", Line: 3, Text: "a", RuleID: "R1"}))
+	require.Equal(id, commentStateID(dl, &lookout.Comment{File: "main.go", Line: 1, Text: "b", RuleID: "R1"}))
+
+	require.NotEqual(id, commentStateID(dl, &lookout.Comment{File: "main.go", Line: 1, Text: "a", RuleID: "R2"}))
+	require.NotEqual(id, commentStateID(dl, &lookout.Comment{File: "main.go", Line: 2, Text: "a", RuleID: "R1"}))
+
+	// without rule, the text identifies the finding
+	noRule := commentStateID(dl, &lookout.Comment{File: "main.go", Line: 1, Text: "a"})
+	require.Equal(noRule, commentStateID(dl, &lookout.Comment{File: "main.go", Line: 3, Text: "a"}))
+	require.NotEqual(noRule, commentStateID(dl, &lookout.Comment{File: "main.go", Line: 1, Text: "b"}))
+
+	// out of the diff, the line number identifies it
+	out := commentStateID(dl, &lookout.Comment{File: "other.go", Line: 10, Text: "a"})
+	require.Equal(out, commentStateID(nil, &lookout.Comment{File: "other.go", Line: 10, Text: "a"}))
+	require.NotEqual(out, commentStateID(dl, &lookout.Comment{File: "other.go", Line: 11, Text: "a"}))
+}
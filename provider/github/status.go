@@ -0,0 +1,246 @@
+package github
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/src-d/lookout"
+)
+
+// postedResult is the result of posting the comments of a commit, used to
+// set its final analysis status
+type postedResult struct {
+	// blocking is true if the comments make the analysis status fail
+	blocking bool
+	// comments are the posted comments
+	comments []lookout.AnalyzerComments
+	// analyzers are the statuses of each analyzer, if
+	// ProviderConfig.AnalyzerStatuses is enabled
+	analyzers []analyzerStatus
+	// description replaces the one of the final status if it succeeds, it
+	// can be empty
+	description string
+}
+
+// analyzerStatus is the final status of the analysis of a single analyzer
+type analyzerStatus struct {
+	name   string
+	status lookout.AnalysisStatus
+}
+
+// analyzerStatuses returns the status of each analyzer in analyzed, the
+// comments received from the analyzers, given the comments to post: error if
+// the analysis failed, failure if the comments to post are blocking, and
+// success otherwise. It returns nil if AnalyzerStatuses is disabled.
+func (p *Poster) analyzerStatuses(
+	dl *diffLines,
+	analyzed, posted []lookout.AnalyzerComments,
+) []analyzerStatus {
+	if !p.conf.AnalyzerStatuses {
+		return nil
+	}
+
+	result := make([]analyzerStatus, 0, len(analyzed))
+	for _, aComments := range analyzed {
+		status := lookout.SuccessAnalysisStatus
+		if aComments.Error != "" {
+			status = lookout.ErrorAnalysisStatus
+		} else {
+			var own []lookout.AnalyzerComments
+			for _, pComments := range posted {
+				if pComments.Config.Name == aComments.Config.Name {
+					own = append(own, pComments)
+				}
+			}
+
+			if hasBlockingComments(dl, own, p.conf.StatusAddedLinesOnly) {
+				status = lookout.FailureAnalysisStatus
+			}
+		}
+
+		result = append(result, analyzerStatus{name: aComments.Config.Name, status: status})
+	}
+
+	return result
+}
+
+// postedCommits records the results of the commits whose comments were
+// posted, between posting them and setting the final status
+type postedCommits struct {
+	mu      sync.Mutex
+	commits map[string]postedResult
+}
+
+func (c *postedCommits) set(hash string, r postedResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.commits == nil {
+		c.commits = make(map[string]postedResult)
+	}
+
+	c.commits[hash] = r
+}
+
+// take returns the result of posting the comments of the commit, and forgets
+// it. ok is false if no comments were posted for the commit.
+func (c *postedCommits) take(hash string) (r postedResult, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r, ok = c.commits[hash]
+	delete(c.commits, hash)
+	return r, ok
+}
+
+// prHeads tracks the newest head commit of each pull request, so statuses of
+// superseded commits are not posted
+type prHeads struct {
+	mu    sync.Mutex
+	heads map[string]*prHead
+}
+
+type prHead struct {
+	hash      string
+	updatedAt time.Time
+	// final is true once a final status was posted for the commit
+	final bool
+}
+
+// target returns the commit the status for the given pull request commit
+// must be posted on, or false if it must not be posted. A commit is
+// superseded if the pull request was already seen with a different head and a
+// later update time. The statuses of superseded commits are dropped, or
+// posted on the newest head if copyForward is true and the newest head
+// doesn't have a final status of its own yet.
+func (h *prHeads) target(
+	pr, hash string,
+	updatedAt time.Time,
+	final, copyForward bool,
+) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.heads == nil {
+		h.heads = make(map[string]*prHead)
+	}
+
+	cur, ok := h.heads[pr]
+	if ok && cur.hash != hash && !updatedAt.IsZero() && updatedAt.Before(cur.updatedAt) {
+		if !copyForward || cur.final {
+			return "", false
+		}
+
+		return cur.hash, true
+	}
+
+	if !ok || cur.hash != hash {
+		cur = &prHead{hash: hash}
+		h.heads[pr] = cur
+	}
+
+	if updatedAt.After(cur.updatedAt) {
+		cur.updatedAt = updatedAt
+	}
+
+	if final {
+		cur.final = true
+	}
+
+	return hash, true
+}
+
+// hasBlockingComments returns true if any of the comments has ErrorSeverity.
+// If addedLinesOnly is true, only the comments on lines added in the diff are
+// taken into account, using the same detection as the strict line conversion.
+func hasBlockingComments(
+	dl *diffLines,
+	aCommentsList []lookout.AnalyzerComments,
+	addedLinesOnly bool,
+) bool {
+	for _, aComments := range aCommentsList {
+		for _, c := range aComments.Comments {
+			if c.Severity < lookout.ErrorSeverity {
+				continue
+			}
+
+			if !addedLinesOnly {
+				return true
+			}
+
+			if c.File == "" || c.Line <= 0 {
+				continue
+			}
+
+			if _, err := dl.ConvertLine(c.File, int(c.Line), true); err == nil {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// countComments returns the number of comments in aCommentsList
+func countComments(aCommentsList []lookout.AnalyzerComments) int {
+	var n int
+	for _, aComments := range aCommentsList {
+		n += len(aComments.Comments)
+	}
+
+	return n
+}
+
+// durationDescription returns the description of a final status with the
+// duration of the analysis, rounded to tenths of a second, and the number of
+// issues found, used if ShowDurationInStatus is enabled
+func durationDescription(d time.Duration, issues int) string {
+	noun := "issues"
+	if issues == 1 {
+		noun = "issue"
+	}
+
+	return fmt.Sprintf("Analyzed in %s, %d %s found",
+		d.Round(100*time.Millisecond), issues, noun)
+}
+
+// GitHub rejects the statuses with longer contexts
+var maxStatusContextLength = 255
+
+// length of the hash suffix of the truncated contexts
+const statusContextHashLength = 8
+
+// statusContext returns the context of the statuses for the given analyzer,
+// "<prefix>/<analyzer>", or only the prefix if analyzer is empty. The
+// default prefix is "lookout". Contexts over maxStatusContextLength are
+// truncated and end with a hash of the full context, so they are still
+// unique and the same analyzer always gets the same context.
+func statusContext(prefix, analyzer string) string {
+	if prefix == "" {
+		prefix = defaultStatusContext
+	}
+
+	context := prefix
+	if analyzer != "" {
+		context = prefix + "/" + analyzer
+	}
+
+	if len(context) <= maxStatusContextLength {
+		return context
+	}
+
+	sum := sha1.Sum([]byte(context))
+	hash := hex.EncodeToString(sum[:])[:statusContextHashLength]
+
+	cut := maxStatusContextLength - len(hash) - 1
+	// don't split multi-byte characters
+	for cut > 0 && !utf8.RuneStart(context[cut]) {
+		cut--
+	}
+
+	return context[:cut] + "~" + hash
+}
@@ -0,0 +1,93 @@
+package github
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusContext(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal("lookout", statusContext("", ""))
+	require.Equal("lookout/style", statusContext("", "style"))
+	require.Equal("ci/lookout", statusContext("ci/lookout", ""))
+	require.Equal("ci/lookout/style", statusContext("ci/lookout", "style"))
+}
+
+func TestStatusContextTruncated(t *testing.T) {
+	require := require.New(t)
+
+	long := strings.Repeat("a", maxStatusContextLength)
+	context := statusContext("lookout", long)
+	require.Len(context, maxStatusContextLength)
+	require.True(strings.HasPrefix(context, "lookout/aaa"))
+
+	// deterministic
+	require.Equal(context, statusContext("lookout", long))
+
+	// analyzers with the same truncated name don't collide
+	other := statusContext("lookout", long+"b")
+	require.Len(other, maxStatusContextLength)
+	require.NotEqual(context, other)
+
+	// exactly at the limit it is not truncated
+	exact := strings.Repeat("a", maxStatusContextLength-len("lookout/"))
+	require.Equal("lookout/"+exact, statusContext("lookout", exact))
+}
+
+func TestStatusContextTruncatedMultiByte(t *testing.T) {
+	require := require.New(t)
+
+	context := statusContext("lookout", strings.Repeat("ñ", maxStatusContextLength))
+	require.True(len(context) <= maxStatusContextLength)
+	require.True(utf8.ValidString(context))
+}
+
+func TestDurationDescription(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal("Analyzed in 4.2s, 3 issues found",
+		durationDescription(4213*time.Millisecond, 3))
+	require.Equal("Analyzed in 0s, 1 issue found",
+		durationDescription(20*time.Millisecond, 1))
+	require.Equal("Analyzed in 1m2s, 0 issues found",
+		durationDescription(62*time.Second, 0))
+}
+
+func TestPRHeadsTarget(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Now()
+	var h prHeads
+
+	sha, ok := h.target("foo/bar#1", "a", now, false, false)
+	require.True(ok)
+	require.Equal("a", sha)
+
+	// a newer head replaces it
+	sha, ok = h.target("foo/bar#1", "b", now.Add(time.Second), false, false)
+	require.True(ok)
+	require.Equal("b", sha)
+
+	// the old head is superseded
+	_, ok = h.target("foo/bar#1", "a", now, true, false)
+	require.False(ok)
+
+	sha, ok = h.target("foo/bar#1", "a", now, true, true)
+	require.True(ok)
+	require.Equal("b", sha)
+
+	// other pull requests are independent
+	sha, ok = h.target("foo/bar#2", "a", now, false, false)
+	require.True(ok)
+	require.Equal("a", sha)
+
+	// without update time the event is handled as the newest
+	sha, ok = h.target("foo/bar#1", "c", time.Time{}, false, false)
+	require.True(ok)
+	require.Equal("c", sha)
+}
@@ -0,0 +1,179 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/util/ctxlog"
+
+	"github.com/google/go-github/github"
+)
+
+// summaryMarker is the hidden marker of the summary comment, used to find it
+// in the next analyses
+const summaryMarker = "<!-- lookout-summary -->"
+
+// summarySeverities are the rows of the summary, by decreasing severity
+var summarySeverities = []struct {
+	severity lookout.Severity
+	name     string
+}{
+	{lookout.ErrorSeverity, "Error"},
+	{lookout.WarningSeverity, "Warning"},
+	{lookout.InfoSeverity, "Info"},
+	{lookout.UnspecifiedSeverity, "Unspecified"},
+}
+
+// summaryBody returns the body of the summary comment, with the number of
+// comments of each severity and a link to the inline comments of the pull
+// request, if filesURL is not empty
+func summaryBody(aCommentsList []lookout.AnalyzerComments, filesURL string) string {
+	counts := make(map[lookout.Severity]int)
+	total := 0
+	for _, aComments := range aCommentsList {
+		for _, c := range aComments.Comments {
+			counts[c.Severity]++
+			total++
+		}
+	}
+
+	lines := []string{
+		summaryMarker,
+		"**lookout summary**",
+		"",
+		"| Severity | Findings |",
+		"|---|---|",
+	}
+	for _, s := range summarySeverities {
+		lines = append(lines, fmt.Sprintf("| %s | %d |", s.name, counts[s.severity]))
+	}
+	lines = append(lines, fmt.Sprintf("| **Total** | **%d** |", total))
+
+	if filesURL != "" {
+		lines = append(lines, "", fmt.Sprintf("[See the inline comments](%s)", filesURL))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// prFilesURL returns the URL of the changes of the pull request, where the
+// inline comments are shown, or an empty string if the repository URL of the
+// event is not an HTTP one
+func prFilesURL(e *lookout.ReviewEvent, pr int) string {
+	url := e.Base.InternalRepositoryURL
+	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		return ""
+	}
+
+	return fmt.Sprintf("%s/pull/%d/files", strings.TrimSuffix(url, ".git"), pr)
+}
+
+// postSummary keeps the summary comment of the pull request up to date, if
+// SummaryComment is enabled. Errors are only logged, the review is already
+// posted.
+func (p *Poster) postSummary(
+	ctx context.Context,
+	client *Client,
+	budget *retryBudget,
+	owner, repo string,
+	pr int,
+	e *lookout.ReviewEvent,
+	aCommentsList []lookout.AnalyzerComments,
+) {
+	if !p.conf.SummaryComment {
+		return
+	}
+
+	err := p.updateSummary(ctx, client, budget, owner, repo, pr, e, aCommentsList)
+	if err != nil {
+		ctxlog.Get(ctx).Errorf(err, "can't update the summary comment")
+	}
+}
+
+// updateSummary creates the summary comment of the pull request, or edits
+// the one posted by a previous analysis, found by its marker.
+func (p *Poster) updateSummary(
+	ctx context.Context,
+	client *Client,
+	budget *retryBudget,
+	owner, repo string,
+	pr int,
+	e *lookout.ReviewEvent,
+	aCommentsList []lookout.AnalyzerComments,
+) error {
+	var existing *github.IssueComment
+	err := budget.do(ctx, "list comments", func() error {
+		var err error
+		existing, err = p.findMarkedComment(ctx, client, owner, repo, pr, summaryMarker)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	body := summaryBody(aCommentsList, prFilesURL(e, pr))
+	if existing != nil && existing.GetBody() == body {
+		return nil
+	}
+
+	comment := &github.IssueComment{Body: &body}
+	// creating the comment is not idempotent
+	retry := budget.do
+	if existing == nil {
+		retry = budget.doCreate
+	}
+
+	return retry(ctx, "update summary", func() error {
+		ctx, cancel := withTimeout(ctx, p.postTimeout)
+		defer cancel()
+
+		var resp *github.Response
+		var err error
+		if existing == nil {
+			_, resp, err = client.Issues.CreateComment(ctx, owner, repo, pr, comment)
+			if err == nil && resp.StatusCode == http.StatusCreated {
+				return nil
+			}
+		} else {
+			_, resp, err = client.Issues.EditComment(ctx, owner, repo, int(existing.GetID()), comment)
+		}
+
+		return p.handleAPIError(resp, err)
+	})
+}
+
+// findMarkedComment returns the comment of the issue or pull request whose
+// body starts with the given marker, or nil if there is none
+func (p *Poster) findMarkedComment(
+	ctx context.Context,
+	client *Client,
+	owner, repo string,
+	number int,
+	marker string,
+) (*github.IssueComment, error) {
+	opts := &github.IssueListCommentsOptions{
+		ListOptions: github.ListOptions{PerPage: p.perPage()},
+	}
+
+	for {
+		comments, resp, err := client.Issues.ListComments(ctx, owner, repo, number, opts)
+		if err != nil {
+			return nil, p.handleAPIError(resp, err)
+		}
+
+		for _, c := range comments {
+			if strings.HasPrefix(c.GetBody(), marker) {
+				return c, nil
+			}
+		}
+
+		if resp.NextPage == 0 {
+			return nil, nil
+		}
+
+		opts.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,142 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/src-d/lookout"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+var summaryComments = []lookout.AnalyzerComments{
+	lookout.AnalyzerComments{
+		Config: lookout.AnalyzerConfig{Name: "mock"},
+		Comments: []*lookout.Comment{
+			&lookout.Comment{File: "main.go", Line: 3, Text: "a", Severity: lookout.ErrorSeverity},
+			&lookout.Comment{File: "main.go", Line: 4, Text: "b", Severity: lookout.WarningSeverity},
+			&lookout.Comment{File: "main.go", Line: 5, Text: "c", Severity: lookout.WarningSeverity},
+			&lookout.Comment{Text: "global"},
+		},
+	}}
+
+func TestSummaryBody(t *testing.T) {
+	require := require.New(t)
+
+	expected := summaryMarker + `
+**lookout summary**
+
+| Severity | Findings |
+|---|---|
+| Error | 1 |
+| Warning | 2 |
+| Info | 0 |
+| Unspecified | 1 |
+| **Total** | **4** |
+
+[See the inline comments](https://github.com/foo/bar/pull/42/files)`
+	require.Equal(expected, summaryBody(summaryComments, "https://github.com/foo/bar/pull/42/files"))
+
+	require.NotContains(summaryBody(summaryComments, ""), "See the inline comments")
+}
+
+func TestPRFilesURL(t *testing.T) {
+	require := require.New(t)
+
+	e := &lookout.ReviewEvent{}
+	e.Base.InternalRepositoryURL = "https://github.com/foo/bar.git"
+	require.Equal("https://github.com/foo/bar/pull/42/files", prFilesURL(e, 42))
+
+	e.Base.InternalRepositoryURL = "git@github.com:foo/bar.git"
+	require.Equal("", prFilesURL(e, 42))
+}
+
+func (s *PosterTestSuite) TestPostSummaryComment() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	var posted []*github.IssueComment
+	s.mux.HandleFunc("/repos/foo/bar/issues/42/comments", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			s.Equal("25", r.URL.Query().Get("per_page"))
+
+			comments := []*github.IssueComment{&github.IssueComment{
+				ID:   int64ptr(6),
+				Body: strptr("Unrelated comment"),
+			}}
+			comments = append(comments, posted...)
+			json.NewEncoder(w).Encode(comments)
+		case "POST":
+			var c github.IssueComment
+			s.NoError(json.NewDecoder(r.Body).Decode(&c))
+			c.ID = int64ptr(7)
+			posted = append(posted, &c)
+
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(c)
+		default:
+			s.Failf("unexpected request", "%s %s", r.Method, r.URL)
+		}
+	})
+
+	var edited []string
+	s.mux.HandleFunc("/repos/foo/bar/issues/comments/7", func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("PATCH", r.Method)
+
+		var c github.IssueComment
+		s.NoError(json.NewDecoder(r.Body).Decode(&c))
+		edited = append(edited, c.GetBody())
+
+		json.NewEncoder(w).Encode(c)
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{SummaryComment: true, PerPage: 25}}
+
+	// the first analysis creates the summary
+	err := p.Post(context.Background(), mockEvent, summaryComments)
+	s.NoError(err)
+	s.Require().Len(posted, 1)
+	s.Equal(summaryBody(summaryComments, "https://github.com/foo/bar/pull/42/files"),
+		posted[0].GetBody())
+	s.Len(edited, 0)
+
+	// the next one edits it
+	compareCalled = false
+	fixed := []lookout.AnalyzerComments{lookout.AnalyzerComments{
+		Config:   summaryComments[0].Config,
+		Comments: summaryComments[0].Comments[1:],
+	}}
+	err = p.Post(context.Background(), mockEvent, fixed)
+	s.NoError(err)
+	s.Len(posted, 1)
+	s.Require().Len(edited, 1)
+	s.Contains(edited[0], "| Error | 0 |")
+	s.Contains(edited[0], "| **Total** | **3** |")
+}
+
+func (s *PosterTestSuite) TestPostSummaryCommentDisabled() {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	s.mux.HandleFunc("/repos/foo/bar/issues/42/comments", func(w http.ResponseWriter, r *http.Request) {
+		s.Failf("unexpected request", "%s %s", r.Method, r.URL)
+	})
+
+	p := &Poster{pool: s.pool}
+	err := p.Post(context.Background(), mockEvent, summaryComments)
+	s.NoError(err)
+}
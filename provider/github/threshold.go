@@ -0,0 +1,77 @@
+package github
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/src-d/lookout"
+)
+
+// applyRuleThresholds removes the comments of the rules with a threshold in
+// ProviderConfig.RuleThresholds that fire fewer times than it in the event,
+// counting the comments of all the analyzers. If NoteSuppressedRules is
+// enabled, a global comment with the number of comments removed for each
+// rule is added to the analyzers that produced them. The given comments are
+// not modified.
+func (p *Poster) applyRuleThresholds(
+	aCommentsList []lookout.AnalyzerComments,
+) []lookout.AnalyzerComments {
+	if len(p.conf.RuleThresholds) == 0 {
+		return aCommentsList
+	}
+
+	counts := make(map[string]int)
+	for _, aComments := range aCommentsList {
+		for _, c := range aComments.Comments {
+			if _, ok := p.conf.RuleThresholds[c.RuleID]; ok && c.RuleID != "" {
+				counts[c.RuleID]++
+			}
+		}
+	}
+
+	suppressed := func(rule string) bool {
+		min, ok := p.conf.RuleThresholds[rule]
+		return ok && rule != "" && counts[rule] < min
+	}
+
+	result := make([]lookout.AnalyzerComments, len(aCommentsList))
+	for i, aComments := range aCommentsList {
+		result[i] = aComments
+		result[i].Comments = nil
+
+		removed := make(map[string]int)
+		for _, c := range aComments.Comments {
+			if suppressed(c.RuleID) {
+				removed[c.RuleID]++
+				continue
+			}
+
+			result[i].Comments = append(result[i].Comments, c)
+		}
+
+		if p.conf.NoteSuppressedRules && len(removed) > 0 {
+			result[i].Comments = append(result[i].Comments, &lookout.Comment{
+				Text: suppressedRulesNote(removed, p.conf.RuleThresholds),
+			})
+		}
+	}
+
+	return result
+}
+
+// suppressedRulesNote returns the text listing the number of comments removed
+// for each rule, sorted by rule
+func suppressedRulesNote(removed map[string]int, thresholds map[string]int) string {
+	rules := make([]string, 0, len(removed))
+	for rule := range removed {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+
+	text := "Findings not posted, under the threshold of their rule:"
+	for _, rule := range rules {
+		text += fmt.Sprintf("\n- %s: %d (threshold %d)", rule, removed[rule], thresholds[rule])
+	}
+
+	return text
+}
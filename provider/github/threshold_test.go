@@ -0,0 +1,75 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/src-d/lookout"
+
+	"github.com/stretchr/testify/require"
+)
+
+func thresholdComments() []lookout.AnalyzerComments {
+	return []lookout.AnalyzerComments{
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "lint"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "a.go", Line: 1, Text: "a", RuleID: "noisy"},
+				&lookout.Comment{File: "a.go", Line: 2, Text: "b", RuleID: "systemic"},
+				&lookout.Comment{File: "a.go", Line: 3, Text: "c", RuleID: "other"},
+			},
+		},
+		lookout.AnalyzerComments{
+			Config: lookout.AnalyzerConfig{Name: "style"},
+			Comments: []*lookout.Comment{
+				&lookout.Comment{File: "b.go", Line: 1, Text: "d", RuleID: "systemic"},
+				&lookout.Comment{File: "b.go", Line: 2, Text: "e", RuleID: "systemic"},
+				&lookout.Comment{Text: "global"},
+			},
+		},
+	}
+}
+
+func TestApplyRuleThresholds(t *testing.T) {
+	require := require.New(t)
+
+	list := thresholdComments()
+	p := &Poster{conf: ProviderConfig{
+		RuleThresholds: map[string]int{"noisy": 2, "systemic": 3},
+	}}
+
+	result := p.applyRuleThresholds(list)
+	require.Equal([]*lookout.Comment{list[0].Comments[1], list[0].Comments[2]},
+		result[0].Comments)
+	require.Equal(list[1].Comments, result[1].Comments)
+
+	// the given comments are not modified
+	require.Equal(thresholdComments(), list)
+}
+
+func TestApplyRuleThresholdsNote(t *testing.T) {
+	require := require.New(t)
+
+	list := thresholdComments()
+	p := &Poster{conf: ProviderConfig{
+		RuleThresholds:      map[string]int{"noisy": 2, "systemic": 4},
+		NoteSuppressedRules: true,
+	}}
+
+	result := p.applyRuleThresholds(list)
+	require.Equal([]*lookout.Comment{
+		list[0].Comments[2],
+		&lookout.Comment{Text: "Findings not posted, under the threshold of their rule:\n" +
+			"- noisy: 1 (threshold 2)\n" +
+			"- systemic: 1 (threshold 4)"},
+	}, result[0].Comments)
+	require.Equal([]*lookout.Comment{
+		list[1].Comments[2],
+		&lookout.Comment{Text: "Findings not posted, under the threshold of their rule:\n" +
+			"- systemic: 2 (threshold 4)"},
+	}, result[1].Comments)
+}
+
+func TestApplyRuleThresholdsDisabled(t *testing.T) {
+	list := thresholdComments()
+	require.Equal(t, list, (&Poster{}).applyRuleThresholds(list))
+}
@@ -0,0 +1,274 @@
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bradleyfalzon/ghinstallation"
+
+	log "gopkg.in/src-d/go-log.v1"
+)
+
+// tokenRefreshMargin is how long before expiring the installation tokens are
+// refreshed by Installations.StartTokenRefresh
+var tokenRefreshMargin = 5 * time.Minute
+
+// installationTransport authenticates the requests with the installation
+// token, requesting it if needed.
+// *appTransport fulfills this interface.
+type installationTransport interface {
+	http.RoundTripper
+	tokenSource
+	// expiresAt returns when the current token expires, or the zero time if
+	// there is no token yet
+	expiresAt() time.Time
+}
+
+// appTransport is a ghinstallation.Transport recording the expiry of its
+// installation tokens, which it doesn't expose
+type appTransport struct {
+	*ghinstallation.Transport
+	expiry *tokenExpiryTransport
+}
+
+var _ installationTransport = &appTransport{}
+
+// newAppTransport returns the transport of the installation of the app,
+// with the private key in the given file
+func newAppTransport(appID, installationID int, privateKey string) (*appTransport, error) {
+	expiry := &tokenExpiryTransport{RoundTripper: http.DefaultTransport}
+	itr, err := ghinstallation.NewKeyFromFile(expiry, appID, installationID, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &appTransport{Transport: itr, expiry: expiry}, nil
+}
+
+func (t *appTransport) expiresAt() time.Time {
+	return t.expiry.get()
+}
+
+// tokenExpiryTransport is an http.RoundTripper recording the expiry of the
+// installation tokens requested through it
+type tokenExpiryTransport struct {
+	http.RoundTripper
+
+	mu        sync.Mutex
+	expiresAt time.Time
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *tokenExpiryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil || req.Method != "POST" ||
+		!strings.HasSuffix(req.URL.Path, "/access_tokens") ||
+		resp.StatusCode/100 != 2 {
+		return resp, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var token struct {
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.Unmarshal(body, &token); err == nil {
+		t.mu.Lock()
+		t.expiresAt = token.ExpiresAt
+		t.mu.Unlock()
+	}
+
+	return resp, nil
+}
+
+func (t *tokenExpiryTransport) get() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.expiresAt
+}
+
+// refreshingTransport is an installationTransport whose token can be
+// refreshed before it expires, so the requests don't wait for it to be
+// renewed. Each refresh creates a new transport, which requests a new token.
+type refreshingTransport struct {
+	// newTransport returns a new transport of the installation, without
+	// token
+	newTransport func() (installationTransport, error)
+	// now returns the current time, it's time.Now except in the tests
+	now func() time.Time
+
+	mu      sync.Mutex
+	current installationTransport
+}
+
+var _ installationTransport = &refreshingTransport{}
+
+func newRefreshingTransport(newTransport func() (installationTransport, error)) *refreshingTransport {
+	return &refreshingTransport{newTransport: newTransport, now: time.Now}
+}
+
+// transport returns the current transport, creating it if there is none
+func (t *refreshingTransport) transport() (installationTransport, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.current == nil {
+		tr, err := t.newTransport()
+		if err != nil {
+			return nil, err
+		}
+
+		t.current = tr
+	}
+
+	return t.current, nil
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *refreshingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tr, err := t.transport()
+	if err != nil {
+		return nil, err
+	}
+
+	return tr.RoundTrip(req)
+}
+
+// Token implements the tokenSource interface.
+func (t *refreshingTransport) Token() (string, error) {
+	tr, err := t.transport()
+	if err != nil {
+		return "", err
+	}
+
+	return tr.Token()
+}
+
+func (t *refreshingTransport) expiresAt() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.current == nil {
+		return time.Time{}
+	}
+
+	return t.current.expiresAt()
+}
+
+// expiresWithin returns true if the token expires within d, or there is no
+// token yet
+func (t *refreshingTransport) expiresWithin(d time.Duration) bool {
+	return !t.now().Add(d).Before(t.expiresAt())
+}
+
+// refresh requests a new token with a new transport, replacing the current
+// one once it's obtained. If it fails the current transport is kept.
+func (t *refreshingTransport) refresh() error {
+	tr, err := t.newTransport()
+	if err != nil {
+		return err
+	}
+
+	// requested before taking the lock, so the requests are not blocked
+	if _, err := tr.Token(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.current = tr
+
+	return nil
+}
+
+// StartTokenRefresh starts refreshing in the background, every interval, the
+// tokens of the installations expiring within tokenRefreshMargin, until
+// StopTokenRefresh is called. Only the installation clients created while
+// InstallationsConfig.RefreshTokens is enabled are refreshed. Failed
+// refreshes are logged and retried on the next interval, keeping the
+// installation.
+func (t *Installations) StartTokenRefresh(interval time.Duration) {
+	t.refreshMutex.Lock()
+	defer t.refreshMutex.Unlock()
+
+	if t.stopRefresh != nil {
+		return
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	t.stopRefresh = func() {
+		close(stop)
+		<-done
+	}
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				t.refreshTokens()
+			}
+		}
+	}()
+}
+
+// StopTokenRefresh stops refreshing the tokens of the installations, waiting
+// for the refresh in progress, if any
+func (t *Installations) StopTokenRefresh() {
+	t.refreshMutex.Lock()
+	defer t.refreshMutex.Unlock()
+
+	if t.stopRefresh == nil {
+		return
+	}
+
+	t.stopRefresh()
+	t.stopRefresh = nil
+}
+
+// refreshTokens refreshes the tokens of the installations expiring within
+// tokenRefreshMargin
+func (t *Installations) refreshTokens() {
+	t.clientsMutex.RLock()
+	transports := make(map[int64]*refreshingTransport, len(t.clients))
+	for id, c := range t.clients {
+		if tr, ok := c.tokens.(*refreshingTransport); ok {
+			transports[id] = tr
+		}
+	}
+	t.clientsMutex.RUnlock()
+
+	for id, tr := range transports {
+		if !tr.expiresWithin(tokenRefreshMargin) {
+			continue
+		}
+
+		logger := log.With(log.Fields{"installation": id})
+		if err := tr.refresh(); err != nil {
+			logger.Errorf(err, "can't refresh the installation token, retrying later")
+			continue
+		}
+
+		logger.Debugf("installation token refreshed")
+	}
+}
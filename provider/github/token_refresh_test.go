@@ -0,0 +1,209 @@
+package github
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// transportMock is an installationTransport with a fixed token
+type transportMock struct {
+	token  string
+	expiry time.Time
+}
+
+func (t *transportMock) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (t *transportMock) Token() (string, error) {
+	return t.token, nil
+}
+
+func (t *transportMock) expiresAt() time.Time {
+	return t.expiry
+}
+
+// tokenLifetime is the lifetime of the tokens of the tests
+const tokenLifetime = time.Hour
+
+func TestRefreshingTransport(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Now()
+	var created int
+	var fail bool
+	tr := newRefreshingTransport(func() (installationTransport, error) {
+		if fail {
+			return nil, fmt.Errorf("refresh error")
+		}
+
+		created++
+		return &transportMock{
+			token:  fmt.Sprintf("token%d", created),
+			expiry: now.Add(tokenLifetime),
+		}, nil
+	})
+	tr.now = func() time.Time { return now }
+
+	require.True(tr.expiresWithin(tokenRefreshMargin))
+	token, err := tr.Token()
+	require.NoError(err)
+	require.Equal("token1", token)
+	require.False(tr.expiresWithin(tokenRefreshMargin))
+
+	// nearing the expiry
+	now = now.Add(tokenLifetime - tokenRefreshMargin + time.Second)
+	require.True(tr.expiresWithin(tokenRefreshMargin))
+
+	// a failed refresh keeps the current token
+	fail = true
+	require.EqualError(tr.refresh(), "refresh error")
+	token, err = tr.Token()
+	require.NoError(err)
+	require.Equal("token1", token)
+
+	fail = false
+	require.NoError(tr.refresh())
+	token, err = tr.Token()
+	require.NoError(err)
+	require.Equal("token2", token)
+	require.False(tr.expiresWithin(tokenRefreshMargin))
+}
+
+func TestInstallationsRefreshTokens(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Now()
+	newClient := func(id int64) (*Client, *int) {
+		created := new(int)
+		tr := newRefreshingTransport(func() (installationTransport, error) {
+			*created++
+			return &transportMock{
+				token:  fmt.Sprintf("token%d", *created),
+				expiry: now.Add(tokenLifetime),
+			}, nil
+		})
+		tr.now = func() time.Time { return now }
+		_, err := tr.Token()
+		require.NoError(err)
+
+		return newInstallationClient(id, tr, tr, nil, ""), created
+	}
+
+	expiring, expiringCreated := newClient(1)
+	now = now.Add(30 * time.Minute)
+	fresh, freshCreated := newClient(2)
+
+	i := &Installations{clients: map[int64]*Client{
+		1: expiring,
+		2: fresh,
+		// clients without refreshing transports are skipped
+		3: newInstallationClient(3, &transportMock{}, &transportMock{}, nil, ""),
+	}}
+
+	// the token of the first installation is nearing its expiry
+	now = now.Add(tokenLifetime - 30*time.Minute - time.Minute)
+	i.refreshTokens()
+	require.Equal(2, *expiringCreated)
+	require.Equal(1, *freshCreated)
+
+	token, err := expiring.tokens.Token()
+	require.NoError(err)
+	require.Equal("token2", token)
+}
+
+func TestInstallationsStartTokenRefresh(t *testing.T) {
+	require := require.New(t)
+
+	refreshed := make(chan struct{}, 10)
+	tr := newRefreshingTransport(func() (installationTransport, error) {
+		refreshed <- struct{}{}
+		return &transportMock{token: "token", expiry: time.Now().Add(tokenLifetime)}, nil
+	})
+
+	// without token, it's requested by the refresh
+	i := &Installations{clients: map[int64]*Client{
+		1: newInstallationClient(1, tr, tr, nil, ""),
+	}}
+
+	i.StartTokenRefresh(time.Millisecond)
+	// starting it again does nothing
+	i.StartTokenRefresh(time.Millisecond)
+
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		require.Fail("the token was not refreshed")
+	}
+
+	i.StopTokenRefresh()
+	i.StopTokenRefresh()
+
+	token, err := tr.Token()
+	require.NoError(err)
+	require.Equal("token", token)
+}
+
+func TestRefreshingTransportTokenExpiry(t *testing.T) {
+	require := require.New(t)
+
+	// the token was obtained long after creating the transport, its expiry
+	// is the one of the token
+	now := time.Now()
+	tr := newRefreshingTransport(func() (installationTransport, error) {
+		return &transportMock{token: "token", expiry: now.Add(10 * time.Minute)}, nil
+	})
+	tr.now = func() time.Time { return now }
+
+	_, err := tr.Token()
+	require.NoError(err)
+	require.False(tr.expiresWithin(tokenRefreshMargin))
+
+	now = now.Add(6 * time.Minute)
+	require.True(tr.expiresWithin(tokenRefreshMargin))
+}
+
+func TestTokenExpiryTransport(t *testing.T) {
+	require := require.New(t)
+
+	expiresAt := time.Date(2019, 1, 1, 10, 0, 0, 0, time.UTC)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/installations/1/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token":"token","expires_at":"%s"}`, expiresAt.Format(time.RFC3339))
+	})
+	mux.HandleFunc("/repos/foo/bar", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"expires_at":"2020-01-01T10:00:00Z"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tr := &tokenExpiryTransport{RoundTripper: http.DefaultTransport}
+	require.True(tr.get().IsZero())
+
+	// other requests are not recorded
+	req, err := http.NewRequest("GET", server.URL+"/repos/foo/bar", nil)
+	require.NoError(err)
+	resp, err := tr.RoundTrip(req)
+	require.NoError(err)
+	resp.Body.Close()
+	require.True(tr.get().IsZero())
+
+	req, err = http.NewRequest("POST", server.URL+"/installations/1/access_tokens", nil)
+	require.NoError(err)
+	resp, err = tr.RoundTrip(req)
+	require.NoError(err)
+	defer resp.Body.Close()
+	require.True(expiresAt.Equal(tr.get()))
+
+	// the body is still readable
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Contains(string(body), `"token":"token"`)
+}
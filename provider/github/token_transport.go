@@ -86,3 +86,30 @@ func (t *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 }
 
 var _ http.RoundTripper = &roundTripper{}
+
+// userTokenRoundTripper authenticates the requests with a user-to-server
+// OAuth token of a GitHub App, acting on behalf of the user
+type userTokenRoundTripper struct {
+	Base  http.RoundTripper
+	Token string
+}
+
+func (t *userTokenRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// the request must not be modified, see http.RoundTripper
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set("Authorization", "token "+t.Token)
+
+	rt := t.Base
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	return rt.RoundTrip(r)
+}
+
+var _ http.RoundTripper = &userTokenRoundTripper{}
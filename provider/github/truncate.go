@@ -0,0 +1,70 @@
+package github
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/src-d/lookout/util/ctxlog"
+)
+
+const (
+	// TruncateDetails keeps the rest of a truncated comment in a collapsed
+	// <details> block
+	TruncateDetails = "details"
+	// TruncateLink stores the full text of a truncated comment in the
+	// findings store, and links to it
+	TruncateLink = "link"
+)
+
+// TruncateDecorator returns a decorator that truncates the texts longer than
+// max characters. With the TruncateLink strategy the full text is stored in
+// store and linked from the truncated text; if it can't be stored, or with
+// any other strategy, the rest of the text is kept in a collapsed <details>
+// block.
+func TruncateDecorator(max int, strategy string, store FindingsStore) CommentDecorator {
+	return func(ctx context.Context, rc *RenderContext, text string) string {
+		head, rest, ok := truncate(text, max)
+		if !ok {
+			return text
+		}
+
+		if strategy == TruncateLink && store != nil {
+			sum := sha1.Sum([]byte(text))
+			key := "comments/" + hex.EncodeToString(sum[:])
+			url, err := store.Store(ctx, key, []byte(text))
+			if err == nil {
+				return fmt.Sprintf("%s…\n\n[Show more](%s)", head, url)
+			}
+
+			ctxlog.Get(ctx).Errorf(err, "can't store the full text of the comment")
+		}
+
+		return fmt.Sprintf("%s…\n\n<details>\n<summary>Show more</summary>\n\n%s\n\n</details>",
+			head, rest)
+	}
+}
+
+// truncate splits text in a head of at most max characters and the rest,
+// preferring to split at whitespace. ok is false if text is not longer than
+// max.
+func truncate(text string, max int) (head, rest string, ok bool) {
+	runes := []rune(text)
+	if max <= 0 || len(runes) <= max {
+		return text, "", false
+	}
+
+	cut := max
+	for i := max; i > max/2; i-- {
+		if unicode.IsSpace(runes[i]) {
+			cut = i
+			break
+		}
+	}
+
+	return strings.TrimRightFunc(string(runes[:cut]), unicode.IsSpace),
+		strings.TrimLeftFunc(string(runes[cut:]), unicode.IsSpace), true
+}
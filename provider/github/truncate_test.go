@@ -0,0 +1,73 @@
+package github
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/src-d/lookout"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTruncate(t *testing.T) {
+	require := require.New(t)
+
+	head, rest, ok := truncate("short", 10)
+	require.False(ok)
+	require.Equal("short", head)
+	require.Equal("", rest)
+
+	head, rest, ok = truncate("some long text here", 12)
+	require.True(ok)
+	require.Equal("some long", head)
+	require.Equal("text here", rest)
+
+	// no whitespace to split at
+	head, rest, ok = truncate("ñññññññññ", 4)
+	require.True(ok)
+	require.Equal("ññññ", head)
+	require.Equal("ñññññ", rest)
+}
+
+func TestTruncateDecoratorDetails(t *testing.T) {
+	require := require.New(t)
+
+	r := NewDefaultRenderer(ProviderConfig{MaxCommentLength: 12})
+	rc := &RenderContext{Comment: &lookout.Comment{Text: "some long text here"}}
+	require.Equal(
+		"some long…\n\n<details>\n<summary>Show more</summary>\n\ntext here\n\n</details>",
+		r.Render(context.Background(), rc))
+
+	rc = &RenderContext{Comment: &lookout.Comment{Text: "short text"}}
+	require.Equal("short text", r.Render(context.Background(), rc))
+}
+
+func TestTruncateDecoratorLink(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "lookout-findings")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	r := NewDefaultRenderer(ProviderConfig{
+		MaxCommentLength: 12,
+		TruncateStrategy: TruncateLink,
+		FindingsDir:      dir,
+		FindingsURL:      "https://example.com",
+	})
+	rc := &RenderContext{Comment: &lookout.Comment{Text: "some long text here"}}
+	text := r.Render(context.Background(), rc)
+	require.True(strings.HasPrefix(text, "some long…\n\n[Show more](https://example.com/comments/"))
+
+	files, err := filepath.Glob(filepath.Join(dir, "comments", "*.json"))
+	require.NoError(err)
+	require.Len(files, 1)
+
+	b, err := ioutil.ReadFile(files[0])
+	require.NoError(err)
+	require.Equal("some long text here", string(b))
+}
@@ -70,6 +70,8 @@ func castPullRequest(ctx context.Context, r *lookout.RepositoryInfo, pr *github.
 	pre := &lookout.ReviewEvent{}
 	pre.Provider = Provider
 	pre.InternalID = strconv.FormatInt(pr.GetID(), 10)
+	pre.CreatedAt = pr.GetCreatedAt()
+	pre.UpdatedAt = pr.GetUpdatedAt()
 
 	pre.Number = uint32(pr.GetNumber())
 	pre.RepositoryID = uint32(pr.GetHead().GetRepo().GetID())
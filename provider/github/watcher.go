@@ -22,6 +22,342 @@ type ProviderConfig struct {
 	PrivateKey               string `yaml:"private_key"`
 	AppID                    int    `yaml:"app_id"`
 	InstallationSyncInterval string `yaml:"installation_sync_interval"`
+	// InstallationSyncConcurrency is the max number of installations whose
+	// repositories are listed concurrently on each sync. If 0, they are
+	// listed one at a time
+	InstallationSyncConcurrency int `yaml:"installation_sync_concurrency"`
+	// WatchMinInterval is the min interval between the requests watching
+	// the repositories of each GitHub App installation, e.g. "30s". If empty,
+	// 2s is used
+	WatchMinInterval string `yaml:"watch_min_interval"`
+	// InstallationTokenRefresh refreshes the tokens of the installations in
+	// the background shortly before they expire, instead of when a request
+	// finds them expired
+	InstallationTokenRefresh bool `yaml:"installation_token_refresh"`
+	// InstallationSyncRetries is the max number of retries of each failed
+	// GitHub API request of the installations sync. If 0, 3 retries are
+	// made
+	InstallationSyncRetries int `yaml:"installation_sync_retries"`
+	// InstallationSyncRetryDelay is the time to wait before the first retry
+	// of the installations sync requests, e.g. "2s", doubled with jitter for
+	// each following retry. If empty, 1s is used
+	InstallationSyncRetryDelay string `yaml:"installation_sync_retry_delay"`
+	// BaseRefs is a list of glob patterns for the base branches to analyze,
+	// e.g. "master" or "release/*". Events for other branches are ignored.
+	// If empty, all the branches are analyzed.
+	BaseRefs []string `yaml:"base_refs"`
+	// QuoteOffendingLine adds the commented line, quoted, before the text of
+	// each line comment
+	QuoteOffendingLine bool `yaml:"quote_offending_line"`
+	// NormalizeHTML converts the HTML in the comments text to Markdown, and
+	// strips the tags not supported
+	NormalizeHTML bool `yaml:"normalize_html"`
+	// MaxGlobalComments is the max number of global comments rendered in the
+	// body of the review, the rest are collapsed. If 0, there is no limit
+	MaxGlobalComments int `yaml:"max_global_comments"`
+	// DescriptionComments is how the comments on the pull request
+	// description are posted: DescriptionCommentsReview in their own section
+	// of the review body, or DescriptionCommentsEdit appended to the
+	// description. If empty, DescriptionCommentsReview
+	DescriptionComments string `yaml:"description_comments"`
+	// InstallationConcurrency is the max number of concurrent operations
+	// for the client of each installation. If 0, there is no limit
+	InstallationConcurrency int `yaml:"installation_concurrency"`
+	// InstallationConcurrencyOverrides overrides InstallationConcurrency
+	// for specific installation IDs
+	InstallationConcurrencyOverrides map[int64]int `yaml:"installation_concurrency_overrides"`
+	// PerRepoRateLimit is the max number of posts per hour for each
+	// repository, the posts over it are deferred. If 0, there is no limit
+	PerRepoRateLimit int `yaml:"per_repo_rate_limit"`
+	// InstallationUserTokens are user-to-server OAuth tokens by installation
+	// ID. The installations with a token post as the user of the token
+	// instead of as the app
+	InstallationUserTokens map[int64]string `yaml:"installation_user_tokens"`
+	// RetryBudget is the max number of retries of failed GitHub API requests
+	// for a single event, shared by all the requests made for it. If 0,
+	// failed requests are not retried
+	RetryBudget int `yaml:"retry_budget"`
+	// RetryDelay is the time to wait before the first retry of a failed
+	// request, e.g. "500ms", doubled for each following retry of the same
+	// request. A Retry-After header of the response takes precedence. If
+	// empty, 500ms is used
+	RetryDelay string `yaml:"retry_delay"`
+	// CompareRetries is the max number of retries of the failed requests
+	// fetching the diff of a pull request for a single event. They don't
+	// consume RetryBudget. If 0, they are retried within RetryBudget
+	CompareRetries int `yaml:"compare_retries"`
+	// CompareTimeout is the timeout for each request fetching the diff of
+	// a pull request, e.g. "30s". Big diffs can take long to be fetched
+	CompareTimeout string `yaml:"compare_timeout"`
+	// PostTimeout is the timeout for each request posting reviews and
+	// statuses, e.g. "5s"
+	PostTimeout string `yaml:"post_timeout"`
+	// StatusContextPrefix is the prefix of the context of the statuses,
+	// "lookout" by default
+	StatusContextPrefix string `yaml:"status_context_prefix"`
+	// AnalyzerStatuses posts a status for each analyzer besides the overall
+	// one, "<prefix>/<analyzer>", so a failed analyzer doesn't hide the
+	// results of the rest: error if its analysis failed, failure if its
+	// comments are blocking, and success otherwise
+	AnalyzerStatuses bool `yaml:"analyzer_statuses"`
+	// StatusCopyForward posts the statuses of the commits superseded by a
+	// newer head of the pull request on the newer head, until it has a final
+	// status of its own. By default they are not posted
+	StatusCopyForward bool `yaml:"status_copy_forward"`
+	// CommentOnError posts a global comment explaining the failure when an
+	// analyzer fails. By default failed analyses are only logged
+	CommentOnError bool `yaml:"comment_on_error"`
+	// LatestPushOnly only posts the comments on the files changed since the
+	// last head posted for the pull request
+	LatestPushOnly bool `yaml:"latest_push_only"`
+	// RequestReviewer is the login added as a requested reviewer of the pull
+	// requests with blocking comments, and removed once they have none. If
+	// empty, the reviewers are not changed
+	RequestReviewer string `yaml:"request_reviewer"`
+	// ReportOutOfRange lists the line comments out of the diff range in a
+	// section of the review body, instead of dropping them
+	ReportOutOfRange bool `yaml:"report_out_of_range"`
+	// NotifyAllOutOfRange posts a review listing the line comments out of
+	// the diff range when all of them are, instead of posting nothing
+	NotifyAllOutOfRange bool `yaml:"notify_all_out_of_range"`
+	// OneCommentPerFile posts a single inline comment for each file, anchored
+	// at its first finding, listing all the findings of the file, also the
+	// ones out of the diff range
+	OneCommentPerFile bool `yaml:"one_comment_per_file"`
+	// KeepEmptyComments posts the comments with empty text, by default they
+	// are dropped unless they have items
+	KeepEmptyComments bool `yaml:"keep_empty_comments"`
+	// MergeSameLine merges the comments on the same line: "combine" posts a
+	// single comment with all the texts, "priority" only the comment of the
+	// analyzer with the highest priority, "dedupe" collapses the ones with
+	// the same text and combines the rest, and "none" posts all of them. If
+	// empty, "dedupe" is used
+	MergeSameLine string `yaml:"merge_same_line"`
+	// MinCommentLineGap is the min number of lines between the comments on
+	// the same file, the comments closer to another one with a higher
+	// severity are dropped. If 0, all are posted
+	MinCommentLineGap int `yaml:"min_comment_line_gap"`
+	// MaxComments is the max number of line comments posted for each event,
+	// from all the analyzers, sorted by file and line. A global comment
+	// notes the number of the rest, which are not posted. If 0, all are
+	// posted
+	MaxComments int `yaml:"max_comments"`
+	// UniqueComments drops the comments identical to another one of the same
+	// analyzer in the same event, with the same file, line and text
+	UniqueComments bool `yaml:"unique_comments"`
+	// MaxDiffFiles is the max number of files changed by a pull request to
+	// post its comments. On larger ones only LargePRMessage is posted. If 0,
+	// the comments are always posted
+	MaxDiffFiles int `yaml:"max_diff_files"`
+	// LargePRMessage is the format string of the review posted on the pull
+	// requests with more than MaxDiffFiles, with the number of files changed
+	// and of findings not posted as arguments. If empty a default one is used
+	LargePRMessage string `yaml:"large_pr_message"`
+	// RuleThresholds is the min number of comments of each rule, by RuleID,
+	// in an event to post them. Rules without a threshold are always posted
+	RuleThresholds map[string]int `yaml:"rule_thresholds"`
+	// NoteSuppressedRules adds a global comment with the number of comments
+	// not posted because of RuleThresholds
+	NoteSuppressedRules bool `yaml:"note_suppressed_rules"`
+	// AllowApprove allows posting approving reviews. If disabled, they are
+	// posted as comments. Approvals rejected by GitHub are always posted as
+	// comments
+	AllowApprove bool `yaml:"allow_approve"`
+	// RequestChangesSeverity is the min severity of the comments, e.g.
+	// "ERROR", that makes their review request changes, to gate the merge of
+	// the pull request. The reviews without them are posted as comments. If
+	// empty, all the reviews are posted as comments
+	RequestChangesSeverity string `yaml:"request_changes_severity"`
+	// SummaryComment keeps a comment on each pull request with the number of
+	// findings of the last analysis by severity, edited on every analysis
+	SummaryComment bool `yaml:"summary_comment"`
+	// PostToLinkedIssues keeps a comment on each issue referenced by the
+	// IssueRef of the comments, listing the findings of the pull request
+	// referencing it, edited on every analysis
+	PostToLinkedIssues bool `yaml:"post_to_linked_issues"`
+	// PerPage is the page size of the paginated listings of the GitHub API,
+	// e.g. of the comments already posted. It is capped to 100, the max
+	// allowed by GitHub. If 0, 100 is used
+	PerPage int `yaml:"per_page"`
+	// ArtifactsDir is the directory where a JSON document is written for
+	// each event, with all the comments of the analyzers and, for the ones
+	// not posted, the reason. If empty, no documents are written
+	ArtifactsDir string `yaml:"artifacts_dir"`
+	// LocalDiffFallback computes the diff of the files whose patch is
+	// omitted by GitHub, e.g. because it's too large, from their contents, so
+	// their comments can be posted. It needs several requests for each file
+	LocalDiffFallback bool `yaml:"local_diff_fallback"`
+	// MaxCommentsPerReview is the max number of comments of each review,
+	// the reviews with more comments are posted in several chunks. If 0, 30
+	// is used, as GitHub fails with larger reviews
+	MaxCommentsPerReview int `yaml:"max_comments_per_review"`
+	// BodyChunkPlacement is the chunk posting the body of the reviews with
+	// too many comments, split in several chunks: BodyChunkFirst or
+	// BodyChunkLast. If empty, the body is posted with the last one
+	BodyChunkPlacement string `yaml:"body_chunk_placement"`
+	// OrgConfig enables loading the organization-wide .lookout.yml from the
+	// .github repository of the organization, merged under the repository one
+	OrgConfig bool `yaml:"org_config"`
+	// PostSchedule restricts posting the comments to some time windows,
+	// outside of them posting is deferred. Statuses are not affected
+	PostSchedule PostSchedule `yaml:"post_schedule"`
+	// SeverityPolicies changes the severity of the comments depending on
+	// the path of their files, before posting them
+	SeverityPolicies SeverityPolicies `yaml:"severity_policies"`
+	// MinSeverity drops the comments with a lower severity, e.g. "WARNING",
+	// after applying the SeverityPolicies. The comments without severity are
+	// always posted. If empty, no comment is dropped
+	MinSeverity string `yaml:"min_severity"`
+	// PerAnalyzerReviews posts the comments of each analyzer as its own
+	// review, instead of a single review for all the analyzers
+	PerAnalyzerReviews bool `yaml:"per_analyzer_reviews"`
+	// AnchorComments adds to line comments a hidden marker with a hash of
+	// the commented line content. On following analyses the comments already
+	// posted are relocated to where that content moved, and are not posted
+	// again
+	AnchorComments bool `yaml:"anchor_comments"`
+	// SkipExistingComments doesn't post again the review comments matching,
+	// as set by DedupeBy, one already posted on the same path and position in
+	// the pull request. The CommentFooter is ignored to compare the bodies
+	SkipExistingComments bool `yaml:"skip_existing_comments"`
+	// ResolveOutdatedComments marks as outdated the anchored comments
+	// already posted whose line is not in the diff anymore after a new push,
+	// collapsing their text. It needs AnchorComments
+	ResolveOutdatedComments bool `yaml:"resolve_outdated_comments"`
+	// SyncOnMissingRepo syncs the GitHub App installations when there is no
+	// client for the repository of an event, before giving up. Syncs are
+	// done at most once per minute
+	SyncOnMissingRepo bool `yaml:"sync_on_missing_repo"`
+	// UseChecks posts the comments of pull requests as the annotations of a
+	// check run, grouped by rule, instead of as reviews
+	UseChecks bool `yaml:"use_checks"`
+	// AggregateCheckRun makes the check run of UseChecks have a section for
+	// each analyzer in its summary, instead of grouping all the comments by
+	// rule. It's updated with each analyzer as it is posted
+	AggregateCheckRun bool `yaml:"aggregate_check_run"`
+	// UploadSARIF uploads the comments as SARIF to GitHub code scanning, in
+	// addition to posting them, so they are shown in the Security tab
+	UploadSARIF bool `yaml:"upload_sarif"`
+	// StatusAddedLinesOnly makes only the error comments on lines added in
+	// the pull request fail the analysis status, ignoring the ones on context
+	// lines and the global and file comments
+	StatusAddedLinesOnly bool `yaml:"status_added_lines_only"`
+	// FindingsDir is the directory where the posted comments of each analysis
+	// are stored as JSON, to be linked from the final status. If empty, the
+	// comments are not stored
+	FindingsDir string `yaml:"findings_dir"`
+	// FindingsURL is the base URL serving FindingsDir, used as the target URL
+	// of the final statuses. If empty, file:// URLs are used
+	FindingsURL string `yaml:"findings_url"`
+	// PostPushComments posts the comments of push events as comments on
+	// the head commit of the push, up to MaxComments line comments. If
+	// false, push events are not posted
+	PostPushComments bool `yaml:"post_push_comments"`
+	// EnvironmentLabel identifies the lookout instance, e.g. "staging", in
+	// the posted comments. It is prepended to the body of each comment
+	EnvironmentLabel string `yaml:"environment_label"`
+	// SeverityBadge is the URL template of a badge image prepended to the
+	// body of each comment, formatted with its severity, rule and color,
+	// e.g. "https://img.shields.io/badge/%[1]s-%[2]s-%[3]s". If empty, no
+	// badge is added
+	SeverityBadge string `yaml:"severity_badge"`
+	// SeverityMarker prefixes the text of each comment with its severity:
+	// "emoji" with an emoji, e.g. ⚠️, and "text" with its name, e.g.
+	// [WARNING]. The comments without severity are not prefixed. If empty,
+	// no comment is
+	SeverityMarker string `yaml:"severity_marker"`
+	// MaxPRAgeDays is the max age, in days since they were created, of the
+	// pull requests to analyze. Older pull requests are ignored. If 0, all
+	// the pull requests are analyzed
+	MaxPRAgeDays int `yaml:"max_pr_age_days"`
+	// MaxChangedFiles is the max number of files changed by the pull
+	// requests to analyze. Pull requests changing more files are not
+	// analyzed, and a status noting it is set. If 0, all the pull requests
+	// are analyzed
+	MaxChangedFiles int `yaml:"max_changed_files"`
+	// DedupeBy is how the comments already posted are found when
+	// AnchorComments is enabled: "exact" (the default) for comments on the
+	// same line with the same text, "file-line" for comments on the same line
+	// and "file-line-rule" for comments on the same line with the same RuleID
+	DedupeBy string `yaml:"dedupe_by"`
+	// DedupTTL is the age, e.g. "720h", after which the comments already
+	// posted are not taken into account when AnchorComments is enabled, so
+	// a recurring finding is posted again. If empty, they are always taken
+	// into account
+	DedupTTL string `yaml:"dedup_ttl"`
+	// MarkerStrategy is how the anchors of the comments are stored when
+	// AnchorComments is enabled: "html" (the default) as a hidden HTML
+	// comment, "zero-width" as a suffix of zero-width characters, and
+	// "index" in MarkerIndexDir, keyed by the comment ID. The anchors of
+	// the comments already posted are read in any of them
+	MarkerStrategy string `yaml:"marker_strategy"`
+	// MarkerIndexDir is the directory where the anchors are stored with
+	// the "index" MarkerStrategy. If empty, the HTML comments are used
+	MarkerIndexDir string `yaml:"marker_index_dir"`
+	// ReviewCommentsCacheDir is the directory where the review comments
+	// listed for each pull request are cached, with the time of the listing,
+	// so the next analysis only requests the comments updated since. If
+	// empty, all the comments are listed every time
+	ReviewCommentsCacheDir string `yaml:"review_comments_cache_dir"`
+	// MaxCommentLength is the max number of characters of the text of each
+	// comment, longer texts are truncated. If 0, texts are not truncated
+	MaxCommentLength int `yaml:"max_comment_length"`
+	// TruncateStrategy is how the rest of truncated texts is made available:
+	// "details" (the default) keeps it in a collapsed block, and "link"
+	// stores the full text in FindingsDir and links to it
+	TruncateStrategy string `yaml:"truncate_strategy"`
+	// AnalyzeMergeRef analyzes the merge preview of the pull requests,
+	// refs/pull/N/merge, instead of their head, to catch issues introduced
+	// by merging them into the base branch
+	AnalyzeMergeRef bool `yaml:"analyze_merge_ref"`
+	// SkipGeneratedFiles drops the comments on generated files, the ones
+	// with a "Code generated ... DO NOT EDIT." header. Their contents are
+	// retrieved using the data service
+	SkipGeneratedFiles bool `yaml:"skip_generated_files"`
+	// GeneratedFilesMaxSeverity downgrades the comments on generated files
+	// to it, e.g. "INFO", instead of dropping them, when SkipGeneratedFiles
+	// is enabled
+	GeneratedFilesMaxSeverity string `yaml:"generated_files_max_severity"`
+	// WIPTitlePatterns are regular expressions, e.g. `^\[WIP\]`, matched
+	// against the title of the pull requests. The comments of the matching
+	// ones are not posted, only the statuses, as for work in progress
+	WIPTitlePatterns []string `yaml:"wip_title_patterns"`
+	// EmptyDiffStatus sets the description of the final status of the pull
+	// requests without changed files, whose comments are never posted, to
+	// "Nothing to analyze"
+	EmptyDiffStatus bool `yaml:"empty_diff_status"`
+	// ShowDurationInStatus sets the description of the final success and
+	// failure statuses to how long the analysis took and the number of
+	// comments posted, e.g. "Analyzed in 4.2s, 3 issues found"
+	ShowDurationInStatus bool `yaml:"show_duration_in_status"`
+	// InferProvider posts the events without provider if the host of their
+	// repository URL is a GitHub host, e.g. github.com, for integrations
+	// that don't set it. By default they are not supported
+	InferProvider bool `yaml:"infer_provider"`
+	// ProviderHosts are the providers of the repositories by host, e.g. a
+	// GitHub Enterprise host, used by InferProvider besides the well known
+	// ones
+	ProviderHosts map[string]string `yaml:"provider_hosts"`
+}
+
+// Validate returns an error if the configuration is not valid
+func (c ProviderConfig) Validate() error {
+	if _, err := parseSeverity(c.RequestChangesSeverity); err != nil {
+		return fmt.Errorf("can't parse request changes severity: %s", err)
+	}
+
+	for _, d := range []struct{ name, value string }{
+		{"compare_timeout", c.CompareTimeout},
+		{"post_timeout", c.PostTimeout},
+		{"dedup_ttl", c.DedupTTL},
+		{"retry_delay", c.RetryDelay},
+	} {
+		if _, err := parseDuration(d.name, d.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // don't call github more often than
@@ -38,14 +374,20 @@ var (
 
 type Watcher struct {
 	pool *ClientPool
+	conf ProviderConfig
 	// maps clients to functions that stop watching the client
 	stopFuncs map[*Client]func()
+
+	// changedFiles caches the number of files changed by the heads of the
+	// pull requests, see MaxChangedFiles
+	changedFiles changedFilesHeads
 }
 
 // NewWatcher returns a new
-func NewWatcher(pool *ClientPool) (*Watcher, error) {
+func NewWatcher(pool *ClientPool, conf ProviderConfig) (*Watcher, error) {
 	return &Watcher{
 		pool:      pool,
+		conf:      conf,
 		stopFuncs: make(map[*Client]func()),
 	}, nil
 }
@@ -144,7 +486,12 @@ func (w *Watcher) watchLoop(
 ) {
 	for {
 		for _, repo := range w.pool.ReposByClient(c) {
-			categoryInterval, err := requestFun(ctx, c, repo, cb)
+			// unhealthy clients can't make requests until they are synced
+			var categoryInterval time.Duration
+			var err error
+			if c.Healthy() {
+				categoryInterval, err = requestFun(ctx, c, repo, cb)
+			}
 
 			if err != nil {
 				errCh <- err
@@ -232,6 +579,32 @@ func (w *Watcher) handlePrs(ctx context.Context,
 			"pr-number": e.GetNumber(),
 		})
 		event := castPullRequest(ctx, r, e)
+		if !matchBaseRef(w.conf.BaseRefs, event.Base.ReferenceName) {
+			ctxlog.Get(ctx).With(log.Fields{
+				"base": event.Base.ReferenceName,
+			}).Debugf("skipping pull request, base reference is filtered out")
+			continue
+		}
+
+		if w.conf.AnalyzeMergeRef {
+			if event.Merge.Hash == "" {
+				ctxlog.Get(ctx).Debugf("skipping pull request, it doesn't have a merge preview")
+				continue
+			}
+
+			event.Head = event.Merge
+		}
+
+		if isTooOld(w.conf.MaxPRAgeDays, event.CreatedAt, time.Now()) {
+			ctxlog.Get(ctx).With(log.Fields{
+				"created": event.CreatedAt,
+			}).Debugf("skipping pull request, it is older than the max age")
+			continue
+		}
+
+		if w.hasTooManyFiles(ctx, client, r, e, event) {
+			continue
+		}
 
 		if err := cb(ctx, event); err != nil {
 			return err
@@ -269,6 +642,13 @@ func (w *Watcher) handleEvents(
 			continue
 		}
 
+		if !matchBaseRef(w.conf.BaseRefs, event.Revision().Base.ReferenceName) {
+			logger.With(log.Fields{
+				"base": event.Revision().Base.ReferenceName,
+			}).Debugf("skipping event, base reference is filtered out")
+			continue
+		}
+
 		if err := cb(ctx, event); err != nil {
 			return err
 		}
@@ -339,6 +719,16 @@ func (w *Watcher) newInterval(rate github.Rate, minInterval time.Duration) time.
 	return interval
 }
 
+// isTooOld returns true if maxDays is set and more days than it have passed
+// since created. Unknown creation times are never too old.
+func isTooOld(maxDays int, created, now time.Time) bool {
+	if maxDays <= 0 || created.IsZero() {
+		return false
+	}
+
+	return now.Sub(created) > time.Duration(maxDays)*24*time.Hour
+}
+
 func isStatusNotModified(resp *http.Response) bool {
 	return resp.Header.Get("X-From-Cache") == "1"
 }
@@ -2,11 +2,13 @@ package github
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -14,7 +16,9 @@ import (
 	"github.com/src-d/lookout"
 	"github.com/src-d/lookout/util/cache"
 
+	"github.com/google/go-github/github"
 	"github.com/gregjones/httpcache"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	vcsurl "gopkg.in/sourcegraph/go-vcsurl.v1"
 	log "gopkg.in/src-d/go-log.v1"
@@ -84,7 +88,7 @@ const (
 
 func (s *WatcherTestSuite) newWatcher(repoURLs []string) *Watcher {
 	pool := newTestPool(s.Suite, repoURLs, s.githubURL, s.cache)
-	w, err := NewWatcher(pool)
+	w, err := NewWatcher(pool, ProviderConfig{})
 
 	s.NoError(err)
 
@@ -160,6 +164,190 @@ func (s *WatcherTestSuite) TestWatch_CallbackError_Event() {
 	s.EqualError(err, "foo")
 }
 
+func (s *WatcherTestSuite) TestWatch_BaseRefs() {
+	s.mux.HandleFunc("/repos/mock/test/pulls", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"id":5, "number":1, "base":{"ref":"master", "repo":{"clone_url":"https://github.com/mock/test.git"}}},
+			{"id":6, "number":2, "base":{"ref":"feature", "repo":{"clone_url":"https://github.com/mock/test.git"}}},
+			{"id":7, "number":3, "base":{"ref":"release/1.0", "repo":{"clone_url":"https://github.com/mock/test.git"}}}
+		]`)
+	})
+	s.mux.HandleFunc("/repos/mock/test/events", emptyArrayHandler)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), minInterval*5)
+	defer cancel()
+
+	pool := newTestPool(s.Suite, []string{"github.com/mock/test"}, s.githubURL, s.cache)
+	w, err := NewWatcher(pool, ProviderConfig{BaseRefs: []string{"master", "release/*"}})
+	s.NoError(err)
+
+	var mutex sync.Mutex
+	bases := make(map[string]bool)
+	err = w.Watch(ctx, func(ctx context.Context, e lookout.Event) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		bases[e.Revision().Base.ReferenceName.String()] = true
+		return nil
+	})
+
+	s.EqualError(err, "context deadline exceeded")
+
+	// the callbacks of the clients may still be running
+	mutex.Lock()
+	defer mutex.Unlock()
+	s.Equal(map[string]bool{
+		"refs/heads/master":      true,
+		"refs/heads/release/1.0": true,
+	}, bases)
+}
+
+func (s *WatcherTestSuite) TestWatch_MaxPRAgeDays() {
+	recent := time.Now().Add(-24 * time.Hour).Format(time.RFC3339)
+	s.mux.HandleFunc("/repos/mock/test/pulls", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[
+			{"id":5, "number":1, "created_at":"2010-01-01T00:00:00Z", "base":{"ref":"master", "repo":{"clone_url":"https://github.com/mock/test.git"}}},
+			{"id":6, "number":2, "created_at":"%s", "base":{"ref":"master", "repo":{"clone_url":"https://github.com/mock/test.git"}}}
+		]`, recent)
+	})
+	s.mux.HandleFunc("/repos/mock/test/events", emptyArrayHandler)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), minInterval*5)
+	defer cancel()
+
+	pool := newTestPool(s.Suite, []string{"github.com/mock/test"}, s.githubURL, s.cache)
+	w, err := NewWatcher(pool, ProviderConfig{MaxPRAgeDays: 30})
+	s.NoError(err)
+
+	var mutex sync.Mutex
+	numbers := make(map[uint32]bool)
+	err = w.Watch(ctx, func(ctx context.Context, e lookout.Event) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		numbers[e.(*lookout.ReviewEvent).Number] = true
+		return nil
+	})
+
+	s.EqualError(err, "context deadline exceeded")
+
+	// the callbacks of the clients may still be running
+	mutex.Lock()
+	defer mutex.Unlock()
+	s.Equal(map[uint32]bool{2: true}, numbers)
+}
+
+func (s *WatcherTestSuite) TestWatch_MaxChangedFiles() {
+	s.mux.HandleFunc("/repos/mock/test/pulls", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"id":5, "number":1, "head":{"sha":"aaaa"}, "base":{"ref":"master", "repo":{"clone_url":"https://github.com/mock/test.git"}}},
+			{"id":6, "number":2, "head":{"sha":"bbbb"}, "base":{"ref":"master", "repo":{"clone_url":"https://github.com/mock/test.git"}}}
+		]`)
+	})
+	s.mux.HandleFunc("/repos/mock/test/events", emptyArrayHandler)
+
+	// the listings don't include the number of changed files
+	s.mux.HandleFunc("/repos/mock/test/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":5, "number":1, "changed_files":2000}`)
+	})
+	var getCalls int32
+	s.mux.HandleFunc("/repos/mock/test/pulls/2", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&getCalls, 1)
+		fmt.Fprint(w, `{"id":6, "number":2, "changed_files":10}`)
+	})
+
+	var statusCalls int32
+	s.mux.HandleFunc("/repos/mock/test/statuses/aaaa", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&statusCalls, 1)
+
+		var status github.RepoStatus
+		s.NoError(json.NewDecoder(r.Body).Decode(&status))
+		s.Equal("success", status.GetState())
+		s.Equal("Not analyzed, the pull request changes 2000 files, more than 1000",
+			status.GetDescription())
+		s.Equal("lookout", status.GetContext())
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(status)
+	})
+
+	ctx, cancel := context.WithTimeout(context.TODO(), minInterval*5)
+	defer cancel()
+
+	pool := newTestPool(s.Suite, []string{"github.com/mock/test"}, s.githubURL, s.cache)
+	w, err := NewWatcher(pool, ProviderConfig{MaxChangedFiles: 1000})
+	s.NoError(err)
+
+	var mutex sync.Mutex
+	numbers := make(map[uint32]bool)
+	err = w.Watch(ctx, func(ctx context.Context, e lookout.Event) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		numbers[e.(*lookout.ReviewEvent).Number] = true
+		return nil
+	})
+
+	s.EqualError(err, "context deadline exceeded")
+
+	// the callbacks of the clients may still be running
+	mutex.Lock()
+	defer mutex.Unlock()
+	s.Equal(map[uint32]bool{2: true}, numbers)
+	// the status is set once for each head
+	s.EqualValues(1, atomic.LoadInt32(&statusCalls))
+	// the number of files is requested once for each head
+	s.EqualValues(1, atomic.LoadInt32(&getCalls))
+}
+
+func (s *WatcherTestSuite) TestWatch_AnalyzeMergeRef() {
+	s.mux.HandleFunc("/repos/mock/test/pulls", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"id":5, "number":1, "head":{"ref":"feature", "sha":"aaaa"}, "base":{"ref":"master", "repo":{"clone_url":"https://github.com/mock/test.git"}}},
+			{"id":6, "number":2, "merge_commit_sha":"bbbb", "head":{"ref":"feature", "sha":"cccc"}, "base":{"ref":"master", "repo":{"clone_url":"https://github.com/mock/test.git"}}}
+		]`)
+	})
+	s.mux.HandleFunc("/repos/mock/test/events", emptyArrayHandler)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), minInterval*5)
+	defer cancel()
+
+	pool := newTestPool(s.Suite, []string{"github.com/mock/test"}, s.githubURL, s.cache)
+	w, err := NewWatcher(pool, ProviderConfig{AnalyzeMergeRef: true})
+	s.NoError(err)
+
+	var mutex sync.Mutex
+	heads := make(map[uint32]lookout.ReferencePointer)
+	err = w.Watch(ctx, func(ctx context.Context, e lookout.Event) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		re := e.(*lookout.ReviewEvent)
+		heads[re.Number] = re.Head
+		return nil
+	})
+
+	s.EqualError(err, "context deadline exceeded")
+
+	// the callbacks of the clients may still be running
+	mutex.Lock()
+	defer mutex.Unlock()
+	// the pull request without merge preview is skipped
+	s.Len(heads, 1)
+	s.Equal("refs/pull/2/merge", heads[2].ReferenceName.String())
+	s.Equal("bbbb", heads[2].Hash)
+}
+
+func TestIsTooOld(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Date(2018, 10, 31, 12, 0, 0, 0, time.UTC)
+	require.False(isTooOld(0, now.AddDate(-1, 0, 0), now))
+	require.False(isTooOld(30, time.Time{}, now))
+	require.False(isTooOld(30, now.AddDate(0, 0, -29), now))
+	require.True(isTooOld(30, now.AddDate(0, 0, -31), now))
+}
+
 func (s *WatcherTestSuite) TestWatch_HttpError() {
 	var calls, callsErr int32
 
@@ -310,7 +498,7 @@ func (s *WatcherTestSuite) TestCustomMinInterval() {
 		subs:   make(map[chan ClientPoolEvent]bool),
 	}
 
-	w, err := NewWatcher(pool)
+	w, err := NewWatcher(pool, ProviderConfig{})
 	s.NoError(err)
 
 	globalTimeout := clientMinInterval * 3
@@ -450,7 +638,7 @@ func (s *WatcherTestSuite) TestRemoveClient() {
 		subs:      make(map[chan ClientPoolEvent]bool),
 	}
 
-	w, _ := NewWatcher(pool)
+	w, _ := NewWatcher(pool, ProviderConfig{})
 
 	// remove client
 	go func() {
@@ -0,0 +1,58 @@
+package github
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/src-d/lookout/util/ctxlog"
+
+	"github.com/google/go-github/github"
+	log "gopkg.in/src-d/go-log.v1"
+)
+
+// isWIP returns true if the title of the pull request matches any of the
+// WIPTitlePatterns. The title is not part of the event, so the pull request
+// is retrieved only if there are patterns. Errors are logged and the pull
+// request is not considered a work in progress.
+func (p *Poster) isWIP(
+	ctx context.Context,
+	client *Client,
+	budget *retryBudget,
+	owner, repo string,
+	pr int,
+) bool {
+	if len(p.conf.WIPTitlePatterns) == 0 {
+		return false
+	}
+
+	var pull *github.PullRequest
+	err := budget.do(ctx, "get pull request", func() error {
+		ctx, cancel := withTimeout(ctx, p.compareTimeout)
+		defer cancel()
+
+		var resp *github.Response
+		var err error
+		pull, resp, err = client.PullRequests.Get(ctx, owner, repo, pr)
+		return p.handleAPIError(resp, err)
+	})
+	if err != nil {
+		ctxlog.Get(ctx).Errorf(err, "can't get the title of the pull request, posting anyway")
+		return false
+	}
+
+	title := pull.GetTitle()
+	for _, pattern := range p.conf.WIPTitlePatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			ctxlog.Get(ctx).With(log.Fields{"pattern": pattern}).
+				Errorf(err, "invalid work in progress title pattern")
+			continue
+		}
+
+		if re.MatchString(title) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,48 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/go-github/github"
+)
+
+// postWithTitle posts mockAnalyzerComments on a pull request with the given
+// title, and returns if the review was posted
+func (s *PosterTestSuite) postWithTitle(title string) bool {
+	compareCalled := false
+	s.compareHandle(&compareCalled)
+
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.PullRequest{Title: strptr(title)})
+	})
+
+	posted := false
+	s.mux.HandleFunc("/repos/foo/bar/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		posted = true
+
+		resp := &github.Response{Response: &http.Response{StatusCode: 200}}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	p := &Poster{pool: s.pool, conf: ProviderConfig{
+		WIPTitlePatterns: []string{`^\[WIP\]`, `(?i)^draft:`},
+	}}
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.NoError(err)
+
+	return posted
+}
+
+func (s *PosterTestSuite) TestPostWIPTitle() {
+	s.False(s.postWithTitle("[WIP] Add the feature"))
+}
+
+func (s *PosterTestSuite) TestPostDraftTitle() {
+	s.False(s.postWithTitle("DRAFT: Add the feature"))
+}
+
+func (s *PosterTestSuite) TestPostNotWIPTitle() {
+	s.True(s.postWithTitle("Add the feature [WIP]"))
+}
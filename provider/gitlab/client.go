@@ -0,0 +1,444 @@
+package gitlab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+// defaultURL is the URL of the GitLab instance used when ClientConfig.URL
+// is empty
+const defaultURL = "https://gitlab.com"
+
+// defaultRetries is the max number of retries of the failed requests
+const defaultRetries = 3
+
+// defaultRetryDelay is the time to wait before the first retry of a failed
+// request, doubled for each following retry
+const defaultRetryDelay = time.Second
+
+// perPage is the number of items requested per page of the listings
+const perPage = 100
+
+// ClientConfig holds the URL of the GitLab instance and the access token
+type ClientConfig struct {
+	// URL is the URL of the GitLab instance, e.g.
+	// "https://gitlab.example.com". If empty, https://gitlab.com is used
+	URL   string
+	Token string
+}
+
+// IsZero returns true if the config is empty
+func (c ClientConfig) IsZero() bool {
+	return c == ClientConfig{}
+}
+
+// Client is a client of the GitLab API v4, authenticated with a personal,
+// project or group access token
+type Client struct {
+	http    *http.Client
+	baseURL string
+	token   string
+	// retries is the max number of retries of the failed requests, see do
+	retries    int
+	retryDelay time.Duration
+}
+
+// NewClient creates a new client for the GitLab instance at baseURL, or
+// https://gitlab.com if it's empty
+func NewClient(baseURL, token string) (*Client, error) {
+	if baseURL == "" {
+		baseURL = defaultURL
+	}
+
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("bad GitLab URL: %s", baseURL)
+	}
+
+	return &Client{
+		http:       &http.Client{},
+		baseURL:    strings.TrimSuffix(u.String(), "/") + "/api/v4/",
+		token:      token,
+		retries:    defaultRetries,
+		retryDelay: defaultRetryDelay,
+	}, nil
+}
+
+// apiError is returned by the requests answered with an unsuccessful HTTP
+// status
+type apiError struct {
+	status int
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("bad HTTP status: %d", e.status)
+}
+
+// do sends a request to the given path of the API, with body encoded as JSON
+// if it's not nil, and decodes the response into out if it's not nil.
+// The requests failing with a network error or a server error are retried,
+// except the ones creating resources, that could be created twice; all the
+// requests answered with 429 Too Many Requests are retried, they were not
+// processed.
+func (c *Client) do(
+	ctx context.Context,
+	method, path string,
+	body, out interface{},
+) error {
+	_, err := c.doHeader(ctx, method, path, body, out)
+	return err
+}
+
+// doHeader is the same as do, returning the headers of the response
+func (c *Client) doHeader(
+	ctx context.Context,
+	method, path string,
+	body, out interface{},
+) (http.Header, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+
+	delay := c.retryDelay
+	for attempt := 0; ; attempt++ {
+		header, err := c.send(ctx, method, path, data, out)
+		if err == nil || attempt >= c.retries || !isRetryable(method, err) {
+			return header, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ErrGitLabAPI.Wrap(ctx.Err())
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+// send sends a single request, see do
+func (c *Client) send(
+	ctx context.Context,
+	method, path string,
+	data []byte,
+	out interface{},
+) (http.Header, error) {
+	req, err := http.NewRequest(method, c.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("PRIVATE-TOKEN", c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, ErrGitLabAPI.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, ErrGitLabAPI.Wrap(&apiError{status: resp.StatusCode})
+	}
+
+	if out == nil {
+		return resp.Header, nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return nil, ErrGitLabAPI.Wrap(err)
+	}
+
+	return resp.Header, nil
+}
+
+// isRetryable returns true if the request with the given method failing with
+// err can be retried, see do
+func isRetryable(method string, err error) bool {
+	if !ErrGitLabAPI.Is(err) {
+		return false
+	}
+
+	apiErr, ok := err.(*errors.Error).Cause().(*apiError)
+	if ok && apiErr.status == http.StatusTooManyRequests {
+		return true
+	}
+
+	if method != http.MethodGet {
+		return false
+	}
+
+	return !ok || apiErr.status >= http.StatusInternalServerError
+}
+
+// nextPage returns the next page of a listing from the headers of the
+// response, or 0 if it was the last one
+func nextPage(header http.Header) int {
+	page, err := strconv.Atoi(header.Get("X-Next-Page"))
+	if err != nil {
+		return 0
+	}
+
+	return page
+}
+
+// projectPath returns the path of the API resources of a project, with its
+// full path URL-encoded as GitLab expects
+func projectPath(project string) string {
+	return "projects/" + url.PathEscape(project)
+}
+
+// diffRefs are the commits of a merge request version, needed to place
+// comments on its diff
+type diffRefs struct {
+	BaseSHA  string `json:"base_sha"`
+	HeadSHA  string `json:"head_sha"`
+	StartSHA string `json:"start_sha"`
+}
+
+type mergeRequest struct {
+	ID              int       `json:"id"`
+	IID             int       `json:"iid"`
+	ProjectID       int       `json:"project_id"`
+	SourceProjectID int       `json:"source_project_id"`
+	SourceBranch    string    `json:"source_branch"`
+	TargetBranch    string    `json:"target_branch"`
+	SHA             string    `json:"sha"`
+	MergeStatus     string    `json:"merge_status"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	DiffRefs        diffRefs  `json:"diff_refs"`
+}
+
+// mergeRequest returns the merge request iid of the project
+func (c *Client) mergeRequest(
+	ctx context.Context,
+	project string,
+	iid int,
+) (*mergeRequest, error) {
+	var mr mergeRequest
+	path := fmt.Sprintf("%s/merge_requests/%d", projectPath(project), iid)
+	if err := c.do(ctx, http.MethodGet, path, nil, &mr); err != nil {
+		return nil, err
+	}
+
+	return &mr, nil
+}
+
+// openMergeRequests returns the open merge requests of the project,
+// following the pagination
+func (c *Client) openMergeRequests(
+	ctx context.Context,
+	project string,
+) ([]*mergeRequest, error) {
+	var result []*mergeRequest
+	for page := 1; page != 0; {
+		var mrs []*mergeRequest
+		path := fmt.Sprintf("%s/merge_requests?state=opened&per_page=%d&page=%d",
+			projectPath(project), perPage, page)
+		header, err := c.doHeader(ctx, http.MethodGet, path, nil, &mrs)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, mrs...)
+		page = nextPage(header)
+	}
+
+	return result, nil
+}
+
+// position is the position of a discussion on the diff of a merge request
+type position struct {
+	diffRefs
+	PositionType string `json:"position_type"`
+	OldPath      string `json:"old_path"`
+	NewPath      string `json:"new_path"`
+	NewLine      int    `json:"new_line"`
+}
+
+type discussion struct {
+	Body     string    `json:"body"`
+	Position *position `json:"position,omitempty"`
+}
+
+// createDiscussion starts a discussion on the merge request iid of the
+// project, on the diff if pos is not nil
+func (c *Client) createDiscussion(
+	ctx context.Context,
+	project string,
+	iid int,
+	body string,
+	pos *position,
+) error {
+	path := fmt.Sprintf("%s/merge_requests/%d/discussions", projectPath(project), iid)
+	return c.do(ctx, http.MethodPost, path, &discussion{Body: body, Position: pos}, nil)
+}
+
+type note struct {
+	Body string `json:"body"`
+}
+
+// notes returns all the notes of the merge request iid of the project,
+// including the ones of the discussions, following the pagination
+func (c *Client) notes(
+	ctx context.Context,
+	project string,
+	iid int,
+) ([]*note, error) {
+	var result []*note
+	for page := 1; page != 0; {
+		var notes []*note
+		path := fmt.Sprintf("%s/merge_requests/%d/notes?per_page=%d&page=%d",
+			projectPath(project), iid, perPage, page)
+		header, err := c.doHeader(ctx, http.MethodGet, path, nil, &notes)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, notes...)
+		page = nextPage(header)
+	}
+
+	return result, nil
+}
+
+// createNote adds a note to the merge request iid of the project
+func (c *Client) createNote(
+	ctx context.Context,
+	project string,
+	iid int,
+	body string,
+) error {
+	path := fmt.Sprintf("%s/merge_requests/%d/notes", projectPath(project), iid)
+	return c.do(ctx, http.MethodPost, path, &note{Body: body}, nil)
+}
+
+// commitStatus is the status of an external job on a commit
+type commitStatus struct {
+	State       string `json:"state"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	TargetURL   string `json:"target_url,omitempty"`
+}
+
+// setCommitStatus sets the status of the commit sha of the project
+func (c *Client) setCommitStatus(
+	ctx context.Context,
+	project, sha string,
+	status *commitStatus,
+) error {
+	path := fmt.Sprintf("%s/statuses/%s", projectPath(project), url.PathEscape(sha))
+	return c.do(ctx, http.MethodPost, path, status, nil)
+}
+
+// ClientPool holds the clients of the GitLab projects, by their full path,
+// e.g. "group/subgroup/project"
+type ClientPool struct {
+	mutex     sync.Mutex
+	byProject map[string]*Client
+	// urls holds the repository URL of each project
+	urls map[string]string
+}
+
+// NewClientPool creates a new pool of clients for the projects, by their
+// repository URL. The projects with the same config share the client.
+func NewClientPool(urlToConfig map[string]ClientConfig) (*ClientPool, error) {
+	byConfig := make(map[ClientConfig]*Client)
+	byProject := make(map[string]*Client, len(urlToConfig))
+	urls := make(map[string]string, len(urlToConfig))
+	for repoURL, conf := range urlToConfig {
+		project, err := parseProject(repoURL)
+		if err != nil {
+			return nil, err
+		}
+
+		client, ok := byConfig[conf]
+		if !ok {
+			client, err = NewClient(conf.URL, conf.Token)
+			if err != nil {
+				return nil, err
+			}
+
+			byConfig[conf] = client
+		}
+
+		byProject[project] = client
+		urls[project] = repoURL
+	}
+
+	return &ClientPool{byProject: byProject, urls: urls}, nil
+}
+
+// Client returns the client of the project, by its full path
+func (p *ClientPool) Client(project string) (*Client, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	c, ok := p.byProject[project]
+	return c, ok
+}
+
+// Projects returns the repository URL of each project of the pool, by its
+// full path
+func (p *ClientPool) Projects() map[string]string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	result := make(map[string]string, len(p.urls))
+	for project, repoURL := range p.urls {
+		result[project] = repoURL
+	}
+
+	return result
+}
+
+// Update sets the client of the project, by its full path
+func (p *ClientPool) Update(project string, c *Client) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.byProject == nil {
+		p.byProject = make(map[string]*Client)
+	}
+
+	p.byProject[project] = c
+}
+
+// parseProject returns the full path of the project of a repository URL,
+// e.g. "group/subgroup/project" for
+// https://gitlab.example.com/group/subgroup/project.git
+func parseProject(repoURL string) (string, error) {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return "", err
+	}
+
+	project := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	if u.Host == "" || !strings.Contains(project, "/") {
+		return "", fmt.Errorf("bad GitLab project URL: %s", repoURL)
+	}
+
+	return project, nil
+}
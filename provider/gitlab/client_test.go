@@ -0,0 +1,81 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewClientPool(t *testing.T) {
+	require := require.New(t)
+
+	conf := ClientConfig{URL: "https://gitlab.example.com", Token: "token"}
+	pool, err := NewClientPool(map[string]ClientConfig{
+		"https://gitlab.example.com/foo/bar.git":     conf,
+		"https://gitlab.example.com/foo/sub/baz.git": conf,
+		"https://gitlab.com/qux/quux":                ClientConfig{},
+	})
+	require.NoError(err)
+
+	bar, ok := pool.Client("foo/bar")
+	require.True(ok)
+	baz, ok := pool.Client("foo/sub/baz")
+	require.True(ok)
+	require.True(bar == baz)
+	require.Equal("https://gitlab.example.com/api/v4/", bar.baseURL)
+
+	quux, ok := pool.Client("qux/quux")
+	require.True(ok)
+	require.Equal("https://gitlab.com/api/v4/", quux.baseURL)
+
+	_, ok = pool.Client("foo/qux")
+	require.False(ok)
+
+	require.Equal(map[string]string{
+		"foo/bar":     "https://gitlab.example.com/foo/bar.git",
+		"foo/sub/baz": "https://gitlab.example.com/foo/sub/baz.git",
+		"qux/quux":    "https://gitlab.com/qux/quux",
+	}, pool.Projects())
+}
+
+func TestNewClientPoolBadURL(t *testing.T) {
+	require := require.New(t)
+
+	_, err := NewClientPool(map[string]ClientConfig{
+		"https://gitlab.example.com/foo": ClientConfig{},
+	})
+	require.Error(err)
+
+	_, err = NewClientPool(map[string]ClientConfig{
+		"https://gitlab.example.com/foo/bar": ClientConfig{URL: "gitlab.example.com"},
+	})
+	require.Error(err)
+}
+
+func TestClientNotesPagination(t *testing.T) {
+	require := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal("/api/v4/projects/foo%2Fbar/merge_requests/42/notes", r.URL.EscapedPath())
+		require.Equal("100", r.URL.Query().Get("per_page"))
+
+		page := r.URL.Query().Get("page")
+		if page == "1" {
+			w.Header().Set("X-Next-Page", "2")
+		}
+
+		json.NewEncoder(w).Encode([]*note{{Body: "page " + page}})
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "")
+	require.NoError(err)
+
+	notes, err := client.notes(context.Background(), "foo/bar", 42)
+	require.NoError(err)
+	require.Equal([]*note{{Body: "page 1"}, {Body: "page 2"}}, notes)
+}
@@ -0,0 +1,357 @@
+package gitlab
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/util/ctxlog"
+
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	log "gopkg.in/src-d/go-log.v1"
+)
+
+// Provider is the name of the GitLab provider
+const Provider = "gitlab"
+
+var (
+	// ErrGitLabAPI signals an error while making a request to the GitLab API.
+	ErrGitLabAPI = errors.NewKind("gitlab api error")
+	// ErrEventNotSupported signals that this provider does not support the
+	// given event for a given operation.
+	ErrEventNotSupported = errors.NewKind("event not supported")
+)
+
+// defaultStatusName is the name of the commit statuses if
+// ProviderConfig.StatusName is empty
+const defaultStatusName = "lookout"
+
+// ProviderConfig represents the yml config
+type ProviderConfig struct {
+	// CommentFooter is the format string of a footer appended to each
+	// comment, with the feedback URL of the analyzer as argument. It's not
+	// added if the analyzer doesn't have one
+	CommentFooter string `yaml:"comment_footer"`
+	// StatusName is the name of the commit statuses, "lookout" by default
+	StatusName string `yaml:"status_name"`
+	// WatchInterval is the interval between the listings of the open merge
+	// requests of each project, e.g. "30s". If empty, 1m is used
+	WatchInterval string `yaml:"watch_interval"`
+}
+
+// Poster posts comments as discussions and notes of GitLab merge requests,
+// and the analysis status as commit statuses
+type Poster struct {
+	pool *ClientPool
+	conf ProviderConfig
+}
+
+var _ lookout.Poster = &Poster{}
+
+// NewPoster creates a new poster for the GitLab API
+func NewPoster(pool *ClientPool, conf ProviderConfig) *Poster {
+	return &Poster{
+		pool: pool,
+		conf: conf,
+	}
+}
+
+// IsPermanentError returns true if err can't be solved by posting again,
+// like an unsupported event
+func IsPermanentError(err error) bool {
+	return ErrEventNotSupported.Is(err)
+}
+
+// Post posts the comments of a merge request: line comments as discussions
+// on its diff, and global and file comments as notes. Line comments GitLab
+// can't place on the diff are posted as notes too.
+// Each comment carries a hidden marker, and the ones already in the merge
+// request for the same head are not posted again, so posting the same
+// analysis twice, e.g. after a failure, doesn't duplicate them.
+// If a GitLab API request fails, ErrGitLabAPI is returned.
+func (p *Poster) Post(ctx context.Context, e lookout.Event,
+	aCommentsList []lookout.AnalyzerComments) error {
+	switch ev := e.(type) {
+	case *lookout.ReviewEvent:
+		if ev.Provider != Provider {
+			return ErrEventNotSupported.Wrap(
+				fmt.Errorf("unsupported provider: %s", ev.Provider))
+		}
+
+		return p.postMR(ctx, ev, aCommentsList)
+	default:
+		return ErrEventNotSupported.Wrap(fmt.Errorf("unsupported event type"))
+	}
+}
+
+func (p *Poster) postMR(ctx context.Context, e *lookout.ReviewEvent,
+	aCommentsList []lookout.AnalyzerComments) error {
+	project, iid, err := validateMR(e)
+	if err != nil {
+		return err
+	}
+
+	client, err := p.getClient(project)
+	if err != nil {
+		return err
+	}
+
+	posted, err := postedKeys(ctx, client, project, iid)
+	if err != nil {
+		return err
+	}
+
+	var refs *diffRefs
+	for _, aComments := range aCommentsList {
+		for _, c := range aComments.Comments {
+			if c.Text == "" {
+				continue
+			}
+
+			key := commentKey(c)
+			if posted[key] {
+				ctxlog.Get(ctx).With(log.Fields{
+					"file": c.File,
+					"line": c.Line,
+				}).Debugf("comment already posted, skipping it")
+				continue
+			}
+
+			body := p.render(aComments.Config, c.Text)
+			if c.File == "" {
+				if err := client.createNote(ctx, project, iid, withMarker(body, key)); err != nil {
+					return err
+				}
+
+				posted[key] = true
+				continue
+			}
+
+			if c.Line <= 0 {
+				body = fmt.Sprintf("`%s`: %s", c.File, body)
+				if err := client.createNote(ctx, project, iid, withMarker(body, key)); err != nil {
+					return err
+				}
+
+				posted[key] = true
+				continue
+			}
+
+			if refs == nil {
+				mr, err := client.mergeRequest(ctx, project, iid)
+				if err != nil {
+					return err
+				}
+
+				refs = &mr.DiffRefs
+			}
+
+			err := client.createDiscussion(ctx, project, iid, withMarker(body, key), &position{
+				diffRefs:     *refs,
+				PositionType: "text",
+				OldPath:      c.File,
+				NewPath:      c.File,
+				NewLine:      int(c.Line),
+			})
+			if !isBadRequest(err) {
+				if err != nil {
+					return err
+				}
+
+				posted[key] = true
+				continue
+			}
+
+			// GitLab rejects the positions out of the diff
+			ctxlog.Get(ctx).With(log.Fields{
+				"file": c.File,
+				"line": c.Line,
+			}).Debugf("line out of the diff, posting the comment as a note")
+
+			body = fmt.Sprintf("`%s:%d`: %s", c.File, c.Line, body)
+			if err := client.createNote(ctx, project, iid, withMarker(body, key)); err != nil {
+				return err
+			}
+
+			posted[key] = true
+		}
+	}
+
+	return nil
+}
+
+// markerPattern matches the hidden marker of the comments posted by
+// lookout, with their key, see withMarker
+var markerPattern = regexp.MustCompile(`<!-- lookout:([0-9a-f]{40}) -->`)
+
+// commentKey returns the key of a comment of a merge request, identifying it
+// by its file, line, rule and text. The head of the analysis is not part of
+// the key, so the comments are not posted again on each push.
+func commentKey(c *lookout.Comment) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s:%d:%s:%s", c.File, c.Line, c.RuleID, c.Text)))
+	return hex.EncodeToString(sum[:])
+}
+
+// withMarker returns the body with the hidden marker of the comment key at
+// the end, not rendered by GitLab
+func withMarker(body, key string) string {
+	return fmt.Sprintf("%s\n\n<!-- lookout:%s -->", body, key)
+}
+
+// postedKeys returns the keys of the comments already posted in the merge
+// request, found by their markers
+func postedKeys(
+	ctx context.Context,
+	client *Client,
+	project string,
+	iid int,
+) (map[string]bool, error) {
+	notes, err := client.notes(ctx, project, iid)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]bool, len(notes))
+	for _, n := range notes {
+		for _, m := range markerPattern.FindAllStringSubmatch(n.Body, -1) {
+			result[m[1]] = true
+		}
+	}
+
+	return result, nil
+}
+
+// render returns the body of a comment of the given analyzer, with the
+// CommentFooter if there is one
+func (p *Poster) render(a lookout.AnalyzerConfig, text string) string {
+	if p.conf.CommentFooter == "" || a.Feedback == "" {
+		return text
+	}
+
+	return fmt.Sprintf("%s\n\n%s", text, fmt.Sprintf(p.conf.CommentFooter, a.Feedback))
+}
+
+// isBadRequest returns true if err is a GitLab API error for a request
+// answered with 400 Bad Request
+func isBadRequest(err error) bool {
+	if !ErrGitLabAPI.Is(err) {
+		return false
+	}
+
+	apiErr, ok := err.(*errors.Error).Cause().(*apiError)
+	return ok && apiErr.status == http.StatusBadRequest
+}
+
+// Status sets the commit status of the head of the merge request, visible
+// from the GitLab UI.
+// If a GitLab API request fails, ErrGitLabAPI is returned.
+func (p *Poster) Status(ctx context.Context, e lookout.Event,
+	status lookout.AnalysisStatus) error {
+	switch ev := e.(type) {
+	case *lookout.ReviewEvent:
+		if ev.Provider != Provider {
+			return ErrEventNotSupported.Wrap(
+				fmt.Errorf("unsupported provider: %s", ev.Provider))
+		}
+
+		return p.statusMR(ctx, ev, status)
+	default:
+		return ErrEventNotSupported.Wrap(fmt.Errorf("unsupported event type"))
+	}
+}
+
+func (p *Poster) statusMR(ctx context.Context, e *lookout.ReviewEvent,
+	status lookout.AnalysisStatus) error {
+	project, _, err := validateMR(e)
+	if err != nil {
+		return err
+	}
+
+	state, description, err := statusStrings(status)
+	if err != nil {
+		return err
+	}
+
+	client, err := p.getClient(project)
+	if err != nil {
+		return err
+	}
+
+	name := p.conf.StatusName
+	if name == "" {
+		name = defaultStatusName
+	}
+
+	return client.setCommitStatus(ctx, project, e.Head.Hash, &commitStatus{
+		State:       state,
+		Name:        name,
+		Description: description,
+	})
+}
+
+func statusStrings(s lookout.AnalysisStatus) (string, string, error) {
+	switch s {
+	case lookout.ErrorAnalysisStatus:
+		return "failed", "There was an error during the analysis", nil
+	case lookout.FailureAnalysisStatus:
+		return "failed", "The analysis result was negative", nil
+	case lookout.PendingAnalysisStatus:
+		return "pending", "The analysis is in progress", nil
+	case lookout.SuccessAnalysisStatus:
+		return "success", "The analysis was performed", nil
+	case lookout.SkippedAnalysisStatus:
+		return "success", "The analysis was skipped", nil
+	default:
+		return "", "", fmt.Errorf("unsupported AnalysisStatus %s", s)
+	}
+}
+
+func (p *Poster) getClient(project string) (*Client, error) {
+	client, ok := p.pool.Client(project)
+	if !ok {
+		return nil, fmt.Errorf("client for %s doesn't exists", project)
+	}
+
+	return client, nil
+}
+
+// validateMR returns the full path of the project and the IID of the merge
+// request of the event
+func validateMR(e *lookout.ReviewEvent) (project string, iid int, err error) {
+	project, err = parseProject(e.Base.InternalRepositoryURL)
+	if err != nil {
+		err = ErrEventNotSupported.Wrap(err)
+		return
+	}
+
+	if iid, err = parseMRRef(e.Head.ReferenceName); err != nil {
+		err = ErrEventNotSupported.Wrap(err)
+		return
+	}
+
+	return
+}
+
+var mrRefPattern = regexp.MustCompile(`^refs/merge-requests/(\d+)/head$`)
+
+// parseMRRef returns the IID of the merge request of a reference,
+// refs/merge-requests/N/head
+func parseMRRef(ref plumbing.ReferenceName) (int, error) {
+	m := mrRefPattern.FindStringSubmatch(ref.String())
+	if m == nil {
+		return 0, fmt.Errorf("bad MR: %s", ref)
+	}
+
+	iid, err := strconv.Atoi(m[1])
+	if err != nil || iid <= 0 {
+		return 0, fmt.Errorf("bad MR: %s", ref)
+	}
+
+	return iid, nil
+}
@@ -0,0 +1,336 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/src-d/lookout"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+const (
+	hash1 = "f67e5455a86d0f2a366f1b980489fac77a373bd0"
+	hash2 = "02801e1a27a0a906d59530aeb81f4cd137f2c717"
+)
+
+var mockEvent = &lookout.ReviewEvent{
+	Provider: Provider,
+	CommitRevision: lookout.CommitRevision{
+		Base: lookout.ReferencePointer{
+			InternalRepositoryURL: "https://gitlab.example.com/foo/bar.git",
+			ReferenceName:         "refs/heads/master",
+			Hash:                  hash1,
+		},
+		Head: lookout.ReferencePointer{
+			InternalRepositoryURL: "https://gitlab.example.com/foo/bar.git",
+			ReferenceName:         "refs/merge-requests/42/head",
+			Hash:                  hash2,
+		}}}
+
+var mockAnalyzerComments = []lookout.AnalyzerComments{
+	lookout.AnalyzerComments{
+		Config: lookout.AnalyzerConfig{
+			Name:     "mock",
+			Feedback: "https://foo.bar/feedback",
+		},
+		Comments: []*lookout.Comment{
+			&lookout.Comment{Text: "Global comment"},
+			&lookout.Comment{File: "main.go", Text: "File comment"},
+			&lookout.Comment{File: "main.go", Line: 5, Text: "Line comment"},
+			&lookout.Comment{File: "main.go", Line: 50, Text: "Out of diff"},
+		}}}
+
+type PosterTestSuite struct {
+	suite.Suite
+	handlers map[string]http.HandlerFunc
+	server   *httptest.Server
+	pool     *ClientPool
+}
+
+func (s *PosterTestSuite) SetupTest() {
+	s.handlers = make(map[string]http.HandlerFunc)
+	// the project paths are URL-encoded, so the handlers are matched by the
+	// escaped path
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, ok := s.handlers[r.URL.EscapedPath()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		h(w, r)
+	}))
+
+	client, err := NewClient(s.server.URL, "token")
+	s.Require().NoError(err)
+	client.retryDelay = 0
+
+	s.pool = &ClientPool{}
+	s.pool.Update("foo/bar", client)
+}
+
+func (s *PosterTestSuite) handle(path string, h http.HandlerFunc) {
+	s.handlers[path] = h
+}
+
+func (s *PosterTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+// handleMR handles the requests of the merge request 42 as GitLab does,
+// keeping the posted notes and discussions, and returns the bodies of all
+// the posted notes and the discussions
+func (s *PosterTestSuite) handleMR() (*[]string, *[]discussion) {
+	s.handle("/api/v4/projects/foo%2Fbar/merge_requests/42", func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("token", r.Header.Get("PRIVATE-TOKEN"))
+		json.NewEncoder(w).Encode(&mergeRequest{IID: 42, DiffRefs: diffRefs{
+			BaseSHA:  hash1,
+			HeadSHA:  hash2,
+			StartSHA: hash1,
+		}})
+	})
+
+	var notes []string
+	var discussions []discussion
+	s.handle("/api/v4/projects/foo%2Fbar/merge_requests/42/notes", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			var all []*note
+			for _, n := range notes {
+				all = append(all, &note{Body: n})
+			}
+			for _, d := range discussions {
+				all = append(all, &note{Body: d.Body})
+			}
+
+			json.NewEncoder(w).Encode(all)
+			return
+		}
+
+		s.Equal("POST", r.Method)
+
+		var n note
+		s.NoError(json.NewDecoder(r.Body).Decode(&n))
+		notes = append(notes, n.Body)
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	s.handle("/api/v4/projects/foo%2Fbar/merge_requests/42/discussions", func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("POST", r.Method)
+
+		var d discussion
+		s.NoError(json.NewDecoder(r.Body).Decode(&d))
+		if d.Position.NewLine > 10 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		discussions = append(discussions, d)
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	return &notes, &discussions
+}
+
+// stripMarker returns the body without the marker of the comment
+func stripMarker(body string) string {
+	return strings.TrimSuffix(markerPattern.ReplaceAllString(body, ""), "\n\n")
+}
+
+func (s *PosterTestSuite) TestPost() {
+	notes, discussions := s.handleMR()
+
+	p := NewPoster(s.pool, ProviderConfig{CommentFooter: "Feedback: %s"})
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.NoError(err)
+
+	var bodies []string
+	for _, n := range *notes {
+		s.True(markerPattern.MatchString(n))
+		bodies = append(bodies, stripMarker(n))
+	}
+
+	s.Equal([]string{
+		"Global comment\n\nFeedback: https://foo.bar/feedback",
+		"`main.go`: File comment\n\nFeedback: https://foo.bar/feedback",
+		"`main.go:50`: Out of diff\n\nFeedback: https://foo.bar/feedback",
+	}, bodies)
+
+	s.Require().Len(*discussions, 1)
+	d := (*discussions)[0]
+	s.Equal(withMarker(
+		"Line comment\n\nFeedback: https://foo.bar/feedback",
+		commentKey(mockAnalyzerComments[0].Comments[2]),
+	), d.Body)
+	s.Equal(&position{
+		diffRefs:     diffRefs{BaseSHA: hash1, HeadSHA: hash2, StartSHA: hash1},
+		PositionType: "text",
+		OldPath:      "main.go",
+		NewPath:      "main.go",
+		NewLine:      5,
+	}, d.Position)
+}
+
+func (s *PosterTestSuite) TestPostTwice() {
+	notes, discussions := s.handleMR()
+
+	p := NewPoster(s.pool, ProviderConfig{})
+	s.NoError(p.Post(context.Background(), mockEvent, mockAnalyzerComments))
+	s.NoError(p.Post(context.Background(), mockEvent, mockAnalyzerComments))
+
+	s.Len(*notes, 3)
+	s.Len(*discussions, 1)
+
+	// the comments of a new head already posted are skipped
+	e := *mockEvent
+	e.Head.Hash = hash1
+	s.NoError(p.Post(context.Background(), &e, mockAnalyzerComments))
+
+	s.Len(*notes, 3)
+	s.Len(*discussions, 1)
+
+	// a comment with a different text is a new one
+	changed := *mockAnalyzerComments[0].Comments[2]
+	changed.Text = "Another line comment"
+	s.NoError(p.Post(context.Background(), &e, []lookout.AnalyzerComments{{
+		Config:   mockAnalyzerComments[0].Config,
+		Comments: []*lookout.Comment{&changed},
+	}}))
+
+	s.Len(*notes, 3)
+	s.Len(*discussions, 2)
+}
+
+func (s *PosterTestSuite) TestPostError() {
+	var calls int
+	s.handle("/api/v4/projects/foo%2Fbar/merge_requests/42/notes", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	p := NewPoster(s.pool, ProviderConfig{})
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.True(ErrGitLabAPI.Is(err))
+	s.Equal(defaultRetries+1, calls)
+}
+
+func (s *PosterTestSuite) TestPostRetry() {
+	notes, _ := s.handleMR()
+
+	handler := s.handlers["/api/v4/projects/foo%2Fbar/merge_requests/42/notes"]
+	var failed bool
+	s.handle("/api/v4/projects/foo%2Fbar/merge_requests/42/notes", func(w http.ResponseWriter, r *http.Request) {
+		if !failed {
+			failed = true
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		handler(w, r)
+	})
+
+	p := NewPoster(s.pool, ProviderConfig{})
+	s.NoError(p.Post(context.Background(), mockEvent, mockAnalyzerComments))
+	s.True(failed)
+	s.Len(*notes, 3)
+}
+
+func (s *PosterTestSuite) TestPostCreateNotRetried() {
+	var calls int
+	s.handle("/api/v4/projects/foo%2Fbar/merge_requests/42/notes", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			json.NewEncoder(w).Encode([]*note{})
+			return
+		}
+
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	p := NewPoster(s.pool, ProviderConfig{})
+	err := p.Post(context.Background(), mockEvent, mockAnalyzerComments)
+	s.True(ErrGitLabAPI.Is(err))
+	s.Equal(1, calls)
+}
+
+func (s *PosterTestSuite) TestPostBadProvider() {
+	e := *mockEvent
+	e.Provider = "badprovider"
+
+	p := NewPoster(s.pool, ProviderConfig{})
+	err := p.Post(context.Background(), &e, mockAnalyzerComments)
+	s.True(ErrEventNotSupported.Is(err))
+	s.Equal("event not supported: unsupported provider: badprovider", err.Error())
+}
+
+func (s *PosterTestSuite) TestPostBadReference() {
+	e := *mockEvent
+	e.Head.ReferenceName = "refs/pull/42/head"
+
+	p := NewPoster(s.pool, ProviderConfig{})
+	err := p.Post(context.Background(), &e, mockAnalyzerComments)
+	s.True(ErrEventNotSupported.Is(err))
+	s.Equal("event not supported: bad MR: refs/pull/42/head", err.Error())
+}
+
+func (s *PosterTestSuite) TestStatus() {
+	var statuses []commitStatus
+	s.handle("/api/v4/projects/foo%2Fbar/statuses/"+hash2, func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("POST", r.Method)
+
+		var st commitStatus
+		s.NoError(json.NewDecoder(r.Body).Decode(&st))
+		statuses = append(statuses, st)
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	p := NewPoster(s.pool, ProviderConfig{})
+	for _, st := range []lookout.AnalysisStatus{
+		lookout.PendingAnalysisStatus,
+		lookout.SuccessAnalysisStatus,
+		lookout.FailureAnalysisStatus,
+	} {
+		s.NoError(p.Status(context.Background(), mockEvent, st))
+	}
+
+	s.Equal([]commitStatus{
+		{State: "pending", Name: "lookout", Description: "The analysis is in progress"},
+		{State: "success", Name: "lookout", Description: "The analysis was performed"},
+		{State: "failed", Name: "lookout", Description: "The analysis result was negative"},
+	}, statuses)
+}
+
+func TestPosterTestSuite(t *testing.T) {
+	suite.Run(t, new(PosterTestSuite))
+}
+
+func TestIsPermanentError(t *testing.T) {
+	require := require.New(t)
+
+	require.True(IsPermanentError(ErrEventNotSupported.New()))
+	require.False(IsPermanentError(ErrGitLabAPI.New()))
+}
+
+func TestParseMRRef(t *testing.T) {
+	require := require.New(t)
+
+	iid, err := parseMRRef(plumbing.ReferenceName("refs/merge-requests/42/head"))
+	require.NoError(err)
+	require.Equal(42, iid)
+
+	for _, ref := range []string{
+		"refs/pull/42/head",
+		"refs/merge-requests/0/head",
+		"refs/merge-requests/42/merge",
+		"refs/heads/master",
+	} {
+		_, err := parseMRRef(plumbing.ReferenceName(ref))
+		require.Error(err, ref)
+	}
+}
@@ -0,0 +1,155 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/util/ctxlog"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	log "gopkg.in/src-d/go-log.v1"
+)
+
+// defaultWatchInterval is the interval between the listings of the merge
+// requests if ProviderConfig.WatchInterval is empty
+const defaultWatchInterval = time.Minute
+
+// mergeableStatus is the merge status of the merge requests that can be
+// merged without conflicts
+const mergeableStatus = "can_be_merged"
+
+// Watcher watches the open merge requests of the projects of a ClientPool,
+// listing them periodically
+type Watcher struct {
+	pool     *ClientPool
+	interval time.Duration
+	// heads holds the head of each merge request already notified, by
+	// project and IID
+	heads map[string]string
+}
+
+var _ lookout.Watcher = &Watcher{}
+
+// NewWatcher returns a new watcher of the merge requests of the projects of
+// the pool
+func NewWatcher(pool *ClientPool, conf ProviderConfig) (*Watcher, error) {
+	interval := defaultWatchInterval
+	if conf.WatchInterval != "" {
+		var err error
+		interval, err = time.ParseDuration(conf.WatchInterval)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse watch interval: %s", err)
+		}
+
+		if interval <= 0 {
+			return nil, fmt.Errorf("watch interval must be positive: %s", conf.WatchInterval)
+		}
+	}
+
+	return &Watcher{
+		pool:     pool,
+		interval: interval,
+		heads:    make(map[string]string),
+	}, nil
+}
+
+// Watch lists the open merge requests of the projects every interval, and
+// calls cb with a ReviewEvent for the ones that are new or have a new head.
+// The failed listings are logged and retried on the next interval.
+func (w *Watcher) Watch(ctx context.Context, cb lookout.EventHandler) error {
+	ctxlog.Get(ctx).With(log.Fields{"provider": Provider}).Infof("Starting watcher")
+
+	for {
+		for project, repoURL := range w.pool.Projects() {
+			err := w.watchProject(ctx, project, repoURL, cb)
+			if lookout.NoErrStopWatcher.Is(err) {
+				return nil
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(w.interval):
+		}
+	}
+}
+
+func (w *Watcher) watchProject(
+	ctx context.Context,
+	project, repoURL string,
+	cb lookout.EventHandler,
+) error {
+	ctx, logger := ctxlog.WithLogFields(ctx, log.Fields{"project": project})
+
+	client, ok := w.pool.Client(project)
+	if !ok {
+		return fmt.Errorf("client for %s doesn't exists", project)
+	}
+
+	mrs, err := client.openMergeRequests(ctx, project)
+	if err != nil {
+		logger.Errorf(err, "can't list the merge requests")
+		return nil
+	}
+
+	for _, mr := range mrs {
+		key := fmt.Sprintf("%s!%d", project, mr.IID)
+		if w.heads[key] == mr.SHA {
+			continue
+		}
+
+		ctx, _ := ctxlog.WithLogFields(ctx, log.Fields{"mr": mr.IID})
+		if err := cb(ctx, castMergeRequest(repoURL, mr)); err != nil {
+			return err
+		}
+
+		w.heads[key] = mr.SHA
+	}
+
+	return nil
+}
+
+// castMergeRequest returns the ReviewEvent of a merge request of the
+// project with the given repository URL
+func castMergeRequest(repoURL string, mr *mergeRequest) *lookout.ReviewEvent {
+	e := &lookout.ReviewEvent{}
+	e.Provider = Provider
+	e.InternalID = strconv.Itoa(mr.ID)
+	e.CreatedAt = mr.CreatedAt
+	e.UpdatedAt = mr.UpdatedAt
+	e.Number = uint32(mr.IID)
+	e.RepositoryID = uint32(mr.ProjectID)
+	e.IsMergeable = mr.MergeStatus == mergeableStatus
+
+	e.Base = lookout.ReferencePointer{
+		InternalRepositoryURL: repoURL,
+		ReferenceName:         plumbing.ReferenceName(fmt.Sprintf("refs/heads/%s", mr.TargetBranch)),
+		Hash:                  mr.DiffRefs.BaseSHA,
+	}
+	e.Head = lookout.ReferencePointer{
+		InternalRepositoryURL: repoURL,
+		ReferenceName:         plumbing.ReferenceName(fmt.Sprintf("refs/merge-requests/%d/head", mr.IID)),
+		Hash:                  mr.SHA,
+	}
+
+	// the branches of the merge requests from forks are not in the
+	// repository, their head is
+	e.Source = e.Head
+	if mr.SourceProjectID == mr.ProjectID {
+		e.Source = lookout.ReferencePointer{
+			InternalRepositoryURL: repoURL,
+			ReferenceName:         plumbing.ReferenceName(fmt.Sprintf("refs/heads/%s", mr.SourceBranch)),
+			Hash:                  mr.SHA,
+		}
+	}
+
+	return e
+}
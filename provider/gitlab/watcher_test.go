@@ -0,0 +1,100 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/src-d/lookout"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher(t *testing.T) {
+	require := require.New(t)
+
+	var mutex sync.Mutex
+	mrs := []*mergeRequest{
+		{ID: 1, IID: 1, ProjectID: 7, SourceProjectID: 7, SourceBranch: "feature",
+			TargetBranch: "master", SHA: hash2, MergeStatus: mergeableStatus,
+			DiffRefs: diffRefs{BaseSHA: hash1}},
+		{ID: 2, IID: 2, ProjectID: 7, SourceProjectID: 8, SourceBranch: "fork",
+			TargetBranch: "master", SHA: hash1, DiffRefs: diffRefs{BaseSHA: hash1}},
+	}
+
+	var listings int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal("/api/v4/projects/foo%2Fbar/merge_requests", r.URL.EscapedPath())
+		require.Equal("opened", r.URL.Query().Get("state"))
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		listings++
+		if listings == 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// the head of the first merge request changes after the first
+		// successful listing
+		if listings == 3 {
+			mrs[0].SHA = hash1
+		}
+
+		json.NewEncoder(w).Encode(mrs)
+	}))
+	defer server.Close()
+
+	pool, err := NewClientPool(map[string]ClientConfig{
+		"https://gitlab.example.com/foo/bar.git": ClientConfig{URL: server.URL},
+	})
+	require.NoError(err)
+
+	client, _ := pool.Client("foo/bar")
+	client.retries = 0
+
+	w, err := NewWatcher(pool, ProviderConfig{WatchInterval: "1ms"})
+	require.NoError(err)
+
+	var events []*lookout.ReviewEvent
+	err = w.Watch(context.Background(), func(ctx context.Context, e lookout.Event) error {
+		events = append(events, e.(*lookout.ReviewEvent))
+		if len(events) == 3 {
+			return lookout.NoErrStopWatcher.New()
+		}
+
+		return nil
+	})
+	require.NoError(err)
+
+	require.Len(events, 3)
+	require.Equal(uint32(1), events[0].Number)
+	require.Equal("refs/merge-requests/1/head", events[0].Head.ReferenceName.String())
+	require.Equal(hash2, events[0].Head.Hash)
+	require.Equal("refs/heads/master", events[0].Base.ReferenceName.String())
+	require.Equal(hash1, events[0].Base.Hash)
+	require.Equal("refs/heads/feature", events[0].Source.ReferenceName.String())
+	require.Equal("https://gitlab.example.com/foo/bar.git", events[0].Head.InternalRepositoryURL)
+	require.True(events[0].IsMergeable)
+
+	require.Equal(uint32(2), events[1].Number)
+	require.Equal("refs/merge-requests/2/head", events[1].Source.ReferenceName.String())
+	require.False(events[1].IsMergeable)
+
+	require.Equal(uint32(1), events[2].Number)
+	require.Equal(hash1, events[2].Head.Hash)
+}
+
+func TestNewWatcherBadInterval(t *testing.T) {
+	require := require.New(t)
+
+	_, err := NewWatcher(&ClientPool{}, ProviderConfig{WatchInterval: "1 minute"})
+	require.Error(err)
+
+	_, err = NewWatcher(&ClientPool{}, ProviderConfig{WatchInterval: "-1m"})
+	require.Error(err)
+}
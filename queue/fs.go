@@ -0,0 +1,195 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/src-d/lookout"
+
+	"gopkg.in/src-d/lookout-sdk.v0/pb"
+)
+
+// FSQueue is an EventQueue keeping each event as a file in a directory until
+// it's acknowledged, so the events survive restarts: the ones enqueued, or
+// delivered and not acknowledged, when the process stops are delivered again
+// by the FSQueue of the same directory on the next start.
+type FSQueue struct {
+	dir string
+	mem *MemoryQueue
+
+	mu sync.Mutex
+	// files holds the file of the event of each pending delivery
+	files map[string]string
+}
+
+var _ EventQueue = &FSQueue{}
+
+// fsEvent is an event of a FSQueue, with the name of its file
+type fsEvent struct {
+	lookout.Event
+	file string
+}
+
+// fsEntry is the content of the file of an event
+type fsEntry struct {
+	// EventType is the type of the encoded Event
+	EventType lookout.EventType `json:"event_type"`
+	// Event is the event, encoded as protobuf
+	Event []byte `json:"event"`
+}
+
+type protoEvent interface {
+	lookout.Event
+	Marshal() ([]byte, error)
+}
+
+const (
+	fsEventExt = ".json"
+	fsTmpExt   = ".tmp"
+)
+
+// NewFSQueue returns a new FSQueue keeping the events in dir, with the events
+// already in it ready to be delivered, oldest first. redeliverAfter is the
+// same as for NewMemoryQueue.
+func NewFSQueue(dir string, redeliverAfter time.Duration) (*FSQueue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	q := &FSQueue{
+		dir:   dir,
+		mem:   NewMemoryQueue(redeliverAfter),
+		files: make(map[string]string),
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), fsEventExt) {
+			continue
+		}
+
+		e, err := q.read(f.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		q.mem.Enqueue(context.Background(), &fsEvent{Event: e, file: f.Name()})
+	}
+
+	return q, nil
+}
+
+// Enqueue implements the EventQueue interface. The event is written to its
+// file before returning.
+func (q *FSQueue) Enqueue(ctx context.Context, e lookout.Event) error {
+	pe, ok := e.(protoEvent)
+	if !ok {
+		return fmt.Errorf("unsupported event type: %T", e)
+	}
+
+	data, err := pe.Marshal()
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(&fsEntry{EventType: e.Type(), Event: data})
+	if err != nil {
+		return err
+	}
+
+	// the files are written under a temporary name and renamed, so a
+	// partially written file is never read
+	name := fmt.Sprintf("%d-%s%s", time.Now().UnixNano(), e.ID().String(), fsEventExt)
+	tmp := filepath.Join(q.dir, name+fsTmpExt)
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, filepath.Join(q.dir, name)); err != nil {
+		return err
+	}
+
+	return q.mem.Enqueue(ctx, &fsEvent{Event: e, file: name})
+}
+
+// Dequeue implements the EventQueue interface
+func (q *FSQueue) Dequeue(ctx context.Context) (*Delivery, error) {
+	d, err := q.mem.Dequeue(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fe := d.Event.(*fsEvent)
+
+	q.mu.Lock()
+	q.files[d.ID] = fe.file
+	q.mu.Unlock()
+
+	return &Delivery{ID: d.ID, Event: fe.Event, Attempts: d.Attempts}, nil
+}
+
+// Ack implements the EventQueue interface. The file of the event is removed.
+func (q *FSQueue) Ack(ctx context.Context, id string) error {
+	file := q.release(id)
+	if err := q.mem.Ack(ctx, id); err != nil {
+		return err
+	}
+
+	err := os.Remove(filepath.Join(q.dir, file))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+// Nack implements the EventQueue interface
+func (q *FSQueue) Nack(ctx context.Context, id string) error {
+	q.release(id)
+	return q.mem.Nack(ctx, id)
+}
+
+// release forgets the delivery, returning the file of its event
+func (q *FSQueue) release(id string) string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	file := q.files[id]
+	delete(q.files, id)
+	return file
+}
+
+// read returns the event of the file with the given name
+func (q *FSQueue) read(name string) (lookout.Event, error) {
+	content, err := ioutil.ReadFile(filepath.Join(q.dir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	var entry fsEntry
+	if err := json.Unmarshal(content, &entry); err != nil {
+		return nil, fmt.Errorf("bad queued event %s: %s", name, err)
+	}
+
+	switch entry.EventType {
+	case pb.ReviewEventType:
+		e := &lookout.ReviewEvent{}
+		return e, e.Unmarshal(entry.Event)
+	case pb.PushEventType:
+		e := &lookout.PushEvent{}
+		return e, e.Unmarshal(entry.Event)
+	default:
+		return nil, fmt.Errorf("unsupported event type of queued event %s: %d", name, entry.EventType)
+	}
+}
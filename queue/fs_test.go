@@ -0,0 +1,82 @@
+package queue
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFSQueueRestart(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "lookout-queue")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	q, err := NewFSQueue(dir, 0)
+	require.NoError(err)
+
+	require.NoError(q.Enqueue(ctx, newEvent(1)))
+	require.NoError(q.Enqueue(ctx, newEvent(2)))
+	require.NoError(q.Enqueue(ctx, newEvent(3)))
+
+	d1, err := q.Dequeue(ctx)
+	require.NoError(err)
+	require.Equal(newEvent(1), d1.Event)
+	require.NoError(q.Ack(ctx, d1.ID))
+
+	// delivered but not acknowledged before the restart
+	d2, err := q.Dequeue(ctx)
+	require.NoError(err)
+	require.Equal(newEvent(2), d2.Event)
+
+	q, err = NewFSQueue(dir, 0)
+	require.NoError(err)
+
+	d2, err = q.Dequeue(ctx)
+	require.NoError(err)
+	require.Equal(newEvent(2), d2.Event)
+	require.NoError(q.Nack(ctx, d2.ID))
+
+	d3, err := q.Dequeue(ctx)
+	require.NoError(err)
+	require.Equal(newEvent(3), d3.Event)
+	require.NoError(q.Ack(ctx, d3.ID))
+
+	d2, err = q.Dequeue(ctx)
+	require.NoError(err)
+	require.Equal(newEvent(2), d2.Event)
+	require.NoError(q.Ack(ctx, d2.ID))
+	require.True(ErrUnknownDelivery.Is(q.Ack(ctx, d2.ID)))
+
+	// all the events were acknowledged
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(err)
+	require.Len(files, 0)
+
+	q, err = NewFSQueue(dir, 0)
+	require.NoError(err)
+
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = q.Dequeue(ctx)
+	require.Equal(context.DeadlineExceeded, err)
+}
+
+func TestFSQueueBadFile(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "lookout-queue")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(ioutil.WriteFile(dir+"/1-bad.json", []byte("bad"), 0644))
+
+	_, err = NewFSQueue(dir, 0)
+	require.Error(err)
+}
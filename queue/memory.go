@@ -0,0 +1,154 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/src-d/lookout"
+)
+
+// MemoryQueue is an EventQueue kept in memory
+type MemoryQueue struct {
+	redeliverAfter time.Duration
+
+	mu      sync.Mutex
+	nextSeq int
+	ready   []*item
+	pending map[string]*pendingItem
+	// notify is closed and replaced when a delivery becomes ready
+	notify chan struct{}
+}
+
+// item is an event in the queue, each delivery of it has a different ID, so
+// the consumers of previous deliveries can't acknowledge the last one
+type item struct {
+	seq      int
+	event    lookout.Event
+	attempts int
+}
+
+type pendingItem struct {
+	*item
+	deadline time.Time
+}
+
+var _ EventQueue = &MemoryQueue{}
+
+// NewMemoryQueue returns a new MemoryQueue. If redeliverAfter is greater than
+// zero, the deliveries not acknowledged after that time are delivered again,
+// e.g. because their consumer died.
+func NewMemoryQueue(redeliverAfter time.Duration) *MemoryQueue {
+	return &MemoryQueue{
+		redeliverAfter: redeliverAfter,
+		pending:        make(map[string]*pendingItem),
+		notify:         make(chan struct{}),
+	}
+}
+
+// Enqueue implements the EventQueue interface
+func (q *MemoryQueue) Enqueue(ctx context.Context, e lookout.Event) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.nextSeq++
+	q.push(&item{seq: q.nextSeq, event: e})
+	return nil
+}
+
+// Dequeue implements the EventQueue interface
+func (q *MemoryQueue) Dequeue(ctx context.Context) (*Delivery, error) {
+	for {
+		q.mu.Lock()
+		q.requeueExpired()
+
+		if len(q.ready) > 0 {
+			it := q.ready[0]
+			q.ready = q.ready[1:]
+			it.attempts++
+
+			d := &Delivery{
+				ID:       fmt.Sprintf("%d-%d", it.seq, it.attempts),
+				Event:    it.event,
+				Attempts: it.attempts,
+			}
+
+			p := &pendingItem{item: it}
+			if q.redeliverAfter > 0 {
+				p.deadline = time.Now().Add(q.redeliverAfter)
+			}
+			q.pending[d.ID] = p
+			q.mu.Unlock()
+
+			return d, nil
+		}
+
+		notify := q.notify
+		q.mu.Unlock()
+
+		var expire <-chan time.Time
+		if q.redeliverAfter > 0 {
+			expire = time.After(q.redeliverAfter)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-notify:
+		case <-expire:
+		}
+	}
+}
+
+// Ack implements the EventQueue interface
+func (q *MemoryQueue) Ack(ctx context.Context, id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.pending[id]; !ok {
+		return ErrUnknownDelivery.New(id)
+	}
+
+	delete(q.pending, id)
+	return nil
+}
+
+// Nack implements the EventQueue interface
+func (q *MemoryQueue) Nack(ctx context.Context, id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	p, ok := q.pending[id]
+	if !ok {
+		return ErrUnknownDelivery.New(id)
+	}
+
+	delete(q.pending, id)
+	q.push(p.item)
+	return nil
+}
+
+// push adds the item to the ready ones, waking up the waiting consumers. It
+// must be called with the mutex held.
+func (q *MemoryQueue) push(it *item) {
+	q.ready = append(q.ready, it)
+	close(q.notify)
+	q.notify = make(chan struct{})
+}
+
+// requeueExpired returns to the queue the pending deliveries past their
+// deadline. It must be called with the mutex held.
+func (q *MemoryQueue) requeueExpired() {
+	if q.redeliverAfter <= 0 {
+		return
+	}
+
+	now := time.Now()
+	for id, p := range q.pending {
+		if now.After(p.deadline) {
+			delete(q.pending, id)
+			q.push(p.item)
+		}
+	}
+}
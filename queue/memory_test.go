@@ -0,0 +1,258 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/src-d/lookout"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newEvent(n uint32) lookout.Event {
+	return &lookout.ReviewEvent{Provider: "mock", Number: n}
+}
+
+func TestMemoryQueueAck(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	q := NewMemoryQueue(0)
+
+	require.NoError(q.Enqueue(ctx, newEvent(1)))
+	require.NoError(q.Enqueue(ctx, newEvent(2)))
+
+	d1, err := q.Dequeue(ctx)
+	require.NoError(err)
+	require.Equal(newEvent(1), d1.Event)
+	require.Equal(1, d1.Attempts)
+
+	d2, err := q.Dequeue(ctx)
+	require.NoError(err)
+	require.Equal(newEvent(2), d2.Event)
+
+	require.NoError(q.Ack(ctx, d1.ID))
+	require.NoError(q.Ack(ctx, d2.ID))
+	require.True(ErrUnknownDelivery.Is(q.Ack(ctx, d1.ID)))
+
+	// acknowledged events are not delivered again
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = q.Dequeue(ctx)
+	require.Equal(context.DeadlineExceeded, err)
+}
+
+func TestMemoryQueueNack(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	q := NewMemoryQueue(0)
+
+	require.NoError(q.Enqueue(ctx, newEvent(1)))
+
+	d, err := q.Dequeue(ctx)
+	require.NoError(err)
+	require.NoError(q.Nack(ctx, d.ID))
+	require.True(ErrUnknownDelivery.Is(q.Nack(ctx, d.ID)))
+
+	redelivered, err := q.Dequeue(ctx)
+	require.NoError(err)
+	require.NotEqual(d.ID, redelivered.ID)
+	require.Equal(newEvent(1), redelivered.Event)
+	require.Equal(2, redelivered.Attempts)
+	require.NoError(q.Ack(ctx, redelivered.ID))
+}
+
+func TestMemoryQueueRedeliverAfter(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	q := NewMemoryQueue(20 * time.Millisecond)
+
+	require.NoError(q.Enqueue(ctx, newEvent(1)))
+
+	d, err := q.Dequeue(ctx)
+	require.NoError(err)
+
+	// not acknowledged in time, the event is delivered again
+	redelivered, err := q.Dequeue(ctx)
+	require.NoError(err)
+	require.Equal(newEvent(1), redelivered.Event)
+	require.Equal(2, redelivered.Attempts)
+
+	// the late consumer of the first delivery can't acknowledge the new one
+	require.True(ErrUnknownDelivery.Is(q.Ack(ctx, d.ID)))
+	require.NoError(q.Ack(ctx, redelivered.ID))
+}
+
+func TestMemoryQueueDequeueWaits(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	q := NewMemoryQueue(0)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		q.Enqueue(ctx, newEvent(1))
+	}()
+
+	d, err := q.Dequeue(ctx)
+	require.NoError(err)
+	require.Equal(newEvent(1), d.Event)
+}
+
+func TestConsume(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := NewMemoryQueue(0)
+	handler := EnqueueHandler(q)
+	require.NoError(handler(ctx, newEvent(1)))
+	require.NoError(handler(ctx, newEvent(2)))
+
+	// the first attempt to process each event fails
+	attempts := make(map[uint32]int)
+	done := make(chan struct{})
+	err := Consume(ctx, q, func(ctx context.Context, e lookout.Event) error {
+		n := e.(*lookout.ReviewEvent).Number
+		attempts[n]++
+		if attempts[n] == 1 {
+			return fmt.Errorf("failed")
+		}
+
+		if attempts[1] == 2 && attempts[2] == 2 {
+			close(done)
+			cancel()
+		}
+
+		return nil
+	}, RetryPolicy{})
+	require.NoError(err)
+
+	<-done
+	require.Equal(map[uint32]int{1: 2, 2: 2}, attempts)
+}
+
+func TestConsumeBackoff(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := NewMemoryQueue(0)
+	require.NoError(q.Enqueue(ctx, newEvent(1)))
+	require.NoError(q.Enqueue(ctx, newEvent(2)))
+
+	// the failed event is redelivered after the delay, while the next one
+	// is processed
+	var order []uint32
+	start := time.Now()
+	var redelivered time.Duration
+	err := Consume(ctx, q, func(ctx context.Context, e lookout.Event) error {
+		n := e.(*lookout.ReviewEvent).Number
+		order = append(order, n)
+		if len(order) == 1 {
+			return fmt.Errorf("failed")
+		}
+
+		if len(order) == 3 {
+			redelivered = time.Since(start)
+			cancel()
+		}
+
+		return nil
+	}, RetryPolicy{Delay: 50 * time.Millisecond})
+	require.NoError(err)
+
+	require.Equal([]uint32{1, 2, 1}, order)
+	require.True(redelivered >= 50*time.Millisecond, "redelivered after %s", redelivered)
+}
+
+func TestConsumeMaxAttempts(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := NewMemoryQueue(0)
+	require.NoError(q.Enqueue(ctx, newEvent(1)))
+	require.NoError(q.Enqueue(ctx, newEvent(2)))
+
+	// the first event always fails
+	attempts := make(map[uint32]int)
+	err := Consume(ctx, q, func(ctx context.Context, e lookout.Event) error {
+		n := e.(*lookout.ReviewEvent).Number
+		attempts[n]++
+		if n != 1 {
+			return nil
+		}
+
+		if attempts[n] == 2 {
+			cancel()
+		}
+
+		return fmt.Errorf("failed")
+	}, RetryPolicy{MaxAttempts: 2})
+	require.NoError(err)
+
+	require.Equal(map[uint32]int{1: 2, 2: 1}, attempts)
+
+	// the failed event was dropped
+	require.Len(q.ready, 0)
+	require.Len(q.pending, 0)
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	require := require.New(t)
+
+	p := RetryPolicy{Delay: time.Second}
+	require.Equal(time.Second, p.backoff(1))
+	require.Equal(2*time.Second, p.backoff(2))
+	require.Equal(4*time.Second, p.backoff(3))
+	require.Equal(maxRetryDelay, p.backoff(100))
+
+	require.Equal(time.Duration(0), RetryPolicy{}.backoff(3))
+}
+
+// watcherMock sends the events to the handler, and returns once done is
+// closed
+type watcherMock struct {
+	events []lookout.Event
+	done   chan struct{}
+}
+
+func (w *watcherMock) Watch(ctx context.Context, handler lookout.EventHandler) error {
+	for _, e := range w.events {
+		if err := handler(ctx, e); err != nil {
+			return err
+		}
+	}
+
+	<-w.done
+	return nil
+}
+
+func TestWatcher(t *testing.T) {
+	require := require.New(t)
+
+	inner := &watcherMock{
+		events: []lookout.Event{newEvent(1), newEvent(2)},
+		done:   make(chan struct{}),
+	}
+	w := &Watcher{Watcher: inner, Queue: NewMemoryQueue(0)}
+
+	// the first attempt to process the first event fails
+	attempts := make(map[uint32]int)
+	err := w.Watch(context.Background(), func(ctx context.Context, e lookout.Event) error {
+		n := e.(*lookout.ReviewEvent).Number
+		attempts[n]++
+		if n == 1 && attempts[n] == 1 {
+			return fmt.Errorf("failed")
+		}
+
+		if attempts[1] == 2 && attempts[2] == 1 {
+			close(inner.done)
+		}
+
+		return nil
+	})
+	require.NoError(err)
+	require.Equal(map[uint32]int{1: 2, 2: 1}, attempts)
+}
@@ -0,0 +1,207 @@
+// Package queue provides queues of events with at-least-once delivery, to
+// decouple the watchers producing the events from the analysis and posting
+// of their comments.
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/util/ctxlog"
+
+	"gopkg.in/src-d/go-errors.v1"
+	log "gopkg.in/src-d/go-log.v1"
+)
+
+var (
+	// ErrUnknownDelivery is returned when acknowledging a delivery that is
+	// not pending, e.g. because it was already acknowledged or redelivered.
+	ErrUnknownDelivery = errors.NewKind("unknown delivery: %s")
+)
+
+// Delivery is an event dequeued from an EventQueue. It must be acknowledged
+// with Ack once processed, or with Nack to have it redelivered.
+type Delivery struct {
+	// ID identifies the delivery in its queue, each delivery of the same
+	// event has a different ID
+	ID string
+	// Event is the event enqueued
+	Event lookout.Event
+	// Attempts is the number of times the event has been delivered,
+	// including this one
+	Attempts int
+}
+
+// EventQueue is a queue of events with at-least-once semantics: an event
+// dequeued and not acknowledged is delivered again, so the consumers must
+// tolerate processing the same event more than once, e.g. using its ID.
+//
+// NewMemoryQueue is the in-memory implementation, the events don't survive
+// restarts, and NewFSQueue keeps them in a directory, so they do.
+// Implementations backed by a broker, e.g. AMQP or Kafka, satisfy this same
+// interface.
+type EventQueue interface {
+	// Enqueue adds the event to the queue.
+	Enqueue(context.Context, lookout.Event) error
+	// Dequeue returns the next delivery, blocking until there is one or the
+	// context is done.
+	Dequeue(context.Context) (*Delivery, error)
+	// Ack acknowledges a delivery as processed, it won't be delivered again.
+	Ack(ctx context.Context, id string) error
+	// Nack returns a delivery to the queue to be delivered again.
+	Nack(ctx context.Context, id string) error
+}
+
+// EnqueueHandler returns a lookout.EventHandler that enqueues the events, to
+// be used as the handler of a lookout.Watcher.
+func EnqueueHandler(q EventQueue) lookout.EventHandler {
+	return func(ctx context.Context, e lookout.Event) error {
+		return q.Enqueue(ctx, e)
+	}
+}
+
+// maxRetryDelay is the max time to wait before redelivering a failed event
+var maxRetryDelay = 10 * time.Minute
+
+// RetryPolicy is how the events the handler fails to process are redelivered
+// by Consume.
+type RetryPolicy struct {
+	// MaxAttempts is the max number of deliveries of each event, once
+	// reached a failed event is dropped. If 0, it is redelivered until it's
+	// processed
+	MaxAttempts int
+	// Delay is the time to wait before redelivering a failed event, doubled
+	// for each following attempt up to maxRetryDelay. If 0, it is
+	// redelivered at once
+	Delay time.Duration
+}
+
+// exhausted returns whether the event of a failed delivery with the given
+// attempts must be dropped
+func (p RetryPolicy) exhausted(attempts int) bool {
+	return p.MaxAttempts > 0 && attempts >= p.MaxAttempts
+}
+
+// backoff returns the time to wait before redelivering a failed delivery
+// with the given attempts
+func (p RetryPolicy) backoff(attempts int) time.Duration {
+	d := p.Delay
+	for i := 1; i < attempts && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+
+	if d > maxRetryDelay {
+		return maxRetryDelay
+	}
+
+	return d
+}
+
+// Consume dequeues the events and calls the handler for each of them, until
+// the context is done or dequeuing fails. The deliveries are acknowledged if
+// the handler succeeds, or returned to the queue otherwise, after the
+// backoff of the retry policy. Meanwhile, the rest of the events are
+// consumed. Once the max attempts of the policy are reached, a failed event
+// is acknowledged and dropped.
+func Consume(
+	ctx context.Context,
+	q EventQueue,
+	handler lookout.EventHandler,
+	retry RetryPolicy,
+) error {
+	for {
+		d, err := q.Dequeue(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		logger := ctxlog.Get(ctx).With(log.Fields{
+			"delivery": d.ID,
+			"attempts": d.Attempts,
+		})
+
+		if err := handler(ctx, d.Event); err != nil {
+			if !retry.exhausted(d.Attempts) {
+				delay := retry.backoff(d.Attempts)
+				logger.With(log.Fields{"delay": delay}).
+					Errorf(err, "processing the event failed, it will be redelivered")
+				nack(ctx, q, d.ID, delay)
+				continue
+			}
+
+			logger.Errorf(err, "processing the event failed too many times, dropping it")
+		}
+
+		if err := q.Ack(ctx, d.ID); err != nil {
+			logger.Errorf(err, "can't acknowledge the event")
+		}
+	}
+}
+
+// nack returns the delivery to the queue once the delay passed. If the
+// context is done before, it is not returned, and it is delivered again
+// depending on the queue, e.g. after a restart for FSQueue.
+func nack(ctx context.Context, q EventQueue, id string, delay time.Duration) {
+	do := func() {
+		if err := q.Nack(ctx, id); err != nil {
+			ctxlog.Get(ctx).With(log.Fields{"delivery": id}).
+				Errorf(err, "can't return the event to the queue")
+		}
+	}
+
+	if delay <= 0 {
+		do()
+		return
+	}
+
+	go func() {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+			do()
+		}
+	}()
+}
+
+// Watcher is a lookout.Watcher that enqueues the events of another watcher,
+// and calls the handler with the events consumed from the queue, so the
+// events are redelivered if the handler fails. With a durable queue, e.g.
+// FSQueue, they are also redelivered after a restart if they weren't
+// processed.
+type Watcher struct {
+	// Watcher produces the events
+	Watcher lookout.Watcher
+	// Queue keeps the events until they are processed
+	Queue EventQueue
+	// Retry is how the events failing to be processed are redelivered
+	Retry RetryPolicy
+}
+
+var _ lookout.Watcher = &Watcher{}
+
+// Watch implements the lookout.Watcher interface. The events are consumed
+// while the inner watcher runs, the ones not consumed when it stops stay in
+// the queue.
+func (w *Watcher) Watch(ctx context.Context, handler lookout.EventHandler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- Consume(ctx, w.Queue, handler, w.Retry)
+	}()
+
+	err := w.Watcher.Watch(ctx, EnqueueHandler(w.Queue))
+	cancel()
+	if consumeErr := <-done; err == nil {
+		err = consumeErr
+	}
+
+	return err
+}
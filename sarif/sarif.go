@@ -0,0 +1,180 @@
+// Package sarif converts the comments of the analyzers to SARIF 2.1.0
+// documents, the Static Analysis Results Interchange Format.
+package sarif
+
+import (
+	"github.com/src-d/lookout"
+)
+
+const (
+	// Version is the SARIF version of the documents
+	Version = "2.1.0"
+	// Schema is the JSON schema of the documents
+	Schema = "https://schemastore.azurewebsites.net/schemas/json/sarif-2.1.0-rtm.4.json"
+)
+
+// Log is the root object of a SARIF document
+type Log struct {
+	Schema  string `json:"$schema,omitempty"`
+	Version string `json:"version"`
+	Runs    []*Run `json:"runs"`
+}
+
+// Run is the result of a single analysis tool, each analyzer is a run
+type Run struct {
+	Tool                     Tool                     `json:"tool"`
+	Results                  []*Result                `json:"results"`
+	VersionControlProvenance []*VersionControlDetails `json:"versionControlProvenance,omitempty"`
+}
+
+// Tool describes the analysis tool of a run
+type Tool struct {
+	Driver Driver `json:"driver"`
+}
+
+// Driver is the component of the tool that produced the results
+type Driver struct {
+	Name           string                 `json:"name"`
+	Version        string                 `json:"version,omitempty"`
+	InformationURI string                 `json:"informationUri,omitempty"`
+	Rules          []*ReportingDescriptor `json:"rules,omitempty"`
+}
+
+// ReportingDescriptor describes a rule of the tool
+type ReportingDescriptor struct {
+	ID      string `json:"id"`
+	HelpURI string `json:"helpUri,omitempty"`
+}
+
+// Result is a single finding
+type Result struct {
+	RuleID    string      `json:"ruleId,omitempty"`
+	RuleIndex *int        `json:"ruleIndex,omitempty"`
+	Level     string      `json:"level,omitempty"`
+	Message   Message     `json:"message"`
+	Locations []*Location `json:"locations,omitempty"`
+}
+
+// Message is the text of a result
+type Message struct {
+	Text string `json:"text"`
+}
+
+// Location is where a result was found
+type Location struct {
+	PhysicalLocation PhysicalLocation `json:"physicalLocation"`
+}
+
+// PhysicalLocation is a file, and optionally a region of it
+type PhysicalLocation struct {
+	ArtifactLocation ArtifactLocation `json:"artifactLocation"`
+	Region           *Region          `json:"region,omitempty"`
+}
+
+// ArtifactLocation is the URI of a file, relative to the repository root
+type ArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// Region is a part of a file
+type Region struct {
+	StartLine int `json:"startLine"`
+}
+
+// VersionControlDetails is the revision of the repository that was analyzed
+type VersionControlDetails struct {
+	RepositoryURI string `json:"repositoryUri"`
+	RevisionID    string `json:"revisionId,omitempty"`
+	Branch        string `json:"branch,omitempty"`
+}
+
+// Result levels
+const (
+	LevelNote    = "note"
+	LevelWarning = "warning"
+	LevelError   = "error"
+)
+
+// level returns the level of the results with the given severity. Comments
+// without severity have no level, SARIF handles them as warnings.
+func level(s lookout.Severity) string {
+	switch s {
+	case lookout.InfoSeverity:
+		return LevelNote
+	case lookout.WarningSeverity:
+		return LevelWarning
+	case lookout.ErrorSeverity:
+		return LevelError
+	default:
+		return ""
+	}
+}
+
+// FromComments returns the SARIF document with the comments of each analyzer
+// for the event, as one run per analyzer. The rules of each run are the
+// RuleIDs of its comments, global comments are results without location.
+func FromComments(e lookout.Event, aCommentsList []lookout.AnalyzerComments) *Log {
+	var provenance []*VersionControlDetails
+	if rev := e.Revision(); rev != nil && rev.Head.InternalRepositoryURL != "" {
+		provenance = []*VersionControlDetails{{
+			RepositoryURI: rev.Head.InternalRepositoryURL,
+			RevisionID:    rev.Head.Hash,
+			Branch:        rev.Head.ReferenceName.String(),
+		}}
+	}
+
+	log := &Log{
+		Schema:  Schema,
+		Version: Version,
+		Runs:    make([]*Run, 0, len(aCommentsList)),
+	}
+
+	for _, aComments := range aCommentsList {
+		run := &Run{
+			Tool: Tool{Driver: Driver{
+				Name:           aComments.Config.Name,
+				InformationURI: aComments.Config.Feedback,
+			}},
+			Results:                  make([]*Result, 0, len(aComments.Comments)),
+			VersionControlProvenance: provenance,
+		}
+
+		rules := make(map[string]int)
+		for _, c := range aComments.Comments {
+			r := &Result{
+				RuleID:  c.RuleID,
+				Level:   level(c.Severity),
+				Message: Message{Text: c.Text},
+			}
+
+			if c.RuleID != "" {
+				i, ok := rules[c.RuleID]
+				if !ok {
+					i = len(run.Tool.Driver.Rules)
+					rules[c.RuleID] = i
+					run.Tool.Driver.Rules = append(run.Tool.Driver.Rules,
+						&ReportingDescriptor{ID: c.RuleID, HelpURI: c.DetailURL})
+				}
+
+				r.RuleIndex = &i
+			}
+
+			if c.File != "" {
+				loc := &Location{PhysicalLocation: PhysicalLocation{
+					ArtifactLocation: ArtifactLocation{URI: c.File},
+				}}
+				if c.Line > 0 {
+					loc.PhysicalLocation.Region = &Region{StartLine: int(c.Line)}
+				}
+
+				r.Locations = []*Location{loc}
+			}
+
+			run.Results = append(run.Results, r)
+		}
+
+		log.Runs = append(log.Runs, run)
+	}
+
+	return log
+}
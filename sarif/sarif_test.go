@@ -0,0 +1,131 @@
+package sarif
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/src-d/lookout"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testEvent = &lookout.ReviewEvent{
+	Provider: "github",
+	CommitRevision: lookout.CommitRevision{
+		Base: lookout.ReferencePointer{
+			InternalRepositoryURL: "https://github.com/foo/bar",
+			ReferenceName:         "refs/heads/master",
+			Hash:                  "f67e5455a86d0f2a366f1b980489fac77a373bd0",
+		},
+		Head: lookout.ReferencePointer{
+			InternalRepositoryURL: "https://github.com/foo/bar",
+			ReferenceName:         "refs/pull/42/head",
+			Hash:                  "02801e1a27a0a906d59530aeb81f4cd137f2c717",
+		},
+	},
+}
+
+var testComments = []lookout.AnalyzerComments{
+	lookout.AnalyzerComments{
+		Config: lookout.AnalyzerConfig{Name: "sec", Feedback: "https://sec.example.com"},
+		Comments: []*lookout.Comment{
+			&lookout.Comment{Text: "global"},
+			&lookout.Comment{File: "main.go", Text: "file", RuleID: "SEC001",
+				DetailURL: "https://sec.example.com/SEC001"},
+			&lookout.Comment{File: "main.go", Line: 5, Text: "line", RuleID: "SEC002",
+				Severity: lookout.ErrorSeverity},
+			&lookout.Comment{File: "util.go", Line: 7, Text: "again", RuleID: "SEC001",
+				Severity: lookout.InfoSeverity},
+		},
+	},
+	lookout.AnalyzerComments{
+		Config: lookout.AnalyzerConfig{Name: "style"},
+		Comments: []*lookout.Comment{
+			&lookout.Comment{File: "main.go", Line: 1, Text: "style", Severity: lookout.WarningSeverity},
+		},
+	},
+}
+
+func TestFromComments(t *testing.T) {
+	require := require.New(t)
+
+	log := FromComments(testEvent, testComments)
+	require.Equal(Version, log.Version)
+	require.Len(log.Runs, 2)
+
+	run := log.Runs[0]
+	require.Equal("sec", run.Tool.Driver.Name)
+	require.Equal("https://sec.example.com", run.Tool.Driver.InformationURI)
+	require.Equal([]*ReportingDescriptor{
+		{ID: "SEC001", HelpURI: "https://sec.example.com/SEC001"},
+		{ID: "SEC002"},
+	}, run.Tool.Driver.Rules)
+	require.Equal([]*VersionControlDetails{{
+		RepositoryURI: "https://github.com/foo/bar",
+		RevisionID:    "02801e1a27a0a906d59530aeb81f4cd137f2c717",
+		Branch:        "refs/pull/42/head",
+	}}, run.VersionControlProvenance)
+
+	require.Len(run.Results, 4)
+
+	global := run.Results[0]
+	require.Equal("global", global.Message.Text)
+	require.Empty(global.RuleID)
+	require.Nil(global.RuleIndex)
+	require.Empty(global.Level)
+	require.Empty(global.Locations)
+
+	file := run.Results[1]
+	require.Equal("SEC001", file.RuleID)
+	require.Equal(0, *file.RuleIndex)
+	require.Equal("main.go", file.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	require.Nil(file.Locations[0].PhysicalLocation.Region)
+
+	line := run.Results[2]
+	require.Equal(1, *line.RuleIndex)
+	require.Equal(LevelError, line.Level)
+	require.Equal(5, line.Locations[0].PhysicalLocation.Region.StartLine)
+
+	again := run.Results[3]
+	require.Equal(0, *again.RuleIndex)
+	require.Equal(LevelNote, again.Level)
+
+	style := log.Runs[1]
+	require.Equal("style", style.Tool.Driver.Name)
+	require.Empty(style.Tool.Driver.Rules)
+	require.Equal(LevelWarning, style.Results[0].Level)
+}
+
+func TestFromCommentsRequiredFields(t *testing.T) {
+	require := require.New(t)
+
+	b, err := json.Marshal(FromComments(testEvent, testComments))
+	require.NoError(err)
+
+	var doc map[string]interface{}
+	require.NoError(json.Unmarshal(b, &doc))
+
+	require.Equal("2.1.0", doc["version"])
+	runs := doc["runs"].([]interface{})
+	require.Len(runs, 2)
+	for _, r := range runs {
+		run := r.(map[string]interface{})
+		driver := run["tool"].(map[string]interface{})["driver"].(map[string]interface{})
+		require.NotEmpty(driver["name"])
+
+		for _, res := range run["results"].([]interface{}) {
+			message := res.(map[string]interface{})["message"].(map[string]interface{})
+			require.NotEmpty(message["text"])
+		}
+	}
+}
+
+func TestFromCommentsEmpty(t *testing.T) {
+	require := require.New(t)
+
+	b, err := json.Marshal(FromComments(testEvent, nil))
+	require.NoError(err)
+
+	// runs is required even if there are no analyzers
+	require.Contains(string(b), `"runs":[]`)
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/store"
+	"github.com/src-d/lookout/util/ctxlog"
+
+	log "gopkg.in/src-d/go-log.v1"
+)
+
+// DeadLetterPoster is a lookout.Poster that writes the failed attempts to
+// post comments to a DeadLetterStore, so they are not lost and can be
+// re-driven with Redrive. Deferred posts are not written, nor the ones
+// failing with a permanent error. The parts of the post done before failing
+// are recorded in the dead letter, so Redrive doesn't post them again.
+type DeadLetterPoster struct {
+	lookout.Poster
+	Store store.DeadLetterStore
+	// IsPermanent returns true for the errors that would happen again when
+	// re-driven, e.g. an unsupported event. If nil, all the errors are
+	// considered transient
+	IsPermanent func(error) bool
+}
+
+var _ lookout.Poster = &DeadLetterPoster{}
+
+// Post implements the lookout.Poster interface
+func (p *DeadLetterPoster) Post(ctx context.Context, e lookout.Event,
+	comments []lookout.AnalyzerComments) error {
+	parts := lookout.GetPostedParts(ctx)
+	if parts == nil {
+		parts = lookout.NewPostedParts(nil)
+		ctx = lookout.WithPostedParts(ctx, parts)
+	}
+
+	err := p.Poster.Post(ctx, e, comments)
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := err.(*lookout.PostDeferredError); ok {
+		return err
+	}
+
+	if p.IsPermanent != nil && p.IsPermanent(err) {
+		return err
+	}
+
+	d, dErr := store.NewDeadLetter(e, comments, err)
+	if dErr == nil {
+		d.PostedParts = parts.Keys()
+		dErr = p.Store.Put(ctx, d)
+	}
+
+	if dErr != nil {
+		ctxlog.Get(ctx).Errorf(dErr, "can't write the dead letter of the failed post")
+	} else {
+		ctxlog.Get(ctx).With(log.Fields{"dead-letter": d.ID}).
+			Warningf("posting failed, dead letter written")
+	}
+
+	return err
+}
+
+// Redrive posts again, using the given poster, the comments of the dead
+// letters in the store, skipping the parts already posted. The dead letters
+// posted successfully are deleted, the rest are kept with the parts posted so
+// far. It returns the number of dead letters posted.
+func Redrive(ctx context.Context, s store.DeadLetterStore, p lookout.Poster) (int, error) {
+	letters, err := s.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	posted := 0
+	for _, d := range letters {
+		logger := ctxlog.Get(ctx).With(log.Fields{"dead-letter": d.ID})
+
+		e, err := d.DecodeEvent()
+		if err != nil {
+			logger.Errorf(err, "can't decode the event of the dead letter")
+			continue
+		}
+
+		parts := lookout.NewPostedParts(d.PostedParts)
+		if err := p.Post(lookout.WithPostedParts(ctx, parts), e, d.Comments); err != nil {
+			logger.Errorf(err, "posting the dead letter failed")
+
+			d.PostedParts = parts.Keys()
+			if err := s.Put(ctx, d); err != nil {
+				return posted, err
+			}
+
+			continue
+		}
+
+		if err := s.Delete(ctx, d.ID); err != nil {
+			return posted, err
+		}
+
+		posted++
+		logger.Infof("dead letter posted")
+	}
+
+	return posted, nil
+}
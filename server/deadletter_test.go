@@ -0,0 +1,215 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/store"
+
+	"github.com/stretchr/testify/require"
+)
+
+type FailingPosterMock struct {
+	PosterMock
+	err error
+}
+
+func (p *FailingPosterMock) Post(ctx context.Context, e lookout.Event, aCommentsList []lookout.AnalyzerComments) error {
+	if p.err != nil {
+		return p.err
+	}
+
+	return p.PosterMock.Post(ctx, e, aCommentsList)
+}
+
+var deadLetterEvent = &lookout.ReviewEvent{
+	Provider:   "Mock",
+	InternalID: "internal-id",
+	Number:     42,
+	CommitRevision: lookout.CommitRevision{
+		Base: lookout.ReferencePointer{
+			InternalRepositoryURL: "file:///test",
+			ReferenceName:         "master",
+			Hash:                  "base-hash",
+		},
+		Head: lookout.ReferencePointer{
+			InternalRepositoryURL: "file:///test",
+			ReferenceName:         "refs/pull/42/head",
+			Hash:                  "head-hash",
+		},
+	},
+}
+
+var deadLetterComments = []lookout.AnalyzerComments{
+	lookout.AnalyzerComments{
+		Config: lookout.AnalyzerConfig{Name: "mock"},
+		Comments: []*lookout.Comment{
+			&lookout.Comment{File: "main.go", Line: 5, Text: "comment"},
+		},
+	},
+}
+
+func newDeadLetterStore(t *testing.T) (*store.FSDeadLetterStore, func()) {
+	dir, err := ioutil.TempDir("", "lookout-dead-letters")
+	require.NoError(t, err)
+
+	return store.NewFSDeadLetterStore(dir), func() { os.RemoveAll(dir) }
+}
+
+func TestDeadLetterPosterWriteOnFailure(t *testing.T) {
+	require := require.New(t)
+
+	s, cleanup := newDeadLetterStore(t)
+	defer cleanup()
+
+	poster := &DeadLetterPoster{
+		Poster: &FailingPosterMock{err: fmt.Errorf("github is down")},
+		Store:  s,
+	}
+
+	err := poster.Post(context.TODO(), deadLetterEvent, deadLetterComments)
+	require.EqualError(err, "github is down")
+
+	letters, err := s.List(context.TODO())
+	require.NoError(err)
+	require.Len(letters, 1)
+	require.Equal("github is down", letters[0].Error)
+	require.Equal(deadLetterComments, letters[0].Comments)
+
+	e, err := letters[0].DecodeEvent()
+	require.NoError(err)
+	require.Equal(deadLetterEvent, e)
+}
+
+func TestDeadLetterPosterNoFailure(t *testing.T) {
+	require := require.New(t)
+
+	s, cleanup := newDeadLetterStore(t)
+	defer cleanup()
+
+	poster := &DeadLetterPoster{Poster: &FailingPosterMock{}, Store: s}
+	err := poster.Post(context.TODO(), deadLetterEvent, deadLetterComments)
+	require.NoError(err)
+
+	letters, err := s.List(context.TODO())
+	require.NoError(err)
+	require.Len(letters, 0)
+}
+
+func TestRedrive(t *testing.T) {
+	require := require.New(t)
+
+	s, cleanup := newDeadLetterStore(t)
+	defer cleanup()
+
+	failing := &FailingPosterMock{err: fmt.Errorf("github is down")}
+	poster := &DeadLetterPoster{Poster: failing, Store: s}
+	poster.Post(context.TODO(), deadLetterEvent, deadLetterComments)
+
+	// still failing, the dead letter is kept
+	n, err := Redrive(context.TODO(), s, failing)
+	require.NoError(err)
+	require.Equal(0, n)
+
+	letters, err := s.List(context.TODO())
+	require.NoError(err)
+	require.Len(letters, 1)
+
+	failing.err = nil
+	n, err = Redrive(context.TODO(), s, failing)
+	require.NoError(err)
+	require.Equal(1, n)
+	require.Equal(deadLetterComments[0].Comments, failing.PopComments())
+
+	letters, err = s.List(context.TODO())
+	require.NoError(err)
+	require.Len(letters, 0)
+}
+
+func TestDeadLetterPosterPermanentError(t *testing.T) {
+	require := require.New(t)
+
+	s, cleanup := newDeadLetterStore(t)
+	defer cleanup()
+
+	unsupported := fmt.Errorf("event not supported")
+	poster := &DeadLetterPoster{
+		Poster:      &FailingPosterMock{err: unsupported},
+		Store:       s,
+		IsPermanent: func(err error) bool { return err == unsupported },
+	}
+
+	err := poster.Post(context.TODO(), deadLetterEvent, deadLetterComments)
+	require.Equal(unsupported, err)
+
+	// it would fail again, there is no dead letter
+	letters, err := s.List(context.TODO())
+	require.NoError(err)
+	require.Len(letters, 0)
+}
+
+// partsPosterMock posts its parts in order, skipping the ones already posted,
+// and fails on failAt
+type partsPosterMock struct {
+	PosterMock
+	parts  []string
+	failAt string
+	posted []string
+}
+
+func (p *partsPosterMock) Post(ctx context.Context, e lookout.Event, aCommentsList []lookout.AnalyzerComments) error {
+	done := lookout.GetPostedParts(ctx)
+	for _, part := range p.parts {
+		if done.Has(part) {
+			continue
+		}
+
+		if part == p.failAt {
+			return fmt.Errorf("can't post %s", part)
+		}
+
+		p.posted = append(p.posted, part)
+		done.Add(part)
+	}
+
+	return nil
+}
+
+func TestRedrivePostedParts(t *testing.T) {
+	require := require.New(t)
+
+	s, cleanup := newDeadLetterStore(t)
+	defer cleanup()
+
+	mock := &partsPosterMock{parts: []string{"a", "b", "c"}, failAt: "b"}
+	poster := &DeadLetterPoster{Poster: mock, Store: s}
+	require.Error(poster.Post(context.TODO(), deadLetterEvent, deadLetterComments))
+
+	letters, err := s.List(context.TODO())
+	require.NoError(err)
+	require.Len(letters, 1)
+	require.Equal([]string{"a"}, letters[0].PostedParts)
+
+	// the parts posted on each attempt are kept
+	mock.failAt = "c"
+	n, err := Redrive(context.TODO(), s, mock)
+	require.NoError(err)
+	require.Equal(0, n)
+
+	letters, err = s.List(context.TODO())
+	require.NoError(err)
+	require.Len(letters, 1)
+	require.Equal([]string{"a", "b"}, letters[0].PostedParts)
+
+	mock.failAt = ""
+	n, err = Redrive(context.TODO(), s, mock)
+	require.NoError(err)
+	require.Equal(1, n)
+
+	// each part is posted once
+	require.Equal([]string{"a", "b", "c"}, mock.posted)
+}
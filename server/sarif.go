@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/sarif"
+	"github.com/src-d/lookout/util/ctxlog"
+)
+
+// SARIFSink receives the SARIF documents of the analyzed events
+type SARIFSink interface {
+	// Write stores the SARIF document with the comments for the event
+	Write(ctx context.Context, e lookout.Event, log *sarif.Log) error
+}
+
+// FSSARIFSink is a SARIFSink writing each document to a file in a directory,
+// named after the ID of the event
+type FSSARIFSink struct {
+	Dir string
+}
+
+var _ SARIFSink = &FSSARIFSink{}
+
+// NewFSSARIFSink returns a new FSSARIFSink writing to the given directory
+func NewFSSARIFSink(dir string) *FSSARIFSink {
+	return &FSSARIFSink{Dir: dir}
+}
+
+// Write implements the SARIFSink interface
+func (s *FSSARIFSink) Write(ctx context.Context, e lookout.Event, log *sarif.Log) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.Dir, e.ID().String()+".sarif")
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// SARIFPoster is a lookout.Poster that exports the comments as SARIF to a
+// SARIFSink, in addition to posting them with the wrapped Poster. If the
+// wrapped Poster is nil, the comments are only exported.
+type SARIFPoster struct {
+	lookout.Poster
+	Sink SARIFSink
+}
+
+var _ lookout.Poster = &SARIFPoster{}
+
+// Post implements the lookout.Poster interface. When the comments are also
+// posted, failing to export them is logged but doesn't make posting fail.
+func (p *SARIFPoster) Post(ctx context.Context, e lookout.Event,
+	comments []lookout.AnalyzerComments) error {
+	err := p.Sink.Write(ctx, e, sarif.FromComments(e, comments))
+	if p.Poster == nil {
+		return err
+	}
+
+	if err != nil {
+		ctxlog.Get(ctx).Errorf(err, "can't export the comments as SARIF")
+	}
+
+	return p.Poster.Post(ctx, e, comments)
+}
+
+// Status implements the lookout.Poster interface
+func (p *SARIFPoster) Status(ctx context.Context, e lookout.Event,
+	status lookout.AnalysisStatus) error {
+	if p.Poster == nil {
+		return nil
+	}
+
+	return p.Poster.Status(ctx, e, status)
+}
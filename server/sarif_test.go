@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/src-d/lookout"
+	"github.com/src-d/lookout/sarif"
+
+	"github.com/stretchr/testify/require"
+)
+
+type failingSARIFSink struct{}
+
+func (failingSARIFSink) Write(context.Context, lookout.Event, *sarif.Log) error {
+	return fmt.Errorf("sink error")
+}
+
+func newSARIFDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "lookout-sarif")
+	require.NoError(t, err)
+
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestSARIFPoster(t *testing.T) {
+	require := require.New(t)
+
+	dir, cleanup := newSARIFDir(t)
+	defer cleanup()
+
+	mock := &PosterMock{}
+	p := &SARIFPoster{Poster: mock, Sink: NewFSSARIFSink(dir)}
+
+	ctx := context.Background()
+	require.NoError(p.Post(ctx, deadLetterEvent, deadLetterComments))
+	require.Len(mock.PopComments(), 1)
+
+	require.NoError(p.Status(ctx, deadLetterEvent, lookout.SuccessAnalysisStatus))
+	require.Equal(lookout.SuccessAnalysisStatus, mock.PopStatus())
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, deadLetterEvent.ID().String()+".sarif"))
+	require.NoError(err)
+
+	var log sarif.Log
+	require.NoError(json.Unmarshal(data, &log))
+	require.Equal(sarif.Version, log.Version)
+	require.Len(log.Runs, 1)
+	require.Equal("mock", log.Runs[0].Tool.Driver.Name)
+	require.Len(log.Runs[0].Results, 1)
+	require.Equal("comment", log.Runs[0].Results[0].Message.Text)
+}
+
+func TestSARIFPosterOnly(t *testing.T) {
+	require := require.New(t)
+
+	dir, cleanup := newSARIFDir(t)
+	defer cleanup()
+
+	p := &SARIFPoster{Sink: NewFSSARIFSink(dir)}
+
+	ctx := context.Background()
+	require.NoError(p.Post(ctx, deadLetterEvent, deadLetterComments))
+	require.NoError(p.Status(ctx, deadLetterEvent, lookout.SuccessAnalysisStatus))
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(err)
+	require.Len(files, 1)
+
+	p.Sink = failingSARIFSink{}
+	require.EqualError(p.Post(ctx, deadLetterEvent, deadLetterComments), "sink error")
+}
+
+func TestSARIFPosterSinkError(t *testing.T) {
+	require := require.New(t)
+
+	mock := &PosterMock{}
+	p := &SARIFPoster{Poster: mock, Sink: failingSARIFSink{}}
+
+	// the comments are posted anyway
+	require.NoError(p.Post(context.Background(), deadLetterEvent, deadLetterComments))
+	require.Len(mock.PopComments(), 1)
+}
@@ -3,7 +3,9 @@ package server
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/src-d/lookout"
 	"github.com/src-d/lookout/store"
@@ -30,16 +32,54 @@ type Server struct {
 	analyzers  map[string]lookout.Analyzer
 	eventOp    store.EventOperator
 	commentOp  store.CommentOperator
+	orgConfig  lookout.OrgConfigGetter
+	languages  lookout.LanguageGetter
+	deferred   store.DeferredPostStore
+	// deferredInterval is how often the deferred posts are checked
+	deferredInterval time.Duration
+	// redeliverFailed returns the errors processing the events, see
+	// SetRedeliverFailed
+	redeliverFailed bool
 }
 
 // NewServer creates new Server
 func NewServer(w lookout.Watcher, p lookout.Poster, fileGetter lookout.FileGetter,
 	analyzers map[string]lookout.Analyzer, eventOp store.EventOperator, commentOp store.CommentOperator) *Server {
-	return &Server{w, p, fileGetter, analyzers, eventOp, commentOp}
+	return &Server{w, p, fileGetter, analyzers, eventOp, commentOp, nil, nil,
+		store.NewMemDeferredPostStore(), deferredPostsInterval, false}
+}
+
+// SetOrgConfigGetter sets the getter for the organization-wide configuration,
+// that is merged under the repository .lookout.yml
+func (s *Server) SetOrgConfigGetter(g lookout.OrgConfigGetter) {
+	s.orgConfig = g
+}
+
+// SetLanguageGetter sets the getter for the languages of the repositories,
+// used to skip the analyzers without any of them, see
+// lookout.AnalyzerConfig.Languages
+func (s *Server) SetLanguageGetter(g lookout.LanguageGetter) {
+	s.languages = g
+}
+
+// SetDeferredPostStore sets the store of the posts deferred by the poster,
+// by default they are kept in memory
+func (s *Server) SetDeferredPostStore(st store.DeferredPostStore) {
+	s.deferred = st
+}
+
+// SetRedeliverFailed sets whether the errors processing the events are
+// returned to the watcher, e.g. a queue.Watcher, so it delivers them again.
+// By default, the events that fail are marked as failed and not processed
+// again.
+func (s *Server) SetRedeliverFailed(redeliver bool) {
+	s.redeliverFailed = redeliver
 }
 
 // Run starts server
 func (s *Server) Run(ctx context.Context) error {
+	go s.runDeferredPosts(ctx)
+
 	errCh := make(chan error, 1)
 	for {
 		go func() {
@@ -83,6 +123,23 @@ func (s *Server) handleEvent(ctx context.Context, e lookout.Event) error {
 		return nil
 	}
 
+	// the deferred post of a pending event is lost if the server restarted
+	// with a store in memory, then it's processed again
+	if status == models.EventStatusPending {
+		_, ok, err := s.deferred.Get(ctx, e.ID().String())
+		if err != nil {
+			logger.Errorf(err, "can't get the deferred post")
+			return err
+		}
+
+		if ok {
+			logger.Infof("event posting deferred, skipping...")
+			return nil
+		}
+
+		logger.Infof("event posting deferred but its post was lost, processing it again")
+	}
+
 	switch ev := e.(type) {
 	case *lookout.ReviewEvent:
 		err = s.HandleReview(ctx, ev)
@@ -92,10 +149,25 @@ func (s *Server) handleEvent(ctx context.Context, e lookout.Event) error {
 		logger.Debugf("ignoring unsupported event: %s", ev)
 	}
 
+	if _, ok := err.(*lookout.PostDeferredError); ok {
+		status = models.EventStatusPending
+		if updateErr := s.eventOp.UpdateStatus(ctx, e, status); updateErr != nil {
+			logger.Errorf(updateErr, "can't update status in database")
+		}
+
+		return nil
+	}
+
 	if err == nil {
 		status = models.EventStatusProcessed
 	} else {
 		logger.Errorf(err, "event processing failed")
+		// the status is kept, so the event is processed again once it's
+		// redelivered
+		if s.redeliverFailed {
+			return err
+		}
+
 		status = models.EventStatusFailed
 	}
 
@@ -125,6 +197,7 @@ func (s *Server) HandleReview(ctx context.Context, e *lookout.ReviewEvent) error
 		return err
 	}
 
+	ctx = lookout.WithAnalysisStart(ctx, time.Now())
 	s.status(ctx, e, lookout.PendingAnalysisStatus)
 
 	send := func(a lookout.AnalyzerClient, settings map[string]interface{}) ([]*lookout.Comment, error) {
@@ -136,11 +209,15 @@ func (s *Server) HandleReview(ctx context.Context, e *lookout.ReviewEvent) error
 		if err != nil {
 			return nil, err
 		}
-		return resp.Comments, nil
+		return lookout.NewComments(resp.Comments), nil
 	}
-	comments := s.concurrentRequest(ctx, conf, send)
+	comments := s.concurrentRequest(ctx, conf, s.getLanguages(ctx, e), send)
 
 	if err := s.post(ctx, e, comments); err != nil {
+		if _, ok := err.(*lookout.PostDeferredError); ok {
+			return err
+		}
+
 		s.status(ctx, e, lookout.ErrorAnalysisStatus)
 		return fmt.Errorf("posting analysis failed: %s", err)
 	}
@@ -168,6 +245,7 @@ func (s *Server) HandlePush(ctx context.Context, e *lookout.PushEvent) error {
 		return err
 	}
 
+	ctx = lookout.WithAnalysisStart(ctx, time.Now())
 	s.status(ctx, e, lookout.PendingAnalysisStatus)
 
 	send := func(a lookout.AnalyzerClient, settings map[string]interface{}) ([]*lookout.Comment, error) {
@@ -179,11 +257,15 @@ func (s *Server) HandlePush(ctx context.Context, e *lookout.PushEvent) error {
 		if err != nil {
 			return nil, err
 		}
-		return resp.Comments, nil
+		return lookout.NewComments(resp.Comments), nil
 	}
-	comments := s.concurrentRequest(ctx, conf, send)
+	comments := s.concurrentRequest(ctx, conf, s.getLanguages(ctx, e), send)
 
 	if err := s.post(ctx, e, comments); err != nil {
+		if _, ok := err.(*lookout.PostDeferredError); ok {
+			return err
+		}
+
 		s.status(ctx, e, lookout.ErrorAnalysisStatus)
 		return fmt.Errorf("posting analysis failed: %s", err)
 	}
@@ -192,7 +274,100 @@ func (s *Server) HandlePush(ctx context.Context, e *lookout.PushEvent) error {
 	return nil
 }
 
+// deferredPostsInterval is how often the deferred posts are checked by
+// default
+const deferredPostsInterval = time.Minute
+
+// runDeferredPosts posts the deferred posts once they are due, until the
+// context is done
+func (s *Server) runDeferredPosts(ctx context.Context) {
+	ticker := time.NewTicker(s.deferredInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.postDeferred(ctx, time.Now())
+		}
+	}
+}
+
+// postDeferred posts the comments of the deferred posts due at the given
+// time, without analyzing their events again
+func (s *Server) postDeferred(ctx context.Context, now time.Time) {
+	posts, err := s.deferred.List(ctx)
+	if err != nil {
+		ctxlog.Get(ctx).Errorf(err, "can't list the deferred posts")
+		return
+	}
+
+	for _, d := range posts {
+		// they are sorted, soonest first
+		if d.Until.After(now) {
+			return
+		}
+
+		s.repost(ctx, d)
+	}
+}
+
+// repost posts the comments of the deferred post, updating the status of
+// its event. If the poster defers it again, it's kept with the new time.
+func (s *Server) repost(ctx context.Context, d *store.DeferredPost) {
+	e, err := d.DecodeEvent()
+	if err != nil {
+		ctxlog.Get(ctx).With(log.Fields{"deferred-post": d.ID}).
+			Errorf(err, "can't decode the event of the deferred post")
+		return
+	}
+
+	ctx, logger := ctxlog.WithLogFields(ctx, log.Fields{
+		"event-type": e.Type(),
+		"event-id":   e.ID().String(),
+	})
+	logger.Infof("posting deferred analysis")
+
+	err = s.poster.Post(ctx, e, d.Comments)
+	if deferred, ok := err.(*lookout.PostDeferredError); ok {
+		logger.With(log.Fields{"until": deferred.Until}).Infof("posting deferred again")
+
+		d.Until = deferred.Until
+		if err := s.deferred.Put(ctx, d); err != nil {
+			logger.Errorf(err, "can't save the deferred post")
+		}
+
+		return
+	}
+
+	status := models.EventStatusProcessed
+	if err != nil {
+		logger.Errorf(err, "posting deferred analysis failed")
+		s.status(ctx, e, lookout.ErrorAnalysisStatus)
+		status = models.EventStatusFailed
+	} else {
+		s.saveComments(ctx, e, d.Comments)
+		s.status(ctx, e, lookout.SuccessAnalysisStatus)
+	}
+
+	if err := s.eventOp.UpdateStatus(ctx, e, status); err != nil {
+		logger.Errorf(err, "can't update status in database")
+	}
+
+	if err := s.deferred.Delete(ctx, d.ID); err != nil {
+		logger.Errorf(err, "can't delete the deferred post")
+	}
+}
+
 func (s *Server) getConfig(ctx context.Context, e lookout.Event) (map[string]lookout.AnalyzerConfig, error) {
+	// without the organization config, the repository one still applies
+	orgConf, err := s.getOrgConfig(ctx, e)
+	if err != nil {
+		ctxlog.Get(ctx).Errorf(err, "can't get the organization config, using the repository one")
+		orgConf = nil
+	}
+
 	rev := e.Revision()
 	ctxlog.Get(ctx).Infof("getting .lookout.yml")
 	scanner, err := s.fileGetter.GetFiles(ctx, &lookout.FilesRequest{
@@ -212,7 +387,7 @@ func (s *Server) getConfig(ctx context.Context, e lookout.Event) (map[string]loo
 		return nil, err
 	}
 
-	if len(configContent) == 0 {
+	if len(configContent) == 0 && orgConf == nil {
 		ctxlog.Get(ctx).Infof("repository config is not found")
 		return nil, nil
 	}
@@ -222,6 +397,10 @@ func (s *Server) getConfig(ctx context.Context, e lookout.Event) (map[string]loo
 		return nil, fmt.Errorf("Can't parse configuration file: %s", err)
 	}
 
+	if orgConf != nil {
+		conf = mergeConfigs(*orgConf, conf)
+	}
+
 	res := make(map[string]lookout.AnalyzerConfig, len(s.analyzers))
 	for name, a := range s.analyzers {
 		res[name] = a.Config
@@ -237,7 +416,117 @@ func (s *Server) getConfig(ctx context.Context, e lookout.Event) (map[string]loo
 	return res, nil
 }
 
-func (s *Server) concurrentRequest(ctx context.Context, conf map[string]lookout.AnalyzerConfig, send reqSent) []lookout.AnalyzerComments {
+// getOrgConfig returns the organization-wide configuration, or nil if there
+// is none
+func (s *Server) getOrgConfig(ctx context.Context, e lookout.Event) (*Config, error) {
+	if s.orgConfig == nil {
+		return nil, nil
+	}
+
+	ctxlog.Get(ctx).Infof("getting organization .lookout.yml")
+	content, err := s.orgConfig.OrgConfig(ctx, e)
+	if err != nil {
+		return nil, fmt.Errorf("Can't get organization configuration: %s", err)
+	}
+
+	if len(content) == 0 {
+		return nil, nil
+	}
+
+	var conf Config
+	if err := yaml.Unmarshal(content, &conf); err != nil {
+		return nil, fmt.Errorf("Can't parse organization configuration file: %s", err)
+	}
+
+	return &conf, nil
+}
+
+// mergeConfigs merges the repository configuration over the organization one.
+// The settings of an analyzer are merged, and it is disabled as set by the
+// repository if it's listed there.
+func mergeConfigs(org, repo Config) Config {
+	var merged Config
+	byName := make(map[string]int, len(org.Analyzers))
+	for _, aConf := range org.Analyzers {
+		byName[aConf.Name] = len(merged.Analyzers)
+		merged.Analyzers = append(merged.Analyzers, aConf)
+	}
+
+	for _, aConf := range repo.Analyzers {
+		i, ok := byName[aConf.Name]
+		if !ok {
+			merged.Analyzers = append(merged.Analyzers, aConf)
+			continue
+		}
+
+		orgConf := merged.Analyzers[i]
+		if aConf.Feedback == "" {
+			aConf.Feedback = orgConf.Feedback
+		}
+		if aConf.FeedbackLinks == nil {
+			aConf.FeedbackLinks = orgConf.FeedbackLinks
+		}
+		aConf.Settings = mergeSettings(orgConf.Settings, aConf.Settings)
+		merged.Analyzers[i] = aConf
+	}
+
+	return merged
+}
+
+// getLanguages returns the languages of the repository of the event, or nil
+// if there is no LanguageGetter, no analyzer is limited to some languages or
+// they can't be retrieved
+func (s *Server) getLanguages(ctx context.Context, e lookout.Event) []string {
+	if s.languages == nil {
+		return nil
+	}
+
+	limited := false
+	for _, a := range s.analyzers {
+		if len(a.Config.Languages) > 0 {
+			limited = true
+			break
+		}
+	}
+
+	if !limited {
+		return nil
+	}
+
+	langs, err := s.languages.Languages(ctx, e)
+	if err != nil {
+		ctxlog.Get(ctx).Errorf(err, "can't get the languages of the repository, "+
+			"all the analyzers are called")
+		return nil
+	}
+
+	return langs
+}
+
+// handlesLanguages returns true if the analyzer handles any of the languages,
+// or if any of them is unknown
+func handlesLanguages(analyzer, repo []string) bool {
+	if len(analyzer) == 0 || len(repo) == 0 {
+		return true
+	}
+
+	for _, a := range analyzer {
+		for _, r := range repo {
+			if strings.EqualFold(a, r) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (s *Server) concurrentRequest(
+	ctx context.Context,
+	conf map[string]lookout.AnalyzerConfig,
+	languages []string,
+	send reqSent,
+) []lookout.AnalyzerComments {
 	var comments commentsList
 
 	var wg sync.WaitGroup
@@ -247,6 +536,11 @@ func (s *Server) concurrentRequest(ctx context.Context, conf map[string]lookout.
 			continue
 		}
 
+		if !handlesLanguages(a.Config.Languages, languages) {
+			ctxlog.Get(ctx).Infof("analyzer %s skipped, the repository has none of its languages", name)
+			continue
+		}
+
 		wg.Add(1)
 		go func(name string, a lookout.Analyzer) {
 			defer wg.Done()
@@ -259,6 +553,7 @@ func (s *Server) concurrentRequest(ctx context.Context, conf map[string]lookout.
 			cs, err := send(a.Client, settings)
 			if err != nil {
 				aLogger.Errorf(err, "analysis failed")
+				comments.AddError(a.Config, err)
 				return
 			}
 
@@ -321,10 +616,11 @@ func (s *Server) post(ctx context.Context, e lookout.Event, comments []lookout.A
 			}
 			filteredComments = append(filteredComments, c)
 		}
-		if len(filteredComments) > 0 {
+		if len(filteredComments) > 0 || cg.Error != "" {
 			filtered = append(filtered, lookout.AnalyzerComments{
 				Config:   cg.Config,
 				Comments: filteredComments,
+				Error:    cg.Error,
 			})
 		}
 	}
@@ -337,10 +633,31 @@ func (s *Server) post(ctx context.Context, e lookout.Event, comments []lookout.A
 		"comments": len(comments),
 	}).Infof("posting analysis")
 
-	if err := s.poster.Post(ctx, e, comments); err != nil {
+	err := s.poster.Post(ctx, e, comments)
+	if d, ok := err.(*lookout.PostDeferredError); ok {
+		ctxlog.Get(ctx).With(log.Fields{"until": d.Until}).Infof("posting deferred")
+
+		// the comments are kept to post them later without analyzing again
+		post, err := store.NewDeferredPost(e, comments, d.Until)
+		if err == nil {
+			err = s.deferred.Put(ctx, post)
+		}
+		if err != nil {
+			return fmt.Errorf("can't save the deferred post: %s", err)
+		}
+
+		return d
+	}
+	if err != nil {
 		return err
 	}
 
+	s.saveComments(ctx, e, comments)
+	return nil
+}
+
+// saveComments saves the posted comments of the event
+func (s *Server) saveComments(ctx context.Context, e lookout.Event, comments []lookout.AnalyzerComments) {
 	for _, cg := range comments {
 		for _, c := range cg.Comments {
 			if err := s.commentOp.Save(ctx, e, c, cg.Config.Name); err != nil {
@@ -348,8 +665,6 @@ func (s *Server) post(ctx context.Context, e lookout.Event, comments []lookout.A
 			}
 		}
 	}
-
-	return nil
 }
 
 func (s *Server) status(ctx context.Context, e lookout.Event, st lookout.AnalysisStatus) {
@@ -365,7 +680,15 @@ type commentsList struct {
 
 func (l *commentsList) Add(conf lookout.AnalyzerConfig, cs ...*lookout.Comment) {
 	l.Lock()
-	l.list = append(l.list, lookout.AnalyzerComments{conf, cs})
+	l.list = append(l.list, lookout.AnalyzerComments{Config: conf, Comments: cs})
+	l.Unlock()
+}
+
+// AddError adds the failed analysis of an analyzer, so the poster can report
+// it
+func (l *commentsList) AddError(conf lookout.AnalyzerConfig, err error) {
+	l.Lock()
+	l.list = append(l.list, lookout.AnalyzerComments{Config: conf, Error: err.Error()})
 	l.Unlock()
 }
 
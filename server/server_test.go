@@ -4,18 +4,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
 
 	"github.com/src-d/lookout"
 	"github.com/src-d/lookout/mock"
 	"github.com/src-d/lookout/store"
+	"github.com/src-d/lookout/store/models"
 	"github.com/src-d/lookout/util/ctxlog"
 	"github.com/src-d/lookout/util/grpchelper"
 
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
 	log "gopkg.in/src-d/go-log.v1"
+	"gopkg.in/src-d/lookout-sdk.v0/pb"
 )
 
 var correctReviewEvent = lookout.ReviewEvent{
@@ -209,6 +213,261 @@ func TestAnalyzerConfigDisabled(t *testing.T) {
 	require.Equal(lookout.SuccessAnalysisStatus, status)
 }
 
+type DeferredPosterMock struct {
+	PosterMock
+	deferred bool
+	posted   chan struct{}
+}
+
+func (p *DeferredPosterMock) Post(ctx context.Context, e lookout.Event, aCommentsList []lookout.AnalyzerComments) error {
+	if !p.deferred {
+		p.deferred = true
+		return &lookout.PostDeferredError{Until: time.Now().Add(10 * time.Millisecond)}
+	}
+
+	return p.PosterMock.Post(ctx, e, aCommentsList)
+}
+
+func (p *DeferredPosterMock) Status(ctx context.Context, e lookout.Event, st lookout.AnalysisStatus) error {
+	err := p.PosterMock.Status(ctx, e, st)
+	if st == lookout.SuccessAnalysisStatus {
+		close(p.posted)
+	}
+
+	return err
+}
+
+func TestServerPostDeferred(t *testing.T) {
+	require := require.New(t)
+
+	watcher := &WatcherMock{}
+	poster := &DeferredPosterMock{posted: make(chan struct{})}
+	fileGetter := &FileGetterMock{}
+	analyzer := &AnalyzerClientMock{}
+	analyzers := map[string]lookout.Analyzer{
+		"mock": lookout.Analyzer{
+			Client: analyzer,
+		},
+	}
+	eventOp := store.NewMemEventOperator()
+
+	srv := NewServer(watcher, poster, fileGetter, analyzers, eventOp, &store.NoopCommentOperator{})
+	srv.deferredInterval = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv.Run(ctx)
+
+	err := watcher.Send(&correctReviewEvent)
+	require.Nil(err)
+
+	select {
+	case <-poster.posted:
+	case <-time.After(time.Second):
+		require.Fail("deferred event was not posted")
+	}
+
+	require.True(poster.deferred)
+	require.Len(poster.PopComments(), 1)
+	require.Equal(lookout.SuccessAnalysisStatus, poster.PopStatus())
+
+	// the comments of the first analysis were posted, without analyzing again
+	require.Len(analyzer.PopReviewEvents(), 1)
+
+	status, err := eventOp.Save(ctx, &correctReviewEvent)
+	require.NoError(err)
+	require.Equal(models.EventStatusProcessed, status)
+
+	posts, err := srv.deferred.List(ctx)
+	require.NoError(err)
+	require.Len(posts, 0)
+}
+
+func TestServerPostDeferredRestart(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "lookout-deferred")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	eventOp := store.NewMemEventOperator()
+	analyzer := &AnalyzerClientMock{}
+	analyzers := map[string]lookout.Analyzer{
+		"mock": lookout.Analyzer{
+			Client: analyzer,
+		},
+	}
+
+	poster := &DeferredPosterMock{posted: make(chan struct{})}
+	srv := NewServer(&WatcherMock{}, poster, &FileGetterMock{}, analyzers, eventOp, &store.NoopCommentOperator{})
+	srv.SetDeferredPostStore(store.NewFSDeferredPostStore(dir))
+
+	require.NoError(srv.handleEvent(ctx, &correctReviewEvent))
+	require.True(poster.deferred)
+	require.Len(analyzer.PopReviewEvents(), 1)
+
+	// the pending event is not analyzed again if it's received again
+	require.NoError(srv.handleEvent(ctx, &correctReviewEvent))
+	require.Len(analyzer.PopReviewEvents(), 0)
+
+	// a new server with the same store posts it once it's due
+	poster = &DeferredPosterMock{posted: make(chan struct{}), deferred: true}
+	srv = NewServer(&WatcherMock{}, poster, &FileGetterMock{}, analyzers, eventOp, &store.NoopCommentOperator{})
+	srv.SetDeferredPostStore(store.NewFSDeferredPostStore(dir))
+
+	srv.postDeferred(ctx, time.Now().Add(-time.Hour))
+	require.Len(poster.PopComments(), 0)
+
+	srv.postDeferred(ctx, time.Now().Add(time.Hour))
+	require.Len(poster.PopComments(), 1)
+	require.Equal(lookout.SuccessAnalysisStatus, poster.PopStatus())
+	require.Len(analyzer.PopReviewEvents(), 0)
+
+	status, err := eventOp.Save(ctx, &correctReviewEvent)
+	require.NoError(err)
+	require.Equal(models.EventStatusProcessed, status)
+
+	posts, err := store.NewFSDeferredPostStore(dir).List(ctx)
+	require.NoError(err)
+	require.Len(posts, 0)
+}
+
+func TestServerPendingWithoutDeferredPost(t *testing.T) {
+	require := require.New(t)
+
+	ctx := context.Background()
+	eventOp := store.NewMemEventOperator()
+	analyzer := &AnalyzerClientMock{}
+	analyzers := map[string]lookout.Analyzer{
+		"mock": lookout.Analyzer{
+			Client: analyzer,
+		},
+	}
+
+	poster := &DeferredPosterMock{posted: make(chan struct{})}
+	srv := NewServer(&WatcherMock{}, poster, &FileGetterMock{}, analyzers, eventOp, &store.NoopCommentOperator{})
+
+	require.NoError(srv.handleEvent(ctx, &correctReviewEvent))
+	require.True(poster.deferred)
+	require.Len(analyzer.PopReviewEvents(), 1)
+
+	// after a restart the deferred posts in memory are lost, so the pending
+	// event is analyzed again
+	poster = &DeferredPosterMock{posted: make(chan struct{}), deferred: true}
+	srv = NewServer(&WatcherMock{}, poster, &FileGetterMock{}, analyzers, eventOp, &store.NoopCommentOperator{})
+
+	require.NoError(srv.handleEvent(ctx, &correctReviewEvent))
+	require.Len(analyzer.PopReviewEvents(), 1)
+	require.Len(poster.PopComments(), 1)
+
+	status, err := eventOp.Save(ctx, &correctReviewEvent)
+	require.NoError(err)
+	require.Equal(models.EventStatusProcessed, status)
+}
+
+func TestServerRedeliverFailed(t *testing.T) {
+	require := require.New(t)
+
+	ctx := context.Background()
+	eventOp := store.NewMemEventOperator()
+	analyzer := &AnalyzerClientMock{}
+	analyzers := map[string]lookout.Analyzer{
+		"mock": lookout.Analyzer{
+			Client: analyzer,
+		},
+	}
+
+	poster := &FailingPosterMock{err: errors.New("post error")}
+	srv := NewServer(&WatcherMock{}, poster, &FileGetterMock{}, analyzers, eventOp, &store.NoopCommentOperator{})
+	srv.SetRedeliverFailed(true)
+
+	// the error is returned, so the queue delivers the event again
+	require.Error(srv.handleEvent(ctx, &correctReviewEvent))
+	require.Len(analyzer.PopReviewEvents(), 1)
+
+	poster.err = nil
+	require.NoError(srv.handleEvent(ctx, &correctReviewEvent))
+	require.Len(analyzer.PopReviewEvents(), 1)
+	require.Len(poster.PopComments(), 1)
+
+	status, err := eventOp.Save(ctx, &correctReviewEvent)
+	require.NoError(err)
+	require.Equal(models.EventStatusProcessed, status)
+}
+
+func TestServerFailed(t *testing.T) {
+	require := require.New(t)
+
+	ctx := context.Background()
+	eventOp := store.NewMemEventOperator()
+	analyzer := &AnalyzerClientMock{}
+	analyzers := map[string]lookout.Analyzer{
+		"mock": lookout.Analyzer{
+			Client: analyzer,
+		},
+	}
+
+	poster := &FailingPosterMock{err: errors.New("post error")}
+	srv := NewServer(&WatcherMock{}, poster, &FileGetterMock{}, analyzers, eventOp, &store.NoopCommentOperator{})
+
+	// without redelivery, the event is marked as failed and skipped
+	require.NoError(srv.handleEvent(ctx, &correctReviewEvent))
+	require.Len(analyzer.PopReviewEvents(), 1)
+
+	poster.err = nil
+	require.NoError(srv.handleEvent(ctx, &correctReviewEvent))
+	require.Len(analyzer.PopReviewEvents(), 0)
+
+	status, err := eventOp.Save(ctx, &correctReviewEvent)
+	require.NoError(err)
+	require.Equal(models.EventStatusFailed, status)
+}
+
+type FailingAnalyzerClientMock struct {
+	AnalyzerClientMock
+}
+
+func (a *FailingAnalyzerClientMock) NotifyReviewEvent(ctx context.Context, in *lookout.ReviewEvent, opts ...grpc.CallOption) (*lookout.EventResponse, error) {
+	return nil, errors.New("analyzer error")
+}
+
+type AnalysisPosterMock struct {
+	PosterMock
+	list []lookout.AnalyzerComments
+}
+
+func (p *AnalysisPosterMock) Post(ctx context.Context, e lookout.Event, aCommentsList []lookout.AnalyzerComments) error {
+	p.list = aCommentsList
+	return p.PosterMock.Post(ctx, e, aCommentsList)
+}
+
+func TestServerAnalyzerError(t *testing.T) {
+	require := require.New(t)
+
+	watcher := &WatcherMock{}
+	poster := &AnalysisPosterMock{}
+	analyzers := map[string]lookout.Analyzer{
+		"failing": lookout.Analyzer{
+			Config: lookout.AnalyzerConfig{Name: "failing"},
+			Client: &FailingAnalyzerClientMock{},
+		},
+	}
+
+	srv := NewServer(watcher, poster, &FileGetterMock{}, analyzers, &store.NoopEventOperator{}, &store.NoopCommentOperator{})
+	srv.Run(context.TODO())
+
+	err := watcher.Send(&correctReviewEvent)
+	require.Nil(err)
+
+	// the failed analysis is passed to the poster, to report it
+	require.Equal([]lookout.AnalyzerComments{{
+		Config: lookout.AnalyzerConfig{Name: "failing"},
+		Error:  "analyzer error",
+	}}, poster.list)
+	require.Empty(poster.PopComments())
+}
+
 var globalConfig = lookout.AnalyzerConfig{
 	Name: "test",
 	Settings: map[string]interface{}{
@@ -280,6 +539,176 @@ func TestMergeConfigWithLocal(t *testing.T) {
 	require.Equal(grpchelper.ToPBStruct(expectedMap), &es[0].Configuration)
 }
 
+type OrgConfigGetterMock struct {
+	content string
+	err     error
+}
+
+func (g *OrgConfigGetterMock) OrgConfig(_ context.Context, e lookout.Event) ([]byte, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+
+	return []byte(g.content), nil
+}
+
+func TestMergeConfigWithOrgError(t *testing.T) {
+	require := require.New(t)
+
+	watcher := &WatcherMock{}
+	poster := &PosterMock{}
+	fileGetter := &FileGetterMockWithConfig{
+		content: `analyzers:
+ - name: mock
+   settings:
+     some: value
+`,
+	}
+	analyzerClient := &AnalyzerClientMock{}
+	analyzers := map[string]lookout.Analyzer{
+		"mock": lookout.Analyzer{
+			Client: analyzerClient,
+			Config: globalConfig,
+		},
+	}
+
+	srv := NewServer(watcher, poster, fileGetter, analyzers, &store.NoopEventOperator{}, &store.NoopCommentOperator{})
+	srv.SetOrgConfigGetter(&OrgConfigGetterMock{err: errors.New("org error")})
+	srv.Run(context.TODO())
+
+	err := watcher.Send(&correctReviewEvent)
+	require.Nil(err)
+
+	// the event is analyzed with the repository config
+	es := analyzerClient.PopReviewEvents()
+	require.Len(es, 1)
+
+	expectedMap := make(map[string]interface{})
+	for k, v := range globalConfig.Settings {
+		expectedMap[k] = v
+	}
+	expectedMap["some"] = "value"
+
+	require.Equal(grpchelper.ToPBStruct(expectedMap), &es[0].Configuration)
+}
+
+func TestMergeConfigWithOrg(t *testing.T) {
+	require := require.New(t)
+
+	watcher := &WatcherMock{}
+	poster := &PosterMock{}
+	fileGetter := &FileGetterMock{}
+	analyzerClient := &AnalyzerClientMock{}
+	analyzers := map[string]lookout.Analyzer{
+		"mock": lookout.Analyzer{
+			Client: analyzerClient,
+			Config: globalConfig,
+		},
+	}
+
+	srv := NewServer(watcher, poster, fileGetter, analyzers, &store.NoopEventOperator{}, &store.NoopCommentOperator{})
+	srv.SetOrgConfigGetter(&OrgConfigGetterMock{
+		content: `analyzers:
+ - name: mock
+   settings:
+     org: value
+`,
+	})
+	srv.Run(context.TODO())
+
+	err := watcher.Send(&correctReviewEvent)
+	require.Nil(err)
+
+	es := analyzerClient.PopReviewEvents()
+	require.Len(es, 1)
+
+	expectedMap := make(map[string]interface{})
+	for k, v := range globalConfig.Settings {
+		expectedMap[k] = v
+	}
+	expectedMap["org"] = "value"
+
+	require.Equal(grpchelper.ToPBStruct(expectedMap), &es[0].Configuration)
+}
+
+func TestMergeConfigWithOrgAndLocal(t *testing.T) {
+	require := require.New(t)
+
+	watcher := &WatcherMock{}
+	poster := &PosterMock{}
+	fileGetter := &FileGetterMockWithConfig{
+		content: `analyzers:
+ - name: mock
+   settings:
+     some: value
+     overridden: repo
+`,
+	}
+	analyzerClient := &AnalyzerClientMock{}
+	analyzers := map[string]lookout.Analyzer{
+		"mock": lookout.Analyzer{
+			Client: analyzerClient,
+			Config: globalConfig,
+		},
+	}
+
+	srv := NewServer(watcher, poster, fileGetter, analyzers, &store.NoopEventOperator{}, &store.NoopCommentOperator{})
+	srv.SetOrgConfigGetter(&OrgConfigGetterMock{
+		content: `analyzers:
+ - name: mock
+   settings:
+     org: value
+     overridden: org
+`,
+	})
+	srv.Run(context.TODO())
+
+	err := watcher.Send(&correctReviewEvent)
+	require.Nil(err)
+
+	es := analyzerClient.PopReviewEvents()
+	require.Len(es, 1)
+
+	expectedMap := make(map[string]interface{})
+	for k, v := range globalConfig.Settings {
+		expectedMap[k] = v
+	}
+	expectedMap["org"] = "value"
+	expectedMap["some"] = "value"
+	expectedMap["overridden"] = "repo"
+
+	require.Equal(grpchelper.ToPBStruct(expectedMap), &es[0].Configuration)
+}
+
+func TestMergeConfigsDisabled(t *testing.T) {
+	require := require.New(t)
+
+	merged := mergeConfigs(
+		Config{Analyzers: []lookout.AnalyzerConfig{
+			{Name: "a", Disabled: true},
+			{Name: "b", Feedback: "org-feedback", FeedbackLinks: map[string]string{"bug": "org-bugs"}},
+			{Name: "d"},
+			{Name: "e", Disabled: true},
+		}},
+		Config{Analyzers: []lookout.AnalyzerConfig{
+			{Name: "a"},
+			{Name: "b"},
+			{Name: "c", Disabled: true},
+			{Name: "d", Disabled: true},
+		}},
+	)
+
+	// the repository value wins, the organization one applies to the
+	// analyzers not listed by the repository
+	require.Equal([]lookout.AnalyzerConfig{
+		{Name: "a"},
+		{Name: "b", Feedback: "org-feedback", FeedbackLinks: map[string]string{"bug": "org-bugs"}},
+		{Name: "d", Disabled: true},
+		{Name: "e", Disabled: true},
+		{Name: "c", Disabled: true},
+	}, merged.Analyzers)
+}
+
 func TestConfigMerger(t *testing.T) {
 	require := require.New(t)
 
@@ -448,16 +877,16 @@ type AnalyzerClientMock struct {
 func (a *AnalyzerClientMock) NotifyReviewEvent(ctx context.Context, in *lookout.ReviewEvent, opts ...grpc.CallOption) (*lookout.EventResponse, error) {
 	a.reviewEvents = append(a.reviewEvents, in)
 	return &lookout.EventResponse{
-		Comments: []*lookout.Comment{
-			makeComment(in.CommitRevision.Base, in.CommitRevision.Head),
+		Comments: []*pb.Comment{
+			pbComment(makeComment(in.CommitRevision.Base, in.CommitRevision.Head)),
 		},
 	}, nil
 }
 
 func (a *AnalyzerClientMock) NotifyPushEvent(ctx context.Context, in *lookout.PushEvent, opts ...grpc.CallOption) (*lookout.EventResponse, error) {
 	return &lookout.EventResponse{
-		Comments: []*lookout.Comment{
-			makeComment(in.CommitRevision.Base, in.CommitRevision.Head),
+		Comments: []*pb.Comment{
+			pbComment(makeComment(in.CommitRevision.Base, in.CommitRevision.Head)),
 		},
 	}, nil
 }
@@ -474,6 +903,11 @@ func makeComment(from, to lookout.ReferencePointer) *lookout.Comment {
 	}
 }
 
+// pbComment returns the comment as returned by the analyzers
+func pbComment(c *lookout.Comment) *pb.Comment {
+	return &pb.Comment{File: c.File, Line: c.Line, Text: c.Text, Confidence: c.Confidence}
+}
+
 type NoopFileScanner struct {
 }
 
@@ -515,3 +949,50 @@ func (l *MockLogger) Warningf(format string, args ...interface{}) {}
 func (l *MockLogger) Errorf(err error, format string, args ...interface{}) {
 	l.errors = append(l.errors, err)
 }
+
+type LanguageGetterMock struct {
+	languages []string
+}
+
+func (g *LanguageGetterMock) Languages(_ context.Context, e lookout.Event) ([]string, error) {
+	return g.languages, nil
+}
+
+func TestServerAnalyzerLanguages(t *testing.T) {
+	require := require.New(t)
+
+	watcher := &WatcherMock{}
+	poster := &AnalysisPosterMock{}
+	goClient := &AnalyzerClientMock{}
+	analyzers := map[string]lookout.Analyzer{
+		"go": lookout.Analyzer{
+			Config: lookout.AnalyzerConfig{Name: "go", Languages: []string{"Go"}},
+			Client: goClient,
+		},
+		"any": lookout.Analyzer{
+			Config: lookout.AnalyzerConfig{Name: "any"},
+			Client: &AnalyzerClientMock{},
+		},
+	}
+
+	srv := NewServer(watcher, poster, &FileGetterMock{}, analyzers, &store.NoopEventOperator{}, &store.NoopCommentOperator{})
+	srv.SetLanguageGetter(&LanguageGetterMock{languages: []string{"Markdown"}})
+	srv.Run(context.TODO())
+
+	err := watcher.Send(&correctReviewEvent)
+	require.Nil(err)
+
+	// the Go analyzer is not called for a repository without Go
+	require.Empty(goClient.reviewEvents)
+	require.Len(poster.list, 1)
+	require.Equal("any", poster.list[0].Config.Name)
+}
+
+func TestHandlesLanguages(t *testing.T) {
+	require := require.New(t)
+
+	require.True(handlesLanguages(nil, []string{"Markdown"}))
+	require.True(handlesLanguages([]string{"Go"}, nil))
+	require.True(handlesLanguages([]string{"Go", "Python"}, []string{"python"}))
+	require.False(handlesLanguages([]string{"Go"}, []string{"Markdown"}))
+}
@@ -14,6 +14,8 @@
 // store/migrations/1537268276_data_migrate.up.sql
 // store/migrations/1537455097_delete_old_columns.down.sql
 // store/migrations/1537455097_delete_old_columns.up.sql
+// store/migrations/1539167324_add_comment_state.down.sql
+// store/migrations/1539167324_add_comment_state.up.sql
 // store/migrations/lock.json
 // DO NOT EDIT!
 
@@ -362,6 +364,46 @@ func _1537455097_delete_old_columnsUpSql() (*asset, error) {
 	return a, nil
 }
 
+var __1539167324_add_comment_stateDownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x73\x72\x75\xf7\xf4\xb3\xe6\xe2\x72\x09\xf2\x0f\x50\x08\x71\x74\xf2\x71\x55\x48\xce\xcf\xcd\x4d\xcd\x2b\x89\x2f\x2e\x49\x2c\x49\x05\x4a\x39\xfb\xfb\xfa\x7a\x86\x58\x73\x01\x00\x61\x1d\xfa\x4f\x2b\x00\x00\x00")
+
+func _1539167324_add_comment_stateDownSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__1539167324_add_comment_stateDownSql,
+		"1539167324_add_comment_state.down.sql",
+	)
+}
+
+func _1539167324_add_comment_stateDownSql() (*asset, error) {
+	bytes, err := _1539167324_add_comment_stateDownSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "1539167324_add_comment_state.down.sql", size: 43, mode: os.FileMode(484), modTime: time.Unix(1, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __1539167324_add_comment_stateUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x85\x90\xdd\x0a\x82\x40\x10\x85\xaf\xdd\xa7\x98\x4b\x05\xdf\xa0\x2b\x8d\x25\x24\x7f\x42\xec\xc2\x2b\xd1\x5c\x62\xc3\xfd\x61\x1d\x23\x7d\xfa\x56\x2a\xd0\x0c\xba\x9d\x33\xe7\xcc\x7c\x27\xa4\x87\x28\xdd\x11\xb2\xcf\x69\x50\x50\x28\x82\x30\xa6\x70\x51\x42\x30\x89\x55\x8f\x35\x32\x70\x89\xa3\x8d\xba\xf3\x96\x19\x40\xf6\x40\x48\xb3\x02\xd2\x73\x1c\xfb\xc4\x31\x4c\xab\x9e\xa3\x32\x63\xc5\x5b\x68\xf8\x95\xcb\x95\x2e\x07\xd1\x58\xdb\x56\xb0\x39\xcc\xc8\xba\x9b\x6d\xdf\xa1\xb5\x9d\x8f\xd3\x8f\x6b\xef\xbf\xe0\xd6\x2b\xd9\xac\xdf\xe8\x55\x37\x20\x57\x72\xeb\x31\xcc\x42\xb4\x55\x8d\x80\x5c\x30\x8b\x24\x34\x4e\xcb\x8d\x41\xb7\x7f\x36\x4e\x79\x94\x04\x79\x09\x47\x5a\x82\xfb\xe9\xc2\x87\x15\xbc\x0f\x2f\x56\x1f\x16\x68\x1e\xf1\xe6\x6e\xb3\x24\x89\x8a\x1d\x79\x02\xee\x3a\x77\x76\x6c\x01\x00\x00")
+
+func _1539167324_add_comment_stateUpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__1539167324_add_comment_stateUpSql,
+		"1539167324_add_comment_state.up.sql",
+	)
+}
+
+func _1539167324_add_comment_stateUpSql() (*asset, error) {
+	bytes, err := _1539167324_add_comment_stateUpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "1539167324_add_comment_state.up.sql", size: 364, mode: os.FileMode(484), modTime: time.Unix(1, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
 var _lockJson = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xec\x58\xc1\x8e\x9b\x30\x10\xbd\xe7\x2b\x2c\xce\xfb\x05\xb9\xf6\x58\x29\xaa\xaa\xed\xa9\xaa\x90\x81\x09\x3b\x95\x3d\xa6\xf6\x38\x2d\xbb\xca\xbf\x57\xb8\xbb\x69\x20\x38\x69\x73\x28\x86\x72\x89\x10\xa3\x89\xdf\x1b\x66\xe6\x8d\xe7\x65\x23\x44\xf6\x28\x0b\x05\x2e\xdb\x8a\xcf\x1b\x21\x84\x78\x09\xbf\x42\x64\x3b\xa9\x21\xdb\x8a\xac\x34\x5a\x03\x71\xf6\xf0\x66\x78\x67\x94\xd7\xf4\xdb\xe3\xdc\xab\xe7\x89\xd5\xc9\x29\xbc\x7f\x6c\x9b\xf0\xde\xfb\xa1\xe5\x83\x45\x2d\x6d\xfb\x1e\xda\x6c\x2b\xd8\x7a\xe8\x59\x3f\xc2\x1e\x2c\x50\xd9\x39\x93\x57\xaa\x67\xdc\x19\xde\x79\xa5\xc6\xfc\x3e\x11\x7e\xf3\x9d\xd3\x5e\x2a\x07\x27\xcb\xf1\xe1\x3a\xec\xd2\x82\x64\xa8\x72\xc9\xe3\xf0\x19\x35\x38\x96\xba\xe1\xe7\x2b\x2c\xc2\x99\x53\xd2\xf0\x4d\xb5\x04\x1a\x16\x0e\x08\xdf\x73\x38\x00\x71\x7e\x67\x46\x5d\x27\x71\x7e\xec\x5b\x3d\x0c\x4f\xee\xfd\xf9\xa9\x06\x5e\x93\xfc\xcc\x74\x8c\x44\xe3\x12\xc1\x9d\xe1\xd8\xa3\x82\xc8\xf7\x84\x1f\x9c\xf2\x87\x54\x48\x11\xe4\x48\x0c\x35\xd8\x94\xc1\x5f\x06\x77\x2e\x61\x2f\x0d\xed\xb1\x0a\xe7\x8d\xe2\x2f\xb0\x46\x4a\x9a\x81\x24\xa9\xda\xe7\x61\x7e\x24\x13\xff\xd7\xa7\x2f\x9b\x33\x2e\x17\x22\xda\x78\xf7\x34\xe8\x24\x8b\xd7\x51\xc7\x92\xbd\x4b\xf4\xab\xdd\xc0\xde\x58\x73\xc0\x2a\xd9\x9c\xbb\x81\xbe\x6b\xa8\x96\xa4\x8a\xea\x65\xea\x04\x16\x32\x82\x75\xa3\x33\x72\xa4\x04\xd2\x6f\xbc\x15\x3a\x46\x2a\x39\x9f\x39\x8f\x20\x81\xb5\xb7\x92\xd1\xd0\x38\x89\xaf\xce\x50\x91\x32\x87\x42\xba\x88\x80\x27\x0f\xfd\x09\x64\xa4\x0d\x4d\x0f\xfd\x8f\xc4\x7b\xf4\x22\xb0\xca\x77\xc2\x29\x67\x54\x95\xcf\x5e\x04\xd1\xe5\x1a\x6c\x0d\xe1\x3e\x3a\xde\x7a\x8d\x51\x20\x29\x65\x12\xce\x78\x1b\xbb\x7a\x4c\x5f\xfe\x37\xc0\x87\xf0\xcf\x14\xfb\x2a\x7a\xab\xe8\xfd\xd7\xc3\xf7\xb2\xf6\x9f\x2c\x6d\x0d\xd3\x2c\x40\x7f\x1d\xfd\xef\x36\xa0\x7f\x33\x93\x0d\xb0\x2d\x7e\x28\x5b\x6b\x33\x25\x1a\xeb\x96\x68\xe2\xd6\xd8\x18\x87\x6c\x6c\x1b\xa5\x90\xfe\x72\x82\xbc\x2e\x62\x19\x94\x00\xfa\x7e\x33\xde\x74\x4f\xc7\x9f\x01\x00\x00\xff\xff\x91\xfd\x31\xe6\x37\x1e\x00\x00")
 
 func lockJsonBytes() ([]byte, error) {
@@ -448,6 +490,8 @@ var _bindata = map[string]func() (*asset, error){
 	"1537268276_data_migrate.up.sql": _1537268276_data_migrateUpSql,
 	"1537455097_delete_old_columns.down.sql": _1537455097_delete_old_columnsDownSql,
 	"1537455097_delete_old_columns.up.sql": _1537455097_delete_old_columnsUpSql,
+	"1539167324_add_comment_state.down.sql": _1539167324_add_comment_stateDownSql,
+	"1539167324_add_comment_state.up.sql": _1539167324_add_comment_stateUpSql,
 	"lock.json": lockJson,
 }
 
@@ -505,6 +549,8 @@ var _bintree = &bintree{nil, map[string]*bintree{
 	"1537268276_data_migrate.up.sql": &bintree{_1537268276_data_migrateUpSql, map[string]*bintree{}},
 	"1537455097_delete_old_columns.down.sql": &bintree{_1537455097_delete_old_columnsDownSql, map[string]*bintree{}},
 	"1537455097_delete_old_columns.up.sql": &bintree{_1537455097_delete_old_columnsUpSql, map[string]*bintree{}},
+	"1539167324_add_comment_state.down.sql": &bintree{_1539167324_add_comment_stateDownSql, map[string]*bintree{}},
+	"1539167324_add_comment_state.up.sql": &bintree{_1539167324_add_comment_stateUpSql, map[string]*bintree{}},
 	"lock.json": &bintree{lockJson, map[string]*bintree{}},
 }}
 
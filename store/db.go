@@ -2,7 +2,10 @@ package store
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/src-d/lookout"
 	"github.com/src-d/lookout/store/models"
@@ -287,3 +290,84 @@ func (o *DBCommentOperator) posted(ctx context.Context, e *lookout.ReviewEvent,
 
 	return count > 0, nil
 }
+
+// DBCommentStateOperator operates on the comment_state table. The states are
+// upserted, which kallax doesn't support, so the queries are plain SQL.
+type DBCommentStateOperator struct {
+	db *sql.DB
+}
+
+// NewDBCommentStateOperator creates new DBCommentStateOperator
+func NewDBCommentStateOperator(db *sql.DB) *DBCommentStateOperator {
+	return &DBCommentStateOperator{db}
+}
+
+var _ CommentStateOperator = &DBCommentStateOperator{}
+
+const upsertCommentStateQuery = `INSERT INTO comment_state
+	(provider, repository_id, number, external_id, analyzer, comment, resolution, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+	ON CONFLICT (provider, repository_id, number, external_id) DO UPDATE SET
+	analyzer = EXCLUDED.analyzer,
+	comment = EXCLUDED.comment,
+	resolution = EXCLUDED.resolution,
+	updated_at = EXCLUDED.updated_at`
+
+const openFindingsQuery = `SELECT external_id, analyzer, comment, resolution, created_at, updated_at
+	FROM comment_state
+	WHERE provider = $1 AND repository_id = $2 AND number = $3 AND resolution = $4
+	ORDER BY created_at`
+
+// UpsertState implements CommentStateOperator interface
+func (o *DBCommentStateOperator) UpsertState(ctx context.Context, e lookout.Event, s *CommentState) error {
+	ev, ok := e.(*lookout.ReviewEvent)
+	if !ok {
+		return fmt.Errorf("comments can belong only to review event but %v is given", e.Type())
+	}
+
+	comment, err := json.Marshal(s.Comment)
+	if err != nil {
+		return err
+	}
+
+	_, err = o.db.ExecContext(ctx, upsertCommentStateQuery,
+		ev.Provider, ev.RepositoryID, ev.Number,
+		s.ExternalID, s.Analyzer, string(comment), string(s.Resolution), time.Now())
+	return err
+}
+
+// OpenFindings implements CommentStateOperator interface
+func (o *DBCommentStateOperator) OpenFindings(ctx context.Context, e lookout.Event) ([]*CommentState, error) {
+	ev, ok := e.(*lookout.ReviewEvent)
+	if !ok {
+		return nil, fmt.Errorf("comments can belong only to review event but %v is given", e.Type())
+	}
+
+	rows, err := o.db.QueryContext(ctx, openFindingsQuery,
+		ev.Provider, ev.RepositoryID, ev.Number, string(CommentResolutionOpen))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var states []*CommentState
+	for rows.Next() {
+		var s CommentState
+		var comment []byte
+		var resolution string
+		err := rows.Scan(&s.ExternalID, &s.Analyzer, &comment, &resolution,
+			&s.CreatedAt, &s.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(comment, &s.Comment); err != nil {
+			return nil, err
+		}
+
+		s.Resolution = CommentResolution(resolution)
+		states = append(states, &s)
+	}
+
+	return states, rows.Err()
+}
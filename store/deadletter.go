@@ -0,0 +1,178 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/src-d/lookout"
+
+	"gopkg.in/src-d/lookout-sdk.v0/pb"
+)
+
+// DeadLetter is a failed attempt to post the comments of an event
+type DeadLetter struct {
+	// ID identifies the dead letter in its store
+	ID string `json:"id"`
+	// CreatedAt is the time when posting failed
+	CreatedAt time.Time `json:"created_at"`
+	// EventType is the type of the encoded Event
+	EventType lookout.EventType `json:"event_type"`
+	// Event is the event, encoded as protobuf
+	Event []byte `json:"event"`
+	// Comments are the comments that couldn't be posted
+	Comments []lookout.AnalyzerComments `json:"comments"`
+	// Error is the error returned when posting
+	Error string `json:"error"`
+	// PostedParts are the keys of the parts of the post done before it
+	// failed, see lookout.PostedParts
+	PostedParts []string `json:"posted_parts,omitempty"`
+}
+
+type protoEvent interface {
+	lookout.Event
+	Marshal() ([]byte, error)
+}
+
+// NewDeadLetter returns a new DeadLetter for the failed attempt to post the
+// comments of the event.
+func NewDeadLetter(
+	e lookout.Event,
+	comments []lookout.AnalyzerComments,
+	postErr error,
+) (*DeadLetter, error) {
+	data, err := encodeEvent(e)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &DeadLetter{
+		ID:        fmt.Sprintf("%d-%s", now.UnixNano(), e.ID().String()),
+		CreatedAt: now,
+		EventType: e.Type(),
+		Event:     data,
+		Comments:  comments,
+		Error:     postErr.Error(),
+	}, nil
+}
+
+// DecodeEvent returns the event of the dead letter
+func (d *DeadLetter) DecodeEvent() (lookout.Event, error) {
+	return decodeEvent(d.EventType, d.Event)
+}
+
+// encodeEvent returns the event encoded as protobuf
+func encodeEvent(e lookout.Event) ([]byte, error) {
+	pe, ok := e.(protoEvent)
+	if !ok {
+		return nil, fmt.Errorf("unsupported event type: %T", e)
+	}
+
+	return pe.Marshal()
+}
+
+// decodeEvent returns the event of the given type encoded as protobuf
+func decodeEvent(t lookout.EventType, data []byte) (lookout.Event, error) {
+	switch t {
+	case pb.ReviewEventType:
+		e := &lookout.ReviewEvent{}
+		return e, e.Unmarshal(data)
+	case pb.PushEventType:
+		e := &lookout.PushEvent{}
+		return e, e.Unmarshal(data)
+	default:
+		return nil, fmt.Errorf("unsupported event type: %d", t)
+	}
+}
+
+// DeadLetterStore keeps the failed attempts to post comments, so they can be
+// re-driven once the issue is fixed
+type DeadLetterStore interface {
+	// Put saves the dead letter
+	Put(context.Context, *DeadLetter) error
+	// List returns all the dead letters, oldest first
+	List(context.Context) ([]*DeadLetter, error)
+	// Delete removes the dead letter with the given ID
+	Delete(context.Context, string) error
+}
+
+// FSDeadLetterStore satisfies DeadLetterStore interface keeping each dead
+// letter as a JSON file in a directory
+type FSDeadLetterStore struct {
+	dir string
+}
+
+// NewFSDeadLetterStore creates new FSDeadLetterStore
+func NewFSDeadLetterStore(dir string) *FSDeadLetterStore {
+	return &FSDeadLetterStore{dir: dir}
+}
+
+var _ DeadLetterStore = &FSDeadLetterStore{}
+
+const deadLetterExt = ".json"
+
+func (s *FSDeadLetterStore) path(id string) string {
+	return filepath.Join(s.dir, id+deadLetterExt)
+}
+
+// Put implements DeadLetterStore interface
+func (s *FSDeadLetterStore) Put(ctx context.Context, d *DeadLetter) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(s.path(d.ID), data, 0644)
+}
+
+// List implements DeadLetterStore interface
+func (s *FSDeadLetterStore) List(ctx context.Context) ([]*DeadLetter, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*DeadLetter
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), deadLetterExt) {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(s.dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var d DeadLetter
+		if err := json.Unmarshal(data, &d); err != nil {
+			return nil, fmt.Errorf("bad dead letter %s: %s", f.Name(), err)
+		}
+
+		result = append(result, &d)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+
+	return result, nil
+}
+
+// Delete implements DeadLetterStore interface
+func (s *FSDeadLetterStore) Delete(ctx context.Context, id string) error {
+	return os.Remove(s.path(id))
+}
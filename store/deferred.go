@@ -0,0 +1,242 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/src-d/lookout"
+)
+
+// DeferredPost is a post of the comments of an event deferred by the poster,
+// see lookout.PostDeferredError. The comments are posted again once Until is
+// reached, without analyzing the event again.
+type DeferredPost struct {
+	// ID identifies the deferred post in its store
+	ID string `json:"id"`
+	// Until is the time when the comments can be posted
+	Until time.Time `json:"until"`
+	// EventType is the type of the encoded Event
+	EventType lookout.EventType `json:"event_type"`
+	// Event is the event, encoded as protobuf
+	Event []byte `json:"event"`
+	// Comments are the comments to post
+	Comments []lookout.AnalyzerComments `json:"comments"`
+}
+
+// NewDeferredPost returns a new DeferredPost of the comments of the event,
+// to be posted once the given time is reached.
+func NewDeferredPost(
+	e lookout.Event,
+	comments []lookout.AnalyzerComments,
+	until time.Time,
+) (*DeferredPost, error) {
+	data, err := encodeEvent(e)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeferredPost{
+		ID:        e.ID().String(),
+		Until:     until,
+		EventType: e.Type(),
+		Event:     data,
+		Comments:  comments,
+	}, nil
+}
+
+// DecodeEvent returns the event of the deferred post
+func (d *DeferredPost) DecodeEvent() (lookout.Event, error) {
+	return decodeEvent(d.EventType, d.Event)
+}
+
+// DeferredPostStore keeps the deferred posts until they are done
+type DeferredPostStore interface {
+	// Put saves the deferred post, replacing the one with the same ID
+	Put(context.Context, *DeferredPost) error
+	// Get returns the deferred post with the given ID, or false if there
+	// is none
+	Get(context.Context, string) (*DeferredPost, bool, error)
+	// List returns all the deferred posts, soonest first
+	List(context.Context) ([]*DeferredPost, error)
+	// Delete removes the deferred post with the given ID
+	Delete(context.Context, string) error
+}
+
+func sortDeferredPosts(posts []*DeferredPost) {
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].Until.Before(posts[j].Until)
+	})
+}
+
+// MemDeferredPostStore satisfies DeferredPostStore interface keeping the
+// deferred posts in memory, so they are lost on restart
+type MemDeferredPostStore struct {
+	mu    sync.Mutex
+	posts map[string]*DeferredPost
+}
+
+// NewMemDeferredPostStore creates new MemDeferredPostStore
+func NewMemDeferredPostStore() *MemDeferredPostStore {
+	return &MemDeferredPostStore{posts: make(map[string]*DeferredPost)}
+}
+
+var _ DeferredPostStore = &MemDeferredPostStore{}
+
+// Put implements DeferredPostStore interface
+func (s *MemDeferredPostStore) Put(ctx context.Context, d *DeferredPost) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp := *d
+	s.posts[d.ID] = &cp
+	return nil
+}
+
+// Get implements DeferredPostStore interface
+func (s *MemDeferredPostStore) Get(ctx context.Context, id string) (*DeferredPost, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.posts[id]
+	if !ok {
+		return nil, false, nil
+	}
+
+	cp := *d
+	return &cp, true, nil
+}
+
+// List implements DeferredPostStore interface
+func (s *MemDeferredPostStore) List(ctx context.Context) ([]*DeferredPost, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]*DeferredPost, 0, len(s.posts))
+	for _, d := range s.posts {
+		cp := *d
+		result = append(result, &cp)
+	}
+
+	sortDeferredPosts(result)
+	return result, nil
+}
+
+// Delete implements DeferredPostStore interface
+func (s *MemDeferredPostStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.posts, id)
+	return nil
+}
+
+// FSDeferredPostStore satisfies DeferredPostStore interface keeping each
+// deferred post as a JSON file in a directory, so they survive restarts
+type FSDeferredPostStore struct {
+	dir string
+}
+
+// NewFSDeferredPostStore creates new FSDeferredPostStore
+func NewFSDeferredPostStore(dir string) *FSDeferredPostStore {
+	return &FSDeferredPostStore{dir: dir}
+}
+
+var _ DeferredPostStore = &FSDeferredPostStore{}
+
+const (
+	deferredPostExt = ".json"
+	deferredPostTmp = ".tmp"
+)
+
+func (s *FSDeferredPostStore) path(id string) string {
+	return filepath.Join(s.dir, id+deferredPostExt)
+}
+
+// Put implements DeferredPostStore interface. The file is written under a
+// temporary name and renamed, so a partially written one is never read.
+func (s *FSDeferredPostStore) Put(ctx context.Context, d *DeferredPost) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path(d.ID) + deferredPostTmp
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path(d.ID))
+}
+
+// Get implements DeferredPostStore interface
+func (s *FSDeferredPostStore) Get(ctx context.Context, id string) (*DeferredPost, bool, error) {
+	data, err := ioutil.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var d DeferredPost
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, false, fmt.Errorf("bad deferred post %s: %s", id, err)
+	}
+
+	return &d, true, nil
+}
+
+// List implements DeferredPostStore interface
+func (s *FSDeferredPostStore) List(ctx context.Context) ([]*DeferredPost, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*DeferredPost
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), deferredPostExt) {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(s.dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var d DeferredPost
+		if err := json.Unmarshal(data, &d); err != nil {
+			return nil, fmt.Errorf("bad deferred post %s: %s", f.Name(), err)
+		}
+
+		result = append(result, &d)
+	}
+
+	sortDeferredPosts(result)
+	return result, nil
+}
+
+// Delete implements DeferredPostStore interface
+func (s *FSDeferredPostStore) Delete(ctx context.Context, id string) error {
+	err := os.Remove(s.path(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/src-d/lookout"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemDeferredPostStore(t *testing.T) {
+	testDeferredPostStore(t, NewMemDeferredPostStore())
+}
+
+func TestFSDeferredPostStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lookout-deferred")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	testDeferredPostStore(t, NewFSDeferredPostStore(dir))
+}
+
+// testDeferredPostStore checks the lifecycle of the deferred posts of s,
+// which must be empty
+func testDeferredPostStore(t *testing.T, s DeferredPostStore) {
+	require := require.New(t)
+
+	ctx := context.Background()
+	now := time.Now()
+
+	posts, err := s.List(ctx)
+	require.NoError(err)
+	require.Len(posts, 0)
+
+	comments := []lookout.AnalyzerComments{{
+		Config:   lookout.AnalyzerConfig{Name: "mock"},
+		Comments: []*lookout.Comment{{File: "main.go", Line: 5, Text: "foo"}},
+	}}
+
+	later := &lookout.ReviewEvent{Provider: "github", InternalID: "1", Number: 1}
+	d1, err := NewDeferredPost(later, comments, now.Add(time.Hour))
+	require.NoError(err)
+	require.NoError(s.Put(ctx, d1))
+
+	sooner := &lookout.PushEvent{Provider: "github", InternalID: "2"}
+	d2, err := NewDeferredPost(sooner, nil, now.Add(time.Minute))
+	require.NoError(err)
+	require.NoError(s.Put(ctx, d2))
+
+	posts, err = s.List(ctx)
+	require.NoError(err)
+	require.Len(posts, 2)
+	require.Equal(d2.ID, posts[0].ID)
+	require.Equal(d1.ID, posts[1].ID)
+	require.Equal(comments, posts[1].Comments)
+
+	d, ok, err := s.Get(ctx, d1.ID)
+	require.NoError(err)
+	require.True(ok)
+	require.Equal(comments, d.Comments)
+
+	e, err := posts[1].DecodeEvent()
+	require.NoError(err)
+	require.Equal(later.ID(), e.ID())
+
+	// deferring it again replaces it
+	d1.Until = now
+	require.NoError(s.Put(ctx, d1))
+	posts, err = s.List(ctx)
+	require.NoError(err)
+	require.Len(posts, 2)
+	require.Equal(d1.ID, posts[0].ID)
+
+	require.NoError(s.Delete(ctx, d1.ID))
+	require.NoError(s.Delete(ctx, d2.ID))
+	posts, err = s.List(ctx)
+	require.NoError(err)
+	require.Len(posts, 0)
+
+	_, ok, err = s.Get(ctx, d1.ID)
+	require.NoError(err)
+	require.False(ok)
+}
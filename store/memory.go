@@ -3,6 +3,9 @@ package store
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync"
+	"time"
 
 	"github.com/src-d/lookout"
 	"github.com/src-d/lookout/store/models"
@@ -10,6 +13,7 @@ import (
 
 // MemEventOperator satisfies EventOperator interface keeps events in memory
 type MemEventOperator struct {
+	mu     sync.Mutex
 	events map[string]models.EventStatus
 }
 
@@ -22,6 +26,9 @@ var _ EventOperator = &MemEventOperator{}
 
 // Save implements EventOperator interface
 func (o *MemEventOperator) Save(ctx context.Context, e lookout.Event) (models.EventStatus, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
 	id := e.ID().String()
 	s, ok := o.events[id]
 	if !ok {
@@ -34,6 +41,9 @@ func (o *MemEventOperator) Save(ctx context.Context, e lookout.Event) (models.Ev
 
 // UpdateStatus implements EventOperator interface
 func (o *MemEventOperator) UpdateStatus(ctx context.Context, e lookout.Event, s models.EventStatus) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
 	id := e.ID().String()
 	if _, ok := o.events[id]; !ok {
 		return errors.New("event not found")
@@ -80,3 +90,76 @@ func (o *MemCommentOperator) Posted(ctx context.Context, e lookout.Event, c *loo
 
 	return false, nil
 }
+
+// MemCommentStateOperator satisfies CommentStateOperator interface keeps the
+// states in memory
+type MemCommentStateOperator struct {
+	mu     sync.Mutex
+	states map[string][]*CommentState
+}
+
+// NewMemCommentStateOperator creates new MemCommentStateOperator
+func NewMemCommentStateOperator() *MemCommentStateOperator {
+	return &MemCommentStateOperator{states: make(map[string][]*CommentState)}
+}
+
+var _ CommentStateOperator = &MemCommentStateOperator{}
+
+// UpsertState implements CommentStateOperator interface
+func (o *MemCommentStateOperator) UpsertState(ctx context.Context, e lookout.Event, s *CommentState) error {
+	key, err := memReviewKey(e)
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	state := *s
+	state.CreatedAt = now
+	state.UpdatedAt = now
+
+	states := o.states[key]
+	for i, prev := range states {
+		if prev.ExternalID == s.ExternalID {
+			state.CreatedAt = prev.CreatedAt
+			states[i] = &state
+			return nil
+		}
+	}
+
+	o.states[key] = append(states, &state)
+	return nil
+}
+
+// OpenFindings implements CommentStateOperator interface
+func (o *MemCommentStateOperator) OpenFindings(ctx context.Context, e lookout.Event) ([]*CommentState, error) {
+	key, err := memReviewKey(e)
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var open []*CommentState
+	for _, s := range o.states[key] {
+		if s.Resolution == CommentResolutionOpen {
+			state := *s
+			open = append(open, &state)
+		}
+	}
+
+	return open, nil
+}
+
+// memReviewKey returns the key of the pull request of the review event
+func memReviewKey(e lookout.Event) (string, error) {
+	re, ok := e.(*lookout.ReviewEvent)
+	if !ok {
+		return "", fmt.Errorf("comments can belong only to review event but %v is given", e.Type())
+	}
+
+	return fmt.Sprintf("%s/%d/%d", re.Provider, re.RepositoryID, re.Number), nil
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/src-d/lookout"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemCommentStateOperatorLifecycle(t *testing.T) {
+	testCommentStateLifecycle(t, NewMemCommentStateOperator())
+}
+
+func TestMemCommentStateOperatorConcurrent(t *testing.T) {
+	require := require.New(t)
+
+	ctx := context.Background()
+	o := NewMemCommentStateOperator()
+	e := &lookout.ReviewEvent{Provider: "github", RepositoryID: 1, Number: 1}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- o.UpsertState(ctx, e, &CommentState{
+				ExternalID: strconv.Itoa(i),
+				Resolution: CommentResolutionOpen,
+			})
+			_, err := o.OpenFindings(ctx, e)
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+
+	close(errs)
+	for err := range errs {
+		require.NoError(err)
+	}
+
+	open, err := o.OpenFindings(ctx, e)
+	require.NoError(err)
+	require.Len(open, 10)
+}
+
+// testCommentStateLifecycle checks the upserts and queries of the comment
+// states of o, which must be empty
+func testCommentStateLifecycle(t *testing.T, o CommentStateOperator) {
+	require := require.New(t)
+
+	ctx := context.Background()
+
+	pr := &lookout.ReviewEvent{Provider: "github", RepositoryID: 1, Number: 42}
+	otherPR := &lookout.ReviewEvent{Provider: "github", RepositoryID: 1, Number: 43}
+
+	open, err := o.OpenFindings(ctx, pr)
+	require.NoError(err)
+	require.Len(open, 0)
+
+	first := &CommentState{
+		ExternalID: "1",
+		Analyzer:   "mock",
+		Comment:    lookout.Comment{File: "main.go", Line: 5, Text: "first", Severity: lookout.ErrorSeverity},
+		Resolution: CommentResolutionOpen,
+	}
+	second := &CommentState{
+		ExternalID: "2",
+		Analyzer:   "mock",
+		Comment:    lookout.Comment{File: "main.go", Line: 7, Text: "second"},
+		Resolution: CommentResolutionOpen,
+	}
+	require.NoError(o.UpsertState(ctx, pr, first))
+	require.NoError(o.UpsertState(ctx, pr, second))
+	require.NoError(o.UpsertState(ctx, otherPR, &CommentState{
+		ExternalID: "3",
+		Resolution: CommentResolutionOpen,
+	}))
+
+	open, err = o.OpenFindings(ctx, pr)
+	require.NoError(err)
+	require.Len(open, 2)
+	require.Equal("1", open[0].ExternalID)
+	require.Equal(lookout.ErrorSeverity, open[0].Comment.Severity)
+	require.Equal("2", open[1].ExternalID)
+	require.False(open[0].CreatedAt.IsZero())
+
+	// the severity of the first one is lowered
+	createdAt := open[0].CreatedAt
+	deescalated := *first
+	deescalated.Comment.Severity = lookout.WarningSeverity
+	require.NoError(o.UpsertState(ctx, pr, &deescalated))
+
+	open, err = o.OpenFindings(ctx, pr)
+	require.NoError(err)
+	require.Len(open, 2)
+	require.Equal("1", open[0].ExternalID)
+	require.Equal(lookout.WarningSeverity, open[0].Comment.Severity)
+	require.Equal(createdAt, open[0].CreatedAt)
+
+	// and the second one is resolved
+	resolved := *second
+	resolved.Resolution = CommentResolutionResolved
+	require.NoError(o.UpsertState(ctx, pr, &resolved))
+
+	open, err = o.OpenFindings(ctx, pr)
+	require.NoError(err)
+	require.Len(open, 1)
+	require.Equal("1", open[0].ExternalID)
+
+	// the other pull request is not affected
+	open, err = o.OpenFindings(ctx, otherPR)
+	require.NoError(err)
+	require.Len(open, 1)
+	require.Equal("3", open[0].ExternalID)
+
+	// comments only belong to reviews
+	require.Error(o.UpsertState(ctx, &lookout.PushEvent{}, first))
+	_, err = o.OpenFindings(ctx, &lookout.PushEvent{})
+	require.Error(err)
+}
@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE comment_state;
+
+COMMIT;
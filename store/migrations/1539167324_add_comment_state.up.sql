@@ -0,0 +1,16 @@
+BEGIN;
+
+CREATE TABLE comment_state (
+	provider text NOT NULL,
+	repository_id bigint NOT NULL,
+	number bigint NOT NULL,
+	external_id text NOT NULL,
+	analyzer text NOT NULL,
+	comment jsonb NOT NULL,
+	resolution text NOT NULL,
+	created_at timestamptz NOT NULL,
+	updated_at timestamptz NOT NULL,
+	PRIMARY KEY (provider, repository_id, number, external_id)
+);
+
+COMMIT;
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/src-d/lookout"
 	"gopkg.in/src-d/go-kallax.v1"
 	"gopkg.in/src-d/go-kallax.v1/types"
 	"gopkg.in/src-d/lookout-sdk.v0/pb"
@@ -20,7 +21,7 @@ var _ fmt.Formatter
 type modelSaveFunc func(*kallax.Store) error
 
 // NewComment returns a new instance of Comment.
-func NewComment(r *ReviewEvent, c *pb.Comment) (record *Comment) {
+func NewComment(r *ReviewEvent, c *lookout.Comment) (record *Comment) {
 	return newComment(r, c)
 }
 
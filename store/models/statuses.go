@@ -6,4 +6,7 @@ const (
 	EventStatusNew       = EventStatus("new")
 	EventStatusProcessed = EventStatus("processed")
 	EventStatusFailed    = EventStatus("failed")
+	// EventStatusPending is the status of the events analyzed whose posting
+	// was deferred, see store.DeferredPost
+	EventStatusPending = EventStatus("pending")
 )
@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"time"
 
 	"github.com/src-d/lookout"
 	"github.com/src-d/lookout/store/models"
@@ -23,6 +24,45 @@ type CommentOperator interface {
 	Posted(context.Context, lookout.Event, *lookout.Comment) (bool, error)
 }
 
+// CommentResolution is the resolution state of a posted comment
+type CommentResolution string
+
+const (
+	// CommentResolutionOpen is the state of a comment not resolved yet
+	CommentResolutionOpen CommentResolution = "open"
+	// CommentResolutionResolved is the state of a comment not reported by
+	// the analyses anymore
+	CommentResolutionResolved CommentResolution = "resolved"
+	// CommentResolutionOutdated is the state of a comment on a line changed
+	// by a later push
+	CommentResolutionOutdated CommentResolution = "outdated"
+)
+
+// CommentState is the current state of a comment posted on a pull request
+type CommentState struct {
+	// ExternalID identifies the posted comment in the provider, e.g. the ID
+	// of the GitHub review comment
+	ExternalID string
+	// Analyzer is the name of the analyzer that produced the comment
+	Analyzer string
+	// Comment is the posted comment, including its severity
+	Comment lookout.Comment
+	// Resolution is the resolution state of the comment
+	Resolution CommentResolution
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// CommentStateOperator manages persistence of the state of posted Comments
+type CommentStateOperator interface {
+	// UpsertState persists the state of a comment posted for the review,
+	// replacing the previous state with the same ExternalID
+	UpsertState(context.Context, lookout.Event, *CommentState) error
+	// OpenFindings returns the states of the comments of the pull request of
+	// the review that are still open, sorted by creation time
+	OpenFindings(context.Context, lookout.Event) ([]*CommentState, error)
+}
+
 // NoopEventOperator satisfies EventOperator interface but does nothing
 type NoopEventOperator struct{}
 
@@ -52,3 +92,20 @@ func (o *NoopCommentOperator) Save(context.Context, lookout.Event, *lookout.Comm
 func (o *NoopCommentOperator) Posted(context.Context, lookout.Event, *lookout.Comment) (bool, error) {
 	return false, nil
 }
+
+// NoopCommentStateOperator satisfies CommentStateOperator interface but does
+// nothing
+type NoopCommentStateOperator struct{}
+
+var _ CommentStateOperator = &NoopCommentStateOperator{}
+
+// UpsertState implements CommentStateOperator interface and does nothing
+func (o *NoopCommentStateOperator) UpsertState(context.Context, lookout.Event, *CommentState) error {
+	return nil
+}
+
+// OpenFindings implements CommentStateOperator interface and always returns
+// no comments
+func (o *NoopCommentStateOperator) OpenFindings(context.Context, lookout.Event) ([]*CommentState, error) {
+	return nil, nil
+}
@@ -169,3 +169,50 @@ func toValue(v reflect.Value) *types.Value {
 		}
 	}
 }
+
+// FromPBStruct converts a types.Struct to a map[string]interface{}, it is
+// the inverse of ToPBStruct. Numbers are returned as float64.
+func FromPBStruct(s *types.Struct) map[string]interface{} {
+	if s == nil || len(s.Fields) == 0 {
+		return nil
+	}
+
+	m := make(map[string]interface{}, len(s.Fields))
+	for k, v := range s.Fields {
+		m[k] = FromValue(v)
+	}
+
+	return m
+}
+
+// FromValue converts a types.Value to an interface{}, it is the inverse of
+// ToValue
+func FromValue(v *types.Value) interface{} {
+	if v == nil {
+		return nil
+	}
+
+	switch k := v.Kind.(type) {
+	case *types.Value_BoolValue:
+		return k.BoolValue
+	case *types.Value_NumberValue:
+		return k.NumberValue
+	case *types.Value_StringValue:
+		return k.StringValue
+	case *types.Value_ListValue:
+		if k.ListValue == nil {
+			return nil
+		}
+
+		l := make([]interface{}, len(k.ListValue.Values))
+		for i, v := range k.ListValue.Values {
+			l[i] = FromValue(v)
+		}
+
+		return l
+	case *types.Value_StructValue:
+		return FromPBStruct(k.StructValue)
+	default:
+		return nil
+	}
+}
@@ -169,3 +169,20 @@ func TestToStructSliceInterfaceWithMap(t *testing.T) {
 	st := grpchelper.ToPBStruct(inputMap)
 	require.Equal(expectedSt, st)
 }
+
+func TestFromStruct(t *testing.T) {
+	require := require.New(t)
+
+	inputMap := map[string]interface{}{
+		"bool":   true,
+		"number": 1.5,
+		"string": "val",
+		"array":  []interface{}{"a", 2.0},
+		"map": map[string]interface{}{
+			"field1": "val",
+		},
+	}
+
+	require.Equal(inputMap, grpchelper.FromPBStruct(grpchelper.ToPBStruct(inputMap)))
+	require.Nil(grpchelper.FromPBStruct(nil))
+}